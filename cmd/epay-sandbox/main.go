@@ -0,0 +1,77 @@
+// Command epay-sandbox is a local stand-in for an epay gateway. It serves
+// the submit.php, mapi.php and api.php endpoints used by
+// internal/payment/epay, signs with the same MD5 scheme and fires notify
+// callbacks so the purchase flow can run without a real gateway.
+//
+// Point the shop at it with:
+//
+//	EPAY_PID=1000 EPAY_KEY=sandbox-key EPAY_GATEWAY=http://localhost:8090
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	logger "shop-bot/internal/log"
+)
+
+func main() {
+	var cfg Config
+	flag.StringVar(&cfg.Addr, "addr", envOr("SANDBOX_ADDR", ":8090"), "listen address")
+	flag.StringVar(&cfg.BaseURL, "base-url", envOr("SANDBOX_BASE_URL", "http://localhost:8090"), "public URL of the sandbox, used for pay links")
+	flag.StringVar(&cfg.PID, "pid", envOr("SANDBOX_PID", "1000"), "merchant ID accepted by the sandbox")
+	flag.StringVar(&cfg.Key, "key", envOr("SANDBOX_KEY", "sandbox-key"), "merchant key used for MD5 signing")
+	flag.DurationVar(&cfg.Notify.Delay, "notify-delay", 2*time.Second, "delay before the notify callback is sent")
+	flag.IntVar(&cfg.Notify.Duplicates, "notify-duplicates", 0, "extra copies of each notify callback")
+	flag.StringVar(&cfg.Notify.Mode, "notify-mode", NotifyNormal, "notify behaviour: normal, drop or bad-sign")
+	flag.IntVar(&cfg.Notify.Retries, "notify-retries", 3, "retries when the merchant does not answer success")
+	flag.BoolVar(&cfg.AutoPay, "auto-pay", false, "mark orders paid immediately without opening the pay page")
+	flag.Parse()
+
+	logger.Init()
+	defer logger.Sync()
+
+	if !validNotifyMode(cfg.Notify.Mode) {
+		logger.Fatal("Invalid notify mode", "mode", cfg.Notify.Mode)
+	}
+
+	sandbox := NewSandbox(cfg)
+	srv := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: sandbox.Routes(),
+	}
+
+	go func() {
+		logger.Info("Epay sandbox listening", "addr", cfg.Addr, "pid", cfg.PID,
+			"notify_delay", cfg.Notify.Delay, "notify_duplicates", cfg.Notify.Duplicates,
+			"notify_mode", cfg.Notify.Mode)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("Sandbox server failed", "error", err)
+		}
+	}()
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	logger.Info("Shutting down epay sandbox...")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("Sandbox shutdown failed", "error", err)
+	}
+}
+
+// envOr returns the environment variable or a fallback
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
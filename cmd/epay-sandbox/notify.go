@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	logger "shop-bot/internal/log"
+)
+
+// Notify modes
+const (
+	NotifyNormal  = "normal"   // Send a correctly signed callback
+	NotifyDrop    = "drop"     // Never send the callback, e.g. to test order queries
+	NotifyBadSign = "bad-sign" // Send a callback with a tampered signature
+)
+
+var notifyModes = []string{NotifyNormal, NotifyDrop, NotifyBadSign}
+
+func validNotifyMode(mode string) bool {
+	for _, m := range notifyModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// NotifyConfig controls how notify callbacks are delivered
+type NotifyConfig struct {
+	Delay      time.Duration
+	Duplicates int
+	Mode       string
+	Retries    int
+}
+
+// NotifyAttempt records one callback delivery for the order page
+type NotifyAttempt struct {
+	At       time.Time
+	Status   int
+	Response string
+	Error    string
+}
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendNotifications delivers the callback plus any configured duplicates
+func (s *Sandbox) sendNotifications(order *Order, params url.Values, notify NotifyConfig) {
+	if notify.Mode == NotifyDrop {
+		logger.Info("Sandbox notify dropped", "trade_no", order.TradeNo)
+		return
+	}
+
+	if notify.Mode == NotifyBadSign {
+		params.Set("sign", strings.Repeat("0", 32))
+	}
+
+	time.Sleep(notify.Delay)
+
+	for i := 0; i <= notify.Duplicates; i++ {
+		s.deliver(order, params, notify.Retries)
+	}
+}
+
+// deliver sends one callback, retrying with backoff until the merchant answers "success"
+func (s *Sandbox) deliver(order *Order, params url.Values, retries int) {
+	target := order.NotifyURL
+	if strings.Contains(target, "?") {
+		target += "&" + params.Encode()
+	} else {
+		target += "?" + params.Encode()
+	}
+
+	backoff := time.Second
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		record := NotifyAttempt{At: time.Now()}
+		resp, err := notifyClient.Get(target)
+		if err != nil {
+			record.Error = err.Error()
+		} else {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			record.Status = resp.StatusCode
+			record.Response = strings.TrimSpace(string(body))
+		}
+
+		s.mu.Lock()
+		order.Notifies = append(order.Notifies, record)
+		s.mu.Unlock()
+
+		logger.Info("Sandbox notify sent", "trade_no", order.TradeNo, "attempt", attempt+1,
+			"status", record.Status, "response", record.Response, "error", record.Error)
+
+		if record.Response == "success" {
+			return
+		}
+	}
+
+	logger.Warn("Sandbox notify gave up", "trade_no", order.TradeNo, "retries", retries)
+}
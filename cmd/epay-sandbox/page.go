@@ -0,0 +1,108 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+
+	logger "shop-bot/internal/log"
+)
+
+var pageTemplates = template.Must(template.New("layout").Parse(`{{define "head"}}<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>Epay Sandbox</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #f5f6fa; color: #2d3436; margin: 0; padding: 24px; }
+.box { max-width: 720px; margin: 0 auto; background: #fff; border-radius: 8px; padding: 24px; box-shadow: 0 1px 4px rgba(0,0,0,.08); }
+.banner { background: #fdcb6e; padding: 8px 12px; border-radius: 4px; margin-bottom: 16px; font-weight: 600; }
+table { width: 100%; border-collapse: collapse; margin: 12px 0; }
+th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #eee; font-size: 14px; }
+.amount { font-size: 32px; font-weight: 700; margin: 8px 0 16px; }
+label { display: block; margin: 8px 0 4px; font-size: 14px; }
+input, select { padding: 6px 8px; width: 100%; box-sizing: border-box; }
+.actions { display: flex; gap: 12px; margin-top: 16px; }
+button { flex: 1; padding: 10px; border: 0; border-radius: 4px; font-size: 16px; cursor: pointer; }
+.pay { background: #00b894; color: #fff; }
+.cancel { background: #dfe6e9; }
+.paid { color: #00b894; font-weight: 600; }
+</style>
+</head>
+<body>
+<div class="box">
+<div class="banner">⚠️ Epay Sandbox — no real money is charged</div>
+{{end}}
+{{define "foot"}}</div>
+</body>
+</html>{{end}}
+{{define "pay"}}{{template "head"}}
+{{with .Order}}
+<div>{{.Name}}</div>
+<div class="amount">¥{{.Money}}</div>
+<table>
+<tr><th>商户订单号</th><td>{{.OutTradeNo}}</td></tr>
+<tr><th>平台订单号</th><td>{{.TradeNo}}</td></tr>
+<tr><th>回调地址</th><td>{{.NotifyURL}}</td></tr>
+<tr><th>状态</th><td>{{if eq .Status 1}}<span class="paid">已支付</span>{{else}}待支付{{end}}</td></tr>
+</table>
+{{end}}
+{{if ne .Order.Status 1}}
+<form method="post">
+<label>支付方式</label>
+<select name="type">
+<option value="alipay" {{if eq .Order.Type "alipay"}}selected{{end}}>支付宝</option>
+<option value="wxpay" {{if eq .Order.Type "wxpay"}}selected{{end}}>微信支付</option>
+<option value="qqpay" {{if eq .Order.Type "qqpay"}}selected{{end}}>QQ钱包</option>
+</select>
+<label>回调延迟</label>
+<input name="delay" value="{{.Notify.Delay}}">
+<label>重复回调次数</label>
+<input name="duplicates" type="number" min="0" value="{{.Notify.Duplicates}}">
+<label>回调模式</label>
+<select name="mode">
+{{range .Modes}}<option value="{{.}}" {{if eq . $.Notify.Mode}}selected{{end}}>{{.}}</option>{{end}}
+</select>
+<div class="actions">
+<button class="pay" name="action" value="pay">模拟支付成功</button>
+<button class="cancel" name="action" value="cancel">取消支付</button>
+</div>
+</form>
+{{end}}
+{{if .Order.Notifies}}
+<h3>回调记录</h3>
+<table>
+<tr><th>时间</th><th>HTTP</th><th>响应</th></tr>
+{{range .Order.Notifies}}<tr><td>{{.At.Format "15:04:05"}}</td><td>{{.Status}}</td><td>{{if .Error}}{{.Error}}{{else}}{{.Response}}{{end}}</td></tr>{{end}}
+</table>
+{{end}}
+{{template "foot"}}{{end}}
+{{define "index"}}{{template "head"}}
+<p>PID: <b>{{.Config.PID}}</b> · KEY: <b>{{.Config.Key}}</b> · Gateway: <b>{{.Config.BaseURL}}</b></p>
+<table>
+<tr><th>平台订单号</th><th>商户订单号</th><th>金额</th><th>状态</th><th>回调</th></tr>
+{{range .Orders}}
+<tr>
+<td><a href="/pay/{{.TradeNo}}">{{.TradeNo}}</a></td>
+<td>{{.OutTradeNo}}</td>
+<td>¥{{.Money}}{{if .Refunded}} (退 ¥{{.Refunded}}){{end}}</td>
+<td>{{if eq .Status 1}}<span class="paid">已支付</span>{{else}}待支付{{end}}</td>
+<td>{{len .Notifies}}</td>
+</tr>
+{{else}}
+<tr><td colspan="5">暂无订单</td></tr>
+{{end}}
+</table>
+{{template "foot"}}{{end}}`))
+
+const (
+	payPage   = "pay"
+	indexPage = "index"
+)
+
+func renderPage(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pageTemplates.ExecuteTemplate(w, name, data); err != nil {
+		logger.Error("Failed to render sandbox page", "page", name, "error", err)
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/payment/epay"
+)
+
+// Config controls the sandbox gateway
+type Config struct {
+	Addr    string
+	BaseURL string
+	PID     string
+	Key     string
+	AutoPay bool
+	Notify  NotifyConfig
+}
+
+// Order is a payment created through submit.php or mapi.php
+type Order struct {
+	TradeNo    string
+	OutTradeNo string
+	Type       string
+	Name       string
+	Money      string
+	NotifyURL  string
+	ReturnURL  string
+	Param      string
+	ClientIP   string
+	Status     int // 1 for paid, 0 for unpaid
+	Refunded   string
+	AddTime    time.Time
+	EndTime    *time.Time
+	Notifies   []NotifyAttempt
+}
+
+// Sandbox is an in-memory epay gateway
+type Sandbox struct {
+	config Config
+
+	mu      sync.Mutex
+	orders  map[string]*Order // by trade_no
+	byOut   map[string]string // out_trade_no -> trade_no
+	counter int
+}
+
+// NewSandbox creates a sandbox gateway
+func NewSandbox(cfg Config) *Sandbox {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &Sandbox{
+		config: cfg,
+		orders: make(map[string]*Order),
+		byOut:  make(map[string]string),
+	}
+}
+
+// Routes returns the sandbox HTTP handler
+func (s *Sandbox) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/submit.php", s.handleSubmit)
+	mux.HandleFunc("/mapi.php", s.handleMAPI)
+	mux.HandleFunc("/api.php", s.handleAPI)
+	mux.HandleFunc("/pay/", s.handlePay)
+	mux.HandleFunc("/", s.handleIndex)
+	return mux
+}
+
+// handleSubmit creates an order from a signed form submission and redirects to the pay page
+func (s *Sandbox) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	order, err := s.createOrder(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.config.AutoPay {
+		s.markPaid(order, order.Type)
+		http.Redirect(w, r, s.returnURL(order), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/pay/"+order.TradeNo, http.StatusFound)
+}
+
+// handleMAPI creates an order through the API interface and returns pay links as JSON
+func (s *Sandbox) handleMAPI(w http.ResponseWriter, r *http.Request) {
+	order, err := s.createOrder(r)
+	if err != nil {
+		writeJSON(w, map[string]interface{}{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	if s.config.AutoPay {
+		s.markPaid(order, order.Type)
+	}
+
+	payURL := s.config.BaseURL + "/pay/" + order.TradeNo
+	writeJSON(w, map[string]interface{}{
+		"code":     1,
+		"msg":      "success",
+		"trade_no": order.TradeNo,
+		"payurl":   payURL,
+		"qrcode":   payURL,
+	})
+}
+
+// handleAPI implements the order query, merchant query and refund actions
+func (s *Sandbox) handleAPI(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, map[string]interface{}{"code": -1, "msg": "invalid request"})
+		return
+	}
+
+	if r.Form.Get("pid") != s.config.PID || r.Form.Get("key") != s.config.Key {
+		writeJSON(w, map[string]interface{}{"code": -3, "msg": "商户ID或密钥错误"})
+		return
+	}
+
+	switch r.Form.Get("act") {
+	case "order":
+		order := s.findOrder(r.Form.Get("trade_no"), r.Form.Get("out_trade_no"))
+		if order == nil {
+			writeJSON(w, map[string]interface{}{"code": -1, "msg": "订单号不存在"})
+			return
+		}
+
+		s.mu.Lock()
+		resp := map[string]interface{}{
+			"code":         1,
+			"msg":          "查询订单号成功！",
+			"trade_no":     order.TradeNo,
+			"out_trade_no": order.OutTradeNo,
+			"api_trade_no": "API" + order.TradeNo,
+			"type":         order.Type,
+			"pid":          s.pidNumber(),
+			"addtime":      order.AddTime.Format("2006-01-02 15:04:05"),
+			"endtime":      formatEndTime(order.EndTime),
+			"name":         order.Name,
+			"money":        order.Money,
+			"status":       order.Status,
+			"param":        order.Param,
+			"buyer":        "sandbox@example.com",
+		}
+		s.mu.Unlock()
+		writeJSON(w, resp)
+
+	case "refund":
+		order := s.findOrder(r.Form.Get("trade_no"), r.Form.Get("out_trade_no"))
+		if order == nil {
+			writeJSON(w, map[string]interface{}{"code": -1, "msg": "订单号不存在"})
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if order.Status != 1 {
+			writeJSON(w, map[string]interface{}{"code": -1, "msg": "订单未支付"})
+			return
+		}
+		money := r.Form.Get("money")
+		if moneyCents(money) <= 0 || moneyCents(money) > moneyCents(order.Money)-moneyCents(order.Refunded) {
+			writeJSON(w, map[string]interface{}{"code": -1, "msg": "退款金额无效"})
+			return
+		}
+		order.Refunded = fmt.Sprintf("%.2f", float64(moneyCents(order.Refunded)+moneyCents(money))/100)
+		logger.Info("Sandbox refund", "trade_no", order.TradeNo, "money", money)
+		// The refund API returns 0 for success
+		writeJSON(w, map[string]interface{}{"code": 0, "msg": "退款成功"})
+
+	case "query":
+		s.mu.Lock()
+		count := len(s.orders)
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{
+			"code":          1,
+			"pid":           s.pidNumber(),
+			"key":           s.config.Key,
+			"active":        1,
+			"money":         "0.00",
+			"type":          1,
+			"account":       "sandbox@example.com",
+			"username":      "Sandbox",
+			"orders":        count,
+			"order_today":   count,
+			"order_lastday": 0,
+		})
+
+	default:
+		writeJSON(w, map[string]interface{}{"code": -1, "msg": "unknown act"})
+	}
+}
+
+// handlePay shows the fake pay page and handles its form
+func (s *Sandbox) handlePay(w http.ResponseWriter, r *http.Request) {
+	tradeNo := strings.TrimPrefix(r.URL.Path, "/pay/")
+	order := s.findOrder(tradeNo, "")
+	if order == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+
+		if r.Form.Get("action") == "pay" {
+			notify := s.config.Notify
+			if d, err := time.ParseDuration(r.Form.Get("delay")); err == nil {
+				notify.Delay = d
+			}
+			if n, err := strconv.Atoi(r.Form.Get("duplicates")); err == nil && n >= 0 {
+				notify.Duplicates = n
+			}
+			if mode := r.Form.Get("mode"); validNotifyMode(mode) {
+				notify.Mode = mode
+			}
+
+			s.markPaidWith(order, r.Form.Get("type"), notify)
+			http.Redirect(w, r, s.returnURL(order), http.StatusFound)
+			return
+		}
+
+		// Cancelled, go back to the merchant without paying
+		http.Redirect(w, r, order.ReturnURL, http.StatusFound)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	renderPage(w, payPage, map[string]interface{}{
+		"Order":  order,
+		"Notify": s.config.Notify,
+		"Modes":  notifyModes,
+	})
+}
+
+// handleIndex lists all sandbox orders
+func (s *Sandbox) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := make([]*Order, 0, len(s.orders))
+	for _, o := range s.orders {
+		orders = append(orders, o)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].AddTime.After(orders[j].AddTime) })
+
+	renderPage(w, indexPage, map[string]interface{}{
+		"Orders": orders,
+		"Config": s.config,
+	})
+}
+
+// createOrder validates a signed create request and stores the order
+func (s *Sandbox) createOrder(r *http.Request) (*Order, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("invalid request")
+	}
+	params := r.Form
+
+	if params.Get("pid") != s.config.PID {
+		return nil, fmt.Errorf("商户不存在")
+	}
+	if !epay.VerifySign(params, s.config.Key) {
+		return nil, fmt.Errorf("签名校验失败")
+	}
+	if params.Get("out_trade_no") == "" || params.Get("notify_url") == "" {
+		return nil, fmt.Errorf("缺少必要参数")
+	}
+	if moneyCents(params.Get("money")) <= 0 {
+		return nil, fmt.Errorf("金额不合法")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tradeNo, exists := s.byOut[params.Get("out_trade_no")]; exists {
+		return s.orders[tradeNo], nil
+	}
+
+	s.counter++
+	order := &Order{
+		TradeNo:    fmt.Sprintf("%s%04d", time.Now().Format("20060102150405"), s.counter),
+		OutTradeNo: params.Get("out_trade_no"),
+		Type:       params.Get("type"),
+		Name:       params.Get("name"),
+		Money:      params.Get("money"),
+		NotifyURL:  params.Get("notify_url"),
+		ReturnURL:  params.Get("return_url"),
+		Param:      params.Get("param"),
+		ClientIP:   params.Get("clientip"),
+		AddTime:    time.Now(),
+	}
+	s.orders[order.TradeNo] = order
+	s.byOut[order.OutTradeNo] = order.TradeNo
+
+	logger.Info("Sandbox order created", "trade_no", order.TradeNo, "out_trade_no", order.OutTradeNo, "money", order.Money)
+	return order, nil
+}
+
+// findOrder looks up an order by trade_no or out_trade_no
+func (s *Sandbox) findOrder(tradeNo, outTradeNo string) *Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tradeNo != "" {
+		return s.orders[tradeNo]
+	}
+	if id, ok := s.byOut[outTradeNo]; ok {
+		return s.orders[id]
+	}
+	return nil
+}
+
+// markPaid marks the order paid using the default notify settings
+func (s *Sandbox) markPaid(order *Order, payType string) {
+	s.markPaidWith(order, payType, s.config.Notify)
+}
+
+// markPaidWith marks the order paid and schedules the notify callbacks
+func (s *Sandbox) markPaidWith(order *Order, payType string, notify NotifyConfig) {
+	s.mu.Lock()
+	if order.Status == 1 {
+		s.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	order.Status = 1
+	order.EndTime = &now
+	if order.Type == "" {
+		order.Type = payType
+	}
+	if order.Type == "" {
+		order.Type = string(epay.PaymentAlipay)
+	}
+	params := s.notifyParams(order)
+	s.mu.Unlock()
+
+	logger.Info("Sandbox order paid", "trade_no", order.TradeNo, "out_trade_no", order.OutTradeNo,
+		"notify_mode", notify.Mode, "notify_delay", notify.Delay, "notify_duplicates", notify.Duplicates)
+
+	go s.sendNotifications(order, params, notify)
+}
+
+// notifyParams builds the signed callback parameters for an order
+func (s *Sandbox) notifyParams(order *Order) url.Values {
+	params := url.Values{}
+	params.Set("pid", s.config.PID)
+	params.Set("trade_no", order.TradeNo)
+	params.Set("out_trade_no", order.OutTradeNo)
+	params.Set("type", order.Type)
+	params.Set("name", order.Name)
+	params.Set("money", order.Money)
+	params.Set("trade_status", "TRADE_SUCCESS")
+	if order.Param != "" {
+		params.Set("param", order.Param)
+	}
+	params.Set("sign", epay.Sign(params, s.config.Key))
+	params.Set("sign_type", "MD5")
+	return params
+}
+
+// returnURL is where the browser goes after paying, carrying the signed result like a real gateway
+func (s *Sandbox) returnURL(order *Order) string {
+	if order.ReturnURL == "" {
+		return "/pay/" + order.TradeNo
+	}
+
+	s.mu.Lock()
+	params := s.notifyParams(order)
+	s.mu.Unlock()
+
+	sep := "?"
+	if strings.Contains(order.ReturnURL, "?") {
+		sep = "&"
+	}
+	return order.ReturnURL + sep + params.Encode()
+}
+
+// pidNumber returns the merchant ID as a number for JSON responses
+func (s *Sandbox) pidNumber() int {
+	pid, _ := strconv.Atoi(s.config.PID)
+	return pid
+}
+
+// moneyCents parses a yuan amount into cents, returning 0 when invalid
+func moneyCents(money string) int {
+	value, err := strconv.ParseFloat(money, 64)
+	if err != nil {
+		return 0
+	}
+	return int(value*100 + 0.5)
+}
+
+func formatEndTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,95 @@
+// Command rotate-code-key re-encrypts every stored code, and the TOTP
+// secrets of admins, with a new data encryption key. It also encrypts
+// values that were stored in plaintext before DATA_ENCRYPTION_KEY was
+// configured.
+//
+// Stop the shop, then run it with the database settings of the server:
+//
+//	OLD_DATA_ENCRYPTION_KEY=<current key> DATA_ENCRYPTION_KEY=<new key> go run ./cmd/rotate-code-key
+//
+// Rows already encrypted with the new key are skipped, so an interrupted
+// run can be repeated. Start the shop with the new key afterwards.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"shop-bot/internal/config"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/security"
+	"shop-bot/internal/store"
+)
+
+func main() {
+	oldKey := flag.String("old-key", os.Getenv("OLD_DATA_ENCRYPTION_KEY"), "key the codes are currently encrypted with, empty if they are plaintext")
+	newKey := flag.String("new-key", os.Getenv("DATA_ENCRYPTION_KEY"), "key to encrypt the codes with")
+	batchSize := flag.Int("batch", 500, "rows re-encrypted per transaction")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	flag.Parse()
+
+	logger.Init()
+	defer logger.Sync()
+
+	if *newKey == "" {
+		logger.Fatal("A new key is required, set DATA_ENCRYPTION_KEY or -new-key")
+	}
+	if *oldKey == *newKey {
+		logger.Fatal("The old and new keys are the same")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatal("Failed to load config", "error", err)
+	}
+
+	db, err := store.InitDB(cfg.GetDBDSN())
+	if err != nil {
+		logger.Fatal("Failed to init database", "error", err)
+	}
+
+	// NewDataSecurity generates a random key for an empty string, which
+	// could never decrypt anything, so no old key means plaintext rows only
+	var oldCipher store.CodeCipher
+	if *oldKey != "" {
+		ds, err := security.NewDataSecurity(*oldKey)
+		if err != nil {
+			logger.Fatal("Failed to init old key", "error", err)
+		}
+		oldCipher = ds
+	}
+	newCipher, err := security.NewDataSecurity(*newKey)
+	if err != nil {
+		logger.Fatal("Failed to init new key", "error", err)
+	}
+
+	result, err := store.RotateCodeKey(db, oldCipher, newCipher, *batchSize, *dryRun)
+	if err != nil {
+		logger.Fatal("Key rotation failed", "error", err, "processed", result.Total)
+	}
+
+	logger.Info("Key rotation finished",
+		"dry_run", *dryRun,
+		"total", result.Total,
+		"rotated", result.Rotated,
+		"encrypted", result.Encrypted,
+		"skipped", result.Skipped,
+		"unhashed", result.Unhashed,
+		"failed", result.Failed)
+
+	secrets, failedAdmins, err := store.RotateAdminTOTPSecrets(db, oldCipher, newCipher, *dryRun)
+	if err != nil {
+		logger.Fatal("TOTP secret rotation failed", "error", err)
+	}
+	logger.Info("TOTP secret rotation finished", "dry_run", *dryRun, "rotated", secrets)
+
+	if result.Failed > 0 {
+		logger.Error("Some codes could not be decrypted with either key", "ids", result.FailedIDs)
+	}
+	if len(failedAdmins) > 0 {
+		logger.Error("Some TOTP secrets could not be decrypted with either key", "admin_ids", failedAdmins)
+	}
+	if result.Failed > 0 || len(failedAdmins) > 0 {
+		os.Exit(1)
+	}
+}
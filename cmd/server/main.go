@@ -10,6 +10,7 @@ import (
 	"shop-bot/internal/app"
 	"shop-bot/internal/config"
 	logger "shop-bot/internal/log"
+	"shop-bot/internal/security"
 	"shop-bot/internal/store"
 )
 
@@ -24,6 +25,18 @@ func main() {
 		logger.Fatal("Failed to load config", "error", err)
 	}
 
+	// Encrypt stored codes when a data encryption key is configured. The key
+	// must stay the same across restarts, use cmd/rotate-code-key to change it.
+	if cfg.DataEncryptionKey != "" {
+		ds, err := security.NewDataSecurity(cfg.DataEncryptionKey)
+		if err != nil {
+			logger.Fatal("Failed to init code encryption", "error", err)
+		}
+		store.SetCodeCipher(ds)
+	} else {
+		logger.Warn("DATA_ENCRYPTION_KEY is not set, codes are stored in plaintext")
+	}
+
 	// Initialize database
 	db, err := store.InitDB(cfg.GetDBDSN())
 	if err != nil {
@@ -34,6 +47,22 @@ func main() {
 	if err := store.SeedData(db); err != nil {
 		logger.Error("Failed to seed data", "error", err)
 	}
+
+	// Hash codes stored before duplicate detection was added, and recompute
+	// the hashes when the hashing key changed since they were made
+	if err := store.RehashCodes(db); err != nil {
+		logger.Error("Failed to rehash codes", "error", err)
+	}
+
+	// Encrypt TOTP secrets enrolled before DATA_ENCRYPTION_KEY was set
+	if err := store.EncryptAdminTOTPSecrets(db); err != nil {
+		logger.Error("Failed to encrypt admin TOTP secrets", "error", err)
+	}
+
+	// Give admins flagged as super admin before roles existed their role
+	if err := store.BackfillAdminRoles(db); err != nil {
+		logger.Error("Failed to backfill admin roles", "error", err)
+	}
 	
 	// Fix message_templates constraint
 	logger.Info("Checking and fixing message_templates constraint...")
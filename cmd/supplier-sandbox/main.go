@@ -0,0 +1,76 @@
+// Command supplier-sandbox is a local stand-in for an upstream code
+// supplier. It serves codes in the shape the http_json connector of
+// internal/supplier expects and can simulate failures, so restocking can
+// be tried without a real supplier.
+//
+// Configure a product's supplier with:
+//
+//	url:        http://localhost:8091/codes?quantity={quantity}
+//	headers:    {"Authorization": "Bearer ${SUPPLIER_TOKEN}"}
+//	codes_path: data.codes
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	logger "shop-bot/internal/log"
+)
+
+func main() {
+	var cfg Config
+	flag.StringVar(&cfg.Addr, "addr", envOr("SUPPLIER_SANDBOX_ADDR", ":8091"), "listen address")
+	flag.StringVar(&cfg.Token, "token", envOr("SUPPLIER_SANDBOX_TOKEN", "sandbox-token"), "bearer token required by the sandbox, empty to accept any request")
+	flag.StringVar(&cfg.Prefix, "prefix", "SANDBOX", "prefix of generated codes")
+	flag.StringVar(&cfg.Mode, "mode", ModeNormal, "response behaviour: normal, error, bad-json, empty or duplicates")
+	flag.IntVar(&cfg.FailFirst, "fail-first", 0, "answer the first N requests with HTTP 503 to exercise retries")
+	flag.DurationVar(&cfg.Delay, "delay", 0, "delay before each response, e.g. to trigger timeouts")
+	flag.BoolVar(&cfg.Structured, "structured", false, "return objects with account and password fields instead of plain codes")
+	flag.Parse()
+
+	logger.Init()
+	defer logger.Sync()
+
+	if !validMode(cfg.Mode) {
+		logger.Fatal("Invalid mode", "mode", cfg.Mode)
+	}
+
+	sandbox := NewSandbox(cfg)
+	srv := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: sandbox.Routes(),
+	}
+
+	go func() {
+		logger.Info("Supplier sandbox listening", "addr", cfg.Addr, "mode", cfg.Mode,
+			"fail_first", cfg.FailFirst, "delay", cfg.Delay, "structured", cfg.Structured)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("Sandbox server failed", "error", err)
+		}
+	}()
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	logger.Info("Shutting down supplier sandbox...")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("Sandbox shutdown failed", "error", err)
+	}
+}
+
+// envOr returns the environment variable or a fallback
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	logger "shop-bot/internal/log"
+)
+
+// Response behaviours
+const (
+	ModeNormal     = "normal"
+	ModeError      = "error"      // Always answer HTTP 500
+	ModeBadJSON    = "bad-json"   // Answer a body that is not JSON
+	ModeEmpty      = "empty"      // Answer an empty code list
+	ModeDuplicates = "duplicates" // Repeat the same codes on every request
+)
+
+func validMode(mode string) bool {
+	switch mode {
+	case ModeNormal, ModeError, ModeBadJSON, ModeEmpty, ModeDuplicates:
+		return true
+	}
+	return false
+}
+
+// Config controls the sandbox supplier
+type Config struct {
+	Addr       string
+	Token      string
+	Prefix     string
+	Mode       string
+	FailFirst  int
+	Delay      time.Duration
+	Structured bool
+}
+
+// Sandbox is an in-memory code supplier
+type Sandbox struct {
+	config Config
+
+	mu       sync.Mutex
+	requests int
+	issued   int
+}
+
+// NewSandbox creates a sandbox supplier
+func NewSandbox(cfg Config) *Sandbox {
+	return &Sandbox{config: cfg}
+}
+
+// Routes returns the sandbox HTTP handler
+func (s *Sandbox) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/codes", s.handleCodes)
+	return mux
+}
+
+// handleCodes issues the requested number of codes as {"data":{"codes":[...]}}
+func (s *Sandbox) handleCodes(w http.ResponseWriter, r *http.Request) {
+	if s.config.Delay > 0 {
+		time.Sleep(s.config.Delay)
+	}
+	if s.config.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.config.Token {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+		return
+	}
+
+	quantity, err := s.quantity(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	s.requests++
+	request := s.requests
+	start := s.issued
+	if s.config.Mode != ModeDuplicates {
+		s.issued += quantity
+	} else {
+		start = 0
+	}
+	s.mu.Unlock()
+
+	logger.Info("Supplier sandbox request", "request", request, "quantity", quantity, "mode", s.config.Mode)
+
+	switch {
+	case request <= s.config.FailFirst:
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "temporarily unavailable"})
+		return
+	case s.config.Mode == ModeError:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "supplier error"})
+		return
+	case s.config.Mode == ModeBadJSON:
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("<html>maintenance</html>"))
+		return
+	case s.config.Mode == ModeEmpty:
+		quantity = 0
+	}
+
+	codes := make([]interface{}, 0, quantity)
+	for i := start + 1; i <= start+quantity; i++ {
+		if s.config.Structured {
+			codes = append(codes, map[string]string{
+				"account":  fmt.Sprintf("%s-user-%06d", s.config.Prefix, i),
+				"password": fmt.Sprintf("pw-%06d", i),
+			})
+			continue
+		}
+		codes = append(codes, fmt.Sprintf("%s-%06d", s.config.Prefix, i))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{"codes": codes},
+	})
+}
+
+// quantity reads the quantity from the query string or a JSON body
+func (s *Sandbox) quantity(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("quantity")
+	if value == "" && r.Method == http.MethodPost {
+		var body struct {
+			Quantity int `json:"quantity"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return 0, fmt.Errorf("invalid body: %w", err)
+		}
+		value = strconv.Itoa(body.Quantity)
+	}
+	if value == "" {
+		return 1, nil
+	}
+	quantity, err := strconv.Atoi(value)
+	if err != nil || quantity < 1 || quantity > 1000 {
+		return 0, fmt.Errorf("quantity must be between 1 and 1000")
+	}
+	return quantity, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
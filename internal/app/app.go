@@ -16,9 +16,12 @@ import (
 	"shop-bot/internal/broadcast"
 	"shop-bot/internal/cache"
 	"shop-bot/internal/config"
+	"shop-bot/internal/currency"
 	"shop-bot/internal/httpadmin"
 	logger "shop-bot/internal/log"
+	"shop-bot/internal/payment"
 	"shop-bot/internal/store"
+	"shop-bot/internal/supplier"
 	"shop-bot/internal/ticket"
 	"shop-bot/internal/worker"
 )
@@ -56,10 +59,14 @@ type Application struct {
 	DB          *gorm.DB
 	Cache       *cache.Client
 	Bot         *bot.Bot
+	Payments    *payment.Registry
 	Broadcast   *broadcast.Service
 	AdminServer *httpadmin.Server
 	RetryWorker *worker.RetryWorker
 	OrderMaintenanceWorker *worker.OrderMaintenanceWorker
+	Supplier    *supplier.Service
+	RestockWorker *worker.RestockWorker
+	CodeExpiryWorker *worker.CodeExpiryWorker
 
 	httpServer  *http.Server
 	wg          sync.WaitGroup
@@ -92,8 +99,12 @@ func New(cfg *config.Config, db *gorm.DB) (*Application, error) {
 		cacheClient = &cache.Client{} // Empty cache client
 	}
 
+	// Payment providers, shared by the bot and the admin server so provider
+	// changes made in settings apply to checkout right away
+	payments := payment.NewRegistry()
+
 	// Initialize Telegram bot
-	botInstance, err := bot.New(cfg.BotToken, db, cfg)
+	botInstance, err := bot.New(cfg.BotToken, db, cfg, payments)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init bot: %w", err)
 	}
@@ -101,11 +112,30 @@ func New(cfg *config.Config, db *gorm.DB) (*Application, error) {
 	// Initialize broadcast service
 	broadcastService := broadcast.NewService(db, botInstance.GetAPI())
 
+	// Supplier restocking, on a schedule and on demand at purchase time
+	supplierService := supplier.NewService(db)
+	botInstance.SetRestocker(supplierService)
+	
+	// Alert admins when product stock crosses its low-stock threshold,
+	// when a supplier pull fails and when expired codes are quarantined
+	var expiredCodesReport func([]store.ExpiredCodeReport)
+	if notifier := botInstance.GetNotificationService(); notifier != nil {
+		store.SetStockAlertHook(notifier.NotifyStockAlert)
+		supplierService.SetFailureHook(notifier.NotifySupplierFailure)
+		expiredCodesReport = notifier.NotifyExpiredCodes
+	}
+
 	// Initialize retry worker
 	retryWorker := worker.NewRetryWorker(db, botInstance.GetAPI())
 
 	// Initialize order maintenance worker
 	orderMaintenanceWorker := worker.NewOrderMaintenanceWorker(db)
+	
+	// Initialize restock worker
+	restockWorker := worker.NewRestockWorker(supplierService)
+	
+	// Initialize code expiry worker
+	codeExpiryWorker := worker.NewCodeExpiryWorker(db, expiredCodesReport)
 
 	// Create application
 	app := &Application{
@@ -114,9 +144,13 @@ func New(cfg *config.Config, db *gorm.DB) (*Application, error) {
 		DB:          db,
 		Cache:       cacheClient,
 		Bot:         botInstance,
+		Payments:    payments,
 		Broadcast:   broadcastService,
 		RetryWorker: retryWorker,
 		OrderMaintenanceWorker: orderMaintenanceWorker,
+		Supplier:    supplierService,
+		RestockWorker: restockWorker,
+		CodeExpiryWorker: codeExpiryWorker,
 	}
 	
 	// Initialize ticket service if bot is available
@@ -175,6 +209,20 @@ func (app *Application) Start(ctx context.Context) error {
 		app.OrderMaintenanceWorker.Start(ctx)
 	}()
 	
+	// Start restock worker
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.RestockWorker.Start(ctx)
+	}()
+	
+	// Start code expiry worker
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.CodeExpiryWorker.Start(ctx)
+	}()
+	
 	return nil
 }
 
@@ -208,8 +256,8 @@ func (app *Application) startHTTPServer(ctx context.Context) {
 func (app *Application) setupRouter() *gin.Engine {
 	r := gin.Default()
 	
-	// Get currency settings
-	_, currencySymbol := store.GetCurrencySettings(app.DB, app.Config)
+	// Currency formatting for templates
+	money := currency.NewService(app.DB, app.Config)
 	
 	// Add template functions
 	r.SetFuncMap(template.FuncMap{
@@ -243,7 +291,11 @@ func (app *Application) setupRouter() *gin.Engine {
 			return result
 		},
 		"currency": func() string {
-			return currencySymbol
+			return money.Base().Symbol
+		},
+		"money": func(cents interface{}) string {
+			f, _ := toFloat64(cents)
+			return money.Format(int(f))
 		},
 		"plus": func(a, b int) int {
 			return a + b
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, display, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if !IsAPIKey(key) || !strings.HasPrefix(key, display) || len(display) != apiKeyDisplayLength {
+		t.Fatalf("key %q, display %q", key, display)
+	}
+	if hash != HashAPIKey(key) || strings.Contains(hash, key) {
+		t.Fatalf("hash %q does not match the key", hash)
+	}
+
+	other, _, _, err := GenerateAPIKey()
+	if err != nil || other == key {
+		t.Fatalf("second key %q, %v", other, err)
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	valid := []string{"orders:read", "orders:write", "codes:read", "audit:read"}
+	invalid := []string{"", "orders", "orders:", "orders:delete", "admins:read", "admins:write", "unknown:read", "orders:read:x"}
+	for _, scope := range valid {
+		if !ValidScope(scope) {
+			t.Errorf("ValidScope(%q) = false", scope)
+		}
+	}
+	for _, scope := range invalid {
+		if ValidScope(scope) {
+			t.Errorf("ValidScope(%q) = true", scope)
+		}
+	}
+}
+
+func TestAPIKeyResourcesLeaveOutAdmins(t *testing.T) {
+	resources := APIKeyResources()
+	if len(resources) != len(Resources)-1 {
+		t.Fatalf("resources = %v", resources)
+	}
+	for _, resource := range resources {
+		if resource == ResourceAdmins {
+			t.Fatal("API keys can be scoped to admins")
+		}
+	}
+}
+
+func TestScopesGrant(t *testing.T) {
+	scopes := []string{"orders:read", "codes:write"}
+	tests := []struct {
+		permission string
+		want       bool
+	}{
+		{"orders:read", true},
+		{"codes:write", true},
+		{"orders:write", false},
+		{"codes:read", false}, // Write does not imply read
+		{"users:read", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ScopesGrant(scopes, tt.permission); got != tt.want {
+			t.Errorf("ScopesGrant(%v, %q) = %v, want %v", scopes, tt.permission, got, tt.want)
+		}
+	}
+	if ScopesGrant(nil, "orders:read") {
+		t.Error("no scopes granted a permission")
+	}
+}
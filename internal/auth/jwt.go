@@ -140,9 +140,8 @@ func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
-// RefreshToken creates a new access token from a refresh token
-func (s *JWTService) RefreshToken(refreshTokenString string) (string, error) {
-	// Parse refresh token
+// ParseRefreshToken validates a refresh token and returns its claims
+func (s *JWTService) ParseRefreshToken(refreshTokenString string) (*jwt.RegisteredClaims, error) {
 	token, err := jwt.ParseWithClaims(refreshTokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -151,12 +150,21 @@ func (s *JWTService) RefreshToken(refreshTokenString string) (string, error) {
 	})
 	
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	
 	claims, ok := token.Claims.(*jwt.RegisteredClaims)
 	if !ok || !token.Valid {
-		return "", ErrInvalidClaims
+		return nil, ErrInvalidClaims
+	}
+	return claims, nil
+}
+
+// RefreshToken creates a new access token from a refresh token
+func (s *JWTService) RefreshToken(refreshTokenString string) (string, error) {
+	claims, err := s.ParseRefreshToken(refreshTokenString)
+	if err != nil {
+		return "", err
 	}
 	
 	// Generate new access token
@@ -0,0 +1,122 @@
+package auth
+
+import "sort"
+
+// Admin roles
+const (
+	RoleSuperAdmin = "super_admin" // Everything, including admin management
+	RoleOperator   = "operator"    // Day to day shop operations, no system settings
+	RoleSupport    = "support"     // Tickets and order lookups
+	RoleViewer     = "viewer"      // Read only, without code contents or settings
+)
+
+// Resources guarded by permissions. A permission is "<resource>:read" or
+// "<resource>:write"; write does not imply read.
+const (
+	ResourceProducts      = "products"
+	ResourceCodes         = "codes"
+	ResourceOrders        = "orders"
+	ResourceUsers         = "users"
+	ResourceRechargeCards = "recharge_cards"
+	ResourceWithdrawals   = "withdrawals"
+	ResourcePayments      = "payments"
+	ResourceReports       = "reports"
+	ResourceContent       = "content" // FAQ and message templates
+	ResourceBroadcast     = "broadcast"
+	ResourceTickets       = "tickets"
+	ResourceSettings      = "settings"
+	ResourceAdmins        = "admins"
+	ResourceAudit         = "audit" // Audit log of admin changes
+)
+
+// Permission actions
+const (
+	ActionRead  = "read"
+	ActionWrite = "write"
+)
+
+// Permission builds the permission name of an action on a resource
+func Permission(resource, action string) string {
+	return resource + ":" + action
+}
+
+func readWrite(resources ...string) []string {
+	var perms []string
+	for _, resource := range resources {
+		perms = append(perms, Permission(resource, ActionRead), Permission(resource, ActionWrite))
+	}
+	return perms
+}
+
+func readOnly(resources ...string) []string {
+	var perms []string
+	for _, resource := range resources {
+		perms = append(perms, Permission(resource, ActionRead))
+	}
+	return perms
+}
+
+// Resources lists every guarded resource
+var Resources = []string{
+	ResourceProducts, ResourceCodes, ResourceOrders, ResourceUsers,
+	ResourceRechargeCards, ResourceWithdrawals, ResourcePayments, ResourceReports,
+	ResourceContent, ResourceBroadcast, ResourceTickets, ResourceSettings, ResourceAdmins,
+	ResourceAudit,
+}
+
+// rolePermissions lists the permissions of every role except super admin,
+// which has all of them
+var rolePermissions = map[string][]string{
+	RoleOperator: append(readWrite(
+		ResourceProducts, ResourceCodes, ResourceOrders, ResourceUsers,
+		ResourceRechargeCards, ResourceWithdrawals, ResourceContent,
+		ResourceBroadcast, ResourceTickets,
+	), readOnly(ResourcePayments, ResourceReports)...),
+	RoleSupport: append(readWrite(ResourceTickets),
+		readOnly(ResourceProducts, ResourceOrders, ResourceUsers, ResourceContent)...),
+	RoleViewer: readOnly(
+		ResourceProducts, ResourceOrders, ResourceUsers, ResourceRechargeCards,
+		ResourceWithdrawals, ResourcePayments, ResourceReports, ResourceContent,
+		ResourceBroadcast, ResourceTickets,
+	),
+}
+
+// Roles returns the known roles, most privileged first
+func Roles() []string {
+	return []string{RoleSuperAdmin, RoleOperator, RoleSupport, RoleViewer}
+}
+
+// ValidRole reports whether role is a known role
+func ValidRole(role string) bool {
+	for _, r := range Roles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether a role grants a permission
+func HasPermission(role, permission string) bool {
+	if role == RoleSuperAdmin {
+		return true
+	}
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermissions returns the sorted permissions of a role
+func RolePermissions(role string) []string {
+	var perms []string
+	if role == RoleSuperAdmin {
+		perms = readWrite(Resources...)
+	} else {
+		perms = append(perms, rolePermissions[role]...)
+	}
+	sort.Strings(perms)
+	return perms
+}
@@ -0,0 +1,44 @@
+package auth
+
+import "testing"
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		role       string
+		permission string
+		want       bool
+	}{
+		{RoleSuperAdmin, Permission(ResourceAdmins, ActionWrite), true},
+		{RoleOperator, Permission(ResourceCodes, ActionWrite), true},
+		{RoleOperator, Permission(ResourcePayments, ActionRead), true},
+		{RoleOperator, Permission(ResourcePayments, ActionWrite), false},
+		{RoleOperator, Permission(ResourceSettings, ActionRead), false},
+		{RoleSupport, Permission(ResourceTickets, ActionWrite), true},
+		{RoleSupport, Permission(ResourceOrders, ActionWrite), false},
+		{RoleViewer, Permission(ResourceOrders, ActionRead), true},
+		{RoleViewer, Permission(ResourceCodes, ActionRead), false}, // Code contents stay hidden
+		{"", Permission(ResourceOrders, ActionRead), false},
+		{"unknown", Permission(ResourceOrders, ActionRead), false},
+	}
+	for _, tt := range tests {
+		if got := HasPermission(tt.role, tt.permission); got != tt.want {
+			t.Errorf("HasPermission(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestRolePermissionsAreKnown(t *testing.T) {
+	for _, role := range Roles() {
+		for _, permission := range RolePermissions(role) {
+			known := false
+			for _, resource := range Resources {
+				if permission == Permission(resource, ActionRead) || permission == Permission(resource, ActionWrite) {
+					known = true
+				}
+			}
+			if !known {
+				t.Errorf("role %s has unknown permission %s", role, permission)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC 6238 appendix B SHA1 vectors, cut to the last six digits
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d): %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("TOTPCode(%d) = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		at := time.Unix(v.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, at, 0)
+		if !ok || step != TOTPStep(at) {
+			t.Errorf("ValidateTOTP(%d) = %d, %v, want step %d", v.unix, step, ok, TOTPStep(at))
+		}
+	}
+}
+
+func TestValidateTOTPSkewAndReplay(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	code := "050471"
+
+	// Accepted one period either side for clock drift, not two
+	if _, ok := ValidateTOTP(rfc6238Secret, code, at.Add(TOTPPeriod), 0); !ok {
+		t.Error("code of the previous period rejected")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, at.Add(2*TOTPPeriod), 0); ok {
+		t.Error("code two periods old accepted")
+	}
+
+	step, ok := ValidateTOTP(rfc6238Secret, code, at, 0)
+	if !ok {
+		t.Fatal("code rejected")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, at, step); ok {
+		t.Error("code accepted again at its own step")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, at.Add(TOTPPeriod), step); ok {
+		t.Error("code replayed in the next period")
+	}
+}
+
+func TestValidateTOTPRejectsMalformed(t *testing.T) {
+	at := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at, 0); ok {
+			t.Errorf("ValidateTOTP(%q) accepted", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "287082", at, 0); ok {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes, err := GenerateRecoveryCodes(4000)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+
+	counts := make(map[rune]int)
+	for _, code := range codes {
+		if len(code) != 9 || code[4] != '-' {
+			t.Fatalf("code %q is not like k3f9-x2ma", code)
+		}
+		for _, r := range code[:4] + code[5:] {
+			if !strings.ContainsRune(alphabet, r) {
+				t.Fatalf("code %q has %q outside the alphabet", code, r)
+			}
+			counts[r]++
+		}
+	}
+
+	// Taking bytes modulo 31 makes the first 8 symbols about 12% more
+	// likely than the rest
+	first, rest := 0, 0
+	for i, r := range alphabet {
+		if i < 256%len(alphabet) {
+			first += counts[r]
+		} else {
+			rest += counts[r]
+		}
+	}
+	ratio := (float64(first) / 8) / (float64(rest) / 23)
+	if ratio > 1.06 || ratio < 0.94 {
+		t.Errorf("first symbols drawn %.3f times as often as the rest", ratio)
+	}
+}
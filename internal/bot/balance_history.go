@@ -43,21 +43,31 @@ func (b *Bot) handleBalanceHistory(callback *tgbotapi.CallbackQuery) {
 				txType = b.msg.Get(lang, "tx_type_recharge")
 			} else if txType == "purchase" {
 				txType = b.msg.Get(lang, "tx_type_purchase")
+			} else if txType == "transfer_in" {
+				txType = b.msg.Get(lang, "tx_type_transfer_in")
+			} else if txType == "transfer_out" {
+				txType = b.msg.Get(lang, "tx_type_transfer_out")
+			} else if txType == "withdraw_hold" {
+				txType = b.msg.Get(lang, "tx_type_withdraw_hold")
+			} else if txType == "withdraw_release" {
+				txType = b.msg.Get(lang, "tx_type_withdraw_release")
+			} else if txType == "withdraw" {
+				txType = b.msg.Get(lang, "tx_type_withdraw")
 			}
 			
-			// Format amount with + or -
-			amountStr := fmt.Sprintf("%.2f", float64(tx.AmountCents)/100)
+			// Format amount with + or -, ledger entries stay in the base currency
+			amountStr := b.currency.Format(tx.AmountCents)
 			if tx.AmountCents > 0 {
 				amountStr = "+" + amountStr
 			}
 			
 			// Add transaction line
 			historyMsg.WriteString(fmt.Sprintf(
-				"%s | %s | $%s | Balance: $%.2f | %s\n",
+				"%s | %s | %s | Balance: %s | %s\n",
 				tx.CreatedAt.Format("01/02 15:04"),
 				txType,
 				amountStr,
-				float64(tx.BalanceAfter)/100,
+				b.currency.Format(tx.BalanceAfter),
 				tx.Description,
 			))
 		}
@@ -65,9 +75,9 @@ func (b *Bot) handleBalanceHistory(callback *tgbotapi.CallbackQuery) {
 	
 	// Get current balance
 	balance, _ := store.GetUserBalance(b.db, user.ID)
-	historyMsg.WriteString(fmt.Sprintf("\n%s: $%.2f", 
+	historyMsg.WriteString(fmt.Sprintf("\n%s: %s", 
 		b.msg.Get(lang, "current_balance"),
-		float64(balance)/100,
+		b.currency.ForUser(user).Format(balance),
 	))
 	
 	msg := tgbotapi.NewMessage(callback.Message.Chat.ID, historyMsg.String())
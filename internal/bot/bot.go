@@ -2,6 +2,7 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -12,8 +13,11 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	logger "shop-bot/internal/log"
 	"shop-bot/internal/store"
+	"shop-bot/internal/payment"
 	"shop-bot/internal/payment/epay"
+	"shop-bot/internal/payment/telegram"
 	"shop-bot/internal/config"
+	"shop-bot/internal/currency"
 	"shop-bot/internal/bot/messages"
 	"shop-bot/internal/metrics"
 	"shop-bot/internal/broadcast"
@@ -24,16 +28,28 @@ import (
 type Bot struct {
 	api       *tgbotapi.BotAPI
 	db        *gorm.DB
-	epay      *epay.Client
+	payments  *payment.Registry
 	config    *config.Config
 	msg       *messages.Manager
 	broadcast *broadcast.Service
 	notification *notification.Service
 	ticketService TicketService // Remove pointer - interface should not be pointer
+	restocker Restocker
+	currency  *currency.Service
 	
 	// User state management
 	userStates     map[int64]string
 	userStatesMutex sync.RWMutex
+
+	// Pending balance transfers, guarded by userStatesMutex
+	pendingTransfers map[int64]*pendingTransfer
+	// Pending withdrawal requests, guarded by userStatesMutex
+	pendingWithdrawals map[int64]*pendingWithdrawal
+}
+
+// Restocker fetches codes from a supplier when a buyer finds a product out of stock
+type Restocker interface {
+	FetchOnDemand(ctx context.Context, productID uint) bool
 }
 
 // TicketService interface to avoid circular imports
@@ -43,39 +59,53 @@ type TicketService interface {
 	CreateTicket(userID int64, username, subject, category, content string) (*store.Ticket, error)
 }
 
-func New(token string, db *gorm.DB, cfg *config.Config) (*Bot, error) {
+// New creates the bot. Payment providers that are configured are added to
+// payments, which the admin server shares so settings changes reach the bot.
+func New(token string, db *gorm.DB, cfg *config.Config, payments *payment.Registry) (*Bot, error) {
 	api, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bot api: %w", err)
 	}
 
-	// Initialize epay client if configured
-	var epayClient *epay.Client
-	if cfg.EpayPID != "" && cfg.EpayKey != "" && cfg.EpayGateway != "" {
-		epayClient = epay.NewClient(cfg.EpayPID, cfg.EpayKey, cfg.EpayGateway)
+	// Register payment providers that are configured
+	if client, err := epay.NewClientFromConfig(cfg); err == nil {
+		payments.Register(epay.NewProvider(client))
 		logger.Info("Epay client initialized",
 			"pid", cfg.EpayPID,
 			"gateway", cfg.EpayGateway,
+			"sign_type", client.SignType,
 			"base_url", cfg.BaseURL)
 	} else {
-		logger.Warn("Epay client not initialized - missing configuration",
+		logger.Warn("Epay client not initialized",
+			"error", err,
 			"has_pid", cfg.EpayPID != "",
 			"has_key", cfg.EpayKey != "",
+			"has_private_key", cfg.EpayPrivateKey != "",
 			"has_gateway", cfg.EpayGateway != "")
 	}
 	
+	// Native Telegram checkout, Stars need no provider token
+	payments.Register(telegram.NewStarsProvider(api, db))
+	if cfg.TelegramPaymentToken != "" {
+		payments.Register(telegram.NewProvider(api, db, cfg, cfg.TelegramPaymentToken))
+		logger.Info("Telegram Payments provider initialized")
+	}
+	
 	// Initialize notification service
 	notificationService := notification.NewService(api, cfg, db)
 
 	return &Bot{
 		api:    api,
 		db:     db,
-		epay:   epayClient,
+		payments: payments,
 		config: cfg,
 		msg:    messages.GetManager(),
 		broadcast: broadcast.NewService(db, api),
 		notification: notificationService,
+		currency: currency.NewService(db, cfg),
 		userStates: make(map[int64]string),
+		pendingTransfers: make(map[int64]*pendingTransfer),
+		pendingWithdrawals: make(map[int64]*pendingWithdrawal),
 	}, nil
 }
 
@@ -84,6 +114,21 @@ func (b *Bot) SetTicketService(service TicketService) {
 	b.ticketService = service
 }
 
+// SetRestocker sets the supplier service used for on-demand restocking
+func (b *Bot) SetRestocker(restocker Restocker) {
+	b.restocker = restocker
+}
+
+// fetchOnDemand asks the product's supplier for stock while the buyer waits
+func (b *Bot) fetchOnDemand(productID uint) bool {
+	if b.restocker == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	return b.restocker.FetchOnDemand(ctx, productID)
+}
+
 // GetAPI returns the telegram bot API instance
 func (b *Bot) GetAPI() *tgbotapi.BotAPI {
 	return b.api
@@ -135,11 +180,23 @@ func (b *Bot) handleUpdate(update tgbotapi.Update) {
 		return
 	}
 	
+	// Handle Telegram Payments pre-checkout confirmation
+	if update.PreCheckoutQuery != nil {
+		b.handlePreCheckoutQuery(update.PreCheckoutQuery)
+		return
+	}
+	
 	// Handle regular messages
 	if update.Message == nil {
 		return
 	}
 
+	// Handle completed Telegram Payments
+	if update.Message.SuccessfulPayment != nil {
+		b.handleSuccessfulPayment(update.Message)
+		return
+	}
+
 	// Check if it's a group message
 	if update.Message.Chat.IsGroup() || update.Message.Chat.IsSuperGroup() {
 		metrics.BotMessagesReceived.WithLabelValues("group").Inc()
@@ -153,6 +210,15 @@ func (b *Bot) handleUpdate(update tgbotapi.Update) {
 		switch update.Message.Command() {
 		case "start":
 			b.handleStart(update.Message)
+		case "transfer":
+			b.clearUserState(update.Message.From.ID)
+			b.handleTransferStart(update.Message.Chat.ID, update.Message.From)
+		case "withdraw":
+			b.clearUserState(update.Message.From.ID)
+			b.handleWithdrawStart(update.Message.Chat.ID, update.Message.From)
+		case "cancel":
+			// Let the active input flow handle cancellation
+			b.handleTextMessage(update.Message)
 		}
 		return
 	}
@@ -316,6 +382,26 @@ func (b *Bot) handleTextMessage(message *tgbotapi.Message) {
 		return
 	}
 
+	// Check if user is in the middle of a balance transfer
+	if hasState && userState == "awaiting_transfer_recipient" {
+		b.handleTransferRecipient(message)
+		return
+	}
+	if hasState && userState == "awaiting_transfer_amount" {
+		b.handleTransferAmount(message)
+		return
+	}
+
+	// Check if user is in the middle of a withdrawal request
+	if hasState && userState == "awaiting_withdraw_amount" {
+		b.handleWithdrawAmount(message)
+		return
+	}
+	if hasState && userState == "awaiting_withdraw_account" {
+		b.handleWithdrawAccount(message)
+		return
+	}
+
 	// Check if it's a recharge card code (starts with specific prefix)
 	if strings.HasPrefix(message.Text, "RC-") || strings.HasPrefix(message.Text, "充值卡-") {
 		b.handleRechargeCard(message)
@@ -387,6 +473,9 @@ func (b *Bot) handleBuy(message *tgbotapi.Message) {
 		return
 	}
 	
+	// Prices are shown in the user's display currency
+	money := b.currency.ForUser(user)
+	
 	// Create inline keyboard with products
 	var rows [][]tgbotapi.InlineKeyboardButton
 	
@@ -399,13 +488,9 @@ func (b *Bot) handleBuy(message *tgbotapi.Message) {
 		}
 		
 		// Format button text: "Name - $Price (Stock)"
-		// Get currency symbol
-		_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
-		
-		buttonText := fmt.Sprintf("%s - %s%.2f (%d)", 
+		buttonText := fmt.Sprintf("%s - %s (%d)", 
 			product.Name, 
-			currencySymbol,
-			float64(product.PriceCents)/100, 
+			money.Short(product.PriceCents),
 			stock,
 		)
 		
@@ -450,6 +535,21 @@ func (b *Bot) handleCallbackQuery(callback *tgbotapi.CallbackQuery) {
 			useBalance := parts[2] == "1"
 			b.handleConfirmBuy(callback, uint(productID), useBalance)
 		}
+	} else if strings.HasPrefix(callback.Data, "pay:") {
+		// pay:<provider>:<orderID>[:<method>]
+		parts := strings.Split(callback.Data, ":")
+		if len(parts) == 3 || len(parts) == 4 {
+			orderID, _ := strconv.ParseUint(parts[2], 10, 32)
+			method := ""
+			if len(parts) == 4 {
+				method = parts[3]
+			}
+			b.handlePayWithProvider(callback, parts[1], uint(orderID), method)
+		}
+	} else if callback.Data == "select_currency" {
+		b.handleCurrencySelection(callback)
+	} else if strings.HasPrefix(callback.Data, "set_currency:") {
+		b.handleSetCurrency(callback, strings.TrimPrefix(callback.Data, "set_currency:"))
 	} else if callback.Data == "select_language" {
 		b.handleLanguageSelection(callback.Message)
 	} else if strings.HasPrefix(callback.Data, "set_lang:") {
@@ -537,6 +637,20 @@ func (b *Bot) handleCallbackQuery(callback *tgbotapi.CallbackQuery) {
 		}
 	} else if callback.Data == "balance_history" {
 		b.handleBalanceHistory(callback)
+	} else if callback.Data == "transfer_start" {
+		b.handleTransferStart(callback.Message.Chat.ID, callback.From)
+	} else if callback.Data == "transfer_confirm" {
+		b.handleTransferConfirm(callback)
+	} else if callback.Data == "transfer_cancel" {
+		b.handleTransferCancel(callback)
+	} else if callback.Data == "withdraw_start" {
+		b.handleWithdrawStart(callback.Message.Chat.ID, callback.From)
+	} else if strings.HasPrefix(callback.Data, "withdraw_method_") {
+		b.handleWithdrawMethod(callback)
+	} else if callback.Data == "withdraw_confirm" {
+		b.handleWithdrawConfirm(callback)
+	} else if callback.Data == "withdraw_cancel" {
+		b.handleWithdrawCancel(callback)
 	} else if strings.HasPrefix(callback.Data, "group_toggle_") {
 		b.handleGroupToggle(callback)
 	} else if callback.Data == "my_orders" || callback.Data == "order_list" {
@@ -554,6 +668,13 @@ func (b *Bot) handleCallbackQuery(callback *tgbotapi.CallbackQuery) {
 			// Edit the existing message with new page
 			b.handleMyOrdersPageEdit(callback, page)
 		}
+	} else if strings.HasPrefix(callback.Data, "cancel_order:") {
+		// cancel_order:<orderID>[:details]
+		parts := strings.Split(strings.TrimPrefix(callback.Data, "cancel_order:"), ":")
+		orderID, err := strconv.ParseUint(parts[0], 10, 32)
+		if err == nil {
+			b.handleCancelOrder(callback, uint(orderID), len(parts) > 1 && parts[1] == "details")
+		}
 	} else if callback.Data == "noop" {
 		// No operation - just acknowledge the callback
 		b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
@@ -582,8 +703,8 @@ func (b *Bot) handleBuyProduct(callback *tgbotapi.CallbackQuery, productID uint)
 	
 	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
 	
-	// Get currency symbol
-	_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
+	// Format amounts in the user's display currency
+	money := b.currency.ForUser(user)
 	
 	// Get product
 	product, err := store.GetProduct(b.db, productID)
@@ -593,8 +714,11 @@ func (b *Bot) handleBuyProduct(callback *tgbotapi.CallbackQuery, productID uint)
 		return
 	}
 	
-	// Check stock
+	// Check stock, products with an on-demand supplier are restocked first
 	stock, err := store.CountAvailableCodes(b.db, productID)
+	if err == nil && stock == 0 && b.fetchOnDemand(productID) {
+		stock = 1
+	}
 	if err != nil || stock == 0 {
 		msg := tgbotapi.NewMessage(callback.Message.Chat.ID, b.msg.Get(lang, "out_of_stock"))
 		b.api.Send(msg)
@@ -623,12 +747,11 @@ func (b *Bot) handleBuyProduct(callback *tgbotapi.CallbackQuery, productID uint)
 		
 		// Ask user if they want to use balance
 		balanceMsg := b.msg.Format(lang, "use_balance_prompt", map[string]interface{}{
-			"Currency": currencySymbol,
-			"Balance": fmt.Sprintf("%.2f", float64(balance)/100),
+			"Balance": money.Format(balance),
 			"Product": product.Name,
-			"Price": fmt.Sprintf("%.2f", float64(product.PriceCents)/100),
-			"BalanceUsed": fmt.Sprintf("%.2f", float64(balanceUsed)/100),
-			"ToPay": fmt.Sprintf("%.2f", float64(paymentAmount)/100),
+			"Price": money.Format(product.PriceCents),
+			"BalanceUsed": money.Format(balanceUsed),
+			"ToPay": money.Format(paymentAmount),
 		})
 		
 		// Create inline keyboard for balance usage choice
@@ -669,14 +792,27 @@ func (b *Bot) handleConfirmBuy(callback *tgbotapi.CallbackQuery, productID uint,
 		return
 	}
 
+	if !b.checkPendingOrderLimit(callback.Message.Chat.ID, lang, user) {
+		return
+	}
+
 	// Create order with or without balance
-	var order *store.Order
-	if useBalance {
-		order, err = store.CreateOrderWithBalance(b.db, user.ID, product.ID, product.PriceCents, true)
-	} else {
-		order, err = store.CreateOrder(b.db, user.ID, product.ID, product.PriceCents)
+	createOrder := func() (*store.Order, error) {
+		if useBalance {
+			return store.CreateOrderWithBalance(b.db, user.ID, product.ID, product.PriceCents, true)
+		}
+		return store.CreateOrder(b.db, user.ID, product.ID, product.PriceCents)
+	}
+	order, err := createOrder()
+	if errors.Is(err, store.ErrNoStock) && b.fetchOnDemand(product.ID) {
+		order, err = createOrder()
 	}
 	
+	if errors.Is(err, store.ErrNoStock) {
+		// The last codes are held by other pending orders
+		b.api.Send(tgbotapi.NewMessage(callback.Message.Chat.ID, b.msg.Get(lang, "out_of_stock")))
+		return
+	}
 	if err != nil {
 		logger.Error("Failed to create order", "error", err)
 		b.sendError(callback.Message.Chat.ID, b.msg.Get(lang, "failed_to_create_order"))
@@ -686,8 +822,8 @@ func (b *Bot) handleConfirmBuy(callback *tgbotapi.CallbackQuery, productID uint,
 	// Track order created metric
 	metrics.OrdersCreated.Inc()
 	
-	// Get currency symbol
-	_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
+	// Format amounts in the user's display currency
+	money := b.currency.ForUser(user)
 
 	// If payment amount is 0 (fully paid with balance), deliver immediately
 	if order.PaymentAmount == 0 {
@@ -732,74 +868,20 @@ func (b *Bot) handleConfirmBuy(callback *tgbotapi.CallbackQuery, productID uint,
 		return
 	}
 
-	// Generate out_trade_no for payment with nanosecond precision to avoid duplicates
-	outTradeNo := fmt.Sprintf("%d-%d", order.ID, time.Now().UnixNano())
-
-	// Update order with out_trade_no
-	if err := b.db.Model(&store.Order{}).Where("id = ?", order.ID).Update("epay_out_trade_no", outTradeNo).Error; err != nil {
-		logger.Error("Failed to update order out_trade_no", "error", err, "order_id", order.ID)
-	}
-
-	// Check if payment is configured
-	if b.epay == nil {
-		orderMsg := b.msg.Format(lang, "order_created", map[string]interface{}{
-			"Currency":    currencySymbol,
-			"ProductName": product.Name,
-			"Price":       fmt.Sprintf("%.2f", float64(order.PaymentAmount)/100),
-			"OrderID":     order.ID,
-		})
-		
-		if order.BalanceUsed > 0 {
-			orderMsg += "\n" + b.msg.Format(lang, "balance_used_info", map[string]interface{}{
-				"Currency":    currencySymbol,
-				"BalanceUsed": fmt.Sprintf("%.2f", float64(order.BalanceUsed)/100),
-			})
-		}
-		
-		orderMsg += "\n\n" + b.msg.Get(lang, "payment_not_configured")
-		
-		msg := tgbotapi.NewMessage(callback.Message.Chat.ID, orderMsg)
-		b.api.Send(msg)
-		return
-	}
-
-	// Create payment order using submit URL (allows user to choose payment method)
-	notifyURL := fmt.Sprintf("%s/payment/epay/notify", b.config.BaseURL)
-	returnURL := fmt.Sprintf("%s/payment/return", b.config.BaseURL)
-
-	// Create submit URL for payment page
-	payURL := b.epay.CreateSubmitURL(epay.CreateOrderParams{
-		OutTradeNo: outTradeNo,
-		Name:       product.Name,
-		Money:      float64(order.PaymentAmount) / 100, // Use payment amount after balance deduction
-		NotifyURL:  notifyURL,
-		ReturnURL:  returnURL,
-		Param:      fmt.Sprintf("user_%d", user.ID), // Store user ID for reference
-	})
-
-	// Send payment message with inline button
+	// Send order message with payment options
 	orderMsg := b.msg.Format(lang, "order_created", map[string]interface{}{
 		"ProductName": product.Name,
-		"Price":       fmt.Sprintf("%.2f", float64(order.PaymentAmount)/100),
+		"Price":       money.Format(order.PaymentAmount),
 		"OrderID":     order.ID,
 	})
 	
 	if order.BalanceUsed > 0 {
 		orderMsg += "\n" + b.msg.Format(lang, "balance_used_info", map[string]interface{}{
-			"BalanceUsed": fmt.Sprintf("%.2f", float64(order.BalanceUsed)/100),
+			"BalanceUsed": money.Format(order.BalanceUsed),
 		})
 	}
-
-	// Send payment message with inline button
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonURL(b.msg.Get(lang, "pay_now"), payURL),
-		),
-	)
 	
-	msg := tgbotapi.NewMessage(callback.Message.Chat.ID, orderMsg)
-	msg.ReplyMarkup = keyboard
-	b.api.Send(msg)
+	b.sendCheckout(callback.Message.Chat.ID, lang, user, order, orderMsg, "")
 
 	logger.Info("Order created", "order_id", order.ID, "user_id", user.ID, "product_id", product.ID, "balance_used", order.BalanceUsed)
 }
@@ -812,23 +894,22 @@ func (b *Bot) handleDeposit(message *tgbotapi.Message) {
 	// Get current balance
 	balance, _ := store.GetUserBalance(b.db, user.ID)
 	
-	// Get currency symbol
-	_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
+	// Format amounts in the user's display currency
+	money := b.currency.ForUser(user)
 	
 	depositMsg := b.msg.Format(lang, "deposit_info", map[string]interface{}{
-		"Currency": currencySymbol,
-		"Balance": fmt.Sprintf("%.2f", float64(balance)/100),
+		"Balance": money.Format(balance),
 	})
 	
 	// Add deposit options
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("💵 %s10", currencySymbol), "deposit_10"),
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("💵 %s20", currencySymbol), "deposit_20"),
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("💵 %s50", currencySymbol), "deposit_50"),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("💵 %s10", money.Base.Symbol), "deposit_10"),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("💵 %s20", money.Base.Symbol), "deposit_20"),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("💵 %s50", money.Base.Symbol), "deposit_50"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("💵 %s100", currencySymbol), "deposit_100"),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("💵 %s100", money.Base.Symbol), "deposit_100"),
 			tgbotapi.NewInlineKeyboardButtonData("🔢 "+b.msg.Get(lang, "custom_amount"), "deposit_custom"),
 		),
 	)
@@ -849,11 +930,11 @@ func (b *Bot) handleDepositCallback(callback *tgbotapi.CallbackQuery) {
 	
 	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
 	
-	// Get currency symbol
-	_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
+	// Format amounts in the user's display currency
+	money := b.currency.ForUser(user)
 	
 	// Check if payment is configured
-	if b.epay == nil {
+	if len(b.enabledPaymentProviders()) == 0 {
 		b.api.Request(tgbotapi.NewCallback(callback.ID, b.msg.Get(lang, "payment_not_configured")))
 		return
 	}
@@ -889,6 +970,11 @@ func (b *Bot) handleDepositCallback(callback *tgbotapi.CallbackQuery) {
 		return
 	}
 	
+	if !b.checkPendingOrderLimit(callback.Message.Chat.ID, lang, user) {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+	
 	// Create a deposit order
 	order, err := store.CreateDepositOrder(b.db, user.ID, amountCents)
 	if err != nil {
@@ -897,45 +983,13 @@ func (b *Bot) handleDepositCallback(callback *tgbotapi.CallbackQuery) {
 		return
 	}
 	
-	// Generate payment URL with nanosecond precision to avoid duplicates
-	outTradeNo := fmt.Sprintf("D%d-%d", order.ID, time.Now().UnixNano())
-	
-	// Update order with out_trade_no
-	if err := b.db.Model(&store.Order{}).Where("id = ?", order.ID).Update("epay_out_trade_no", outTradeNo).Error; err != nil {
-		logger.Error("Failed to update order out_trade_no", "error", err, "order_id", order.ID)
-	}
-	
-	// Create payment order using submit URL (allows user to choose payment method)
-	notifyURL := fmt.Sprintf("%s/payment/epay/notify", b.config.BaseURL)
-	returnURL := fmt.Sprintf("%s/payment/return", b.config.BaseURL)
-	
-	// Create submit URL for payment page
-	payURL := b.epay.CreateSubmitURL(epay.CreateOrderParams{
-		OutTradeNo: outTradeNo,
-		Name:       fmt.Sprintf("充值 %s%.2f", currencySymbol, float64(amountCents)/100),
-		Money:      float64(amountCents) / 100,
-		NotifyURL:  notifyURL,
-		ReturnURL:  returnURL,
-		Param:      fmt.Sprintf("deposit_%d", user.ID),
-	})
-	
 	// Send payment message
 	depositMsg := b.msg.Format(lang, "deposit_order_created", map[string]interface{}{
-		"Currency": currencySymbol,
-		"Amount":  fmt.Sprintf("%.2f", float64(amountCents)/100),
+		"Amount":  money.Format(amountCents),
 		"OrderID": order.ID,
 	})
 	
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonURL(b.msg.Get(lang, "pay_now"), payURL),
-		),
-	)
-	
-	msg := tgbotapi.NewMessage(callback.Message.Chat.ID, depositMsg)
-	msg.ReplyMarkup = keyboard
-	msg.ParseMode = "Markdown"
-	b.api.Send(msg)
+	b.sendCheckout(callback.Message.Chat.ID, lang, user, order, depositMsg, "Markdown")
 	
 	logger.Info("Deposit order created", "order_id", order.ID, "user_id", user.ID, "amount", amountCents)
 }
@@ -953,16 +1007,15 @@ func (b *Bot) handleProfile(message *tgbotapi.Message) {
 	// Get user balance
 	balance, _ := store.GetUserBalance(b.db, user.ID)
 	
-	// Get currency symbol
-	_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
+	// Format amounts in the user's display currency
+	money := b.currency.ForUser(user)
 	
 	profileMsg := b.msg.Format(lang, "profile_info", map[string]interface{}{
 		"UserID":     user.TgUserID,
 		"Username":   user.Username,
 		"Language":   user.Language,
 		"JoinedDate": user.CreatedAt.Format("2006-01-02"),
-		"Currency":   currencySymbol,
-		"Balance":    fmt.Sprintf("%.2f", float64(balance)/100),
+		"Balance":    money.Format(balance),
 	})
 	
 	// Add language selection button
@@ -970,9 +1023,16 @@ func (b *Bot) handleProfile(message *tgbotapi.Message) {
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("Change Language / 切换语言", "select_language"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "btn_currency"), "select_currency"),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "view_balance_history"), "balance_history"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "btn_transfer"), "transfer_start"),
+			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "btn_withdraw"), "withdraw_start"),
+		),
 	)
 	
 	msg := tgbotapi.NewMessage(message.Chat.ID, b.msg.Get(lang, "profile_title")+"\n\n"+profileMsg)
@@ -1050,6 +1110,11 @@ func (b *Bot) UpdateInlineStock(chatID int64, messageID int) error {
 		return err
 	}
 	
+	// The chat is the user's private chat, so use their display currency
+	var user store.User
+	b.db.Where("tg_user_id = ?", chatID).First(&user)
+	money := b.currency.ForUser(&user)
+	
 	// Recreate inline keyboard with updated stock
 	var rows [][]tgbotapi.InlineKeyboardButton
 	
@@ -1059,13 +1124,9 @@ func (b *Bot) UpdateInlineStock(chatID int64, messageID int) error {
 			stock = 0
 		}
 		
-		// Get currency symbol
-		_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
-		
-		buttonText := fmt.Sprintf("%s - %s%.2f (%d)", 
+		buttonText := fmt.Sprintf("%s - %s (%d)", 
 			product.Name, 
-			currencySymbol,
-			float64(product.PriceCents)/100, 
+			money.Short(product.PriceCents),
 			stock,
 		)
 		
@@ -1088,6 +1149,11 @@ func (b *Bot) GetBroadcastService() *broadcast.Service {
 	return b.broadcast
 }
 
+// GetNotificationService returns the admin notification service
+func (b *Bot) GetNotificationService() *notification.Service {
+	return b.notification
+}
+
 // SetWebhook sets the webhook URL
 func (b *Bot) SetWebhook(webhookURL string) error {
 	webhook, err := tgbotapi.NewWebhook(webhookURL)
@@ -1135,7 +1201,7 @@ func (b *Bot) handleCustomDepositAmount(message *tgbotapi.Message) {
 	lang := messages.GetUserLanguage(user.Language, message.From.LanguageCode)
 	
 	// Check if payment is configured
-	if b.epay == nil {
+	if len(b.enabledPaymentProviders()) == 0 {
 		b.sendError(message.Chat.ID, b.msg.Get(lang, "payment_not_configured"))
 		return
 	}
@@ -1208,6 +1274,10 @@ func (b *Bot) handleCustomDepositAmount(message *tgbotapi.Message) {
 		return
 	}
 	
+	if !b.checkPendingOrderLimit(message.Chat.ID, lang, user) {
+		return
+	}
+	
 	// Create a deposit order
 	order, err := store.CreateDepositOrder(b.db, user.ID, amountCents)
 	if err != nil {
@@ -1216,48 +1286,16 @@ func (b *Bot) handleCustomDepositAmount(message *tgbotapi.Message) {
 		return
 	}
 	
-	// Generate payment URL with nanosecond precision to avoid duplicates
-	outTradeNo := fmt.Sprintf("D%d-%d", order.ID, time.Now().UnixNano())
-	
-	// Update order with out_trade_no
-	if err := b.db.Model(&store.Order{}).Where("id = ?", order.ID).Update("epay_out_trade_no", outTradeNo).Error; err != nil {
-		logger.Error("Failed to update order out_trade_no", "error", err, "order_id", order.ID)
-	}
-	
-	// Create payment order using submit URL (allows user to choose payment method)
-	notifyURL := fmt.Sprintf("%s/payment/epay/notify", b.config.BaseURL)
-	returnURL := fmt.Sprintf("%s/payment/return", b.config.BaseURL)
-	
-	// Get currency symbol
-	_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
-	
-	// Create submit URL for payment page
-	payURL := b.epay.CreateSubmitURL(epay.CreateOrderParams{
-		OutTradeNo: outTradeNo,
-		Name:       fmt.Sprintf("充值 %s%.2f", currencySymbol, float64(amountCents)/100),
-		Money:      float64(amountCents) / 100,
-		NotifyURL:  notifyURL,
-		ReturnURL:  returnURL,
-		Param:      fmt.Sprintf("deposit_%d", user.ID),
-	})
+	// Format amounts in the user's display currency
+	money := b.currency.ForUser(user)
 	
 	// Send payment message
 	depositMsg := b.msg.Format(lang, "deposit_order_created", map[string]interface{}{
-		"Currency": currencySymbol,
-		"Amount":  fmt.Sprintf("%.2f", float64(amountCents)/100),
+		"Amount":  money.Format(amountCents),
 		"OrderID": order.ID,
 	})
 	
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonURL(b.msg.Get(lang, "pay_now"), payURL),
-		),
-	)
-	
-	msg := tgbotapi.NewMessage(message.Chat.ID, depositMsg)
-	msg.ReplyMarkup = keyboard
-	msg.ParseMode = "Markdown"
-	b.api.Send(msg)
+	b.sendCheckout(message.Chat.ID, lang, user, order, depositMsg, "Markdown")
 	
 	logger.Info("Custom deposit order created", "user_id", user.ID, "amount_cents", amountCents, "order_id", order.ID)
 }
@@ -0,0 +1,279 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"shop-bot/internal/bot/messages"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/payment"
+	"shop-bot/internal/qrcode"
+	"shop-bot/internal/store"
+)
+
+// enabledPaymentProviders returns the configured providers enabled in settings
+func (b *Bot) enabledPaymentProviders() []payment.PaymentProvider {
+	return b.payments.Enabled(store.GetEnabledPaymentProviders(b.db))
+}
+
+// sendCheckout sends the order message with a way to pay. With a single
+// enabled provider the pay link is attached directly, otherwise the user
+// chooses a provider first. The message shows the payment deadline and
+// lets the user cancel the order.
+func (b *Bot) sendCheckout(chatID int64, lang string, user *store.User, order *store.Order, text, parseMode string) {
+	providers := b.enabledPaymentProviders()
+	cancelRow := b.cancelOrderRow(lang, order.ID)
+
+	if len(providers) == 0 {
+		msg := tgbotapi.NewMessage(chatID, text+"\n\n"+b.msg.Get(lang, "payment_not_configured"))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(cancelRow)
+		msg.ParseMode = parseMode
+		b.api.Send(msg)
+		return
+	}
+
+	text += "\n\n" + b.orderExpiryLine(lang, order)
+
+	if len(providers) == 1 && payment.IsInChat(providers[0]) {
+		// Send the order details first, the invoice follows below
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(cancelRow)
+		msg.ParseMode = parseMode
+		b.api.Send(msg)
+
+		if _, err := b.createCheckout(providers[0], user, order, ""); err != nil {
+			logger.Error("Failed to create checkout", "error", err, "order_id", order.ID, "provider", providers[0].Name())
+			b.sendError(chatID, b.msg.Get(lang, "failed_to_create_order"))
+		}
+		return
+	}
+
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	if len(providers) == 1 && len(payment.Methods(providers[0])) > 0 {
+		text += "\n\n" + b.msg.Get(lang, "choose_payment_method")
+		keyboard = b.paymentMethodKeyboard(providers[0], order.ID)
+	} else if len(providers) == 1 {
+		checkout, err := b.createCheckout(providers[0], user, order, "")
+		if err != nil {
+			logger.Error("Failed to create checkout", "error", err, "order_id", order.ID, "provider", providers[0].Name())
+			b.sendError(chatID, b.msg.Get(lang, "failed_to_create_order"))
+			return
+		}
+		keyboard = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonURL(b.msg.Get(lang, "pay_now"), checkout.PayURL),
+			),
+		)
+	} else {
+		text += "\n\n" + b.msg.Get(lang, "choose_payment_provider")
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, p := range providers {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(p.DisplayName(), fmt.Sprintf("pay:%s:%d", p.Name(), order.ID)),
+			))
+		}
+		keyboard = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, cancelRow)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	msg.ParseMode = parseMode
+	b.api.Send(msg)
+}
+
+// paymentMethodKeyboard lists the methods of a provider as pay:<provider>:<order>:<method> buttons
+func (b *Bot) paymentMethodKeyboard(provider payment.PaymentProvider, orderID uint) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, m := range payment.Methods(provider) {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(m.DisplayName, fmt.Sprintf("pay:%s:%d:%s", provider.Name(), orderID, m.Name)),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handlePayWithProvider creates a checkout with the provider the user
+// picked. Providers with selectable methods ask for the method first.
+func (b *Bot) handlePayWithProvider(callback *tgbotapi.CallbackQuery, providerName string, orderID uint, method string) {
+	user, err := store.GetOrCreateUser(b.db, callback.From.ID, callback.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
+
+	var provider payment.PaymentProvider
+	for _, p := range b.enabledPaymentProviders() {
+		if p.Name() == providerName {
+			provider = p
+			break
+		}
+	}
+	if provider == nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, b.msg.Get(lang, "payment_not_configured")))
+		return
+	}
+
+	order, err := store.GetUserOrder(b.db, user.ID, orderID)
+	if err != nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, b.msg.Get(lang, "order_not_found")))
+		return
+	}
+	// A mismatched order can still be paid when money is missing
+	payable := order.Status == "pending" || (order.Status == store.OrderStatusPaymentMismatch && order.AmountDue() > 0)
+	if !payable {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, b.msg.Get(lang, "order_not_pending")))
+		return
+	}
+
+	methods := payment.Methods(provider)
+	methodName := ""
+	if len(methods) > 0 {
+		for _, m := range methods {
+			if m.Name == method {
+				methodName = m.DisplayName
+				break
+			}
+		}
+		if methodName == "" {
+			// No valid method yet, let the user pick one
+			keyboard := b.paymentMethodKeyboard(provider, order.ID)
+			if order.Status == "pending" {
+				keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, b.cancelOrderRow(lang, order.ID))
+			}
+			b.api.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, keyboard))
+			b.api.Request(tgbotapi.NewCallback(callback.ID, b.msg.Get(lang, "choose_payment_method")))
+			return
+		}
+	}
+
+	checkout, err := b.createCheckout(provider, user, order, method)
+	if err != nil {
+		logger.Error("Failed to create checkout", "error", err, "order_id", order.ID, "provider", provider.Name())
+		b.api.Request(tgbotapi.NewCallback(callback.ID, b.msg.Get(lang, "failed_to_create_order")))
+		return
+	}
+
+	// In-chat providers already sent their payment request, drop the choice
+	// buttons and keep only the cancel button
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	switch {
+	case checkout.QRCode != "":
+		if err := b.sendPaymentQRCode(callback.Message.Chat.ID, lang, user, order, methodName, checkout); err != nil {
+			logger.Error("Failed to send payment QR code", "error", err, "order_id", order.ID)
+			link := paymentLink(checkout)
+			if link == "" {
+				b.api.Request(tgbotapi.NewCallback(callback.ID, b.msg.Get(lang, "failed_to_create_order")))
+				return
+			}
+			keyboard = tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonURL(b.msg.Get(lang, "pay_now"), link),
+				),
+			)
+		}
+	case !checkout.InChat:
+		label := provider.DisplayName()
+		if methodName != "" {
+			label = methodName
+		}
+		keyboard = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonURL(fmt.Sprintf("%s · %s", b.msg.Get(lang, "pay_now"), label), checkout.PayURL),
+			),
+		)
+	}
+	if order.Status == "pending" {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, b.cancelOrderRow(lang, order.ID))
+	}
+	b.api.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, keyboard))
+	b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
+}
+
+// sendPaymentQRCode sends the checkout QR code as an image, with a button
+// to the payment page when the provider returned a web link
+func (b *Bot) sendPaymentQRCode(chatID int64, lang string, user *store.User, order *store.Order, methodName string, checkout *payment.Checkout) error {
+	image, err := qrcode.PNG(checkout.QRCode, 512)
+	if err != nil {
+		return err
+	}
+
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("order_%d.png", order.ID),
+		Bytes: image,
+	})
+	photo.Caption = b.msg.Format(lang, "scan_to_pay", map[string]interface{}{
+		"Method":  methodName,
+		"Amount":  b.currency.ForUser(user).Format(order.AmountDue()),
+		"OrderID": order.ID,
+	})
+	if link := paymentLink(checkout); link != "" {
+		photo.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonURL(b.msg.Get(lang, "open_payment_page"), link),
+			),
+		)
+	}
+
+	_, err = b.api.Send(photo)
+	return err
+}
+
+// paymentLink returns a link Telegram accepts for a URL button. QR contents
+// such as weixin:// deep links cannot be used as buttons.
+func paymentLink(checkout *payment.Checkout) string {
+	for _, link := range []string{checkout.PayURL, checkout.QRCode} {
+		if strings.HasPrefix(link, "https://") || strings.HasPrefix(link, "http://") {
+			return link
+		}
+	}
+	return ""
+}
+
+// createCheckout registers a new merchant order number for the order and
+// asks the provider for a payment link or in-chat payment request
+func (b *Bot) createCheckout(provider payment.PaymentProvider, user *store.User, order *store.Order, method string) (*payment.Checkout, error) {
+	// Generate out_trade_no with nanosecond precision to avoid duplicates
+	outTradeNo := fmt.Sprintf("%d-%d", order.ID, time.Now().UnixNano())
+	subject := ""
+	param := fmt.Sprintf("user_%d", user.ID)
+	if order.ProductID == nil {
+		outTradeNo = "D" + outTradeNo
+		subject = "充值 " + b.currency.Format(order.AmountCents)
+		param = fmt.Sprintf("deposit_%d", user.ID)
+	} else if order.Product != nil {
+		subject = order.Product.Name
+	} else {
+		var product store.Product
+		if err := b.db.First(&product, *order.ProductID).Error; err != nil {
+			return nil, fmt.Errorf("failed to load product: %w", err)
+		}
+		subject = product.Name
+	}
+
+	if err := store.SetOrderPaymentRef(b.db, order.ID, provider.Name(), outTradeNo); err != nil {
+		return nil, fmt.Errorf("failed to update order out_trade_no: %w", err)
+	}
+
+	checkout, err := provider.CreateCheckout(context.Background(), payment.CheckoutRequest{
+		OutTradeNo:  outTradeNo,
+		Subject:     subject,
+		AmountCents: order.AmountDue(), // Payment amount after balance deduction, less anything already received
+		NotifyURL:   fmt.Sprintf("%s/payment/%s/notify", b.config.BaseURL, provider.Name()),
+		ReturnURL:   fmt.Sprintf("%s/payment/return", b.config.BaseURL),
+		Method:      method,
+		Param:       param,
+		ChatID:      user.TgUserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Checkout created", "order_id", order.ID, "provider", provider.Name(), "method", method, "out_trade_no", outTradeNo)
+	return checkout, nil
+}
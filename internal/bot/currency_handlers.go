@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"shop-bot/internal/bot/messages"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// Display currency selection handlers
+
+func (b *Bot) handleCurrencySelection(callback *tgbotapi.CallbackQuery) {
+	user, _ := store.GetOrCreateUser(b.db, callback.From.ID, callback.From.UserName)
+	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
+
+	current := b.currency.ForUser(user).Display.Code
+
+	// Create currency selection keyboard
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, c := range b.currency.Available() {
+		label := fmt.Sprintf("%s %s", c.Code, c.Symbol)
+		if c.Name != "" {
+			label = fmt.Sprintf("%s (%s)", label, c.Name)
+		}
+		if c.Code == current {
+			label = "✅ " + label
+		}
+		button := tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("set_currency:%s", c.Code))
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{button})
+	}
+
+	base := b.currency.Base()
+	msg := tgbotapi.NewMessage(callback.Message.Chat.ID, b.msg.Format(lang, "choose_currency", map[string]interface{}{
+		"Base": base.Code,
+	}))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.api.Send(msg)
+}
+
+func (b *Bot) handleSetCurrency(callback *tgbotapi.CallbackQuery, code string) {
+	user, err := store.GetOrCreateUser(b.db, callback.From.ID, callback.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
+
+	// Only allow the base currency or an active exchange rate
+	base := b.currency.Base()
+	if code == base.Code {
+		code = ""
+	} else if _, err := store.GetExchangeRate(b.db, code); err != nil {
+		b.sendError(callback.Message.Chat.ID, b.msg.Get(lang, "currency_not_available"))
+		return
+	}
+
+	if err := store.SetUserDisplayCurrency(b.db, user.ID, code); err != nil {
+		logger.Error("Failed to update display currency", "error", err, "user_id", user.ID)
+		b.sendError(callback.Message.Chat.ID, b.msg.Get(lang, "failed_to_process"))
+		return
+	}
+	user.DisplayCurrency = code
+
+	// Delete the currency selection message
+	b.api.Send(tgbotapi.NewDeleteMessage(callback.Message.Chat.ID, callback.Message.MessageID))
+
+	money := b.currency.ForUser(user)
+	msg := tgbotapi.NewMessage(callback.Message.Chat.ID, b.msg.Format(lang, "currency_changed", map[string]interface{}{
+		"Currency": money.Display.Code,
+		"Base":     base.Code,
+		"Example":  money.Format(10000),
+	}))
+	b.api.Send(msg)
+
+	logger.Info("User display currency updated", "user_id", user.ID, "currency", money.Display.Code)
+}
@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"shop-bot/internal/bot/messages"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// checkPendingOrderLimit tells the user when they already have too many
+// unpaid orders. It returns false if no new order may be created.
+func (b *Bot) checkPendingOrderLimit(chatID int64, lang string, user *store.User) bool {
+	err := store.CheckPendingOrderLimit(b.db, user.ID)
+	if err == nil {
+		return true
+	}
+	if err != store.ErrTooManyPendingOrders {
+		logger.Error("Failed to check pending orders", "error", err, "user_id", user.ID)
+		b.sendError(chatID, b.msg.Get(lang, "failed_to_process"))
+		return false
+	}
+
+	msg := tgbotapi.NewMessage(chatID, b.msg.Format(lang, "too_many_pending_orders", map[string]interface{}{
+		"Count": store.GetMaxPendingOrders(b.db),
+	}))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "btn_orders"), "my_orders"),
+		),
+	)
+	b.api.Send(msg)
+	return false
+}
+
+// cancelOrderRow is the keyboard row that lets the user cancel a pending order
+func (b *Bot) cancelOrderRow(lang string, orderID uint) []tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "btn_cancel_order"), fmt.Sprintf("cancel_order:%d", orderID)),
+	)
+}
+
+// orderExpiryLine shows how long a pending order can still be paid. The
+// remaining time is computed whenever the message is built.
+func (b *Bot) orderExpiryLine(lang string, order *store.Order) string {
+	expiresAt := order.ExpiresAt(store.GetOrderExpireHours(b.db))
+	remaining := time.Until(expiresAt)
+	if remaining < time.Minute {
+		remaining = time.Minute
+	}
+
+	minutes := int(remaining.Minutes())
+	duration := b.msg.Format(lang, "duration_minutes", map[string]interface{}{
+		"Minutes": minutes,
+	})
+	if minutes >= 60 {
+		duration = b.msg.Format(lang, "duration_hours_minutes", map[string]interface{}{
+			"Hours":   minutes / 60,
+			"Minutes": minutes % 60,
+		})
+	}
+
+	return b.msg.Format(lang, "order_expires_in", map[string]interface{}{
+		"Remaining": duration,
+		"ExpiresAt": expiresAt.Format("2006-01-02 15:04"),
+	})
+}
+
+// handleCancelOrder cancels a pending order at the user's request. Orders
+// cancelled from the order details view are shown again afterwards.
+func (b *Bot) handleCancelOrder(callback *tgbotapi.CallbackQuery, orderID uint, fromDetails bool) {
+	user, err := store.GetOrCreateUser(b.db, callback.From.ID, callback.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
+
+	order, err := store.CancelPendingOrder(b.db, user.ID, orderID)
+	if err != nil {
+		switch err {
+		case store.ErrOrderNotFound:
+			b.api.Request(tgbotapi.NewCallback(callback.ID, b.msg.Get(lang, "order_not_found")))
+		case store.ErrOrderNotPending:
+			b.api.Request(tgbotapi.NewCallback(callback.ID, b.msg.Get(lang, "order_not_pending")))
+		default:
+			logger.Error("Failed to cancel order", "error", err, "order_id", orderID)
+			b.api.Request(tgbotapi.NewCallback(callback.ID, b.msg.Get(lang, "failed_to_process")))
+		}
+		return
+	}
+
+	logger.Info("Order cancelled by user", "order_id", order.ID, "user_id", user.ID, "balance_returned", order.BalanceUsed)
+
+	text := b.msg.Format(lang, "order_cancelled", map[string]interface{}{
+		"OrderID": order.ID,
+	})
+	if order.BalanceUsed > 0 {
+		text = b.msg.Format(lang, "order_cancelled_balance_returned", map[string]interface{}{
+			"OrderID":     order.ID,
+			"BalanceUsed": b.currency.ForUser(user).Format(order.BalanceUsed),
+		})
+	}
+
+	if fromDetails {
+		b.handleOrderDetails(callback, order.ID)
+		b.api.Send(tgbotapi.NewMessage(callback.Message.Chat.ID, text))
+		return
+	}
+
+	// Drop the payment buttons from the checkout message
+	b.api.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID,
+		tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+	b.api.Send(tgbotapi.NewMessage(callback.Message.Chat.ID, text))
+	b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
+}
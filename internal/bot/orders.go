@@ -30,9 +30,6 @@ func (b *Bot) handleMyOrdersPage(message *tgbotapi.Message, page int) {
 	
 	lang := messages.GetUserLanguage(user.Language, message.From.LanguageCode)
 	
-	// Get currency symbol
-	_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
-	
 	// Constants for pagination
 	const ordersPerPage = 5
 	offset := page * ordersPerPage
@@ -82,12 +79,11 @@ func (b *Bot) handleMyOrdersPage(message *tgbotapi.Message, page int) {
 			}
 			
 			orderInfo := fmt.Sprintf(
-				"🆔 #%d | %s\n📦 %s\n💰 %s%.2f\n🔑 卡密：`%s`\n🕐 %s\n\n",
+				"🆔 #%d | %s\n📦 %s\n💰 %s\n🔑 卡密：`%s`\n🕐 %s\n\n",
 				order.ID,
 				status,
 				productName,
-				currencySymbol,
-				float64(order.AmountCents)/100,
+				b.currency.Format(order.AmountCents),
 				code,
 				order.CreatedAt.Format("01/02 15:04"),
 			)
@@ -149,8 +145,8 @@ func (b *Bot) handleOrderDetails(callback *tgbotapi.CallbackQuery, orderID uint)
 	
 	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
 	
-	// Get currency symbol
-	_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
+	// Format amounts in the user's display currency
+	money := b.currency.ForUser(user)
 	
 	// Get order with validation that it belongs to user
 	order, err := store.GetUserOrder(b.db, user.ID, orderID)
@@ -174,20 +170,25 @@ func (b *Bot) handleOrderDetails(callback *tgbotapi.CallbackQuery, orderID uint)
 	}
 	
 	msgBuilder.WriteString(b.msg.Format(lang, "order_details", map[string]interface{}{
-		"Currency":    currencySymbol,
 		"ProductName": productName,
-		"Price":       fmt.Sprintf("%.2f", float64(order.AmountCents)/100),
+		"Price":       money.Format(order.AmountCents),
 		"Status":      b.msg.Get(lang, "order_status_"+order.Status),
 		"CreatedAt":   order.CreatedAt.Format("2006-01-02 15:04:05"),
 		"PaidAt":      formatTime(order.PaidAt),
-		"BalanceUsed": fmt.Sprintf("%.2f", float64(order.BalanceUsed)/100),
-		"PaymentAmount": fmt.Sprintf("%.2f", float64(order.PaymentAmount)/100),
+		"BalanceUsed": money.Format(order.BalanceUsed),
+		"PaymentAmount": money.Format(order.PaymentAmount),
 	}))
 	
 	// If order is delivered, show the code again
 	if order.Status == "delivered" {
 		var code store.Code
 		if err := b.db.Where("order_id = ?", order.ID).First(&code).Error; err == nil {
+			plain, err := store.RenderCode(b.db, &code)
+			if err != nil {
+				logger.Error("Failed to decrypt code", "error", err, "order_id", order.ID)
+				plain = b.msg.Get(lang, "failed_to_process")
+			}
+			code.Code = plain
 			msgBuilder.WriteString("\n\n")
 			msgBuilder.WriteString(b.msg.Format(lang, "order_code_resend", map[string]interface{}{
 				"Code": code.Code,
@@ -195,12 +196,21 @@ func (b *Bot) handleOrderDetails(callback *tgbotapi.CallbackQuery, orderID uint)
 		}
 	}
 	
+	// Pending orders show the remaining payment time and can be cancelled
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if order.Status == "pending" {
+		msgBuilder.WriteString("\n\n")
+		msgBuilder.WriteString(b.orderExpiryLine(lang, order))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "btn_cancel_order"), fmt.Sprintf("cancel_order:%d:details", order.ID)),
+		))
+	}
+
 	// Back button
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "back_to_orders"), "my_orders"),
-		),
-	)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "back_to_orders"), "my_orders"),
+	))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	
 	edit := tgbotapi.NewEditMessageText(
 		callback.Message.Chat.ID,
@@ -236,9 +246,6 @@ func (b *Bot) handleMyOrdersPageEdit(callback *tgbotapi.CallbackQuery, page int)
 	
 	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
 	
-	// Get currency symbol
-	_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
-	
 	// Constants for pagination
 	const ordersPerPage = 5
 	offset := page * ordersPerPage
@@ -288,12 +295,11 @@ func (b *Bot) handleMyOrdersPageEdit(callback *tgbotapi.CallbackQuery, page int)
 			}
 			
 			orderInfo := fmt.Sprintf(
-				"🆔 #%d | %s\n📦 %s\n💰 %s%.2f\n🔑 卡密：`%s`\n🕐 %s\n\n",
+				"🆔 #%d | %s\n📦 %s\n💰 %s\n🔑 卡密：`%s`\n🕐 %s\n\n",
 				order.ID,
 				status,
 				productName,
-				currencySymbol,
-				float64(order.AmountCents)/100,
+				b.currency.Format(order.AmountCents),
 				code,
 				order.CreatedAt.Format("01/02 15:04"),
 			)
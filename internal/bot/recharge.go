@@ -1,7 +1,6 @@
 package bot
 
 import (
-	"fmt"
 	"strings"
 	
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -42,14 +41,13 @@ func (b *Bot) handleRechargeCard(message *tgbotapi.Message) {
 	// Get new balance
 	newBalance, _ := store.GetUserBalance(b.db, user.ID)
 	
-	// Get currency symbol
-	_, currencySymbol := store.GetCurrencySettings(b.db, b.config)
+	// Format amounts in the user's display currency
+	money := b.currency.ForUser(user)
 	
 	// Send success message
 	successMsg := b.msg.Format(lang, "balance_recharged", map[string]interface{}{
-		"Currency":   currencySymbol,
-		"Amount":     fmt.Sprintf("%.2f", float64(card.AmountCents)/100),
-		"NewBalance": fmt.Sprintf("%.2f", float64(newBalance)/100),
+		"Amount":     money.Format(card.AmountCents),
+		"NewBalance": money.Format(newBalance),
 		"CardCode":   cardCode,
 	})
 	
@@ -0,0 +1,325 @@
+package bot
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"shop-bot/internal/bot/messages"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/metrics"
+	"shop-bot/internal/notification"
+	"shop-bot/internal/payment/telegram"
+	"shop-bot/internal/store"
+)
+
+// Native Telegram Payments and Stars checkout handlers
+
+// telegramProvider returns the Telegram provider an order was checked out with
+func (b *Bot) telegramProvider(order *store.Order) (*telegram.Provider, bool) {
+	provider, err := b.payments.Get(order.PaymentProvider)
+	if err != nil {
+		return nil, false
+	}
+	tp, ok := provider.(*telegram.Provider)
+	return tp, ok
+}
+
+// handlePreCheckoutQuery re-validates the order before Telegram charges the user.
+// Telegram requires an answer within 10 seconds.
+func (b *Bot) handlePreCheckoutQuery(query *tgbotapi.PreCheckoutQuery) {
+	user, err := store.GetOrCreateUser(b.db, query.From.ID, query.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		b.answerPreCheckout(query, "failed_to_process", "")
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, query.From.LanguageCode)
+
+	order, err := store.GetOrderByOutTradeNo(b.db, query.InvoicePayload)
+	if err != nil || order.UserID != user.ID {
+		logger.Warn("Pre-checkout for unknown order", "payload", query.InvoicePayload, "user_id", user.ID)
+		b.answerPreCheckout(query, "order_not_found", lang)
+		return
+	}
+
+	if order.Status != "pending" {
+		b.answerPreCheckout(query, "order_not_pending", lang)
+		return
+	}
+
+	provider, ok := b.telegramProvider(order)
+	if !ok {
+		logger.Warn("Pre-checkout for order without telegram provider", "order_id", order.ID, "provider", order.PaymentProvider)
+		b.answerPreCheckout(query, "payment_not_configured", lang)
+		return
+	}
+
+	// The invoice must still match the order amount
+	currencyCode, amount, err := provider.InvoiceAmount(order.PaymentAmount)
+	if err != nil || currencyCode != query.Currency || amount != query.TotalAmount {
+		logger.Warn("Pre-checkout amount mismatch", "order_id", order.ID,
+			"expected_currency", currencyCode, "expected_amount", amount,
+			"currency", query.Currency, "amount", query.TotalAmount, "error", err)
+		b.answerPreCheckout(query, "invoice_price_changed", lang)
+		return
+	}
+
+	if order.ProductID != nil {
+		// Product must still be on sale at the ordered price
+		if order.Product == nil || !order.Product.IsActive || order.Product.PriceCents != order.AmountCents {
+			b.answerPreCheckout(query, "invoice_price_changed", lang)
+			return
+		}
+
+		stock, err := store.CountCodesForOrder(b.db, *order.ProductID, order.ID)
+		if err != nil || stock == 0 {
+			b.answerPreCheckout(query, "out_of_stock", lang)
+			return
+		}
+	}
+
+	b.answerPreCheckout(query, "", lang)
+	logger.Info("Pre-checkout approved", "order_id", order.ID, "provider", provider.Name(), "amount", amount, "currency", currencyCode)
+}
+
+// answerPreCheckout approves the query when errKey is empty, otherwise rejects it with the message
+func (b *Bot) answerPreCheckout(query *tgbotapi.PreCheckoutQuery, errKey, lang string) {
+	answer := tgbotapi.PreCheckoutConfig{
+		PreCheckoutQueryID: query.ID,
+		OK:                 errKey == "",
+	}
+	if errKey != "" {
+		answer.ErrorMessage = b.msg.Get(lang, errKey)
+	}
+
+	if _, err := b.api.Request(answer); err != nil {
+		logger.Error("Failed to answer pre-checkout query", "error", err, "query_id", query.ID)
+	}
+}
+
+// handleSuccessfulPayment fulfils an order paid through a Telegram invoice.
+// Telegram has charged the user by now, so a payment that cannot settle its
+// order is credited to the balance or held for an admin, never dropped.
+func (b *Bot) handleSuccessfulPayment(message *tgbotapi.Message) {
+	paid := message.SuccessfulPayment
+	metrics.PaymentCallbacksReceived.Inc()
+
+	// The update comes from Telegram over the bot's own connection, there is
+	// no signature to check
+	callback := &store.PaymentCallback{
+		Provider: telegram.ProviderName,
+		Source:   store.CallbackSourceNotify,
+		RawParams: url.Values{
+			"currency":                   {paid.Currency},
+			"total_amount":               {strconv.Itoa(paid.TotalAmount)},
+			"invoice_payload":            {paid.InvoicePayload},
+			"telegram_payment_charge_id": {paid.TelegramPaymentChargeID},
+			"provider_payment_charge_id": {paid.ProviderPaymentChargeID},
+		}.Encode(),
+		OutTradeNo:     paid.InvoicePayload,
+		TradeNo:        paid.TelegramPaymentChargeID,
+		SignatureValid: true,
+	}
+	if paid.Currency == telegram.StarsCurrency {
+		callback.Provider = telegram.StarsProviderName
+	}
+	defer b.recordTelegramPayment(callback)
+
+	user, err := store.GetOrCreateUser(b.db, message.From.ID, message.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		callback.Result = store.CallbackResultFailed
+		callback.Error = err.Error()
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, message.From.LanguageCode)
+
+	order, err := store.GetOrderByOutTradeNo(b.db, paid.InvoicePayload)
+	if err != nil {
+		logger.Error("Order not found for telegram payment", "payload", paid.InvoicePayload,
+			"charge_id", paid.TelegramPaymentChargeID, "error", err)
+		callback.Result = store.CallbackResultOrderNotFound
+		callback.Error = err.Error()
+		b.sendError(message.Chat.ID, b.msg.Get(lang, "payment_processing_failed"))
+		return
+	}
+	orderID := order.ID
+	callback.OrderID = &orderID
+
+	providerName := order.PaymentProvider
+	displayName := providerName
+	if providerName != "" {
+		callback.Provider = providerName
+	}
+
+	// The charge must match the invoice of the order before anything is settled
+	expectedCurrency, expectedAmount := "", 0
+	provider, ok := b.telegramProvider(order)
+	if ok {
+		displayName = provider.DisplayName()
+		expectedCurrency, expectedAmount, err = provider.InvoiceAmount(order.PaymentAmount)
+	}
+	if !ok || err != nil || paid.Currency != expectedCurrency || paid.TotalAmount != expectedAmount {
+		callback.Result = store.CallbackResultAmountMismatch
+		callback.Error = fmt.Sprintf("charged %d %s, invoice %d %s", paid.TotalAmount, paid.Currency, expectedAmount, expectedCurrency)
+		if err != nil {
+			callback.Error += ": " + err.Error()
+		}
+		logger.Warn("Telegram payment does not match order", "order_id", order.ID,
+			"charge_id", paid.TelegramPaymentChargeID, "currency", paid.Currency, "amount", paid.TotalAmount,
+			"expected_currency", expectedCurrency, "expected_amount", expectedAmount, "error", err)
+		b.holdTelegramPayment(order, paid, displayName)
+		b.sendError(message.Chat.ID, b.msg.Get(lang, "payment_processing_failed"))
+		return
+	}
+
+	code, err := store.CompletePaidOrder(b.db, order, providerName, paid.TelegramPaymentChargeID)
+	if err != nil {
+		if err == store.ErrOrderNotPending {
+			// Expired, cancelled or already paid, possibly while the user paid
+			if err := b.db.Select("status").First(order, order.ID).Error; err != nil {
+				logger.Error("Failed to reload order", "order_id", order.ID, "error", err)
+			}
+			b.creditLateTelegramPayment(message.Chat.ID, user, order, providerName, displayName, paid, callback, lang)
+			return
+		}
+		logger.Error("Failed to process telegram payment", "order_id", order.ID, "error", err,
+			"charge_id", paid.TelegramPaymentChargeID)
+		callback.Result = store.CallbackResultFailed
+		callback.Error = err.Error()
+		b.sendError(message.Chat.ID, b.msg.Get(lang, "payment_processing_failed"))
+		return
+	}
+	callback.Result = store.CallbackResultProcessed
+
+	metrics.OrdersPaid.Inc()
+	logger.Info("Order payment confirmed", "order_id", order.ID, "provider", providerName,
+		"charge_id", paid.TelegramPaymentChargeID, "currency", paid.Currency, "amount", paid.TotalAmount)
+
+	// Deliver the result to the user
+	money := b.currency.ForUser(user)
+	productName := "余额充值"
+	switch {
+	case order.Status == "paid_no_stock":
+		metrics.OrdersNoStock.Inc()
+		productName = order.Product.Name
+		b.api.Send(tgbotapi.NewMessage(message.Chat.ID, b.msg.Format(lang, "no_stock", map[string]interface{}{
+			"OrderID":     order.ID,
+			"ProductName": productName,
+		})))
+	case order.ProductID != nil:
+		metrics.OrdersDelivered.Inc()
+		productName = order.Product.Name
+		msg := tgbotapi.NewMessage(message.Chat.ID, b.msg.Format(lang, "order_paid", map[string]interface{}{
+			"OrderID":     order.ID,
+			"ProductName": productName,
+			"Code":        code,
+		}))
+		msg.ParseMode = "Markdown"
+		b.api.Send(msg)
+	default:
+		newBalance, _ := store.GetUserBalance(b.db, user.ID)
+		b.api.Send(tgbotapi.NewMessage(message.Chat.ID, b.msg.Format(lang, "deposit_paid", map[string]interface{}{
+			"OrderID":    order.ID,
+			"Amount":     money.Format(order.AmountCents),
+			"NewBalance": money.Format(newBalance),
+		})))
+	}
+
+	// Notify admins
+	if b.notification != nil {
+		b.notification.NotifyAdmins(notification.EventOrderPaid, map[string]interface{}{
+			"order_id":       order.ID,
+			"user_id":        order.UserID,
+			"product_name":   productName,
+			"amount":         order.AmountCents,
+			"payment_method": fmt.Sprintf("%s (%d %s)", displayName, paid.TotalAmount, paid.Currency),
+		})
+
+		if order.Status == "paid_no_stock" {
+			b.notification.NotifyAdmins(notification.EventNoStock, map[string]interface{}{
+				"order_id":     order.ID,
+				"product_name": productName,
+				"user_id":      order.UserID,
+				"amount":       order.AmountCents,
+			})
+		}
+	}
+}
+
+// creditLateTelegramPayment credits a charge for an order that no longer
+// awaits payment to the user's balance. The order expired or was cancelled
+// before the payment arrived, or its invoice was paid twice.
+func (b *Bot) creditLateTelegramPayment(chatID int64, user *store.User, order *store.Order, providerName, displayName string, paid *tgbotapi.SuccessfulPayment, callback *store.PaymentCallback, lang string) {
+	status := order.Status
+	if err := store.CreditLatePayment(b.db, order, providerName, paid.TelegramPaymentChargeID, order.PaymentAmount); err != nil {
+		if err == store.ErrLatePaymentCredited {
+			logger.Info("Order already processed", "order_id", order.ID, "charge_id", paid.TelegramPaymentChargeID)
+			callback.Result = store.CallbackResultDuplicate
+			return
+		}
+		logger.Error("Failed to credit late telegram payment", "order_id", order.ID, "error", err,
+			"charge_id", paid.TelegramPaymentChargeID)
+		callback.Result = store.CallbackResultFailed
+		callback.Error = err.Error()
+		b.sendError(chatID, b.msg.Get(lang, "payment_processing_failed"))
+		return
+	}
+
+	logger.Warn("Telegram payment for order no longer pending, credited to balance",
+		"order_id", order.ID, "status", status, "amount", order.PaymentAmount, "charge_id", paid.TelegramPaymentChargeID)
+	callback.Result = store.CallbackResultProcessed
+	callback.Error = "order " + status + ", credited to balance"
+
+	key := "payment_extra_credited"
+	if status == "expired" || status == store.OrderStatusCancelled {
+		key = "payment_late_credited"
+	}
+	b.api.Send(tgbotapi.NewMessage(chatID, b.msg.Format(lang, key, map[string]interface{}{
+		"OrderID":  order.ID,
+		"Credited": b.currency.ForUser(user).Format(order.PaymentAmount),
+	})))
+
+	if b.notification != nil {
+		b.notification.NotifyAdmins(notification.EventLatePayment, map[string]interface{}{
+			"order_id":       order.ID,
+			"user_id":        order.UserID,
+			"status":         status,
+			"amount":         order.PaymentAmount,
+			"payment_method": fmt.Sprintf("%s (%d %s)", displayName, paid.TotalAmount, paid.Currency),
+			"trade_no":       paid.TelegramPaymentChargeID,
+		})
+	}
+}
+
+// holdTelegramPayment alerts admins to a charge that does not match its
+// order, which is left for them to settle by hand
+func (b *Bot) holdTelegramPayment(order *store.Order, paid *tgbotapi.SuccessfulPayment, displayName string) {
+	if b.notification == nil {
+		return
+	}
+	b.notification.NotifyAdmins(notification.EventPaymentMismatch, map[string]interface{}{
+		"order_id":       order.ID,
+		"user_id":        order.UserID,
+		"due":            order.PaymentAmount,
+		"received_text":  fmt.Sprintf("%d %s", paid.TotalAmount, paid.Currency),
+		"payment_method": displayName,
+		"handling":       "未处理，请核对后在管理后台为用户补发或退款",
+	})
+}
+
+// recordTelegramPayment stores a Telegram payment with its outcome in the
+// payment callback log, next to the callbacks of other providers
+func (b *Bot) recordTelegramPayment(callback *store.PaymentCallback) {
+	if callback.Result == store.CallbackResultFailed || callback.Result == store.CallbackResultOrderNotFound ||
+		callback.Result == store.CallbackResultAmountMismatch {
+		metrics.PaymentCallbacksFailed.Inc()
+	}
+	if err := store.CreatePaymentCallback(b.db, callback); err != nil {
+		logger.Error("Failed to store telegram payment", "order_id", callback.OrderID, "error", err)
+	}
+}
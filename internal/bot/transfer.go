@@ -0,0 +1,324 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"shop-bot/internal/bot/messages"
+	"shop-bot/internal/currency"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// pendingTransfer holds a transfer that is waiting for user input or confirmation
+type pendingTransfer struct {
+	RecipientID   uint
+	RecipientName string
+	AmountCents   int
+	CreatedAt     time.Time
+}
+
+// transferConfirmTTL is how long a transfer confirmation stays valid
+const transferConfirmTTL = 10 * time.Minute
+
+// transferDisplayName returns a human readable name for a transfer party
+func transferDisplayName(user *store.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	if user.TgUsername != "" {
+		return "@" + user.TgUsername
+	}
+	return fmt.Sprintf("ID %d", user.TgUserID)
+}
+
+// handleTransferStart starts the balance transfer flow
+func (b *Bot) handleTransferStart(chatID int64, from *tgbotapi.User) {
+	user, err := store.GetOrCreateUser(b.db, from.ID, from.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, from.LanguageCode)
+
+	limits := store.GetTransferLimits(b.db)
+	if !limits.Enabled {
+		b.sendError(chatID, b.msg.Get(lang, "transfer_disabled"))
+		return
+	}
+
+	b.userStatesMutex.Lock()
+	b.userStates[from.ID] = "awaiting_transfer_recipient"
+	delete(b.pendingTransfers, from.ID)
+	b.userStatesMutex.Unlock()
+
+	msg := tgbotapi.NewMessage(chatID, b.msg.Get(lang, "transfer_enter_recipient"))
+	msg.ParseMode = "Markdown"
+	b.api.Send(msg)
+}
+
+// handleTransferRecipient handles the recipient input of the transfer flow
+func (b *Bot) handleTransferRecipient(message *tgbotapi.Message) {
+	user, err := store.GetOrCreateUser(b.db, message.From.ID, message.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, message.From.LanguageCode)
+
+	input := strings.TrimSpace(message.Text)
+	if isCancelText(input) {
+		b.cancelTransfer(message.Chat.ID, message.From.ID, lang)
+		return
+	}
+
+	recipient, err := store.FindUserByIdentifier(b.db, input)
+	if err != nil {
+		if err != store.ErrRecipientNotFound {
+			logger.Error("Failed to look up transfer recipient", "error", err, "input", input)
+		}
+		b.sendError(message.Chat.ID, b.msg.Get(lang, "transfer_recipient_not_found"))
+		return
+	}
+
+	if recipient.ID == user.ID {
+		b.sendError(message.Chat.ID, b.msg.Get(lang, "transfer_to_self"))
+		return
+	}
+
+	b.userStatesMutex.Lock()
+	b.userStates[message.From.ID] = "awaiting_transfer_amount"
+	b.pendingTransfers[message.From.ID] = &pendingTransfer{
+		RecipientID:   recipient.ID,
+		RecipientName: transferDisplayName(recipient),
+		CreatedAt:     time.Now(),
+	}
+	b.userStatesMutex.Unlock()
+
+	limits := store.GetTransferLimits(b.db)
+	balance, _ := store.GetUserBalance(b.db, user.ID)
+	money := b.currency.ForUser(user)
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, b.msg.Format(lang, "transfer_enter_amount", map[string]interface{}{
+		"Recipient": transferDisplayName(recipient),
+		"Balance":   money.Format(balance),
+		"Min":       money.Format(limits.MinCents),
+		"Remaining": money.Format(b.remainingTransferToday(user.ID, limits)),
+		"Currency":  money.Base.Code, // Amounts are entered in the base currency
+	}))
+	b.api.Send(msg)
+}
+
+// handleTransferAmount handles the amount input and asks for confirmation
+func (b *Bot) handleTransferAmount(message *tgbotapi.Message) {
+	user, err := store.GetOrCreateUser(b.db, message.From.ID, message.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, message.From.LanguageCode)
+
+	input := strings.TrimSpace(message.Text)
+	if isCancelText(input) {
+		b.cancelTransfer(message.Chat.ID, message.From.ID, lang)
+		return
+	}
+
+	b.userStatesMutex.RLock()
+	pending := b.pendingTransfers[message.From.ID]
+	b.userStatesMutex.RUnlock()
+
+	if pending == nil {
+		b.clearUserState(message.From.ID)
+		b.sendError(message.Chat.ID, b.msg.Get(lang, "transfer_expired"))
+		return
+	}
+
+	money := b.currency.ForUser(user)
+	amountCents, ok := currency.ParseCents(money.Base.Code, input)
+	if !ok {
+		b.sendError(message.Chat.ID, b.msg.Get(lang, "transfer_invalid_amount"))
+		return
+	}
+
+	limits := store.GetTransferLimits(b.db)
+
+	if amountCents < limits.MinCents {
+		b.sendError(message.Chat.ID, b.msg.Format(lang, "transfer_below_minimum", map[string]interface{}{
+			"Min": money.Format(limits.MinCents),
+		}))
+		return
+	}
+
+	if remaining := b.remainingTransferToday(user.ID, limits); limits.DailyLimitCents > 0 && amountCents > remaining {
+		b.sendError(message.Chat.ID, b.msg.Format(lang, "transfer_daily_limit", map[string]interface{}{
+			"Remaining": money.Format(remaining),
+		}))
+		return
+	}
+
+	balance, _ := store.GetUserBalance(b.db, user.ID)
+	if amountCents > balance {
+		b.sendError(message.Chat.ID, b.msg.Format(lang, "transfer_insufficient_balance", map[string]interface{}{
+			"Balance": money.Format(balance),
+		}))
+		return
+	}
+
+	b.userStatesMutex.Lock()
+	delete(b.userStates, message.From.ID)
+	pending.AmountCents = amountCents
+	pending.CreatedAt = time.Now()
+	b.userStatesMutex.Unlock()
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "transfer_confirm_yes"), "transfer_confirm"),
+			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "transfer_confirm_no"), "transfer_cancel"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, b.msg.Format(lang, "transfer_confirm_prompt", map[string]interface{}{
+		"Recipient": pending.RecipientName,
+		"Amount":    money.Format(amountCents),
+	}))
+	msg.ReplyMarkup = keyboard
+	b.api.Send(msg)
+}
+
+// handleTransferConfirm executes a confirmed transfer
+func (b *Bot) handleTransferConfirm(callback *tgbotapi.CallbackQuery) {
+	user, err := store.GetOrCreateUser(b.db, callback.From.ID, callback.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
+
+	// Take the pending transfer so a double tap cannot execute it twice
+	b.userStatesMutex.Lock()
+	pending := b.pendingTransfers[callback.From.ID]
+	delete(b.pendingTransfers, callback.From.ID)
+	b.userStatesMutex.Unlock()
+
+	// Remove the confirmation buttons
+	b.api.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID,
+		tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	if pending == nil || pending.AmountCents == 0 || time.Since(pending.CreatedAt) > transferConfirmTTL {
+		b.sendError(callback.Message.Chat.ID, b.msg.Get(lang, "transfer_expired"))
+		return
+	}
+
+	money := b.currency.ForUser(user)
+
+	err = store.TransferBalance(b.db, user.ID, pending.RecipientID, pending.AmountCents, "")
+	if err != nil {
+		var errorMsg string
+		switch err {
+		case store.ErrTransferDisabled:
+			errorMsg = b.msg.Get(lang, "transfer_disabled")
+		case store.ErrTransferToSelf:
+			errorMsg = b.msg.Get(lang, "transfer_to_self")
+		case store.ErrRecipientNotFound:
+			errorMsg = b.msg.Get(lang, "transfer_recipient_not_found")
+		case store.ErrTransferBelowMinimum:
+			errorMsg = b.msg.Format(lang, "transfer_below_minimum", map[string]interface{}{
+				"Min": money.Format(store.GetTransferLimits(b.db).MinCents),
+			})
+		case store.ErrTransferDailyLimitExceeded:
+			errorMsg = b.msg.Format(lang, "transfer_daily_limit", map[string]interface{}{
+				"Remaining": money.Format(b.remainingTransferToday(user.ID, store.GetTransferLimits(b.db))),
+			})
+		case store.ErrInsufficientBalance:
+			balance, _ := store.GetUserBalance(b.db, user.ID)
+			errorMsg = b.msg.Format(lang, "transfer_insufficient_balance", map[string]interface{}{
+				"Balance": money.Format(balance),
+			})
+		default:
+			logger.Error("Failed to transfer balance", "error", err, "from", user.ID, "to", pending.RecipientID)
+			errorMsg = b.msg.Get(lang, "transfer_failed")
+		}
+		b.sendError(callback.Message.Chat.ID, errorMsg)
+		return
+	}
+
+	newBalance, _ := store.GetUserBalance(b.db, user.ID)
+
+	msg := tgbotapi.NewMessage(callback.Message.Chat.ID, b.msg.Format(lang, "transfer_success", map[string]interface{}{
+		"Recipient":  pending.RecipientName,
+		"Amount":     money.Format(pending.AmountCents),
+		"NewBalance": money.Format(newBalance),
+	}))
+	b.api.Send(msg)
+
+	// Notify the recipient
+	var recipient store.User
+	if err := b.db.First(&recipient, pending.RecipientID).Error; err == nil {
+		recipientLang := messages.GetUserLanguage(recipient.Language, "")
+		recipientMoney := b.currency.ForUser(&recipient)
+		recipientBalance, _ := store.GetUserBalance(b.db, recipient.ID)
+		notice := tgbotapi.NewMessage(recipient.TgUserID, b.msg.Format(recipientLang, "transfer_received", map[string]interface{}{
+			"Sender":     transferDisplayName(user),
+			"Amount":     recipientMoney.Format(pending.AmountCents),
+			"NewBalance": recipientMoney.Format(recipientBalance),
+		}))
+		if _, err := b.api.Send(notice); err != nil {
+			logger.Warn("Failed to notify transfer recipient", "error", err, "recipient_id", recipient.ID)
+		}
+	}
+
+	logger.Info("Balance transferred", "from", user.ID, "to", pending.RecipientID, "amount", pending.AmountCents)
+}
+
+// handleTransferCancel cancels a pending transfer from the confirmation buttons
+func (b *Bot) handleTransferCancel(callback *tgbotapi.CallbackQuery) {
+	user, _ := store.GetOrCreateUser(b.db, callback.From.ID, callback.From.UserName)
+	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
+
+	b.api.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID,
+		tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	b.cancelTransfer(callback.Message.Chat.ID, callback.From.ID, lang)
+}
+
+// cancelTransfer clears any transfer state for the user
+func (b *Bot) cancelTransfer(chatID int64, tgUserID int64, lang string) {
+	b.userStatesMutex.Lock()
+	delete(b.userStates, tgUserID)
+	delete(b.pendingTransfers, tgUserID)
+	b.userStatesMutex.Unlock()
+
+	msg := tgbotapi.NewMessage(chatID, b.msg.Get(lang, "transfer_cancelled"))
+	b.api.Send(msg)
+}
+
+// remainingTransferToday returns how much the user may still send today
+func (b *Bot) remainingTransferToday(userID uint, limits store.TransferLimits) int {
+	if limits.DailyLimitCents <= 0 {
+		balance, _ := store.GetUserBalance(b.db, userID)
+		return balance
+	}
+
+	sentToday, err := store.GetTransferredToday(b.db, userID)
+	if err != nil {
+		logger.Error("Failed to get today's transfers", "error", err, "user_id", userID)
+	}
+
+	remaining := limits.DailyLimitCents - sentToday
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining
+}
+
+// isCancelText checks whether the input asks to abort the current flow
+func isCancelText(text string) bool {
+	return text == "/cancel" || text == "取消" || strings.EqualFold(text, "cancel")
+}
@@ -0,0 +1,307 @@
+package bot
+
+import (
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"shop-bot/internal/bot/messages"
+	"shop-bot/internal/currency"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/notification"
+	"shop-bot/internal/store"
+)
+
+// pendingWithdrawal holds a withdrawal that is waiting for user input or confirmation
+type pendingWithdrawal struct {
+	AmountCents   int
+	PayoutMethod  string
+	PayoutAccount string
+	CreatedAt     time.Time
+}
+
+// withdrawPayoutMethods lists the payout methods offered to users, in display order
+var withdrawPayoutMethods = []string{"alipay", "wechat", "bank", "usdt"}
+
+// handleWithdrawStart starts the withdrawal flow
+func (b *Bot) handleWithdrawStart(chatID int64, from *tgbotapi.User) {
+	user, err := store.GetOrCreateUser(b.db, from.ID, from.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, from.LanguageCode)
+
+	limits := store.GetWithdrawalLimits(b.db)
+	if !limits.Enabled {
+		b.sendError(chatID, b.msg.Get(lang, "withdraw_disabled"))
+		return
+	}
+
+	money := b.currency.ForUser(user)
+
+	if pending, err := store.GetPendingWithdrawal(b.db, user.ID); err == nil {
+		b.sendError(chatID, b.msg.Format(lang, "withdraw_pending_exists", map[string]interface{}{
+			"ID":     pending.ID,
+			"Amount": money.Format(pending.AmountCents),
+		}))
+		return
+	}
+
+	b.userStatesMutex.Lock()
+	b.userStates[from.ID] = "awaiting_withdraw_amount"
+	delete(b.pendingWithdrawals, from.ID)
+	b.userStatesMutex.Unlock()
+
+	balance, _ := store.GetUserBalance(b.db, user.ID)
+
+	msg := tgbotapi.NewMessage(chatID, b.msg.Format(lang, "withdraw_enter_amount", map[string]interface{}{
+		"Balance":  money.Format(balance),
+		"Min":      money.Format(limits.MinCents),
+		"Currency": money.Base.Code, // Amounts are entered in the base currency
+	}))
+	msg.ParseMode = "Markdown"
+	b.api.Send(msg)
+}
+
+// handleWithdrawAmount handles the amount input and asks for the payout method
+func (b *Bot) handleWithdrawAmount(message *tgbotapi.Message) {
+	user, err := store.GetOrCreateUser(b.db, message.From.ID, message.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, message.From.LanguageCode)
+
+	input := strings.TrimSpace(message.Text)
+	if isCancelText(input) {
+		b.cancelWithdraw(message.Chat.ID, message.From.ID, lang)
+		return
+	}
+
+	money := b.currency.ForUser(user)
+	amountCents, ok := currency.ParseCents(money.Base.Code, input)
+	if !ok {
+		b.sendError(message.Chat.ID, b.msg.Get(lang, "withdraw_invalid_amount"))
+		return
+	}
+
+	limits := store.GetWithdrawalLimits(b.db)
+
+	if amountCents < limits.MinCents {
+		b.sendError(message.Chat.ID, b.msg.Format(lang, "withdraw_below_minimum", map[string]interface{}{
+			"Min": money.Format(limits.MinCents),
+		}))
+		return
+	}
+
+	balance, _ := store.GetUserBalance(b.db, user.ID)
+	if amountCents > balance {
+		b.sendError(message.Chat.ID, b.msg.Format(lang, "withdraw_insufficient_balance", map[string]interface{}{
+			"Balance": money.Format(balance),
+		}))
+		return
+	}
+
+	b.userStatesMutex.Lock()
+	delete(b.userStates, message.From.ID)
+	b.pendingWithdrawals[message.From.ID] = &pendingWithdrawal{
+		AmountCents: amountCents,
+		CreatedAt:   time.Now(),
+	}
+	b.userStatesMutex.Unlock()
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, method := range withdrawPayoutMethods {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "withdraw_method_"+method), "withdraw_method_"+method),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "withdraw_confirm_no"), "withdraw_cancel"),
+	))
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, b.msg.Get(lang, "withdraw_choose_method"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.api.Send(msg)
+}
+
+// handleWithdrawMethod stores the chosen payout method and asks for account details
+func (b *Bot) handleWithdrawMethod(callback *tgbotapi.CallbackQuery) {
+	user, _ := store.GetOrCreateUser(b.db, callback.From.ID, callback.From.UserName)
+	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
+
+	method := strings.TrimPrefix(callback.Data, "withdraw_method_")
+
+	b.api.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID,
+		tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	b.userStatesMutex.Lock()
+	pending := b.pendingWithdrawals[callback.From.ID]
+	if pending != nil {
+		pending.PayoutMethod = method
+		b.userStates[callback.From.ID] = "awaiting_withdraw_account"
+	}
+	b.userStatesMutex.Unlock()
+
+	if pending == nil {
+		b.sendError(callback.Message.Chat.ID, b.msg.Get(lang, "withdraw_expired"))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(callback.Message.Chat.ID, b.msg.Format(lang, "withdraw_enter_account", map[string]interface{}{
+		"Method": b.msg.Get(lang, "withdraw_method_"+method),
+	}))
+	b.api.Send(msg)
+}
+
+// handleWithdrawAccount handles the payout account input and asks for confirmation
+func (b *Bot) handleWithdrawAccount(message *tgbotapi.Message) {
+	user, err := store.GetOrCreateUser(b.db, message.From.ID, message.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, message.From.LanguageCode)
+
+	input := strings.TrimSpace(message.Text)
+	if isCancelText(input) {
+		b.cancelWithdraw(message.Chat.ID, message.From.ID, lang)
+		return
+	}
+	if input == "" || len([]rune(input)) > 500 {
+		b.sendError(message.Chat.ID, b.msg.Get(lang, "withdraw_invalid_account"))
+		return
+	}
+
+	b.userStatesMutex.Lock()
+	delete(b.userStates, message.From.ID)
+	pending := b.pendingWithdrawals[message.From.ID]
+	if pending != nil {
+		pending.PayoutAccount = input
+		pending.CreatedAt = time.Now()
+	}
+	b.userStatesMutex.Unlock()
+
+	if pending == nil {
+		b.sendError(message.Chat.ID, b.msg.Get(lang, "withdraw_expired"))
+		return
+	}
+
+	money := b.currency.ForUser(user)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "withdraw_confirm_yes"), "withdraw_confirm"),
+			tgbotapi.NewInlineKeyboardButtonData(b.msg.Get(lang, "withdraw_confirm_no"), "withdraw_cancel"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, b.msg.Format(lang, "withdraw_confirm_prompt", map[string]interface{}{
+		"Amount":  money.Format(pending.AmountCents),
+		"Method":  b.msg.Get(lang, "withdraw_method_"+pending.PayoutMethod),
+		"Account": pending.PayoutAccount,
+	}))
+	msg.ReplyMarkup = keyboard
+	b.api.Send(msg)
+}
+
+// handleWithdrawConfirm submits a confirmed withdrawal request
+func (b *Bot) handleWithdrawConfirm(callback *tgbotapi.CallbackQuery) {
+	user, err := store.GetOrCreateUser(b.db, callback.From.ID, callback.From.UserName)
+	if err != nil {
+		logger.Error("Failed to get user", "error", err)
+		return
+	}
+
+	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
+
+	// Take the pending withdrawal so a double tap cannot submit it twice
+	b.userStatesMutex.Lock()
+	pending := b.pendingWithdrawals[callback.From.ID]
+	delete(b.pendingWithdrawals, callback.From.ID)
+	b.userStatesMutex.Unlock()
+
+	b.api.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID,
+		tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	if pending == nil || pending.PayoutAccount == "" || time.Since(pending.CreatedAt) > transferConfirmTTL {
+		b.sendError(callback.Message.Chat.ID, b.msg.Get(lang, "withdraw_expired"))
+		return
+	}
+
+	money := b.currency.ForUser(user)
+
+	req, err := store.CreateWithdrawalRequest(b.db, user.ID, pending.AmountCents, pending.PayoutMethod, pending.PayoutAccount)
+	if err != nil {
+		var errorMsg string
+		switch err {
+		case store.ErrWithdrawalDisabled:
+			errorMsg = b.msg.Get(lang, "withdraw_disabled")
+		case store.ErrWithdrawalBelowMinimum:
+			errorMsg = b.msg.Format(lang, "withdraw_below_minimum", map[string]interface{}{
+				"Min": money.Format(store.GetWithdrawalLimits(b.db).MinCents),
+			})
+		case store.ErrWithdrawalMissingAccount:
+			errorMsg = b.msg.Get(lang, "withdraw_invalid_account")
+		case store.ErrWithdrawalPendingExists:
+			errorMsg = b.msg.Get(lang, "withdraw_pending_exists_short")
+		case store.ErrInsufficientBalance:
+			balance, _ := store.GetUserBalance(b.db, user.ID)
+			errorMsg = b.msg.Format(lang, "withdraw_insufficient_balance", map[string]interface{}{
+				"Balance": money.Format(balance),
+			})
+		default:
+			logger.Error("Failed to create withdrawal request", "error", err, "user_id", user.ID)
+			errorMsg = b.msg.Get(lang, "withdraw_failed")
+		}
+		b.sendError(callback.Message.Chat.ID, errorMsg)
+		return
+	}
+
+	newBalance, _ := store.GetUserBalance(b.db, user.ID)
+
+	msg := tgbotapi.NewMessage(callback.Message.Chat.ID, b.msg.Format(lang, "withdraw_submitted", map[string]interface{}{
+		"ID":         req.ID,
+		"Amount":     money.Format(req.AmountCents),
+		"NewBalance": money.Format(newBalance),
+	}))
+	b.api.Send(msg)
+
+	if b.notification != nil {
+		b.notification.NotifyAdmins(notification.EventWithdrawalRequested, map[string]interface{}{
+			"withdrawal_id":  req.ID,
+			"user_id":        user.ID,
+			"amount":         req.AmountCents,
+			"payout_method":  req.PayoutMethod,
+			"payout_account": req.PayoutAccount,
+		})
+	}
+
+	logger.Info("Withdrawal requested", "withdrawal_id", req.ID, "user_id", user.ID, "amount", req.AmountCents)
+}
+
+// handleWithdrawCancel cancels a pending withdrawal from the inline buttons
+func (b *Bot) handleWithdrawCancel(callback *tgbotapi.CallbackQuery) {
+	user, _ := store.GetOrCreateUser(b.db, callback.From.ID, callback.From.UserName)
+	lang := messages.GetUserLanguage(user.Language, callback.From.LanguageCode)
+
+	b.api.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID,
+		tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	b.cancelWithdraw(callback.Message.Chat.ID, callback.From.ID, lang)
+}
+
+// cancelWithdraw clears any withdrawal state for the user
+func (b *Bot) cancelWithdraw(chatID int64, tgUserID int64, lang string) {
+	b.userStatesMutex.Lock()
+	delete(b.userStates, tgUserID)
+	delete(b.pendingWithdrawals, tgUserID)
+	b.userStatesMutex.Unlock()
+
+	msg := tgbotapi.NewMessage(chatID, b.msg.Get(lang, "withdraw_cancelled"))
+	b.api.Send(msg)
+}
@@ -34,6 +34,10 @@ type Config struct {
 	EpayPID     string `envconfig:"EPAY_PID" default:""`
 	EpayKey     string `envconfig:"EPAY_KEY" default:""`
 	EpayGateway string `envconfig:"EPAY_GATEWAY" default:""`
+	EpaySignType string `envconfig:"EPAY_SIGN_TYPE" default:"MD5"` // MD5 (legacy key) or RSA (V2 API)
+	EpayPrivateKey string `envconfig:"EPAY_PRIVATE_KEY" default:""` // Merchant RSA private key for the V2 API
+	EpayPlatformPublicKey string `envconfig:"EPAY_PLATFORM_PUBLIC_KEY" default:""` // Platform RSA public key for the V2 API
+	TelegramPaymentToken string `envconfig:"TELEGRAM_PAYMENT_TOKEN" default:""` // Provider token from @BotFather for Telegram Payments
 	BaseURL     string `envconfig:"BASE_URL" default:"http://localhost:7832"`
 	
 	// Webhook configuration
@@ -86,7 +90,7 @@ type Config struct {
 	EnableUserAgentCheck    bool   `envconfig:"ENABLE_USER_AGENT_CHECK" default:"true"`
 	
 	// Data security
-	DataEncryptionKey       string `envconfig:"DATA_ENCRYPTION_KEY" default:""` // If empty, will be generated
+	DataEncryptionKey       string `envconfig:"DATA_ENCRYPTION_KEY" default:""` // Encrypts stored codes, plaintext if empty
 	EnableSecurityLogging   bool   `envconfig:"ENABLE_SECURITY_LOGGING" default:"true"`
 	MaskSensitiveData       bool   `envconfig:"MASK_SENSITIVE_DATA" default:"true"`
 	
@@ -86,6 +86,26 @@ func (m *Manager) LoadFromDatabase() error {
 		logger.Info("Loaded epay_gateway from database")
 	}
 
+	if val, ok := settings["epay_sign_type"]; ok && val != "" {
+		m.config.EpaySignType = val
+		logger.Info("Loaded epay_sign_type from database", "sign_type", val)
+	}
+
+	if val, ok := settings["epay_private_key"]; ok && val != "" {
+		m.config.EpayPrivateKey = val
+		logger.Info("Loaded epay_private_key from database")
+	}
+
+	if val, ok := settings["epay_platform_public_key"]; ok && val != "" {
+		m.config.EpayPlatformPublicKey = val
+		logger.Info("Loaded epay_platform_public_key from database")
+	}
+
+	if val, ok := settings["telegram_payment_token"]; ok && val != "" {
+		m.config.TelegramPaymentToken = val
+		logger.Info("Loaded telegram_payment_token from database")
+	}
+
 	if val, ok := settings["base_url"]; ok {
 		m.config.BaseURL = val
 		logger.Info("Loaded base_url from database")
@@ -117,7 +137,7 @@ func (m *Manager) UpdateAndReload(updates map[string]string) error {
 
 	for key, value := range updates {
 		// Skip masked values
-		if strings.Contains(value, "*") && (key == "admin_token" || key == "bot_token" || key == "epay_key") {
+		if strings.Contains(value, "*") && (key == "admin_token" || key == "bot_token" || key == "epay_key" || key == "epay_private_key" || key == "telegram_payment_token") {
 			continue
 		}
 
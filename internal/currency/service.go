@@ -0,0 +1,236 @@
+package currency
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"shop-bot/internal/config"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// Currency describes a currency that can be used for display
+type Currency struct {
+	Code   string
+	Symbol string
+	Name   string
+}
+
+// Supported lists the currencies offered in the admin panel
+var Supported = []Currency{
+	{"CNY", "¥", "人民币"},
+	{"USD", "$", "美元"},
+	{"EUR", "€", "欧元"},
+	{"GBP", "£", "英镑"},
+	{"JPY", "¥", "日元"},
+	{"KRW", "₩", "韩元"},
+	{"HKD", "HK$", "港币"},
+	{"TWD", "NT$", "新台币"},
+	{"SGD", "S$", "新加坡元"},
+	{"AUD", "A$", "澳元"},
+	{"CAD", "C$", "加元"},
+	{"THB", "฿", "泰铢"},
+	{"MYR", "RM", "马来西亚令吉"},
+	{"PHP", "₱", "菲律宾比索"},
+	{"IDR", "Rp", "印尼盾"},
+	{"VND", "₫", "越南盾"},
+	{"INR", "₹", "印度卢比"},
+	{"RUB", "₽", "俄罗斯卢布"},
+	{"BRL", "R$", "巴西雷亚尔"},
+	{"MXN", "MX$", "墨西哥比索"},
+}
+
+// zeroDecimal lists currencies without minor units, including Telegram
+// Stars (XTR)
+var zeroDecimal = map[string]bool{
+	"JPY": true,
+	"KRW": true,
+	"VND": true,
+	"XTR": true,
+}
+
+// Decimals returns how many decimals amounts in a currency have
+func Decimals(code string) int {
+	if zeroDecimal[strings.ToUpper(code)] {
+		return 0
+	}
+	return 2
+}
+
+// Lookup returns the supported currency with the given code
+func Lookup(code string) (Currency, bool) {
+	code = strings.ToUpper(code)
+	for _, c := range Supported {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return Currency{}, false
+}
+
+// Service formats amounts stored in base currency cents.
+// Settlement always happens in the base currency; other currencies
+// are display only and converted with admin-maintained rates.
+type Service struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+// NewService creates a new currency service
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	return &Service{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// Base returns the shop base (settlement) currency
+func (s *Service) Base() Currency {
+	code, symbol := store.GetCurrencySettings(s.db, s.config)
+	base := Currency{Code: code, Symbol: symbol}
+	if known, ok := Lookup(code); ok {
+		base.Name = known.Name
+	}
+	return base
+}
+
+// Available returns the base currency followed by all active display currencies
+func (s *Service) Available() []Currency {
+	base := s.Base()
+	result := []Currency{base}
+
+	rates, err := store.GetActiveExchangeRates(s.db)
+	if err != nil {
+		logger.Error("Failed to load exchange rates", "error", err)
+		return result
+	}
+
+	for _, rate := range rates {
+		if rate.Currency == base.Code {
+			continue
+		}
+		result = append(result, currencyFromRate(&rate))
+	}
+	return result
+}
+
+// For returns a formatter for the given display currency. Unknown or
+// inactive currencies fall back to the base currency.
+func (s *Service) For(code string) Formatter {
+	base := s.Base()
+	f := Formatter{Base: base, Display: base, Rate: 1}
+
+	code = strings.ToUpper(code)
+	if code == "" || code == base.Code {
+		return f
+	}
+
+	rate, err := store.GetExchangeRate(s.db, code)
+	if err != nil {
+		if err != store.ErrExchangeRateNotFound {
+			logger.Error("Failed to load exchange rate", "error", err, "currency", code)
+		}
+		return f
+	}
+
+	f.Display = currencyFromRate(rate)
+	f.Rate = rate.Rate
+	return f
+}
+
+// ForUser returns a formatter for the user's preferred display currency
+func (s *Service) ForUser(user *store.User) Formatter {
+	if user == nil {
+		return s.For("")
+	}
+	return s.For(user.DisplayCurrency)
+}
+
+// Format formats base currency cents in the base currency
+func (s *Service) Format(cents int) string {
+	base := s.Base()
+	return FormatCents(base.Code, base.Symbol, cents)
+}
+
+// Formatter formats base currency cents for one display currency
+type Formatter struct {
+	Base    Currency
+	Display Currency
+	Rate    float64
+}
+
+// Converted reports whether amounts are shown in a currency other than the base
+func (f Formatter) Converted() bool {
+	return f.Display.Code != f.Base.Code
+}
+
+// Format returns the amount in the display currency, followed by the
+// settlement amount when the two differ, e.g. "≈$1.40 (¥10.00)"
+func (f Formatter) Format(cents int) string {
+	if !f.Converted() {
+		return FormatCents(f.Base.Code, f.Base.Symbol, cents)
+	}
+	return fmt.Sprintf("%s (%s)", f.Short(cents), FormatCents(f.Base.Code, f.Base.Symbol, cents))
+}
+
+// Short returns the amount in the display currency only, e.g. "≈$1.40"
+func (f Formatter) Short(cents int) string {
+	if !f.Converted() {
+		return FormatCents(f.Base.Code, f.Base.Symbol, cents)
+	}
+	converted := int(math.Round(float64(cents) * f.Rate))
+	return "≈" + FormatCents(f.Display.Code, f.Display.Symbol, converted)
+}
+
+// FormatCents formats cents, hundredths of a currency unit, with a currency
+// symbol and the decimals of the currency, e.g. "¥10.00" for CNY and "¥10"
+// for JPY
+func FormatCents(code, symbol string, cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%s%.*f", sign, symbol, Decimals(code), float64(cents)/100)
+}
+
+// MinorUnits converts cents into the smallest unit of a currency, which
+// payment APIs take, rounding up so the shop never receives less
+func MinorUnits(code string, cents int) int {
+	scale := int(math.Pow10(2 - Decimals(code)))
+	return (cents + scale - 1) / scale
+}
+
+// ParseCents parses an amount a user entered in a currency, e.g. "10.5",
+// into cents. Amounts that are not positive or have more decimals than the
+// currency are rejected.
+func ParseCents(code, input string) (int, bool) {
+	input = strings.TrimSpace(input)
+	amount, err := strconv.ParseFloat(input, 64)
+	if err != nil || amount <= 0 || math.IsInf(amount, 0) || amount > math.MaxInt32/100 {
+		return 0, false
+	}
+	if _, fraction, ok := strings.Cut(input, "."); ok && len(fraction) > Decimals(code) {
+		return 0, false
+	}
+	return int(math.Round(amount * 100)), true
+}
+
+// currencyFromRate builds a display currency from an exchange rate row
+func currencyFromRate(rate *store.ExchangeRate) Currency {
+	c := Currency{Code: rate.Currency, Symbol: rate.Symbol}
+	if known, ok := Lookup(rate.Currency); ok {
+		c.Name = known.Name
+		if c.Symbol == "" {
+			c.Symbol = known.Symbol
+		}
+	}
+	if c.Symbol == "" {
+		c.Symbol = c.Code + " "
+	}
+	return c
+}
@@ -0,0 +1,76 @@
+package currency
+
+import "testing"
+
+func TestFormatCents(t *testing.T) {
+	tests := []struct {
+		code, symbol string
+		cents        int
+		want         string
+	}{
+		{"CNY", "¥", 1000, "¥10.00"},
+		{"USD", "$", 1999, "$19.99"},
+		{"USD", "$", -250, "-$2.50"},
+		{"JPY", "¥", 150000, "¥1500"},
+		{"jpy", "¥", 150000, "¥1500"},
+		{"KRW", "₩", 1234500, "₩12345"},
+		{"XTR", "⭐", 5000, "⭐50"},
+	}
+	for _, tt := range tests {
+		if got := FormatCents(tt.code, tt.symbol, tt.cents); got != tt.want {
+			t.Errorf("FormatCents(%s, %d) = %q, want %q", tt.code, tt.cents, got, tt.want)
+		}
+	}
+}
+
+func TestFormatterShowsDisplayCurrencyDecimals(t *testing.T) {
+	f := Formatter{
+		Base:    Currency{Code: "CNY", Symbol: "¥"},
+		Display: Currency{Code: "JPY", Symbol: "JP¥"},
+		Rate:    20.5,
+	}
+	if got, want := f.Format(1000), "≈JP¥205 (¥10.00)"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+}
+
+func TestParseCents(t *testing.T) {
+	tests := []struct {
+		code, input string
+		want        int
+		ok          bool
+	}{
+		{"CNY", "10", 1000, true},
+		{"CNY", " 10.5 ", 1050, true},
+		{"CNY", "0.07", 7, true},
+		{"CNY", "10.555", 0, false},
+		{"CNY", "0", 0, false},
+		{"CNY", "-5", 0, false},
+		{"CNY", "abc", 0, false},
+		{"JPY", "1500", 150000, true},
+		{"JPY", "1500.5", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseCents(tt.code, tt.input)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseCents(%s, %q) = %d, %v, want %d, %v", tt.code, tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		code  string
+		cents int
+		want  int
+	}{
+		{"USD", 1999, 1999},
+		{"JPY", 150000, 1500},
+		{"JPY", 150001, 1501}, // Rounded up
+	}
+	for _, tt := range tests {
+		if got := MinorUnits(tt.code, tt.cents); got != tt.want {
+			t.Errorf("MinorUnits(%s, %d) = %d, want %d", tt.code, tt.cents, got, tt.want)
+		}
+	}
+}
@@ -11,10 +11,7 @@ import (
 
 // handleGetAdminTelegram gets admin telegram ID
 func (s *Server) handleGetAdminTelegram(c *gin.Context) {
-	adminID := c.GetUint("user_id")
-	if adminID == 0 {
-		adminID = 1 // Default admin
-	}
+	adminID := currentAdminID(c)
 
 	var admin store.AdminUser
 	if err := s.db.First(&admin, adminID).Error; err != nil {
@@ -30,10 +27,7 @@ func (s *Server) handleGetAdminTelegram(c *gin.Context) {
 
 // handleSetAdminTelegram sets admin telegram ID
 func (s *Server) handleSetAdminTelegram(c *gin.Context) {
-	adminID := c.GetUint("user_id")
-	if adminID == 0 {
-		adminID = 1 // Default admin
-	}
+	adminID := currentAdminID(c)
 
 	var req struct {
 		TelegramID int64 `json:"telegram_id" binding:"required"`
@@ -45,12 +39,11 @@ func (s *Server) handleSetAdminTelegram(c *gin.Context) {
 	}
 
 	// Update admin telegram ID
-	updates := map[string]interface{}{
-		"telegram_id": req.TelegramID,
-		"receive_notifications": true,
+	if _, err := store.SetAdminTelegramID(s.db, adminID, &req.TelegramID); err != nil {
+		adminUserError(c, err)
+		return
 	}
-
-	if err := s.db.Model(&store.AdminUser{}).Where("id = ?", adminID).Updates(updates).Error; err != nil {
+	if err := s.db.Model(&store.AdminUser{}).Where("id = ?", adminID).Update("receive_notifications", true).Error; err != nil {
 		logger.Error("Failed to update admin telegram ID", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update telegram ID"})
 		return
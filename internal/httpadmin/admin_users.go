@@ -0,0 +1,286 @@
+package httpadmin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"shop-bot/internal/auth"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/security"
+	"shop-bot/internal/store"
+)
+
+// adminPasswords returns the password service enforcing the configured
+// policy, or the default policy when the policy is not enabled
+func (s *Server) adminPasswords() *auth.PasswordService {
+	if s.passwordService != nil {
+		return s.passwordService
+	}
+	return auth.NewPasswordService(nil)
+}
+
+// currentAdminID returns the admin user id of the request. The ADMIN_TOKEN
+// login maps to the first admin user.
+func currentAdminID(c *gin.Context) uint {
+	userID := c.GetString("user_id")
+	if userID == legacyAdminID {
+		return 1
+	}
+	id, _ := strconv.ParseUint(userID, 10, 32)
+	return uint(id)
+}
+
+// adminIDParam parses the :id of an admin user route, writing the error
+// response when it is invalid
+func adminIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// adminUserError writes the response for errors of admin user changes
+func adminUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "admin not found"})
+	case errors.Is(err, store.ErrAdminUsernameTaken), errors.Is(err, store.ErrAdminTelegramIDTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, store.ErrInvalidRole), errors.Is(err, store.ErrLastSuperAdmin),
+		errors.Is(err, store.ErrInvalidAdminUsername):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logger.Error("Failed to update admin user", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// auditAdminChange records a change to an admin user in the logs
+func (s *Server) auditAdminChange(c *gin.Context, action string, admin *store.AdminUser, oldValue, newValue string) {
+	logger.Info("Admin user changed",
+		"action", action,
+		"admin_id", admin.ID,
+		"target", admin.Username,
+		"old", oldValue,
+		"new", newValue,
+		"admin", c.GetString("username"))
+	if s.securityLogger != nil {
+		s.securityLogger.LogAudit(security.SecurityAudit{
+			UserID:    c.GetString("user_id"),
+			Username:  c.GetString("username"),
+			Action:    action,
+			Resource:  "admin_user:" + strconv.FormatUint(uint64(admin.ID), 10),
+			OldValue:  oldValue,
+			NewValue:  newValue,
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+	}
+}
+
+// logoutAdmin ends every session and token of an admin user
+func (s *Server) logoutAdmin(adminID uint) error {
+	if err := store.RevokeAdminSessions(s.db, adminID); err != nil {
+		return err
+	}
+	if s.sessionManager != nil {
+		s.sessionManager.InvalidateUserSessions(strconv.FormatUint(uint64(adminID), 10))
+	}
+	return nil
+}
+
+// handleAdminCreate creates an admin user
+func (s *Server) handleAdminCreate(c *gin.Context) {
+	var req struct {
+		Username   string `json:"username" binding:"required"`
+		Password   string `json:"password" binding:"required"`
+		Email      string `json:"email"`
+		Role       string `json:"role"`
+		TelegramID *int64 `json:"telegram_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = auth.RoleOperator
+	}
+
+	hash, err := s.adminPasswords().HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	admin := store.AdminUser{
+		Username:             req.Username,
+		Password:             hash,
+		Email:                req.Email,
+		Role:                 req.Role,
+		TelegramID:           req.TelegramID,
+		ReceiveNotifications: req.TelegramID != nil,
+	}
+	if err := store.CreateAdminUser(s.db, &admin); err != nil {
+		adminUserError(c, err)
+		return
+	}
+
+	s.auditAdminChange(c, "create_admin", &admin, "", admin.Role)
+	c.JSON(http.StatusOK, gin.H{"message": "admin created", "admin": admin})
+}
+
+// handleAdminActive disables or enables an admin user. Disabling also logs
+// the admin out.
+func (s *Server) handleAdminActive(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Active *bool `json:"active" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if !*req.Active && id == currentAdminID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot disable your own account"})
+		return
+	}
+
+	admin, err := store.SetAdminActive(s.db, id, *req.Active)
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+	if !admin.IsActive {
+		if err := s.logoutAdmin(admin.ID); err != nil {
+			adminUserError(c, err)
+			return
+		}
+	}
+
+	s.auditAdminChange(c, "set_admin_active", admin,
+		strconv.FormatBool(!admin.IsActive), strconv.FormatBool(admin.IsActive))
+	c.JSON(http.StatusOK, gin.H{"message": "admin updated", "admin": admin})
+}
+
+// handleAdminPasswordReset sets a new password for an admin user and logs
+// them out everywhere
+func (s *Server) handleAdminPasswordReset(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	hash, err := s.adminPasswords().HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	admin, err := store.SetAdminPassword(s.db, id, hash)
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+	if err := s.logoutAdmin(admin.ID); err != nil {
+		adminUserError(c, err)
+		return
+	}
+
+	s.auditAdminChange(c, "reset_admin_password", admin, "", "")
+	c.JSON(http.StatusOK, gin.H{"message": "password reset"})
+}
+
+// handleAdminLogout ends every session and token of an admin user
+func (s *Server) handleAdminLogout(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+	if err := s.logoutAdmin(id); err != nil {
+		adminUserError(c, err)
+		return
+	}
+
+	s.auditAdminChange(c, "force_admin_logout", &store.AdminUser{ID: id}, "", "")
+	c.JSON(http.StatusOK, gin.H{"message": "admin logged out"})
+}
+
+// handleAdminTelegram binds an admin user to a Telegram ID for bot admin
+// commands and notifications. A null telegram_id unbinds it.
+func (s *Server) handleAdminTelegram(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		TelegramID *int64 `json:"telegram_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if req.TelegramID != nil && *req.TelegramID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid telegram ID"})
+		return
+	}
+
+	var before store.AdminUser
+	if err := s.db.Select("telegram_id").First(&before, id).Error; err != nil {
+		adminUserError(c, err)
+		return
+	}
+	admin, err := store.SetAdminTelegramID(s.db, id, req.TelegramID)
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+
+	s.auditAdminChange(c, "bind_admin_telegram", admin, formatTelegramID(before.TelegramID), formatTelegramID(admin.TelegramID))
+	c.JSON(http.StatusOK, gin.H{"message": "telegram ID updated", "admin": admin})
+}
+
+// handleAdminDelete deletes an admin user and logs them out
+func (s *Server) handleAdminDelete(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+	if id == currentAdminID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete your own account"})
+		return
+	}
+
+	admin, err := store.DeleteAdminUser(s.db, id)
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+	if s.sessionManager != nil {
+		s.sessionManager.InvalidateUserSessions(strconv.FormatUint(uint64(admin.ID), 10))
+	}
+
+	s.auditAdminChange(c, "delete_admin", admin, admin.Role, "")
+	c.JSON(http.StatusOK, gin.H{"message": "admin deleted"})
+}
+
+func formatTelegramID(id *int64) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatInt(*id, 10)
+}
@@ -0,0 +1,61 @@
+package httpadmin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"shop-bot/internal/auth"
+	"shop-bot/internal/store"
+)
+
+func TestAdminPasswordPolicy(t *testing.T) {
+	db := newTestDB(t)
+	s := newAuditTestServer(db)
+
+	weak := map[string]string{
+		"Sh0rt!":         auth.ErrPasswordTooShort.Error(),
+		"no-upper-1234":  auth.ErrPasswordNoUpper.Error(),
+		"NO-LOWER-1234":  auth.ErrPasswordNoLower.Error(),
+		"No-Digits-Here": auth.ErrPasswordNoDigit.Error(),
+		"NoSpecial1234":  auth.ErrPasswordNoSpecial.Error(),
+	}
+	for password, want := range weak {
+		w := serveAdmin(s.handleAdminCreate, http.MethodPost, `{"username":"weak","password":"`+password+`"}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("password %q: %d %s, want 400 %q", password, w.Code, w.Body, want)
+		}
+	}
+	if _, err := store.GetAdminUserByUsername(db, "weak"); err == nil {
+		t.Fatal("admin created with a weak password")
+	}
+
+	w := serveAdmin(s.handleAdminCreate, http.MethodPost, `{"username":"alice","password":"Blue-Horse-42"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create admin: %d %s", w.Code, w.Body)
+	}
+	alice, err := store.GetAdminUserByUsername(db, "alice")
+	if err != nil {
+		t.Fatalf("load admin: %v", err)
+	}
+	if alice.Role != auth.RoleOperator || alice.Password == "Blue-Horse-42" {
+		t.Errorf("admin = %+v, want a hashed operator", alice)
+	}
+
+	// Resets follow the same policy and keep the old password
+	id := gin.Param{Key: "id", Value: strconv.FormatUint(uint64(alice.ID), 10)}
+	if w := serveAdmin(s.handleAdminPasswordReset, http.MethodPost, `{"password":"weakpass"}`, id); w.Code != http.StatusBadRequest {
+		t.Errorf("reset to a weak password: %d %s, want 400", w.Code, w.Body)
+	}
+	if stored, _ := store.GetAdminUserByUsername(db, "alice"); stored.Password != alice.Password {
+		t.Error("weak reset replaced the password")
+	}
+
+	// The same username cannot be taken twice
+	if w := serveAdmin(s.handleAdminCreate, http.MethodPost, `{"username":"alice","password":"Blue-Horse-43"}`); w.Code != http.StatusConflict {
+		t.Errorf("duplicate username: %d %s, want 409", w.Code, w.Body)
+	}
+}
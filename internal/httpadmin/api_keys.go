@@ -0,0 +1,160 @@
+package httpadmin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"shop-bot/internal/auth"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// apiKeyResource names an API key in the audit log
+func apiKeyResource(id uint) string {
+	return "api_key:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// authenticateAPIKey signs the request in with an API key. The key gets no
+// role: authorize checks its scopes instead.
+func (s *Server) authenticateAPIKey(c *gin.Context, token string) bool {
+	if s.db == nil {
+		return false
+	}
+	key, err := store.GetActiveAPIKey(s.db, auth.HashAPIKey(token))
+	if err != nil {
+		if !errors.Is(err, store.ErrAPIKeyNotFound) {
+			logger.Error("Failed to look up API key", "error", err)
+		}
+		return false
+	}
+	if err := store.TouchAPIKey(s.db, key.ID, c.ClientIP()); err != nil {
+		logger.Error("Failed to record API key use", "error", err, "api_key_id", key.ID)
+	}
+
+	c.Set("api_key_id", key.ID)
+	c.Set("api_key_scopes", key.ScopeList())
+	c.Set("user_id", apiKeyResource(key.ID))
+	c.Set("username", "api:"+key.Name)
+	return true
+}
+
+// denyAPIKeys keeps API keys out of routes that belong to a signed in admin,
+// like their own profile, which no scope covers
+func (s *Server) denyAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not available to API keys"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// apiKeyError writes the response of an API key store error
+func apiKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, store.ErrAPIKeyRevoked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, store.ErrInvalidAPIKeyName), errors.Is(err, store.ErrInvalidAPIKeyScope),
+		errors.Is(err, store.ErrAPIKeyScopeRequired), errors.Is(err, store.ErrAPIKeyExpiry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logger.Error("Failed to update API key", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// handleAPIKeyList shows the API keys and the scopes they can have
+func (s *Server) handleAPIKeyList(c *gin.Context) {
+	keys, err := store.ListAPIKeys(s.db)
+	if err != nil {
+		logger.Error("Failed to load API keys", "error", err)
+		c.String(http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if c.GetHeader("Accept") == "application/json" {
+		c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+		return
+	}
+
+	c.HTML(http.StatusOK, "api_keys.html", gin.H{
+		"keys":      keys,
+		"resources": auth.APIKeyResources(),
+		"now":       time.Now(),
+		"username":  c.GetString("username"),
+	})
+}
+
+// handleAPIKeyCreate creates an API key and returns it. Only its hash is
+// stored, so this is the only time the key is shown.
+func (s *Server) handleAPIKeyCreate(c *gin.Context) {
+	var req struct {
+		Name      string   `json:"name" binding:"required"`
+		Scopes    []string `json:"scopes"`
+		ExpiresAt string   `json:"expires_at"` // YYYY-MM-DD, the key works through that day
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	record := store.APIKey{
+		Name:          req.Name,
+		CreatedBy:     currentAdminID(c),
+		CreatedByName: c.GetString("username"),
+	}
+	if value := strings.TrimSpace(req.ExpiresAt); value != "" {
+		day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expires_at, use YYYY-MM-DD"})
+			return
+		}
+		expiresAt := day.AddDate(0, 0, 1)
+		record.ExpiresAt = &expiresAt
+	}
+
+	key, display, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	record.Prefix = display
+	record.KeyHash = hash
+	if err := store.CreateAPIKey(s.db, &record, req.Scopes); err != nil {
+		apiKeyError(c, err)
+		return
+	}
+
+	logger.Info("API key created", "api_key_id", record.ID, "name", record.Name, "scopes", record.Scopes, "admin", c.GetString("username"))
+	s.auditChange(c, "create_api_key", apiKeyResource(record.ID), nil, record)
+	c.JSON(http.StatusOK, gin.H{"message": "API key created", "key": key, "api_key": record})
+}
+
+// handleAPIKeyRevoke stops an API key from working. Revoked keys stay
+// listed so their use can still be traced.
+func (s *Server) handleAPIKeyRevoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	key, err := store.RevokeAPIKey(s.db, uint(id))
+	if err != nil {
+		apiKeyError(c, err)
+		return
+	}
+
+	logger.Info("API key revoked", "api_key_id", key.ID, "name", key.Name, "admin", c.GetString("username"))
+	s.auditChange(c, "revoke_api_key", apiKeyResource(key.ID), gin.H{"revoked_at": nil}, gin.H{"revoked_at": key.RevokedAt})
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,393 @@
+package httpadmin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/security"
+	"shop-bot/internal/store"
+	"shop-bot/internal/supplier"
+)
+
+// auditIgnoredFields change on every write and say nothing about the change
+var auditIgnoredFields = map[string]bool{
+	"created_at": true, "CreatedAt": true,
+	"updated_at": true, "UpdatedAt": true,
+}
+
+// auditFields flattens a value to its JSON fields. Values that are not
+// objects are kept under "value".
+func auditFields(v interface{}) map[string]interface{} {
+	if auditNil(v) {
+		return map[string]interface{}{}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]interface{}{"value": fmt.Sprint(v)}
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		var value interface{}
+		json.Unmarshal(data, &value)
+		return map[string]interface{}{"value": value}
+	}
+	for key := range fields {
+		if auditIgnoredFields[key] {
+			delete(fields, key)
+		}
+	}
+	return fields
+}
+
+// auditNil reports whether v is nil or a nil pointer, map or slice
+func auditNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// encodeAuditFields returns the JSON of the fields with sensitive values
+// masked, or "" when there are none
+func encodeAuditFields(fields map[string]interface{}) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	for key := range fields {
+		if security.IsSensitiveField(key) {
+			fields[key] = "***"
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// auditDiff returns the JSON of the fields that differ between before and
+// after. before is nil for created resources and after for deleted ones.
+func auditDiff(before, after interface{}) (string, string) {
+	oldFields, newFields := auditFields(before), auditFields(after)
+	if !auditNil(before) && !auditNil(after) {
+		for key, oldValue := range oldFields {
+			if newValue, ok := newFields[key]; ok && reflect.DeepEqual(oldValue, newValue) {
+				delete(oldFields, key)
+				delete(newFields, key)
+			}
+		}
+	}
+	return encodeAuditFields(oldFields), encodeAuditFields(newFields)
+}
+
+// auditChange records a change made by the current admin in the audit log
+// with the fields of the resource that changed
+func (s *Server) auditChange(c *gin.Context, action, resource string, before, after interface{}) {
+	if s.securityLogger == nil {
+		return
+	}
+	oldValue, newValue := auditDiff(before, after)
+	if !auditNil(before) && !auditNil(after) && oldValue == "" && newValue == "" {
+		return // Nothing changed
+	}
+	s.securityLogger.LogAudit(security.SecurityAudit{
+		UserID:    c.GetString("user_id"),
+		Username:  c.GetString("username"),
+		Action:    action,
+		Resource:  resource,
+		OldValue:  oldValue,
+		NewValue:  newValue,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+}
+
+// productResource names a product in the audit log
+func productResource(id uint) string {
+	return "product:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// productSnapshot loads a product to record its state in the audit log, nil
+// when it does not exist
+func (s *Server) productSnapshot(id uint) *store.Product {
+	var product store.Product
+	if err := s.db.First(&product, id).Error; err != nil {
+		return nil
+	}
+	return &product
+}
+
+// auditProductChange records the change of a product since before
+func (s *Server) auditProductChange(c *gin.Context, action string, before *store.Product) {
+	if before == nil {
+		return
+	}
+	s.auditChange(c, action, productResource(before.ID), before, s.productSnapshot(before.ID))
+}
+
+// settingsSnapshot loads the system settings to record them in the audit
+// log, nil when they cannot be loaded
+func (s *Server) settingsSnapshot() map[string]string {
+	settings, err := store.GetSettingsMap(s.db)
+	if err != nil {
+		logger.Error("Failed to load settings for audit log", "error", err)
+		return nil
+	}
+	return settings
+}
+
+// auditSettingsChange records the settings changed since before. Secrets
+// are masked, so the log shows that they changed but not their values.
+func (s *Server) auditSettingsChange(c *gin.Context, action string, before map[string]string) {
+	if before == nil {
+		return
+	}
+	s.auditChange(c, action, "settings", before, s.settingsSnapshot())
+}
+
+// auditCode is the state of a code recorded in the audit log. The code
+// itself is left out so the log does not leak stock.
+func auditCode(code *store.Code) gin.H {
+	if code == nil {
+		return nil
+	}
+	return gin.H{
+		"product_id": code.ProductID,
+		"status":     code.Status,
+		"is_sold":    code.IsSold,
+		"order_id":   code.OrderID,
+		"batch_id":   code.BatchID,
+		"expires_at": code.ExpiresAt,
+	}
+}
+
+// auditCodeImport records codes added to a product. Only the counts are
+// kept, the codes stay out of the log.
+func (s *Server) auditCodeImport(c *gin.Context, action string, productID uint, report *store.CodeUploadReport) {
+	if report.Inserted == 0 {
+		return
+	}
+	s.auditChange(c, action, productResource(productID)+":codes", nil, gin.H{
+		"inserted":   report.Inserted,
+		"duplicates": report.DuplicateCount(),
+		"invalid":    report.Invalid,
+		"batch_id":   report.BatchID,
+	})
+}
+
+// supplierSnapshot loads the supplier of a product to record it in the audit
+// log with its secrets masked, nil when the product has none
+func (s *Server) supplierSnapshot(productID uint) gin.H {
+	config, err := store.GetProductSupplier(s.db, productID)
+	if err != nil {
+		return nil
+	}
+	return gin.H{
+		"type":              config.Type,
+		"config":            supplier.MaskConfig(config.Type, config.Config),
+		"enabled":           config.Enabled,
+		"restock_threshold": config.RestockThreshold,
+		"restock_quantity":  config.RestockQuantity,
+		"on_demand":         config.OnDemand,
+		"unit_cost_cents":   config.UnitCostCents,
+	}
+}
+
+// exchangeRateSnapshot loads the exchange rate of a currency to record it
+// in the audit log, nil when there is none
+func (s *Server) exchangeRateSnapshot(code string) gin.H {
+	var rate store.ExchangeRate
+	if err := s.db.Where("currency = ?", code).First(&rate).Error; err != nil {
+		return nil
+	}
+	return gin.H{
+		"symbol":    rate.Symbol,
+		"rate":      rate.Rate,
+		"is_active": rate.IsActive,
+	}
+}
+
+// rechargeCardSnapshot loads a recharge card to record it in the audit log,
+// nil when it does not exist. The code is left out since it redeems the card.
+func (s *Server) rechargeCardSnapshot(id uint) gin.H {
+	var card store.RechargeCard
+	if err := s.db.First(&card, id).Error; err != nil {
+		return nil
+	}
+	return gin.H{
+		"amount_cents":      card.AmountCents,
+		"max_uses":          card.MaxUses,
+		"max_uses_per_user": card.MaxUsesPerUser,
+		"used_count":        card.UsedCount,
+		"expires_at":        card.ExpiresAt,
+	}
+}
+
+// auditBalance records a change of a user's balance
+func (s *Server) auditBalance(c *gin.Context, action string, userID uint, before, after int, extra gin.H) {
+	oldValue, newValue := gin.H{"balance_cents": before}, gin.H{"balance_cents": after}
+	for key, value := range extra {
+		newValue[key] = value
+	}
+	s.auditChange(c, action, "user:"+strconv.FormatUint(uint64(userID), 10)+":balance", oldValue, newValue)
+}
+
+// ticketResource names a ticket in the audit log
+func ticketResource(id uint) string {
+	return "ticket:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// ticketSnapshot loads the state of a ticket admins change to record it in
+// the audit log, nil when the ticket does not exist
+func (s *Server) ticketSnapshot(id uint) gin.H {
+	var ticket store.Ticket
+	if err := s.db.First(&ticket, id).Error; err != nil {
+		return nil
+	}
+	return gin.H{
+		"status":      ticket.Status,
+		"priority":    ticket.Priority,
+		"assigned_to": ticket.AssignedTo,
+	}
+}
+
+// auditTicketChange records the change of a ticket since before
+func (s *Server) auditTicketChange(c *gin.Context, action string, id uint, before gin.H) {
+	if before == nil {
+		return
+	}
+	s.auditChange(c, action, ticketResource(id), before, s.ticketSnapshot(id))
+}
+
+// auditLogFilter reads the audit log filters of a request. from and to are
+// inclusive dates.
+func auditLogFilter(c *gin.Context) (store.AuditLogFilter, error) {
+	filter := store.AuditLogFilter{
+		Username: strings.TrimSpace(c.Query("username")),
+		Action:   c.Query("action"),
+		Resource: strings.TrimSpace(c.Query("resource")),
+		Query:    strings.TrimSpace(c.Query("q")),
+		Changes:  c.Query("changes") == "1",
+	}
+	if value := c.Query("from"); value != "" {
+		from, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from date, use YYYY-MM-DD")
+		}
+		filter.From = &from
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to date, use YYYY-MM-DD")
+		}
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+	return filter, nil
+}
+
+// handleAuditLogList shows the audit log with filters
+func (s *Server) handleAuditLogList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage := 20
+	offset := (page - 1) * perPage
+
+	filter, err := auditLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logs, total, err := store.ListAuditLogs(s.db, filter, perPage, offset)
+	if err != nil {
+		logger.Error("Failed to fetch audit logs", "error", err)
+		c.String(http.StatusInternalServerError, "Database error")
+		return
+	}
+	totalPages := int(total+int64(perPage)-1) / perPage
+
+	if c.GetHeader("Accept") == "application/json" {
+		c.JSON(http.StatusOK, gin.H{
+			"logs":        logs,
+			"total":       total,
+			"page":        page,
+			"total_pages": totalPages,
+		})
+		return
+	}
+
+	actions, err := store.ListAuditActions(s.db)
+	if err != nil {
+		logger.Error("Failed to fetch audit actions", "error", err)
+	}
+
+	c.HTML(http.StatusOK, "audit_logs.html", gin.H{
+		"logs":       logs,
+		"filter":     filter,
+		"from":       c.Query("from"),
+		"to":         c.Query("to"),
+		"actions":    actions,
+		"page":       page,
+		"totalPages": totalPages,
+		"total":      total,
+		"username":   c.GetString("username"),
+	})
+}
+
+// handleAuditLogExport downloads the filtered audit log as CSV
+func (s *Server) handleAuditLogExport(c *gin.Context) {
+	filter, err := auditLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("audit-log-%s.csv", time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "time", "user_id", "username", "action", "resource", "old_value", "new_value", "ip_address", "user_agent"})
+	count := 0
+	err = store.EachAuditLog(s.db, filter, func(entry store.AuditLog) error {
+		count++
+		return w.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.CreatedAt.Format("2006-01-02 15:04:05"),
+			entry.UserID,
+			entry.Username,
+			entry.Action,
+			entry.Resource,
+			entry.OldValue,
+			entry.NewValue,
+			entry.IPAddress,
+			entry.UserAgent,
+		})
+	})
+	w.Flush()
+	if err != nil {
+		// The response has started, so the file is cut short
+		logger.Error("Failed to export audit logs", "error", err)
+		return
+	}
+
+	logger.Info("Audit log exported", "count", count, "admin", c.GetString("username"))
+}
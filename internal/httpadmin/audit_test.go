@@ -0,0 +1,138 @@
+package httpadmin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"shop-bot/internal/currency"
+	"shop-bot/internal/security"
+	"shop-bot/internal/store"
+)
+
+// newAuditTestServer returns a server that records audit entries in db
+func newAuditTestServer(db *gorm.DB) *Server {
+	securityLogger := security.NewSecurityLogger(true, false)
+	securityLogger.SetAuditRecorder(store.NewAuditRecorder(db))
+	return &Server{db: db, securityLogger: securityLogger, currency: currency.NewService(db, nil)}
+}
+
+// serveAdmin runs handler for a JSON request and returns the response
+func serveAdmin(handler gin.HandlerFunc, method, body string, params ...gin.Param) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	c.Set("username", "root")
+	handler(c)
+	return w
+}
+
+// auditEntries returns the audit log entries of an action
+func auditEntries(t *testing.T, db *gorm.DB, action string) []store.AuditLog {
+	t.Helper()
+	var entries []store.AuditLog
+	if err := db.Where("action = ?", action).Order("id").Find(&entries).Error; err != nil {
+		t.Fatalf("load audit log: %v", err)
+	}
+	return entries
+}
+
+func TestExchangeRateChangesAreAudited(t *testing.T) {
+	db := newTestDB(t)
+	s := newAuditTestServer(db)
+
+	for _, body := range []string{
+		`{"currency":"usd","rate":0.14,"is_active":true}`,
+		`{"currency":"USD","rate":0.15,"is_active":true}`,
+	} {
+		if w := serveAdmin(s.handleCurrencySave, http.MethodPost, body); w.Code != http.StatusOK {
+			t.Fatalf("save rate: %d %s", w.Code, w.Body)
+		}
+	}
+	saves := auditEntries(t, db, "save_exchange_rate")
+	if len(saves) != 2 || saves[0].Resource != "currency:USD" || saves[0].OldValue != "" {
+		t.Fatalf("save entries = %+v", saves)
+	}
+	if saves[1].OldValue != `{"rate":0.14}` || saves[1].NewValue != `{"rate":0.15}` {
+		t.Fatalf("update entry = %q -> %q, want only the rate", saves[1].OldValue, saves[1].NewValue)
+	}
+
+	if w := serveAdmin(s.handleCurrencyDelete, http.MethodDelete, "", gin.Param{Key: "code", Value: "usd"}); w.Code != http.StatusOK {
+		t.Fatalf("delete rate: %d %s", w.Code, w.Body)
+	}
+	deletes := auditEntries(t, db, "delete_exchange_rate")
+	if len(deletes) != 1 || deletes[0].OldValue == "" || deletes[0].NewValue != "" {
+		t.Fatalf("delete entries = %+v", deletes)
+	}
+}
+
+func TestRechargeCardAuditLeavesOutCodes(t *testing.T) {
+	db := newTestDB(t)
+	s := newAuditTestServer(db)
+
+	w := serveAdmin(s.handleRechargeCardGenerate, http.MethodPost, `{"count":2,"amount_cents":500}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("generate: %d %s", w.Code, w.Body)
+	}
+	var cards []store.RechargeCard
+	if err := db.Find(&cards).Error; err != nil || len(cards) != 2 {
+		t.Fatalf("cards = %d, %v", len(cards), err)
+	}
+
+	entries := auditEntries(t, db, "generate_recharge_cards")
+	if len(entries) != 1 || !strings.Contains(entries[0].NewValue, `"count":2`) {
+		t.Fatalf("generate entries = %+v", entries)
+	}
+	for _, card := range cards {
+		if strings.Contains(entries[0].NewValue, card.Code) {
+			t.Fatalf("audit log contains card code %s", card.Code)
+		}
+	}
+}
+
+func TestCodeDeleteRefusesReservedCode(t *testing.T) {
+	db := newTestDB(t)
+	s := newAuditTestServer(db)
+
+	product := store.Product{Name: "reserved", PriceCents: 100, IsActive: true}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	orderID := uint(1)
+	until := time.Now().Add(time.Hour)
+	codes := []store.Code{
+		{ProductID: product.ID, Code: "HELD", Status: store.CodeStatusAvailable, ReservedOrderID: &orderID, ReservedUntil: &until},
+		{ProductID: product.ID, Code: "FREE", Status: store.CodeStatusAvailable},
+	}
+	if err := db.Create(&codes).Error; err != nil {
+		t.Fatalf("create codes: %v", err)
+	}
+	param := func(code store.Code) gin.Param {
+		return gin.Param{Key: "id", Value: strconv.FormatUint(uint64(code.ID), 10)}
+	}
+
+	if w := serveAdmin(s.handleCodeDelete, http.MethodDelete, "", param(codes[0])); w.Code != http.StatusConflict {
+		t.Fatalf("delete reserved code: %d %s", w.Code, w.Body)
+	}
+	if err := db.First(&store.Code{}, codes[0].ID).Error; err != nil {
+		t.Fatalf("reserved code was deleted: %v", err)
+	}
+	if entries := auditEntries(t, db, "delete_code"); len(entries) != 0 {
+		t.Fatalf("refused delete was audited: %+v", entries)
+	}
+
+	if w := serveAdmin(s.handleCodeDelete, http.MethodDelete, "", param(codes[1])); w.Code != http.StatusOK {
+		t.Fatalf("delete code: %d %s", w.Code, w.Body)
+	}
+	if entries := auditEntries(t, db, "delete_code"); len(entries) != 1 {
+		t.Fatalf("delete entries = %+v", entries)
+	}
+}
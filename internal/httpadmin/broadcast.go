@@ -51,13 +51,10 @@ func (s *Server) processBroadcastWithProducts(ctx context.Context, broadcast *st
 		// Get available stock
 		stock, _ := store.CountAvailableCodes(s.db, product.ID)
 		
-		// Get currency symbol
-		_, currencySymbol := store.GetCurrencySettings(s.db, s.config)
-		
-		buttonText := fmt.Sprintf("%s - %s%.2f (%d)", 
+		// Broadcast buttons are shared by all recipients, so use the base currency
+		buttonText := fmt.Sprintf("%s - %s (%d)", 
 			product.Name, 
-			currencySymbol,
-			float64(product.PriceCents)/100, 
+			s.currency.Format(product.PriceCents),
 			stock,
 		)
 		
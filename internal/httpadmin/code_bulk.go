@@ -0,0 +1,282 @@
+package httpadmin
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// codeSelection is the filter of a bulk code operation, sent as query
+// parameters for exports and as JSON for the other operations
+type codeSelection struct {
+	IDs         []uint `json:"ids" form:"ids"`
+	Sold        string `json:"sold" form:"sold"` // true, false or empty for both
+	Status      string `json:"status" form:"status"`
+	CreatedFrom string `json:"created_from" form:"created_from"` // YYYY-MM-DD
+	CreatedTo   string `json:"created_to" form:"created_to"`     // YYYY-MM-DD, inclusive
+}
+
+func (sel codeSelection) filter(productID uint) (store.CodeFilter, error) {
+	filter := store.CodeFilter{ProductID: productID, IDs: sel.IDs}
+
+	switch sel.Sold {
+	case "":
+	case "true", "false":
+		sold := sel.Sold == "true"
+		filter.Sold = &sold
+	default:
+		return filter, errors.New("sold must be true or false")
+	}
+
+	switch sel.Status {
+	case "", store.CodeStatusAvailable, store.CodeStatusQuarantined, store.CodeStatusVoid:
+		filter.Status = sel.Status
+	default:
+		return filter, errors.New("invalid status")
+	}
+
+	if sel.CreatedFrom != "" {
+		t, err := time.ParseInLocation("2006-01-02", sel.CreatedFrom, time.Local)
+		if err != nil {
+			return filter, errors.New("invalid created_from date")
+		}
+		filter.CreatedFrom = &t
+	}
+	if sel.CreatedTo != "" {
+		t, err := time.ParseInLocation("2006-01-02", sel.CreatedTo, time.Local)
+		if err != nil {
+			return filter, errors.New("invalid created_to date")
+		}
+		t = t.Add(24 * time.Hour)
+		filter.CreatedTo = &t
+	}
+	return filter, nil
+}
+
+// codeImportOptions reads the duplicate handling, expiry and batch details
+// of an upload. A date expires the codes at the end of that day, a
+// datetime-local value at that minute. The unit cost is in the base currency.
+func codeImportOptions(c *gin.Context, source string) (store.CodeImportOptions, error) {
+	opts := store.CodeImportOptions{
+		RejectDuplicates: c.PostForm("reject_duplicates") == "true",
+		Batch: store.CodeBatch{
+			Source:    source,
+			Supplier:  strings.TrimSpace(c.PostForm("batch_supplier")),
+			Note:      strings.TrimSpace(c.PostForm("batch_note")),
+			CreatedBy: c.GetString("username"),
+		},
+	}
+	if len([]rune(opts.Batch.Supplier)) > 200 || len([]rune(opts.Batch.Note)) > 500 {
+		return opts, errors.New("batch supplier must be at most 200 and note at most 500 characters")
+	}
+	if cost := strings.TrimSpace(c.PostForm("unit_cost")); cost != "" {
+		value, err := strconv.ParseFloat(cost, 64)
+		if err != nil || value < 0 || math.IsInf(value, 0) {
+			return opts, store.ErrInvalidUnitCost
+		}
+		opts.Batch.UnitCostCents = int(math.Round(value * 100))
+	}
+
+	value := strings.TrimSpace(c.PostForm("expires_at"))
+	if value == "" {
+		return opts, nil
+	}
+	var expiresAt time.Time
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		expiresAt = t.Add(24 * time.Hour)
+	} else if t, err := time.ParseInLocation("2006-01-02T15:04", value, time.Local); err == nil {
+		expiresAt = t
+	} else {
+		return opts, errors.New("invalid expires_at, use YYYY-MM-DD or YYYY-MM-DDTHH:MM")
+	}
+	if !expiresAt.After(time.Now()) {
+		return opts, errors.New("expires_at must be in the future")
+	}
+	opts.ExpiresAt = &expiresAt
+	return opts, nil
+}
+
+// handleCodesBulk moves, voids, quarantines, releases or deletes a selection of codes
+func (s *Server) handleCodesBulk(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req struct {
+		codeSelection
+		Action          string `json:"action" binding:"required"`
+		TargetProductID uint   `json:"target_product_id"`
+		Note            string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	var product store.Product
+	if err := s.db.First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	filter, err := req.filter(product.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Note) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "note too long"})
+		return
+	}
+
+	admin := c.GetString("username")
+	var result *store.CodeBulkResult
+	if req.Action == store.CodeActionMove {
+		result, err = store.MoveCodes(s.db, filter, req.TargetProductID, admin, req.Note)
+	} else {
+		result, err = store.ApplyCodeAction(s.db, filter, req.Action, admin, req.Note)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrEmptyCodeSelection):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, store.ErrInvalidCodeAction), errors.Is(err, store.ErrInvalidMoveTarget):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			logger.Error("Bulk code operation failed", "error", err, "product_id", id, "action", req.Action)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	logger.Info("Bulk code operation",
+		"product_id", id,
+		"action", req.Action,
+		"target_product_id", req.TargetProductID,
+		"affected", result.Affected,
+		"skipped", result.Skipped,
+		"reserved", result.Reserved,
+		"operation_id", result.OperationID,
+		"admin", admin)
+
+	if result.Affected > 0 {
+		s.auditChange(c, "bulk_"+req.Action+"_codes", productResource(product.ID)+":codes", nil, gin.H{
+			"selection":         req.codeSelection,
+			"target_product_id": req.TargetProductID,
+			"note":              req.Note,
+			"result":            result,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%d codes updated, %d skipped (%d reserved for pending orders)", result.Affected, result.Skipped, result.Reserved),
+		"result":  result,
+	})
+
+	if req.Action == store.CodeActionMove && result.Affected > 0 {
+		var target store.Product
+		if err := s.db.First(&target, req.TargetProductID).Error; err == nil {
+			go s.sendStockUpdateNotification(target.Name, result.Affected)
+		}
+	}
+}
+
+// handleCodesExport downloads the selected codes as CSV. Structured codes
+// get one column per field so the file can be imported again.
+func (s *Server) handleCodesExport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var product store.Product
+	if err := s.db.First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	var sel codeSelection
+	if err := c.ShouldBindQuery(&sel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	filter, err := sel.filter(product.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := store.ExportCodes(s.db, filter, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fields := product.Fields()
+	header := []string{"id", "code"}
+	for _, f := range fields {
+		header = append(header, f.Key)
+	}
+	header = append(header, "status", "sold", "order_id", "sold_at", "expires_at", "batch_id", "created_at")
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(header)
+	for _, code := range codes {
+		plain, err := store.DecryptCode(code.Code)
+		if err != nil {
+			logger.Error("Failed to decrypt code for export", "error", err, "code_id", code.ID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decrypt codes"})
+			return
+		}
+
+		row := []string{strconv.FormatUint(uint64(code.ID), 10), plain}
+		values := map[string]string{}
+		if code.Structured {
+			row[1] = ""
+			if values, err = store.CodeFieldValues(plain); err != nil {
+				values = map[string]string{}
+			}
+		}
+		for _, f := range fields {
+			row = append(row, values[f.Key])
+		}
+
+		orderID, soldAt, expiresAt, batchID := "", "", "", ""
+		if code.OrderID != nil {
+			orderID = strconv.FormatUint(uint64(*code.OrderID), 10)
+		}
+		if code.SoldAt != nil {
+			soldAt = code.SoldAt.Format("2006-01-02 15:04:05")
+		}
+		if code.ExpiresAt != nil {
+			expiresAt = code.ExpiresAt.Format("2006-01-02 15:04:05")
+		}
+		if code.BatchID != nil {
+			batchID = strconv.FormatUint(uint64(*code.BatchID), 10)
+		}
+		row = append(row, code.Status, strconv.FormatBool(code.IsSold), orderID, soldAt, expiresAt, batchID, code.CreatedAt.Format("2006-01-02 15:04:05"))
+		w.Write(row)
+	}
+	w.Flush()
+
+	logger.Info("Codes exported", "product_id", id, "count", len(codes), "admin", c.GetString("username"))
+
+	filename := fmt.Sprintf("product-%d-codes-%s.csv", product.ID, time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
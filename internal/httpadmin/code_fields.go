@@ -0,0 +1,202 @@
+package httpadmin
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// handleProductCodeFields saves the structured code fields and delivery
+// template of a product
+func (s *Server) handleProductCodeFields(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req struct {
+		Fields           []store.CodeField `json:"fields"`
+		DeliveryTemplate string            `json:"delivery_template"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	var product store.Product
+	if err := s.db.First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	before := product
+	if err := store.SetProductCodeFields(s.db, product.ID, req.Fields, req.DeliveryTemplate); err != nil {
+		if errors.Is(err, store.ErrInvalidCodeFields) || errors.Is(err, store.ErrInvalidDeliveryTemplate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("Product code fields updated",
+		"product_id", product.ID,
+		"fields", len(req.Fields),
+		"admin", c.GetString("username"))
+	s.auditProductChange(c, "update_code_fields", &before)
+	c.JSON(http.StatusOK, gin.H{"message": "code fields saved"})
+}
+
+// handleCodesImport imports structured codes from a CSV or JSON file, or
+// from pasted text, mapping columns to the product's code fields
+func (s *Server) handleCodesImport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var product store.Product
+	if err := s.db.First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	fields := product.Fields()
+	if len(fields) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "define code fields for this product first"})
+		return
+	}
+
+	format := strings.ToLower(c.PostForm("format"))
+	var data io.Reader
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		text := c.PostForm("data")
+		if strings.TrimSpace(text) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no file or data provided"})
+			return
+		}
+		data = strings.NewReader(text)
+	} else {
+		defer file.Close()
+
+		// Check file size (10MB limit)
+		if header.Size > 10*1024*1024 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file too large (max 10MB)"})
+			return
+		}
+		if format == "" && strings.HasSuffix(strings.ToLower(header.Filename), ".json") {
+			format = "json"
+		}
+		data = file
+	}
+
+	var records []map[string]string
+	switch format {
+	case "", "csv":
+		records, err = store.ParseCodeRecordsCSV(data, fields)
+	case "json":
+		records, err = store.ParseCodeRecordsJSON(data, fields)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts, err := codeImportOptions(c, store.CodeBatchSourceImport)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := store.ImportStructuredCodes(s.db, &product, records, opts)
+	if err != nil {
+		logger.Error("Failed to import structured codes", "error", err, "product_id", id)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if report.Total == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no valid codes found"})
+		return
+	}
+
+	logger.Info("Structured codes imported",
+		"product_id", id,
+		"format", format,
+		"total", report.Total,
+		"inserted", report.Inserted,
+		"duplicates", report.DuplicateCount(),
+		"invalid", report.Invalid,
+		"rejected", report.Rejected,
+		"admin", c.GetString("username"))
+
+	s.auditCodeImport(c, "import_codes", product.ID, report)
+	message := fmt.Sprintf("%d codes imported, %d duplicates skipped, %d invalid rows", report.Inserted, report.DuplicateCount(), report.Invalid)
+	if report.Rejected {
+		message = fmt.Sprintf("import rejected: %d duplicates found", report.DuplicateCount())
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "report": report})
+
+	if report.Inserted > 0 {
+		go s.sendStockUpdateNotification(product.Name, report.Inserted)
+	}
+}
+
+// handleProductCodeTemplate downloads an empty CSV or JSON file with the
+// product's code fields as columns
+func (s *Server) handleProductCodeTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var product store.Product
+	if err := s.db.First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	fields := product.Fields()
+	if len(fields) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product has no code fields"})
+		return
+	}
+
+	switch c.DefaultQuery("format", "csv") {
+	case "json":
+		example := make(map[string]string, len(fields))
+		for _, f := range fields {
+			example[f.Key] = ""
+		}
+		body, _ := json.MarshalIndent([]map[string]string{example}, "", "  ")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"product-%d-codes.json\"", product.ID))
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	case "csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		header := make([]string, 0, len(fields))
+		for _, f := range fields {
+			header = append(header, f.Key)
+		}
+		w.Write(header)
+		w.Flush()
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"product-%d-codes.csv\"", product.ID))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+	}
+}
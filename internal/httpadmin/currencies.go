@@ -0,0 +1,102 @@
+package httpadmin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"shop-bot/internal/currency"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+func (s *Server) handleCurrencyList(c *gin.Context) {
+	rates, err := store.GetExchangeRates(s.db)
+	if err != nil {
+		logger.Error("Failed to fetch exchange rates", "error", err)
+		c.String(http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	base := s.currency.Base()
+
+	if c.GetHeader("Accept") == "application/json" {
+		c.JSON(http.StatusOK, gin.H{
+			"base":      base,
+			"rates":     rates,
+			"supported": currency.Supported,
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "exchange_rates.html", gin.H{
+		"base":      base,
+		"rates":     rates,
+		"supported": currency.Supported,
+	})
+}
+
+func (s *Server) handleCurrencySave(c *gin.Context) {
+	var req struct {
+		Currency string  `json:"currency" form:"currency" binding:"required"`
+		Symbol   string  `json:"symbol" form:"symbol"`
+		Rate     float64 `json:"rate" form:"rate"`
+		IsActive bool    `json:"is_active" form:"is_active"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	code := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if len(code) < 2 || len(code) > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid currency code"})
+		return
+	}
+	if code == s.currency.Base().Code {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The base currency does not need an exchange rate"})
+		return
+	}
+
+	symbol := strings.TrimSpace(req.Symbol)
+	if symbol == "" {
+		if known, ok := currency.Lookup(code); ok {
+			symbol = known.Symbol
+		}
+	}
+
+	before := s.exchangeRateSnapshot(code)
+	rate, err := store.SaveExchangeRate(s.db, code, symbol, req.Rate, req.IsActive, c.GetString("username"))
+	if err != nil {
+		if err == store.ErrInvalidExchangeRate {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Rate must be greater than 0"})
+			return
+		}
+		logger.Error("Failed to save exchange rate", "error", err, "currency", code)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exchange rate"})
+		return
+	}
+
+	logger.Info("Exchange rate saved", "currency", rate.Currency, "rate", rate.Rate, "active", rate.IsActive, "admin", c.GetString("username"))
+	s.auditChange(c, "save_exchange_rate", "currency:"+rate.Currency, before, s.exchangeRateSnapshot(rate.Currency))
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate saved", "rate": rate})
+}
+
+func (s *Server) handleCurrencyDelete(c *gin.Context) {
+	code := strings.ToUpper(c.Param("code"))
+
+	before := s.exchangeRateSnapshot(code)
+	if err := store.DeleteExchangeRate(s.db, code); err != nil {
+		if err == store.ErrExchangeRateNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exchange rate not found"})
+			return
+		}
+		logger.Error("Failed to delete exchange rate", "error", err, "currency", code)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete exchange rate"})
+		return
+	}
+
+	logger.Info("Exchange rate deleted", "currency", code, "admin", c.GetString("username"))
+	s.auditChange(c, "delete_exchange_rate", "currency:"+code, before, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate deleted"})
+}
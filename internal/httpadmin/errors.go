@@ -47,6 +47,7 @@ const (
 	ErrCodeExternalService   = "EXTERNAL_SERVICE_ERROR"
 	ErrCodeResourceExhausted = "RESOURCE_EXHAUSTED"
 	ErrCodeTooManyRequests   = "TOO_MANY_REQUESTS"
+	ErrCodeTwoFactorRequired = "TWO_FACTOR_REQUIRED"
 )
 
 // 创建各种错误的辅助函数
@@ -2,6 +2,7 @@ package httpadmin
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -11,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	logger "shop-bot/internal/log"
+	"shop-bot/internal/currency"
 	"shop-bot/internal/store"
 )
 
@@ -61,6 +63,7 @@ func (s *Server) handleProductList(c *gin.Context) {
 			PriceCents  int    `json:"price_cents"`
 			IsActive    bool   `json:"is_active"`
 			Stock       int64  `json:"stock"`
+			LowStockThreshold int `json:"low_stock_threshold"`
 			CreatedAt   string `json:"created_at"`
 			UpdatedAt   string `json:"updated_at"`
 		}
@@ -74,6 +77,7 @@ func (s *Server) handleProductList(c *gin.Context) {
 				PriceCents:  p.PriceCents,
 				IsActive:    p.IsActive,
 				Stock:       p.Stock,
+				LowStockThreshold: p.LowStockThreshold,
 				CreatedAt:   p.CreatedAt.Format(time.RFC3339),
 				UpdatedAt:   p.UpdatedAt.Format(time.RFC3339),
 			})
@@ -115,6 +119,7 @@ func (s *Server) handleProductCreate(c *gin.Context) {
 		PriceCents  int     `json:"price_cents"`
 		Price       float64 `json:"price"` // Alternative: price in dollars
 		IsActive    bool    `json:"is_active"`
+		LowStockThreshold int `json:"low_stock_threshold"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -126,12 +131,17 @@ func (s *Server) handleProductCreate(c *gin.Context) {
 	if req.Price > 0 && req.PriceCents == 0 {
 		req.PriceCents = int(req.Price * 100)
 	}
+	if req.LowStockThreshold < 0 || req.LowStockThreshold > 100000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": store.ErrInvalidLowStockThreshold.Error()})
+		return
+	}
 	
 	product := store.Product{
 		Name:        req.Name,
 		Description: req.Description,
 		PriceCents:  req.PriceCents,
 		IsActive:    true, // Default to active
+		LowStockThreshold: req.LowStockThreshold,
 	}
 	
 	if err := s.db.Create(&product).Error; err != nil {
@@ -139,6 +149,7 @@ func (s *Server) handleProductCreate(c *gin.Context) {
 		return
 	}
 	
+	s.auditChange(c, "create_product", productResource(product.ID), nil, product)
 	c.JSON(http.StatusCreated, product)
 }
 
@@ -155,6 +166,7 @@ func (s *Server) handleProductUpdate(c *gin.Context) {
 		PriceCents  int     `json:"price_cents"`
 		Price       float64 `json:"price"`
 		IsActive    *bool   `json:"is_active"`
+		LowStockThreshold *int `json:"low_stock_threshold"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -178,11 +190,26 @@ func (s *Server) handleProductUpdate(c *gin.Context) {
 		updates["is_active"] = *req.IsActive
 	}
 	
+	before := s.productSnapshot(uint(id))
 	if err := s.db.Model(&store.Product{}).Where("id = ?", id).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	
+	// Changing the threshold re-evaluates the stock so a product already
+	// below the new threshold alerts right away
+	if req.LowStockThreshold != nil {
+		if err := store.SetLowStockThreshold(s.db, uint(id), *req.LowStockThreshold); err != nil {
+			if errors.Is(err, store.ErrInvalidLowStockThreshold) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	
+	s.auditProductChange(c, "update_product", before)
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
 }
 
@@ -194,11 +221,13 @@ func (s *Server) handleProductDelete(c *gin.Context) {
 	}
 	
 	// Soft delete - just deactivate
+	before := s.productSnapshot(uint(id))
 	if err := s.db.Model(&store.Product{}).Where("id = ?", id).Update("is_active", false).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	
+	s.auditProductChange(c, "deactivate_product", before)
 	c.JSON(http.StatusOK, gin.H{"message": "deactivated"})
 }
 
@@ -211,11 +240,13 @@ func (s *Server) handleProductRestore(c *gin.Context) {
 	}
 
 	// Restore - reactivate the product
+	before := s.productSnapshot(uint(id))
 	if err := s.db.Model(&store.Product{}).Where("id = ?", id).Update("is_active", true).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	s.auditProductChange(c, "restore_product", before)
 	c.JSON(http.StatusOK, gin.H{"message": "restored"})
 }
 
@@ -276,6 +307,7 @@ func (s *Server) handleProductPermanentDelete(c *gin.Context) {
 	}
 
 	logger.Info("Product permanently deleted", "product_id", id, "product_name", product.Name)
+	s.auditChange(c, "delete_product", productResource(product.ID), &product, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "permanently deleted"})
 }
 
@@ -299,31 +331,59 @@ func (s *Server) handleProductCodes(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 	offset := (page - 1) * limit
+	if offset < 0 || limit <= 0 {
+		page, offset, limit = 1, 0, 50
+	}
 	
-	var codes []store.Code
-	query := s.db.Where("product_id = ?", id)
-	
-	// Filter by sold status if requested
+	// The count and the page use the same filter
+	filter := store.CodeFilter{ProductID: product.ID, Status: c.Query("status")}
 	if soldStr := c.Query("sold"); soldStr != "" {
 		sold := soldStr == "true"
-		query = query.Where("is_sold = ?", sold)
+		filter.Sold = &sold
 	}
 	
-	if err := query.Offset(offset).Limit(limit).Find(&codes).Error; err != nil {
+	var codePage *store.CodePage
+	searchQuery := strings.TrimSpace(c.Query("q"))
+	searchField := c.Query("field")
+	if searchQuery != "" {
+		codePage, err = store.SearchCodes(s.db, &product, filter, searchField, searchQuery, offset, limit)
+	} else {
+		codePage, err = store.ListCodes(s.db, &product, filter, offset, limit)
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	
-	// Get total count
-	var total int64
-	s.db.Model(&store.Code{}).Where("product_id = ?", id).Count(&total)
+	// Products codes can be moved to, the audit trail of bulk operations
+	// and the latest inventory batches
+	var otherProducts []store.Product
+	s.db.Where("id <> ?", id).Order("name").Find(&otherProducts)
+	operations, err := store.ListCodeOperations(s.db, product.ID, 20)
+	if err != nil {
+		logger.Error("Failed to load code operations", "error", err, "product_id", id)
+	}
+	batches, err := store.ListCodeBatches(s.db, product.ID, 20)
+	if err != nil {
+		logger.Error("Failed to load code batches", "error", err, "product_id", id)
+	}
 	
 	c.HTML(http.StatusOK, "product_codes.html", gin.H{
-		"product": product,
-		"codes":   codes,
-		"total":   total,
-		"page":    page,
-		"limit":   limit,
+		"product":          product,
+		"codes":            codePage.Codes,
+		"total":            codePage.Total,
+		"searchTruncated":  codePage.Truncated,
+		"page":             page,
+		"limit":            limit,
+		"fields":           product.Fields(),
+		"deliveryTemplate": product.DeliveryTemplate,
+		"q":                searchQuery,
+		"field":            searchField,
+		"sold":             c.Query("sold"),
+		"status":           c.Query("status"),
+		"products":         otherProducts,
+		"operations":       operations,
+		"batches":          batches,
 	})
 }
 
@@ -334,6 +394,15 @@ func (s *Server) handleCodesUpload(c *gin.Context) {
 		return
 	}
 	
+	// Get product for notification
+	var product store.Product
+	if err := s.db.First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	
+	var codes []string
+	
 	// Parse multipart form
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
@@ -344,85 +413,64 @@ func (s *Server) handleCodesUpload(c *gin.Context) {
 			return
 		}
 		
-		// Get product for notification
-		var product store.Product
-		if err := s.db.First(&product, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
-			return
-		}
-		
 		// Process text codes
-		codes := processCodesText(codesText, uint(id))
-		if len(codes) == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "no valid codes found"})
+		codes = processCodesText(codesText)
+	} else {
+		defer file.Close()
+		
+		// Check file size (10MB limit)
+		if header.Size > 10*1024*1024 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file too large (max 10MB)"})
 			return
 		}
 		
-		if err := s.db.Create(&codes).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// Process file, one code per line
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			codes = append(codes, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to read file: %v", err)})
 			return
 		}
-		
-		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d codes uploaded", len(codes))})
-		
-		// Send stock update notification
-		go s.sendStockUpdateNotification(product.Name, len(codes))
-		
-		return
 	}
-	defer file.Close()
 	
-	// Check file size (10MB limit)
-	if header.Size > 10*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file too large (max 10MB)"})
+	// Duplicates within the upload and against existing stock are skipped and
+	// reported, or reject the whole upload when requested
+	opts, err := codeImportOptions(c, store.CodeBatchSourceUpload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	
-	// Process file
-	scanner := bufio.NewScanner(file)
-	var codes []store.Code
-	lineNum := 0
-	
-	for scanner.Scan() {
-		lineNum++
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-		
-		codes = append(codes, store.Code{
-			ProductID: uint(id),
-			Code:      line,
-			IsSold:    false,
-		})
-		
-		// Batch insert every 100 codes
-		if len(codes) >= 100 {
-			if err := s.db.Create(&codes).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": fmt.Sprintf("error at line %d: %v", lineNum, err),
-				})
-				return
-			}
-			codes = codes[:0]
-		}
+	report, err := store.ImportCodes(s.db, uint(id), codes, opts)
+	if err != nil {
+		logger.Error("Failed to import codes", "error", err, "product_id", id)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	
-	// Insert remaining codes
-	if len(codes) > 0 {
-		if err := s.db.Create(&codes).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	if report.Total == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no valid codes found"})
+		return
 	}
 	
-	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d codes uploaded", lineNum)})
+	logger.Info("Codes uploaded",
+		"product_id", id,
+		"total", report.Total,
+		"inserted", report.Inserted,
+		"duplicates", report.DuplicateCount(),
+		"rejected", report.Rejected,
+		"admin", c.GetString("username"))
 	
-	// Get product for notification
-	var product store.Product
-	if err := s.db.First(&product, id).Error; err == nil {
-		// Send stock update notification
-		go s.sendStockUpdateNotification(product.Name, lineNum)
+	s.auditCodeImport(c, "upload_codes", uint(id), report)
+	message := fmt.Sprintf("%d codes uploaded, %d duplicates skipped", report.Inserted, report.DuplicateCount())
+	if report.Rejected {
+		message = fmt.Sprintf("upload rejected: %d duplicates found", report.DuplicateCount())
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "report": report})
+	
+	// Send stock update notification
+	if report.Inserted > 0 {
+		go s.sendStockUpdateNotification(product.Name, report.Inserted)
 	}
 }
 
@@ -445,17 +493,30 @@ func (s *Server) handleCodeDelete(c *gin.Context) {
 		return
 	}
 	
-	// Delete the code
-	if err := s.db.Delete(&code).Error; err != nil {
+	// Delete the code, recorded like a bulk delete of one code
+	filter := store.CodeFilter{ProductID: code.ProductID, IDs: []uint{code.ID}}
+	result, err := store.ApplyCodeAction(s.db, filter, store.CodeActionDelete, c.GetString("username"), "")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if result.Reserved > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "code is reserved for a pending order"})
+		return
+	}
+	if result.Affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "code was sold or deleted meanwhile"})
+		return
+	}
 	
+	s.auditChange(c, "delete_code", "code:"+strconv.FormatUint(uint64(code.ID), 10), auditCode(&code), nil)
 	c.JSON(http.StatusOK, gin.H{"message": "code deleted"})
 }
 
-func processCodesText(text string, productID uint) []store.Code {
-	var codes []store.Code
+// processCodesText splits pasted text into codes. Multi-line codes are
+// separated by empty lines or lines made of dashes or equals signs.
+func processCodesText(text string) []string {
+	var codes []string
 	lines := strings.Split(text, "\n")
 	
 	// Support both single-line and multi-line codes
@@ -468,12 +529,7 @@ func processCodesText(text string, productID uint) []store.Code {
 		if trimmed == "" || strings.Trim(trimmed, "-=") == "" {
 			// If we have accumulated lines, save them as a code
 			if len(currentCode) > 0 {
-				codeText := strings.Join(currentCode, "\n")
-				codes = append(codes, store.Code{
-					ProductID: productID,
-					Code:      strings.TrimSpace(codeText),
-					IsSold:    false,
-				})
+				codes = append(codes, strings.TrimSpace(strings.Join(currentCode, "\n")))
 				currentCode = nil
 			}
 			continue
@@ -485,12 +541,7 @@ func processCodesText(text string, productID uint) []store.Code {
 	
 	// Don't forget the last code if there's no trailing empty line
 	if len(currentCode) > 0 {
-		codeText := strings.Join(currentCode, "\n")
-		codes = append(codes, store.Code{
-			ProductID: productID,
-			Code:      strings.TrimSpace(codeText),
-			IsSold:    false,
-		})
+		codes = append(codes, strings.TrimSpace(strings.Join(currentCode, "\n")))
 	}
 	
 	return codes
@@ -604,6 +655,9 @@ func (s *Server) handleOrderList(c *gin.Context) {
 		if orders[i].Status == "delivered" && orders[i].ProductID != nil {
 			var code store.Code
 			if err := s.db.Where("order_id = ?", orders[i].ID).First(&code).Error; err == nil {
+				if plain, err := store.RenderCode(s.db, &code); err == nil {
+					code.Code = plain
+				}
 				orders[i].Code = &code
 			}
 		}
@@ -674,7 +728,7 @@ func (s *Server) handleAdminDashboard(c *gin.Context) {
 
 	// Code stats
 	s.db.Model(&store.Code{}).Count(&stats.TotalCodes)
-	s.db.Model(&store.Code{}).Where("is_sold = ?", false).Count(&stats.AvailableCodes)
+	s.db.Model(&store.Code{}).Where("is_sold = ? AND status = ?", false, store.CodeStatusAvailable).Count(&stats.AvailableCodes)
 
 	// Get sales data for last 7 days
 	salesData := make([]struct {
@@ -768,7 +822,7 @@ func (s *Server) handleAdminDashboard(c *gin.Context) {
 // Settings handlers
 func (s *Server) handleSettingsList(c *gin.Context) {
 	// Get current currency settings
-	currency, symbol := store.GetCurrencySettings(s.db, s.config)
+	currencyCode, symbol := store.GetCurrencySettings(s.db, s.config)
 	
 	// Get order settings
 	orderSettings, err := store.GetSettingsMap(s.db)
@@ -784,43 +838,29 @@ func (s *Server) handleSettingsList(c *gin.Context) {
 		orderStats = make(map[string]int64)
 	}
 	
-	// Map of available currencies
-	currencies := []struct {
-		Code   string
-		Symbol string
-		Name   string
-	}{
-		{"CNY", "¥", "人民币"},
-		{"USD", "$", "美元"},
-		{"EUR", "€", "欧元"},
-		{"GBP", "£", "英镑"},
-		{"JPY", "¥", "日元"},
-		{"KRW", "₩", "韩元"},
-		{"HKD", "HK$", "港币"},
-		{"TWD", "NT$", "新台币"},
-		{"SGD", "S$", "新加坡元"},
-		{"CAD", "C$", "加元"},
-		{"AUD", "A$", "澳元"},
-	}
+	// Get currency list
+	currencies := currency.Supported
 	
 	if c.GetHeader("Accept") == "application/json" {
 		c.JSON(http.StatusOK, gin.H{
-			"currency":   currency,
+			"currency":   currencyCode,
 			"symbol":     symbol,
 			"currencies": currencies,
 			"orderSettings": orderSettings,
 			"orderStats": orderStats,
+			"paymentProviders": s.paymentProviderOptions(),
 		})
 		return
 	}
 	
 	// HTML response
 	c.HTML(http.StatusOK, "settings.html", gin.H{
-		"currency":   currency,
+		"currency":   currencyCode,
 		"symbol":     symbol,
 		"currencies": currencies,
 		"orderSettings": orderSettings,
 		"orderStats": orderStats,
+		"paymentProviders": s.paymentProviderOptions(),
 	})
 }
 
@@ -833,6 +873,7 @@ func (s *Server) handleSettingsUpdate(c *gin.Context) {
 		return
 	}
 	
+	before := s.settingsSnapshot()
 	// Handle currency settings
 	if currency, ok := req["currency"].(string); ok {
 		if symbol, ok := req["symbol"].(string); ok {
@@ -883,6 +924,7 @@ func (s *Server) handleSettingsUpdate(c *gin.Context) {
 		}
 	}
 	
+	s.auditSettingsChange(c, "update_settings", before)
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "设置已更新"})
 }
 
@@ -980,6 +1022,9 @@ func (s *Server) handleUserDetail(c *gin.Context) {
 		if orders[i].Status == "delivered" && orders[i].ProductID != nil {
 			var code store.Code
 			if err := s.db.Where("order_id = ?", orders[i].ID).First(&code).Error; err == nil {
+				if plain, err := store.RenderCode(s.db, &code); err == nil {
+					code.Code = plain
+				}
 				orders[i].Code = &code
 			}
 		}
@@ -0,0 +1,40 @@
+package httpadmin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// newTestDB returns a migrated SQLite database in a temporary file
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=10000&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := store.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
@@ -1,7 +1,6 @@
 package httpadmin
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -10,14 +9,55 @@ import (
 
 	"github.com/gin-gonic/gin"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"gorm.io/gorm"
-	payment "shop-bot/internal/payment/epay"
+	"shop-bot/internal/bot/messages"
+	"shop-bot/internal/payment"
+	"shop-bot/internal/payment/epay"
+	"shop-bot/internal/payment/telegram"
 	"shop-bot/internal/store"
 	logger "shop-bot/internal/log"
 	"shop-bot/internal/metrics"
 	"shop-bot/internal/notification"
 )
 
+// configurePaymentProviders registers providers whose configuration is
+// complete and removes the ones that are no longer usable
+func (s *Server) configurePaymentProviders() {
+	if s.payments == nil {
+		s.payments = payment.NewRegistry()
+	}
+	if s.config == nil {
+		return
+	}
+
+	if client, err := epay.NewClientFromConfig(s.config); err == nil {
+		s.payments.Register(epay.NewProvider(client))
+		logger.Info("Epay provider registered",
+			"epay_pid", s.config.EpayPID,
+			"epay_gateway", s.config.EpayGateway,
+			"sign_type", client.SignType)
+	} else {
+		// Remove the provider if configuration is incomplete to avoid using stale credentials
+		s.payments.Unregister(epay.ProviderName)
+		logger.Info("Epay provider not registered",
+			"error", err,
+			"epay_pid_empty", s.config.EpayPID == "",
+			"epay_key_empty", s.config.EpayKey == "",
+			"epay_private_key_empty", s.config.EpayPrivateKey == "",
+			"epay_gateway_empty", s.config.EpayGateway == "")
+	}
+
+	// Telegram checkout is handled by the bot, register it here so it can
+	// be enabled in settings
+	if s.bot != nil {
+		s.payments.Register(telegram.NewStarsProvider(s.bot, s.db))
+		if s.config.TelegramPaymentToken != "" {
+			s.payments.Register(telegram.NewProvider(s.bot, s.db, s.config, s.config.TelegramPaymentToken))
+		} else {
+			s.payments.Unregister(telegram.ProviderName)
+		}
+	}
+}
+
 // handlePaymentReturn handles the payment return page
 func (s *Server) handlePaymentReturn(c *gin.Context) {
 	// Check if this is a payment result with parameters
@@ -65,7 +105,11 @@ func (s *Server) handlePaymentReturn(c *gin.Context) {
 		logger.Info("Processing payment return as notification", "out_trade_no", outTradeNo, "params", params)
 
 		// Process as payment notification
-		s.processPaymentNotification(c, params)
+		if provider, err := s.payments.Get(epay.ProviderName); err == nil {
+			s.processPaymentNotification(c, provider, params, store.CallbackSourceReturn)
+		} else {
+			logger.Warn("Epay provider not configured, skipping return notification", "out_trade_no", outTradeNo)
+		}
 
 		// Show beautiful success page
 		c.HTML(http.StatusOK, "payment_success.html", gin.H{
@@ -81,10 +125,8 @@ func (s *Server) handlePaymentReturn(c *gin.Context) {
 	})
 }
 
-// handleEpayNotify handles payment callbacks from EPay
-func (s *Server) handleEpayNotify(c *gin.Context) {
-	metrics.PaymentCallbacksReceived.Inc()
-
+// handlePaymentNotify handles async payment callbacks for any registered provider
+func (s *Server) handlePaymentNotify(c *gin.Context) {
 	// Parse form data
 	if err := c.Request.ParseForm(); err != nil {
 		logger.Error("Failed to parse form", "error", err)
@@ -92,129 +134,241 @@ func (s *Server) handleEpayNotify(c *gin.Context) {
 		return
 	}
 
+	provider, err := s.payments.Get(c.Param("provider"))
+	if err != nil {
+		logger.Warn("Payment callback for unknown provider", "provider", c.Param("provider"))
+		// Keep the callback so it can be replayed once the provider is configured
+		if err := store.CreatePaymentCallback(s.db, &store.PaymentCallback{
+			Provider:   c.Param("provider"),
+			Source:     store.CallbackSourceNotify,
+			RawParams:  c.Request.Form.Encode(),
+			OutTradeNo: c.Request.Form.Get("out_trade_no"),
+			TradeNo:    c.Request.Form.Get("trade_no"),
+			Result:     store.CallbackResultUnknownProvider,
+			Error:      err.Error(),
+			TraceID:    c.GetString("trace_id"),
+		}); err != nil {
+			logger.Error("Failed to store payment callback", "provider", c.Param("provider"), "error", err)
+		}
+		c.String(http.StatusNotFound, "fail")
+		return
+	}
+
 	params := c.Request.Form
-	s.processPaymentNotification(c, params)
+	s.processPaymentNotification(c, provider, params, store.CallbackSourceNotify)
 
-	logger.Info("Payment processed successfully")
+	logger.Info("Payment processed successfully", "provider", provider.Name())
 	c.String(http.StatusOK, "success")
 }
 
-// processPaymentNotification processes payment notification
-func (s *Server) processPaymentNotification(c *gin.Context, params url.Values) {
+// processPaymentNotification processes a payment notification and stores
+// the callback with its outcome so it can be searched and replayed later
+func (s *Server) processPaymentNotification(c *gin.Context, provider payment.PaymentProvider, params url.Values, source string) *store.PaymentCallback {
+	return s.recordPaymentNotification(c, provider, params, &store.PaymentCallback{Source: source})
+}
+
+// recordPaymentNotification processes params and persists callback, which
+// carries the source and replay details set by the caller
+func (s *Server) recordPaymentNotification(c *gin.Context, provider payment.PaymentProvider, params url.Values, callback *store.PaymentCallback) *store.PaymentCallback {
 	metrics.PaymentCallbacksReceived.Inc()
 
 	traceID := c.GetString("trace_id")
-	logger.Info("Processing payment notification", "params", params, "trace_id", traceID)
+	logger.Info("Processing payment notification", "provider", provider.Name(), "source", callback.Source, "params", params, "trace_id", traceID)
 
-	// Verify signature
-	if s.epay == nil || !s.epay.VerifyNotify(params) {
-		logger.Error("Invalid callback signature", "params", params)
-		return
+	callback.Provider = provider.Name()
+	callback.RawParams = params.Encode()
+	callback.OutTradeNo = params.Get("out_trade_no")
+	callback.TradeNo = params.Get("trade_no")
+	callback.TraceID = traceID
+	s.applyPaymentNotification(provider, params, callback)
+
+	if callback.Result == store.CallbackResultFailed || callback.Result == store.CallbackResultOrderNotFound {
+		metrics.PaymentCallbacksFailed.Inc()
 	}
+	if err := store.CreatePaymentCallback(s.db, callback); err != nil {
+		logger.Error("Failed to store payment callback", "provider", provider.Name(), "error", err, "trace_id", traceID)
+	}
+	return callback
+}
+
+// applyPaymentNotification verifies the callback and fulfils the order,
+// recording the result on callback
+func (s *Server) applyPaymentNotification(provider payment.PaymentProvider, params url.Values, callback *store.PaymentCallback) {
+	traceID := callback.TraceID
 
-	// Parse notification
-	notify := payment.ParseNotify(params)
+	// Verify signature and parse notification
+	notify, err := provider.VerifyCallback(params)
+	if err != nil {
+		logger.Error("Invalid payment callback", "provider", provider.Name(), "error", err, "params", params)
+		callback.Result = store.CallbackResultInvalidParams
+		if err == payment.ErrInvalidSignature {
+			callback.Result = store.CallbackResultInvalidSignature
+		}
+		callback.Error = err.Error()
+		return
+	}
+	callback.SignatureValid = true
+	callback.OutTradeNo = notify.OutTradeNo
+	callback.TradeNo = notify.TradeNo
 
 	// Check trade status
-	if notify.TradeStatus != "TRADE_SUCCESS" {
-		logger.Info("Trade not successful", "status", notify.TradeStatus)
+	if !notify.Paid {
+		logger.Info("Trade not successful", "status", notify.Status)
+		callback.Result = store.CallbackResultNotPaid
+		callback.Error = "trade status " + notify.Status
 		return
 	}
 
 	// Find order by out_trade_no
 	var order store.Order
-	if err := s.db.Preload("User").Preload("Product").Where("epay_out_trade_no = ?", notify.OutTradeNo).First(&order).Error; err != nil {
-		// Try parsing order ID from out_trade_no (format: orderID-timestamp)
-		parts := strings.Split(notify.OutTradeNo, "-")
+	if found, err := store.GetOrderByOutTradeNo(s.db, notify.OutTradeNo); err == nil {
+		order = *found
+	} else {
+		// Try parsing order ID from out_trade_no (format: orderID-timestamp,
+		// with a D in front for deposits)
+		parts := strings.Split(strings.TrimPrefix(notify.OutTradeNo, "D"), "-")
 		if len(parts) > 0 {
-			if orderID, err := strconv.ParseUint(parts[0], 10, 32); err == nil {
+			if orderID, parseErr := strconv.ParseUint(parts[0], 10, 32); parseErr == nil {
 				err = s.db.Preload("User").Preload("Product").First(&order, orderID).Error
 			}
 		}
 
 		if err != nil {
 			logger.Error("Order not found", "out_trade_no", notify.OutTradeNo, "error", err)
-			metrics.PaymentCallbacksFailed.Inc()
+			callback.Result = store.CallbackResultOrderNotFound
+			callback.Error = err.Error()
 			return
 		}
 	}
-
-	// Check if already processed
+	orderID := order.ID
+	callback.OrderID = &orderID
+
+	// Check if already processed. Only repeats of a trade applied before
+	// are duplicates, a new trade is another payment. A mismatched order
+	// still owing money settles with a new trade for its current merchant
+	// order number, issued when the user pays the difference; any other new
+	// trade is credited to the balance.
 	if order.Status != "pending" {
-		logger.Info("Order already processed", "order_id", order.ID, "status", order.Status, "trace_id", traceID)
-		return
-	}
-
-	// Use transaction to process payment
-	err := s.db.Transaction(func(tx *gorm.DB) error {
-		// Update order status
-		updates := map[string]interface{}{
-			"status":        "paid",
-			"epay_trade_no": notify.TradeNo,
+		repeat := notify.TradeNo == order.EpayTradeNo
+		if !repeat {
+			if repeat, err = store.TradeProcessed(s.db, order.ID, notify.TradeNo); err != nil {
+				logger.Error("Failed to check payment trade", "order_id", order.ID, "error", err, "trace_id", traceID)
+				callback.Result = store.CallbackResultFailed
+				callback.Error = err.Error()
+				return
+			}
 		}
-		if err := tx.Model(&order).Updates(updates).Error; err != nil {
-			return err
+		if repeat {
+			logger.Info("Order already processed", "order_id", order.ID, "status", order.Status, "trace_id", traceID)
+			callback.Result = store.CallbackResultDuplicate
+			return
 		}
+		if order.Status != store.OrderStatusPaymentMismatch || order.AmountDue() <= 0 || notify.OutTradeNo != order.EpayOutTradeNo {
+			s.creditLatePayment(&order, provider, notify.TradeNo, notify.AmountCents, callback)
+			return
+		}
+	}
 
-		// Track metric
-		metrics.OrdersPaid.Inc()
-
-		// Handle product delivery or balance recharge
-		if order.ProductID != nil {
-			// Product order - try to claim code
-			code, err := store.ClaimOneCodeTx(context.Background(), tx, *order.ProductID, order.ID)
-			if err != nil {
-				if err == store.ErrNoStock {
-					// Update status to paid_no_stock
-					if err := tx.Model(&order).Update("status", "paid_no_stock").Error; err != nil {
-						return err
-					}
-
-					// Track no stock metric
-					metrics.OrdersNoStock.Inc()
-
-					// Will notify user and admin after transaction
-					return nil
-				}
-				return err
-			}
-
-			// Update order status to delivered
-			if err := tx.Model(&order).Update("status", "delivered").Error; err != nil {
-				return err
+	// Verify the amount, then deliver the code or credit the balance in one transaction
+	settlement, err := store.SettlePayment(s.db, &order, provider.Name(), notify.TradeNo, notify.AmountCents)
+	if err != nil {
+		if err == store.ErrOrderNotPending {
+			// Settled in the meantime, by this trade or by another payment
+			if err := s.db.Preload("User").First(&order, order.ID).Error; err == nil && notify.TradeNo != order.EpayTradeNo {
+				s.creditLatePayment(&order, provider, notify.TradeNo, notify.AmountCents, callback)
+				return
 			}
+			logger.Info("Order already processed", "order_id", order.ID, "trace_id", traceID)
+			callback.Result = store.CallbackResultDuplicate
+			return
+		}
+		logger.Error("Failed to process payment", "order_id", order.ID, "error", err, "trace_id", traceID)
+		callback.Result = store.CallbackResultFailed
+		callback.Error = err.Error()
+		return
+	}
 
-			// Track delivered metric
-			metrics.OrdersDelivered.Inc()
-
-			// Send code to user after transaction
-			go s.sendCodeToUser(&order, code)
-		} else {
-			// Balance recharge
-			if err := store.AddBalance(tx, order.UserID, order.AmountCents, "recharge",
-				fmt.Sprintf("充值订单 #%d", order.ID), nil, &order.ID); err != nil {
-				return err
-			}
+	callback.Result = store.CallbackResultProcessed
+	if settlement.Outcome != store.SettlementCompleted {
+		callback.Result = store.CallbackResultAmountMismatch
+		callback.Error = fmt.Sprintf("received %d, due %d: %s", settlement.ReceivedCents, settlement.DueCents, settlement.Outcome)
+		logger.Warn("Payment amount mismatch",
+			"order_id", order.ID,
+			"received", settlement.ReceivedCents,
+			"due", settlement.DueCents,
+			"outcome", settlement.Outcome,
+			"trace_id", traceID)
+		s.notifyPaymentMismatch(&order, settlement, provider.DisplayName())
+	}
 
-			// Update order status to delivered
-			if err := tx.Model(&order).Update("status", "delivered").Error; err != nil {
-				return err
-			}
+	switch settlement.Outcome {
+	case store.SettlementCompleted, store.SettlementOverpaidCredited:
+		logger.Info("Order payment confirmed", "order_id", order.ID, "trade_no", notify.TradeNo, "trace_id", traceID)
+		s.afterOrderPaid(&order, settlement.Code, provider.DisplayName())
+	}
+}
 
-			// Send notification after transaction
-			go s.sendRechargeSuccessMessage(&order)
+// creditLatePayment moves money paid for an order that was cancelled,
+// expired or already paid to the user's balance, since it cannot pay for
+// the order
+func (s *Server) creditLatePayment(order *store.Order, provider payment.PaymentProvider, tradeNo string, receivedCents int, callback *store.PaymentCallback) {
+	status := order.Status
+	if err := store.CreditLatePayment(s.db, order, provider.Name(), tradeNo, receivedCents); err != nil {
+		if err == store.ErrLatePaymentCredited {
+			logger.Info("Late payment already credited", "order_id", order.ID, "trace_id", callback.TraceID)
+			callback.Result = store.CallbackResultDuplicate
+			return
 		}
+		logger.Error("Failed to credit late payment", "order_id", order.ID, "error", err, "trace_id", callback.TraceID)
+		callback.Result = store.CallbackResultFailed
+		callback.Error = err.Error()
+		return
+	}
 
-		return nil
-	})
+	logger.Warn("Payment received for order no longer pending, credited to balance",
+		"order_id", order.ID, "status", status, "amount", receivedCents, "trade_no", tradeNo, "trace_id", callback.TraceID)
+	callback.Result = store.CallbackResultProcessed
+	callback.Error = "order " + status + ", credited to balance"
 
-	if err != nil {
-		logger.Error("Failed to process payment", "order_id", order.ID, "error", err, "trace_id", traceID)
-		metrics.PaymentCallbacksFailed.Inc()
-		return
+	if s.notification != nil {
+		s.notification.NotifyAdmins(notification.EventLatePayment, map[string]interface{}{
+			"order_id":       order.ID,
+			"user_id":        order.UserID,
+			"status":         status,
+			"amount":         receivedCents,
+			"payment_method": provider.DisplayName(),
+			"trade_no":       tradeNo,
+		})
 	}
 
-	logger.Info("Order payment confirmed", "order_id", order.ID, "trade_no", notify.TradeNo, "trace_id", traceID)
+	if s.bot != nil {
+		key := "payment_extra_credited"
+		if status == "expired" || status == store.OrderStatusCancelled {
+			key = "payment_late_credited"
+		}
+		msgManager := messages.GetManager()
+		lang := messages.GetUserLanguage(order.User.Language, "")
+		text := msgManager.Format(lang, key, map[string]interface{}{
+			"OrderID":  order.ID,
+			"Credited": s.currency.ForUser(&order.User).Format(receivedCents),
+		})
+		go s.bot.Send(tgbotapi.NewMessage(order.User.TgUserID, text))
+	}
+}
+
+// afterOrderPaid tracks metrics and notifies the user and admins once an
+// order has been fulfilled
+func (s *Server) afterOrderPaid(order *store.Order, code, paymentMethod string) {
+	metrics.OrdersPaid.Inc()
+	switch {
+	case order.Status == "paid_no_stock":
+		metrics.OrdersNoStock.Inc()
+	case order.ProductID != nil:
+		metrics.OrdersDelivered.Inc()
+		go s.sendCodeToUser(order, code)
+	default:
+		go s.sendRechargeSuccessMessage(order)
+	}
 
 	// Send notification to admins
 	if s.notification != nil {
@@ -227,14 +381,64 @@ func (s *Server) processPaymentNotification(c *gin.Context, params url.Values) {
 			"user_id":        order.UserID,
 			"product_name":   productName,
 			"amount":         order.AmountCents,
-			"payment_method": "Epay",
+			"payment_method": paymentMethod,
 		})
 	}
 
 	// Handle no stock notification
 	if order.Status == "paid_no_stock" {
-		go s.notifyNoStock(&order)
+		go s.notifyNoStock(order)
+	}
+}
+
+// notifyPaymentMismatch tells the user how a mismatched payment was handled
+// and alerts admins
+func (s *Server) notifyPaymentMismatch(order *store.Order, settlement *store.PaymentSettlement, paymentMethod string) {
+	if s.notification != nil {
+		s.notification.NotifyAdmins(notification.EventPaymentMismatch, map[string]interface{}{
+			"order_id":       order.ID,
+			"user_id":        order.UserID,
+			"received":       settlement.ReceivedCents,
+			"due":            settlement.DueCents,
+			"credited":       settlement.CreditedCents,
+			"outcome":        settlement.Outcome,
+			"payment_method": paymentMethod,
+		})
+	}
+
+	if s.bot == nil {
+		return
+	}
+
+	msgManager := messages.GetManager()
+	lang := messages.GetUserLanguage(order.User.Language, "")
+	money := s.currency.ForUser(&order.User)
+	data := map[string]interface{}{
+		"OrderID":   order.ID,
+		"Received":  money.Format(settlement.ReceivedCents),
+		"Due":       money.Format(settlement.DueCents),
+		"Credited":  money.Format(settlement.CreditedCents),
+		"Remaining": money.Format(settlement.RemainingDue),
+	}
+
+	msg := tgbotapi.NewMessage(order.User.TgUserID, "")
+	switch settlement.Outcome {
+	case store.SettlementOverpaidCredited:
+		msg.Text = msgManager.Format(lang, "payment_overpaid_credited", data)
+	case store.SettlementUnderpaidCredited:
+		msg.Text = msgManager.Format(lang, "payment_underpaid_credited", data)
+	case store.SettlementDifferenceRequested:
+		msg.Text = msgManager.Format(lang, "payment_difference_requested", data)
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(msgManager.Get(lang, "btn_pay_difference"),
+					fmt.Sprintf("pay:%s:%d", order.PaymentProvider, order.ID)),
+			),
+		)
+	default:
+		msg.Text = msgManager.Format(lang, "payment_mismatch_held", data)
 	}
+	go s.bot.Send(msg)
 }
 
 // sendCodeToUser sends the purchased code to the user
@@ -247,13 +451,13 @@ func (s *Server) sendCodeToUser(order *store.Order, code string) {
 		"🎉 购买成功！\n\n"+
 			"订单号: #%d\n"+
 			"商品: %s\n"+
-			"金额: ¥%.2f\n\n"+
+			"金额: %s\n\n"+
 			"📦 您的卡密信息：\n"+
 			"<code>%s</code>\n\n"+
 			"感谢您的购买！如有问题请联系客服。",
 		order.ID,
 		order.Product.Name,
-		float64(order.AmountCents)/100,
+		s.currency.Format(order.AmountCents),
 		code,
 	)
 	msg := tgbotapi.NewMessage(order.User.TgUserID, message)
@@ -268,15 +472,16 @@ func (s *Server) sendRechargeSuccessMessage(order *store.Order) {
 	}
 
 	newBalance, _ := store.GetUserBalance(s.db, order.UserID)
+	money := s.currency.ForUser(&order.User)
 	message := fmt.Sprintf(
 		"✅ 充值成功！\n\n"+
 			"订单号: #%d\n"+
-			"充值金额: ¥%.2f\n"+
-			"当前余额: ¥%.2f\n\n"+
+			"充值金额: %s\n"+
+			"当前余额: %s\n\n"+
 			"感谢您的充值！",
 		order.ID,
-		float64(order.AmountCents)/100,
-		float64(newBalance)/100,
+		money.Format(order.AmountCents),
+		money.Format(newBalance),
 	)
 	msg := tgbotapi.NewMessage(order.User.TgUserID, message)
 	s.bot.Send(msg)
@@ -0,0 +1,126 @@
+package httpadmin
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+func (s *Server) handlePaymentCallbackList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	perPage := 20
+	offset := (page - 1) * perPage
+	filter := store.PaymentCallbackFilter{
+		Provider: c.Query("provider"),
+		Result:   c.Query("result"),
+		Query:    strings.TrimSpace(c.Query("q")),
+	}
+	if orderID, err := strconv.ParseUint(c.Query("order_id"), 10, 32); err == nil {
+		filter.OrderID = uint(orderID)
+	}
+
+	callbacks, total, err := store.ListPaymentCallbacks(s.db, filter, perPage, offset)
+	if err != nil {
+		logger.Error("Failed to fetch payment callbacks", "error", err)
+		c.String(http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	totalPages := int(total+int64(perPage)-1) / perPage
+
+	if c.GetHeader("Accept") == "application/json" {
+		c.JSON(http.StatusOK, gin.H{
+			"callbacks":   callbacks,
+			"total":       total,
+			"page":        page,
+			"total_pages": totalPages,
+		})
+		return
+	}
+
+	var providers []string
+	for _, p := range s.payments.All() {
+		providers = append(providers, p.Name())
+	}
+
+	c.HTML(http.StatusOK, "payment_callbacks.html", gin.H{
+		"callbacks":  callbacks,
+		"filter":     filter,
+		"orderID":    c.Query("order_id"),
+		"providers":  providers,
+		"page":       page,
+		"totalPages": totalPages,
+		"total":      total,
+		"results": []string{
+			store.CallbackResultProcessed,
+			store.CallbackResultDuplicate,
+			store.CallbackResultInvalidSignature,
+			store.CallbackResultInvalidParams,
+			store.CallbackResultNotPaid,
+			store.CallbackResultOrderNotFound,
+			store.CallbackResultFailed,
+			store.CallbackResultUnknownProvider,
+			store.CallbackResultAmountMismatch,
+		},
+	})
+}
+
+// handlePaymentCallbackReplay re-runs processing for a stored callback,
+// typically after the issue that made it fail has been fixed
+func (s *Server) handlePaymentCallbackReplay(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	original, err := store.GetPaymentCallback(s.db, uint(id))
+	if err != nil {
+		if err == store.ErrPaymentCallbackNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Callback not found"})
+			return
+		}
+		logger.Error("Failed to fetch payment callback", "error", err, "callback_id", id)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	provider, err := s.payments.Get(original.Provider)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment provider " + original.Provider + " is not configured"})
+		return
+	}
+
+	params, err := url.ParseQuery(original.RawParams)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stored parameters cannot be parsed"})
+		return
+	}
+
+	originalID := original.ID
+	replay := s.recordPaymentNotification(c, provider, params, &store.PaymentCallback{
+		Source:     store.CallbackSourceReplay,
+		ReplayOf:   &originalID,
+		ReplayedBy: c.GetString("username"),
+	})
+
+	logger.Info("Payment callback replayed",
+		"callback_id", original.ID,
+		"replay_id", replay.ID,
+		"result", replay.Result,
+		"admin", replay.ReplayedBy)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Callback replayed",
+		"callback": replay,
+	})
+}
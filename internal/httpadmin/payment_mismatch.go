@@ -0,0 +1,97 @@
+package httpadmin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"shop-bot/internal/bot/messages"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// handleResolvePaymentMismatch settles an order held in payment_mismatch:
+// "deliver" accepts the received amount and fulfils the order, "credit"
+// cancels it and moves the received amount to the user's balance
+func (s *Server) handleResolvePaymentMismatch(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req struct {
+		Action string `json:"action" form:"action" binding:"required"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order store.Order
+	if err := s.db.Preload("User").Preload("Product").First(&order, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.Status != store.OrderStatusPaymentMismatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order is not waiting for mismatch review"})
+		return
+	}
+
+	admin := c.GetString("username")
+
+	switch req.Action {
+	case "deliver":
+		code, credited, err := store.DeliverMismatchedOrder(s.db, &order)
+		if err != nil {
+			logger.Error("Failed to deliver mismatched order", "error", err, "order_id", order.ID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deliver order"})
+			return
+		}
+		s.afterOrderPaid(&order, code, order.PaymentProvider)
+
+		logger.Info("Payment mismatch resolved by delivery", "order_id", order.ID, "credited", credited, "admin", admin)
+		s.auditMismatchCredit(c, "deliver_mismatched_order", &order, credited)
+		c.JSON(http.StatusOK, gin.H{"message": "Order delivered", "status": order.Status, "credited": credited})
+
+	case "credit":
+		credited, err := store.CreditMismatchedOrder(s.db, &order)
+		if err != nil {
+			logger.Error("Failed to credit mismatched order", "error", err, "order_id", order.ID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to credit balance"})
+			return
+		}
+
+		if s.bot != nil {
+			msgManager := messages.GetManager()
+			lang := messages.GetUserLanguage(order.User.Language, "")
+			text := msgManager.Format(lang, "payment_mismatch_refunded", map[string]interface{}{
+				"OrderID":  order.ID,
+				"Credited": s.currency.ForUser(&order.User).Format(credited),
+			})
+			go s.bot.Send(tgbotapi.NewMessage(order.User.TgUserID, text))
+		}
+
+		logger.Info("Payment mismatch resolved by balance credit", "order_id", order.ID, "credited", credited, "admin", admin)
+		s.auditMismatchCredit(c, "credit_mismatched_order", &order, credited)
+		c.JSON(http.StatusOK, gin.H{"message": "Received amount credited to balance", "status": order.Status, "credited": credited})
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Action must be deliver or credit"})
+	}
+}
+
+// auditMismatchCredit records the amount of a mismatched payment credited to
+// the user's balance
+func (s *Server) auditMismatchCredit(c *gin.Context, action string, order *store.Order, credited int) {
+	if credited <= 0 {
+		return
+	}
+	balance, err := store.GetUserBalance(s.db, order.UserID)
+	if err != nil {
+		logger.Error("Failed to load balance for audit log", "error", err, "user_id", order.UserID)
+		return
+	}
+	s.auditBalance(c, action, order.UserID, balance-credited, balance, gin.H{"order_id": order.ID})
+}
@@ -0,0 +1,175 @@
+package httpadmin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"shop-bot/internal/currency"
+	"shop-bot/internal/payment"
+	"shop-bot/internal/store"
+)
+
+// fakeProvider accepts every callback, reading the notification straight
+// from the parameters
+type fakeProvider struct{}
+
+func (fakeProvider) Name() string        { return "fake" }
+func (fakeProvider) DisplayName() string { return "Fake" }
+
+func (fakeProvider) CreateCheckout(ctx context.Context, req payment.CheckoutRequest) (*payment.Checkout, error) {
+	return &payment.Checkout{}, nil
+}
+
+func (fakeProvider) VerifyCallback(params url.Values) (*payment.Notification, error) {
+	amount, _ := strconv.Atoi(params.Get("amount_cents"))
+	return &payment.Notification{
+		TradeNo:     params.Get("trade_no"),
+		OutTradeNo:  params.Get("out_trade_no"),
+		AmountCents: amount,
+		Paid:        true,
+		Status:      "TRADE_SUCCESS",
+	}, nil
+}
+
+func (fakeProvider) Query(ctx context.Context, outTradeNo string) (*payment.QueryResult, error) {
+	return nil, payment.ErrCallbackNotSupported
+}
+
+func (fakeProvider) Refund(ctx context.Context, outTradeNo string, amountCents int) error {
+	return payment.ErrRefundNotSupported
+}
+
+func TestPaymentNotificationNewTradeIsLatePayment(t *testing.T) {
+	db := newTestDB(t)
+	s := &Server{db: db, payments: payment.NewRegistry(), currency: currency.NewService(db, nil)}
+
+	user := store.User{TgUserID: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	order := store.Order{UserID: user.ID, AmountCents: 1000, PaymentAmount: 1000, Status: "pending", EpayOutTradeNo: "D1-100"}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	notify := func(tradeNo string) *store.PaymentCallback {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		params := url.Values{"out_trade_no": {"D1-100"}, "trade_no": {tradeNo}, "amount_cents": {"1000"}}
+		return s.recordPaymentNotification(c, fakeProvider{}, params, &store.PaymentCallback{Source: store.CallbackSourceNotify})
+	}
+	balance := func() int {
+		balance, err := store.GetUserBalance(db, user.ID)
+		if err != nil {
+			t.Fatalf("get balance: %v", err)
+		}
+		return balance
+	}
+
+	steps := []struct {
+		tradeNo string
+		result  string
+		balance int
+	}{
+		{"T1", store.CallbackResultProcessed, 1000}, // Pays the deposit
+		{"T1", store.CallbackResultDuplicate, 1000}, // Repeat of the paying trade
+		{"T2", store.CallbackResultProcessed, 2000}, // A second payment is credited
+		{"T2", store.CallbackResultDuplicate, 2000}, // Repeat of the second payment
+	}
+	for i, step := range steps {
+		callback := notify(step.tradeNo)
+		if callback.Result != step.result {
+			t.Errorf("step %d: %s result = %q (%s), want %q", i+1, step.tradeNo, callback.Result, callback.Error, step.result)
+		}
+		if got := balance(); got != step.balance {
+			t.Errorf("step %d: balance = %d, want %d", i+1, got, step.balance)
+		}
+	}
+}
+
+func TestPaymentCallbackReplaySettlesOnce(t *testing.T) {
+	db := newTestDB(t)
+	payments := payment.NewRegistry()
+	payments.Register(fakeProvider{})
+	s := &Server{db: db, payments: payments, currency: currency.NewService(db, nil)}
+
+	user := store.User{TgUserID: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	notify := func(outTradeNo, tradeNo, amount string) *store.PaymentCallback {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		params := url.Values{"out_trade_no": {outTradeNo}, "trade_no": {tradeNo}, "amount_cents": {amount}}
+		return s.recordPaymentNotification(c, fakeProvider{}, params, &store.PaymentCallback{Source: store.CallbackSourceNotify})
+	}
+	replay := func(callback *store.PaymentCallback) string {
+		w := serveAdmin(s.handlePaymentCallbackReplay, http.MethodPost, "", gin.Param{Key: "id", Value: strconv.FormatUint(uint64(callback.ID), 10)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("replay callback %d: %d %s", callback.ID, w.Code, w.Body)
+		}
+		var latest store.PaymentCallback
+		if err := db.Order("id DESC").First(&latest).Error; err != nil {
+			t.Fatalf("load replay: %v", err)
+		}
+		if latest.Source != store.CallbackSourceReplay || latest.ReplayOf == nil || *latest.ReplayOf != callback.ID {
+			t.Fatalf("replay = %+v, want a replay of %d", latest, callback.ID)
+		}
+		return latest.Result
+	}
+	credits := func() int64 {
+		var count int64
+		db.Model(&store.BalanceTransaction{}).Where("user_id = ?", user.ID).Count(&count)
+		return count
+	}
+
+	// The callback arrives before its order exists, then is replayed
+	failed := notify("D1-200", "T1", "1000")
+	if failed.Result != store.CallbackResultOrderNotFound {
+		t.Fatalf("result = %q, want %q", failed.Result, store.CallbackResultOrderNotFound)
+	}
+	order := store.Order{UserID: user.ID, AmountCents: 1000, PaymentAmount: 1000, Status: "pending", EpayOutTradeNo: "D1-200"}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if result := replay(failed); result != store.CallbackResultProcessed {
+		t.Fatalf("first replay result = %q, want %q", result, store.CallbackResultProcessed)
+	}
+
+	// Replaying it again, or the provider repeating it, settles nothing more
+	if result := replay(failed); result != store.CallbackResultDuplicate {
+		t.Errorf("second replay result = %q, want %q", result, store.CallbackResultDuplicate)
+	}
+	if repeat := notify("D1-200", "T1", "1000"); repeat.Result != store.CallbackResultDuplicate {
+		t.Errorf("repeat result = %q, want %q", repeat.Result, store.CallbackResultDuplicate)
+	}
+	if balance, _ := store.GetUserBalance(db, user.ID); balance != 1000 || credits() != 1 {
+		t.Errorf("balance = %d after %d credits, want 1000 credited once", balance, credits())
+	}
+
+	// An underpayment held for review is not applied again by a replay
+	held := store.Order{UserID: user.ID, AmountCents: 1000, PaymentAmount: 1000, Status: "pending", EpayOutTradeNo: "D1-300"}
+	if err := db.Create(&held).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	mismatch := notify("D1-300", "T3", "400")
+	if mismatch.Result != store.CallbackResultAmountMismatch {
+		t.Fatalf("result = %q, want %q", mismatch.Result, store.CallbackResultAmountMismatch)
+	}
+	if result := replay(mismatch); result != store.CallbackResultDuplicate {
+		t.Errorf("mismatch replay result = %q, want %q", result, store.CallbackResultDuplicate)
+	}
+	if err := db.First(&held, held.ID).Error; err != nil {
+		t.Fatalf("load order: %v", err)
+	}
+	if held.Status != store.OrderStatusPaymentMismatch || held.PaidAmount != 400 {
+		t.Errorf("order = %s paid %d, want payment_mismatch paid 400", held.Status, held.PaidAmount)
+	}
+	if balance, _ := store.GetUserBalance(db, user.ID); balance != 1000 {
+		t.Errorf("balance = %d, want 1000", balance)
+	}
+}
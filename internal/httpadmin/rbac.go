@@ -0,0 +1,164 @@
+package httpadmin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"shop-bot/internal/auth"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// legacyAdminID is the identity of logins with the ADMIN_TOKEN, which acts
+// as a super admin
+const legacyAdminID = "admin"
+
+// adminRole returns the current role of an authenticated identity. Roles
+// are read from the database on every request so role changes, disabled
+// admins and forced logouts take effect without waiting for tokens to
+// expire. issuedAt is when the token or session was created.
+func (s *Server) adminRole(userID string, issuedAt time.Time) (string, bool) {
+	if userID == legacyAdminID {
+		if s.db != nil && store.TokenLoginDisabled(s.db) {
+			return "", false
+		}
+		return auth.RoleSuperAdmin, true
+	}
+	id, err := strconv.ParseUint(userID, 10, 32)
+	if err != nil || s.db == nil {
+		return "", false
+	}
+	var admin store.AdminUser
+	if err := s.db.Select("id", "role", "is_active", "sessions_revoked_at").First(&admin, id).Error; err != nil {
+		return "", false
+	}
+	if !admin.IsActive || !auth.ValidRole(admin.Role) {
+		return "", false
+	}
+	// Tokens only carry whole seconds, so one issued in the same second
+	// as a forced logout is rejected too
+	if admin.SessionsRevokedAt != nil && issuedAt.Unix() <= admin.SessionsRevokedAt.Unix() {
+		return "", false
+	}
+	return admin.Role, true
+}
+
+// authorize checks the current role's permission on a resource: reads for
+// GET and HEAD requests, writes for everything else. API keys are checked
+// against their scopes instead.
+func (s *Server) authorize(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action := auth.ActionWrite
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			action = auth.ActionRead
+		}
+		permission := auth.Permission(resource, action)
+		allowed := auth.HasPermission(c.GetString("role"), permission)
+		if _, isAPIKey := c.Get("api_key_id"); isAPIKey {
+			allowed = auth.ScopesGrant(c.GetStringSlice("api_key_scopes"), permission)
+		}
+		if allowed {
+			c.Next()
+			return
+		}
+
+		if s.securityLogger != nil {
+			s.securityLogger.LogAccessDenied(c.GetString("user_id"), c.GetString("username"),
+				c.Request.URL.Path, "missing_permission:"+permission)
+		}
+		logger.Warn("Admin permission denied",
+			"username", c.GetString("username"),
+			"role", c.GetString("role"),
+			"permission", permission,
+			"path", c.Request.URL.Path)
+
+		message := "permission denied: " + permission
+		if action == auth.ActionRead &&
+			c.GetHeader("X-Requested-With") != "XMLHttpRequest" &&
+			!strings.Contains(c.GetHeader("Accept"), "application/json") {
+			c.HTML(http.StatusForbidden, "error.html", gin.H{"error": "没有权限访问此页面（" + permission + "）"})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": message})
+		}
+		c.Abort()
+	}
+}
+
+// handleAdminList shows admin users with their roles and the permissions of each role
+func (s *Server) handleAdminList(c *gin.Context) {
+	admins, err := store.ListAdminUsers(s.db)
+	if err != nil {
+		logger.Error("Failed to load admin users", "error", err)
+		c.String(http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	roles := auth.Roles()
+	permissions := make(map[string][]string, len(roles))
+	for _, role := range roles {
+		permissions[role] = auth.RolePermissions(role)
+	}
+
+	if c.GetHeader("Accept") == "application/json" {
+		c.JSON(http.StatusOK, gin.H{
+			"admins":      admins,
+			"roles":       roles,
+			"permissions": permissions,
+		})
+		return
+	}
+
+	// Permission matrix of resources by role for the page
+	type access struct{ Read, Write bool }
+	type matrixRow struct {
+		Resource string
+		Access   []access
+	}
+	matrix := make([]matrixRow, 0, len(auth.Resources))
+	for _, resource := range auth.Resources {
+		row := matrixRow{Resource: resource}
+		for _, role := range roles {
+			row.Access = append(row.Access, access{
+				Read:  auth.HasPermission(role, auth.Permission(resource, auth.ActionRead)),
+				Write: auth.HasPermission(role, auth.Permission(resource, auth.ActionWrite)),
+			})
+		}
+		matrix = append(matrix, row)
+	}
+
+	c.HTML(http.StatusOK, "admins.html", gin.H{
+		"admins":   admins,
+		"roles":    roles,
+		"matrix":   matrix,
+		"username": c.GetString("username"),
+	})
+}
+
+// handleAdminRoleUpdate changes the role of an admin user
+func (s *Server) handleAdminRoleUpdate(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	admin, previous, err := store.SetAdminRole(s.db, id, req.Role)
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+
+	s.auditAdminChange(c, "change_role", admin, previous, admin.Role)
+	c.JSON(http.StatusOK, gin.H{"message": "role updated", "admin": admin})
+}
@@ -0,0 +1,157 @@
+package httpadmin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"shop-bot/internal/auth"
+	"shop-bot/internal/store"
+)
+
+// authorizeStatus runs authorize for a resource with the identity set by
+// setup and returns the response status, 200 when the request got through
+func authorizeStatus(s *Server, resource, method string, setup func(*gin.Context)) int {
+	w := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(w)
+	r.Handle(method, "/", func(c *gin.Context) {
+		setup(c)
+		c.Next()
+	}, s.authorize(resource), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(method, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+// withRole signs the request in as an admin with a role
+func withRole(role string) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.Set("user_id", "1")
+		c.Set("role", role)
+	}
+}
+
+func TestAuthorizeRoles(t *testing.T) {
+	s := &Server{}
+	tests := []struct {
+		role     string
+		resource string
+		method   string
+		want     int
+	}{
+		{auth.RoleSuperAdmin, auth.ResourceSettings, http.MethodPost, http.StatusOK},
+		{auth.RoleOperator, auth.ResourceCodes, http.MethodPost, http.StatusOK},
+		{auth.RoleOperator, auth.ResourcePayments, http.MethodGet, http.StatusOK},
+		{auth.RoleOperator, auth.ResourcePayments, http.MethodPost, http.StatusForbidden},
+		{auth.RoleSupport, auth.ResourceOrders, http.MethodHead, http.StatusOK},
+		{auth.RoleSupport, auth.ResourceOrders, http.MethodDelete, http.StatusForbidden},
+		{auth.RoleViewer, auth.ResourceSettings, http.MethodGet, http.StatusForbidden},
+		{"", auth.ResourceOrders, http.MethodGet, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := authorizeStatus(s, tt.resource, tt.method, withRole(tt.role)); got != tt.want {
+			t.Errorf("%s %s on %s = %d, want %d", tt.role, tt.method, tt.resource, got, tt.want)
+		}
+	}
+}
+
+func TestAdminRoleOfTokenLogin(t *testing.T) {
+	db := newTestDB(t)
+	s := &Server{db: db}
+
+	if role, ok := s.adminRole(legacyAdminID, time.Time{}); !ok || role != auth.RoleSuperAdmin {
+		t.Fatalf("token login role = %q, %v, want super admin", role, ok)
+	}
+
+	admin := store.AdminUser{Username: "root", Role: auth.RoleSuperAdmin, IsActive: true, TOTPEnabled: true}
+	if err := db.Create(&admin).Error; err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	if err := store.SetSetting(db, store.SettingDisableTokenLogin, "true", "", "bool"); err != nil {
+		t.Fatalf("set setting: %v", err)
+	}
+	if _, ok := s.adminRole(legacyAdminID, time.Time{}); ok {
+		t.Fatal("token login session accepted after token login was disabled")
+	}
+	if role, ok := s.adminRole("1", time.Time{}); !ok || role != auth.RoleSuperAdmin {
+		t.Fatalf("admin account role = %q, %v", role, ok)
+	}
+}
+
+func TestAuthorizeAPIKeyScopes(t *testing.T) {
+	s := &Server{}
+	withScopes := func(scopes ...string) func(*gin.Context) {
+		return func(c *gin.Context) {
+			c.Set("api_key_id", uint(1))
+			c.Set("api_key_scopes", scopes)
+			// A role set by mistake must not widen the key
+			c.Set("role", auth.RoleSuperAdmin)
+		}
+	}
+
+	tests := []struct {
+		scopes   []string
+		resource string
+		method   string
+		want     int
+	}{
+		{[]string{"orders:read"}, auth.ResourceOrders, http.MethodGet, http.StatusOK},
+		{[]string{"orders:read"}, auth.ResourceOrders, http.MethodPost, http.StatusForbidden},
+		{[]string{"orders:write"}, auth.ResourceOrders, http.MethodPost, http.StatusOK},
+		{[]string{"orders:write"}, auth.ResourceOrders, http.MethodGet, http.StatusForbidden},
+		{[]string{"orders:read"}, auth.ResourceUsers, http.MethodGet, http.StatusForbidden},
+		{nil, auth.ResourceOrders, http.MethodGet, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := authorizeStatus(s, tt.resource, tt.method, withScopes(tt.scopes...)); got != tt.want {
+			t.Errorf("scopes %v %s on %s = %d, want %d", tt.scopes, tt.method, tt.resource, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	db := newTestDB(t)
+	s := &Server{db: db}
+
+	key, display, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	record := store.APIKey{Name: "erp", Prefix: display, KeyHash: hash}
+	if err := store.CreateAPIKey(db, &record, []string{"orders:read"}); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	authenticate := func(token string) (*gin.Context, bool) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		return c, s.authenticateAPIKey(c, token)
+	}
+
+	c, ok := authenticate(key)
+	if !ok {
+		t.Fatal("valid key rejected")
+	}
+	if scopes := c.GetStringSlice("api_key_scopes"); len(scopes) != 1 || scopes[0] != "orders:read" {
+		t.Fatalf("scopes = %v", scopes)
+	}
+	if role := c.GetString("role"); role != "" {
+		t.Fatalf("API key got role %q", role)
+	}
+
+	if _, ok := authenticate(key + "x"); ok {
+		t.Fatal("unknown key accepted")
+	}
+	if _, err := store.RevokeAPIKey(db, record.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, ok := authenticate(key); ok {
+		t.Fatal("revoked key accepted")
+	}
+}
@@ -98,6 +98,19 @@ func (s *Server) handleRechargeCardGenerate(c *gin.Context) {
 		return
 	}
 	
+	// The codes stay out of the audit log, they redeem the cards
+	if len(cards) > 0 {
+		s.auditChange(c, "generate_recharge_cards", "recharge_cards", nil, gin.H{
+			"count":             len(cards),
+			"amount_cents":      req.AmountCents,
+			"max_uses":          req.MaxUses,
+			"max_uses_per_user": req.MaxUsesPerUser,
+			"expires_at":        expiresAt,
+			"first_id":          cards[0].ID,
+			"last_id":           cards[len(cards)-1].ID,
+		})
+	}
+	
 	// Return generated codes for download
 	var codes []string
 	for _, card := range cards {
@@ -120,11 +133,13 @@ func (s *Server) handleRechargeCardDelete(c *gin.Context) {
 	}
 	
 	// Use new delete function
+	before := s.rechargeCardSnapshot(uint(id))
 	if err := store.DeleteRechargeCard(s.db, uint(id)); err != nil {
 		logger.Error("Failed to delete recharge card", "error", err, "id", id)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	s.auditChange(c, "delete_recharge_card", "recharge_card:"+idStr, before, nil)
 	
 	c.JSON(http.StatusOK, gin.H{"message": "Card deleted successfully"})
 }
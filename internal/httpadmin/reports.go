@@ -0,0 +1,66 @@
+package httpadmin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// handleProfitReport shows revenue, cost and profit of sold codes by
+// product, batch, day or month. from and to are inclusive dates and
+// default to the last 30 days.
+func (s *Server) handleProfitReport(c *gin.Context) {
+	groupBy := c.DefaultQuery("group", store.ProfitByProduct)
+
+	today := time.Now()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)
+	from, to := today.AddDate(0, 0, -29), today
+	if value := c.Query("from"); value != "" {
+		t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date, use YYYY-MM-DD"})
+			return
+		}
+		from = t
+	}
+	if value := c.Query("to"); value != "" {
+		t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date, use YYYY-MM-DD"})
+			return
+		}
+		to = t
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+
+	report, err := store.GetProfitReport(s.db, groupBy, from, to.AddDate(0, 0, 1))
+	if err == store.ErrInvalidProfitGrouping {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to build profit report", "error", err, "group", groupBy)
+		c.String(http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if c.GetHeader("Accept") == "application/json" {
+		c.JSON(http.StatusOK, gin.H{"report": report})
+		return
+	}
+
+	c.HTML(http.StatusOK, "reports_profit.html", gin.H{
+		"report": report,
+		"group":  groupBy,
+		"from":   from.Format("2006-01-02"),
+		"to":     to.Format("2006-01-02"),
+		"groups": []string{store.ProfitByProduct, store.ProfitByBatch, store.ProfitByDay, store.ProfitByMonth},
+	})
+}
@@ -1,6 +1,7 @@
 package httpadmin
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -17,12 +18,14 @@ import (
 	"shop-bot/internal/auth"
 	"shop-bot/internal/broadcast"
 	"shop-bot/internal/config"
+	"shop-bot/internal/currency"
 	logger "shop-bot/internal/log"
 	"shop-bot/internal/middleware"
 	"shop-bot/internal/notification"
-	payment "shop-bot/internal/payment/epay"
+	"shop-bot/internal/payment"
 	"shop-bot/internal/security"
 	"shop-bot/internal/store"
+	"shop-bot/internal/supplier"
 	"shop-bot/internal/ticket"
 )
 
@@ -30,13 +33,15 @@ type Server struct {
 	adminToken   string
 	db           *gorm.DB
 	bot          *tgbotapi.BotAPI
-	epay         *payment.Client
+	payments     *payment.Registry
 	config       *config.Config
 	configManager *config.Manager
 	broadcast    *broadcast.Service
 	notification *notification.Service
 	ticketService *ticket.Service
+	suppliers    *supplier.Service
 	jwtService   *auth.JWTService
+	currency     *currency.Service
 
 	// Security services
 	passwordService  *auth.PasswordService
@@ -54,6 +59,8 @@ func NewServer(adminToken string, db *gorm.DB) *Server {
 		return &Server{
 			adminToken: adminToken,
 			db:         db,
+			payments:   payment.NewRegistry(),
+			currency:   currency.NewService(db, nil),
 		}
 	}
 	
@@ -66,12 +73,6 @@ func NewServer(adminToken string, db *gorm.DB) *Server {
 		}
 	}
 	
-	// Initialize epay client
-	var epayClient *payment.Client
-	if cfg.EpayPID != "" && cfg.EpayKey != "" && cfg.EpayGateway != "" {
-		epayClient = payment.NewClient(cfg.EpayPID, cfg.EpayKey, cfg.EpayGateway)
-	}
-	
 	// Initialize broadcast service
 	var broadcastService *broadcast.Service
 	if bot != nil {
@@ -151,28 +152,38 @@ func NewServer(adminToken string, db *gorm.DB) *Server {
 			logger.Error("Failed to initialize data security", "error", err)
 		}
 		
-		// Security logger
+		// Security logger, persisting audit entries when there is a database
 		if cfg.EnableSecurityLogging {
 			securityLogger = security.NewSecurityLogger(true, cfg.MaskSensitiveData)
+			if db != nil {
+				securityLogger.SetAuditRecorder(store.NewAuditRecorder(db))
+			}
 		}
 	}
 	
-	return &Server{
+	server := &Server{
 		adminToken:      adminToken,
 		db:              db,
 		bot:             bot,
-		epay:            epayClient,
+		payments:        payment.NewRegistry(),
 		config:          cfg,
 		broadcast:       broadcastService,
 		notification:    notificationService,
 		ticketService:   ticketService,
+		suppliers:       supplier.NewService(db),
 		jwtService:      jwtService,
+		currency:        currency.NewService(db, cfg),
 		passwordService: passwordService,
 		rateLimiter:     rateLimiter,
 		sessionManager:  sessionManager,
 		dataSecurity:    dataSecurity,
 		securityLogger:  securityLogger,
 	}
+
+	// Register payment providers that are configured
+	server.configurePaymentProviders()
+
+	return server
 }
 
 // NewServerWithApp creates a new server with application reference
@@ -185,6 +196,7 @@ func NewServerWithApp(adminToken string, app interface{}) *Server {
 	
 	server := &Server{
 		adminToken: adminToken,
+		payments:   payment.NewRegistry(),
 	}
 	
 	// Try to get DB field
@@ -198,19 +210,6 @@ func NewServerWithApp(adminToken string, app interface{}) *Server {
 	if cfgField := appValue.FieldByName("Config"); cfgField.IsValid() {
 		if cfg, ok := cfgField.Interface().(*config.Config); ok {
 			server.config = cfg
-
-			// Initialize payment client with proper validation
-			if cfg.EpayPID != "" && cfg.EpayKey != "" && cfg.EpayGateway != "" {
-				server.epay = payment.NewClient(cfg.EpayPID, cfg.EpayKey, cfg.EpayGateway)
-				logger.Info("Payment client initialized on server startup",
-					"epay_pid", cfg.EpayPID,
-					"epay_gateway", cfg.EpayGateway)
-			} else {
-				logger.Info("Payment client not initialized due to incomplete configuration",
-					"epay_pid_empty", cfg.EpayPID == "",
-					"epay_key_empty", cfg.EpayKey == "",
-					"epay_gateway_empty", cfg.EpayGateway == "")
-			}
 		}
 	}
 
@@ -239,11 +238,34 @@ func NewServerWithApp(adminToken string, app interface{}) *Server {
 		}
 	}
 	
+	// Try to get Payments field, the registry the bot checks out with
+	if paymentsField := appValue.FieldByName("Payments"); paymentsField.IsValid() {
+		if payments, ok := paymentsField.Interface().(*payment.Registry); ok && payments != nil {
+			server.payments = payments
+		}
+	}
+	
+	// Try to get Supplier field
+	if supplierField := appValue.FieldByName("Supplier"); supplierField.IsValid() {
+		if suppliers, ok := supplierField.Interface().(*supplier.Service); ok {
+			server.suppliers = suppliers
+		}
+	}
+	if server.suppliers == nil && server.db != nil {
+		server.suppliers = supplier.NewService(server.db)
+	}
+	
 	// Initialize notification service if we have bot and config
 	if server.bot != nil && server.config != nil {
 		server.notification = notification.NewService(server.bot, server.config, server.db)
 	}
 	
+	// Initialize currency service
+	server.currency = currency.NewService(server.db, server.config)
+	
+	// Register payment providers once config and bot are known
+	server.configurePaymentProviders()
+	
 	// Initialize ticket service
 	if server.bot != nil && server.db != nil {
 		server.ticketService = ticket.NewService(server.db, server.bot)
@@ -303,9 +325,12 @@ func NewServerWithApp(adminToken string, app interface{}) *Server {
 			logger.Error("Failed to initialize data security", "error", err)
 		}
 		
-		// Security logger
+		// Security logger, persisting audit entries when there is a database
 		if cfg.EnableSecurityLogging {
 			server.securityLogger = security.NewSecurityLogger(true, cfg.MaskSensitiveData)
+			if server.db != nil {
+				server.securityLogger.SetAuditRecorder(store.NewAuditRecorder(server.db))
+			}
 		}
 	}
 	
@@ -341,8 +366,8 @@ func toInt64(v interface{}) (int64, error) {
 func (s *Server) Router() *gin.Engine {
 	r := gin.Default()
 	
-	// Get currency settings
-	_, currencySymbol := store.GetCurrencySettings(s.db, s.config)
+	// Currency formatting for templates
+	money := currency.NewService(s.db, s.config)
 	
 	// Add template functions BEFORE loading templates
 	r.SetFuncMap(template.FuncMap{
@@ -376,7 +401,11 @@ func (s *Server) Router() *gin.Engine {
 			return result
 		},
 		"currency": func() string {
-			return currencySymbol
+			return money.Base().Symbol
+		},
+		"money": func(cents interface{}) string {
+			f, _ := toFloat64(cents)
+			return money.Format(int(f))
 		},
 		"plus": func(a, b interface{}) int64 {
 			ai, _ := toInt64(a)
@@ -479,88 +508,150 @@ func (s *Server) SetupRoutes(r *gin.Engine) {
 	r.POST("/api/refresh", s.handleRefreshToken)
 
 	// Payment webhook routes
-	r.POST("/payment/epay/notify", s.handleEpayNotify)
+	r.POST("/payment/:provider/notify", s.handlePaymentNotify)
+	r.GET("/payment/:provider/notify", s.handlePaymentNotify)
 	r.GET("/payment/return", s.handlePaymentReturn)
 	
 	// Test bot endpoint (protected)
-	r.POST("/admin/test-bot/:user_id", s.authMiddleware(), s.handleTestBot)
+	r.POST("/admin/test-bot/:user_id", s.authMiddleware(), s.authorize(auth.ResourceSettings), s.handleTestBot)
 
-	// Admin routes (protected)
+	// Admin routes (protected). Every group below checks the permission of
+	// its resource: GET needs "<resource>:read", other methods "<resource>:write".
 	adminGroup := r.Group("/admin", s.authMiddleware())
 	{
 		// Product management
-		adminGroup.GET("/products", s.handleProductList)
-		adminGroup.GET("/products/test", func(c *gin.Context) {
+		products := adminGroup.Group("", s.authorize(auth.ResourceProducts))
+		products.GET("/products", s.handleProductList)
+		products.GET("/products/test", func(c *gin.Context) {
 			c.HTML(http.StatusOK, "product_test.html", nil)
 		})
-		adminGroup.POST("/products", s.handleProductCreate)
-		adminGroup.PUT("/products/:id", s.handleProductUpdate)
-		adminGroup.DELETE("/products/:id", s.handleProductDelete)
-		adminGroup.PUT("/products/:id/restore", s.handleProductRestore)
-		adminGroup.DELETE("/products/:id/permanent", s.handleProductPermanentDelete)
-		adminGroup.GET("/products/:id/codes", s.handleProductCodes)
-		adminGroup.POST("/products/:id/codes/upload", s.handleCodesUpload)
-		adminGroup.DELETE("/codes/:id", s.handleCodeDelete)
-		adminGroup.GET("/codes/template", s.handleCodeTemplate)
+		products.POST("/products", s.handleProductCreate)
+		products.PUT("/products/:id", s.handleProductUpdate)
+		products.DELETE("/products/:id", s.handleProductDelete)
+		products.PUT("/products/:id/restore", s.handleProductRestore)
+		products.DELETE("/products/:id/permanent", s.handleProductPermanentDelete)
+
+		// Code inventory and supplier restocking
+		codes := adminGroup.Group("", s.authorize(auth.ResourceCodes))
+		codes.GET("/products/:id/codes", s.handleProductCodes)
+		codes.POST("/products/:id/codes/upload", s.handleCodesUpload)
+		codes.POST("/products/:id/codes/import", s.handleCodesImport)
+		codes.GET("/products/:id/codes/template", s.handleProductCodeTemplate)
+		codes.PUT("/products/:id/code-fields", s.handleProductCodeFields)
+		codes.POST("/products/:id/codes/bulk", s.handleCodesBulk)
+		codes.GET("/products/:id/codes/export", s.handleCodesExport)
+		codes.GET("/products/:id/supplier", s.handleProductSupplier)
+		codes.PUT("/products/:id/supplier", s.handleProductSupplierSave)
+		codes.DELETE("/products/:id/supplier", s.handleProductSupplierDelete)
+		codes.POST("/products/:id/supplier/test", s.handleProductSupplierTest)
+		codes.POST("/products/:id/supplier/restock", s.handleProductSupplierRestock)
+		codes.DELETE("/codes/:id", s.handleCodeDelete)
+		codes.GET("/codes/template", s.handleCodeTemplate)
 
 		// Order management
-		adminGroup.GET("/orders", s.handleOrderList)
+		orders := adminGroup.Group("", s.authorize(auth.ResourceOrders))
+		orders.GET("/orders", s.handleOrderList)
+		orders.POST("/orders/:id/resolve-mismatch", s.handleResolvePaymentMismatch)
+		orders.POST("/api/orders/cleanup", s.handleCleanupOrders)
+
+		// Reports
+		reports := adminGroup.Group("", s.authorize(auth.ResourceReports))
+		reports.GET("/reports/profit", s.handleProfitReport)
 		
 		// User management
-		adminGroup.GET("/users", s.handleUserList)
-		adminGroup.GET("/users/:id", s.handleUserDetail)
+		users := adminGroup.Group("", s.authorize(auth.ResourceUsers))
+		users.GET("/users", s.handleUserList)
+		users.GET("/users/:id", s.handleUserDetail)
 
 		// Recharge card management
-		adminGroup.GET("/recharge-cards", s.handleRechargeCardList)
-		adminGroup.POST("/recharge-cards/generate", s.handleRechargeCardGenerate)
-		adminGroup.DELETE("/recharge-cards/:id", s.handleRechargeCardDelete)
-		adminGroup.GET("/recharge-cards/:id/usage", s.handleRechargeCardUsage)
-
-		// Template management
-		adminGroup.GET("/templates", s.handleTemplateList)
-		adminGroup.POST("/templates/:id", s.handleTemplateUpdate)
-
-		// System settings
-		adminGroup.GET("/settings", s.handleSettingsList)
-		adminGroup.POST("/settings", s.handleSettingsUpdate)
-		
-		// FAQ management
-		adminGroup.GET("/faq", s.handleFAQList)
-		adminGroup.POST("/faq", s.handleFAQCreate)
-		adminGroup.PUT("/faq/:id", s.handleFAQUpdate)
-		adminGroup.DELETE("/faq/:id", s.handleFAQDelete)
-		adminGroup.PUT("/faq/:id/sort", s.handleFAQSort)
-		adminGroup.POST("/faq/init", s.handleFAQInit)
+		rechargeCards := adminGroup.Group("", s.authorize(auth.ResourceRechargeCards))
+		rechargeCards.GET("/recharge-cards", s.handleRechargeCardList)
+		rechargeCards.POST("/recharge-cards/generate", s.handleRechargeCardGenerate)
+		rechargeCards.DELETE("/recharge-cards/:id", s.handleRechargeCardDelete)
+		rechargeCards.GET("/recharge-cards/:id/usage", s.handleRechargeCardUsage)
+
+		// Withdrawal approval queue
+		withdrawals := adminGroup.Group("", s.authorize(auth.ResourceWithdrawals))
+		withdrawals.GET("/withdrawals", s.handleWithdrawalList)
+		withdrawals.POST("/withdrawals/:id/approve", s.handleWithdrawalApprove)
+		withdrawals.POST("/withdrawals/:id/reject", s.handleWithdrawalReject)
+
+		// Payment callback log
+		payments := adminGroup.Group("", s.authorize(auth.ResourcePayments))
+		payments.GET("/payment-callbacks", s.handlePaymentCallbackList)
+		payments.POST("/payment-callbacks/:id/replay", s.handlePaymentCallbackReplay)
+
+		// Message templates and FAQ
+		content := adminGroup.Group("", s.authorize(auth.ResourceContent))
+		content.GET("/templates", s.handleTemplateList)
+		content.POST("/templates/:id", s.handleTemplateUpdate)
+		content.GET("/faq", s.handleFAQList)
+		content.POST("/faq", s.handleFAQCreate)
+		content.PUT("/faq/:id", s.handleFAQUpdate)
+		content.DELETE("/faq/:id", s.handleFAQDelete)
+		content.PUT("/faq/:id/sort", s.handleFAQSort)
+		content.POST("/faq/init", s.handleFAQInit)
 		
 		// Broadcast management
-		adminGroup.GET("/broadcast", s.handleBroadcastList)
-		adminGroup.POST("/broadcast", s.handleBroadcastCreate)
-		adminGroup.POST("/broadcast/send", s.handleBroadcastSend)  // Add this route for AJAX requests
-		adminGroup.GET("/broadcast/:id", s.handleBroadcastDetail)
+		broadcasts := adminGroup.Group("", s.authorize(auth.ResourceBroadcast))
+		broadcasts.GET("/broadcast", s.handleBroadcastList)
+		broadcasts.POST("/broadcast", s.handleBroadcastCreate)
+		broadcasts.POST("/broadcast/send", s.handleBroadcastSend)  // Add this route for AJAX requests
+		broadcasts.GET("/broadcast/:id", s.handleBroadcastDetail)
 		
 		// Ticket management
-		adminGroup.GET("/tickets", s.handleTicketList)
-		adminGroup.GET("/tickets/:id", s.handleTicketDetail)
-		adminGroup.POST("/tickets/:id/reply", s.handleTicketReply)
-		adminGroup.PUT("/tickets/:id/status", s.handleTicketStatusUpdate)
-		adminGroup.PUT("/tickets/:id/assign", s.handleTicketAssign)
-		adminGroup.GET("/ticket-templates", s.handleTicketTemplates)
-
-		// Admin profile
-		adminGroup.GET("/profile/telegram", s.handleGetAdminTelegram)
-		adminGroup.POST("/profile/telegram", s.handleSetAdminTelegram)
-		adminGroup.POST("/ticket-templates", s.handleTicketTemplateCreate)
-		adminGroup.PUT("/ticket-templates/:id", s.handleTicketTemplateUpdate)
-		adminGroup.DELETE("/ticket-templates/:id", s.handleTicketTemplateDelete)
-		
-		// Order maintenance APIs
-		adminGroup.POST("/api/settings", s.handleSaveSettings)
-		adminGroup.POST("/api/settings/core", s.handleSaveCoreSettings)
-		adminGroup.POST("/api/settings/payment", s.handleSavePaymentSettings)
-		adminGroup.POST("/api/orders/cleanup", s.handleCleanupOrders)
+		tickets := adminGroup.Group("", s.authorize(auth.ResourceTickets))
+		tickets.GET("/tickets", s.handleTicketList)
+		tickets.GET("/tickets/:id", s.handleTicketDetail)
+		tickets.POST("/tickets/:id/reply", s.handleTicketReply)
+		tickets.PUT("/tickets/:id/status", s.handleTicketStatusUpdate)
+		tickets.PUT("/tickets/:id/assign", s.handleTicketAssign)
+		tickets.GET("/ticket-templates", s.handleTicketTemplates)
+		tickets.POST("/ticket-templates", s.handleTicketTemplateCreate)
+		tickets.PUT("/ticket-templates/:id", s.handleTicketTemplateUpdate)
+		tickets.DELETE("/ticket-templates/:id", s.handleTicketTemplateDelete)
+
+		// System settings and exchange rates
+		settings := adminGroup.Group("", s.authorize(auth.ResourceSettings))
+		settings.GET("/settings", s.handleSettingsList)
+		settings.POST("/settings", s.handleSettingsUpdate)
+		settings.POST("/api/settings", s.handleSaveSettings)
+		settings.POST("/api/settings/core", s.handleSaveCoreSettings)
+		settings.POST("/api/settings/payment", s.handleSavePaymentSettings)
+		settings.GET("/currencies", s.handleCurrencyList)
+		settings.POST("/currencies", s.handleCurrencySave)
+		settings.DELETE("/currencies/:code", s.handleCurrencyDelete)
+
+		// Admin users and roles
+		admins := adminGroup.Group("", s.authorize(auth.ResourceAdmins))
+		admins.GET("/admins", s.handleAdminList)
+		admins.POST("/admins", s.handleAdminCreate)
+		admins.PUT("/admins/:id/role", s.handleAdminRoleUpdate)
+		admins.PUT("/admins/:id/active", s.handleAdminActive)
+		admins.PUT("/admins/:id/password", s.handleAdminPasswordReset)
+		admins.PUT("/admins/:id/telegram", s.handleAdminTelegram)
+		admins.POST("/admins/:id/logout", s.handleAdminLogout)
+		admins.DELETE("/admins/:id", s.handleAdminDelete)
+		admins.DELETE("/admins/:id/2fa", s.handleAdminTwoFactorReset)
+		admins.GET("/api-keys", s.handleAPIKeyList)
+		admins.POST("/api-keys", s.handleAPIKeyCreate)
+		admins.POST("/api-keys/:id/revoke", s.handleAPIKeyRevoke)
 
-		// Dashboard
-		adminGroup.GET("/", s.handleAdminDashboard)
+		// Audit log
+		audit := adminGroup.Group("", s.authorize(auth.ResourceAudit))
+		audit.GET("/audit-logs", s.handleAuditLogList)
+		audit.GET("/audit-logs/export", s.handleAuditLogExport)
+
+		// Own profile and dashboard, open to every role but not to API keys
+		account := adminGroup.Group("", s.denyAPIKeys())
+		account.GET("/profile/telegram", s.handleGetAdminTelegram)
+		account.POST("/profile/telegram", s.handleSetAdminTelegram)
+		account.GET("/profile/2fa", s.handleTwoFactorPage)
+		account.POST("/profile/2fa/setup", s.handleTwoFactorSetup)
+		account.POST("/profile/2fa/enable", s.handleTwoFactorEnable)
+		account.POST("/profile/2fa/disable", s.handleTwoFactorDisable)
+		account.POST("/profile/2fa/recovery-codes", s.handleTwoFactorRecoveryCodes)
+		account.GET("/", s.handleAdminDashboard)
 	}
 }
 
@@ -576,13 +667,16 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 			if err == nil && sessionID != "" {
 				session, err := s.sessionManager.ValidateSession(sessionID, clientIP, userAgent)
 				if err == nil {
-					// Valid session found
-					c.Set("session_id", sessionID)
-					c.Set("user_id", session.UserID)
-					c.Set("username", session.Username)
-					c.Set("role", session.Role)
-					c.Next()
-					return
+					if role, ok := s.adminRole(session.UserID, session.CreatedAt); ok {
+						// Valid session found
+						c.Set("session_id", sessionID)
+						c.Set("user_id", session.UserID)
+						c.Set("username", session.Username)
+						c.Set("role", role)
+						c.Next()
+						s.logDataAccess(c)
+						return
+					}
 				}
 			}
 		}
@@ -606,29 +700,39 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 			}
 		}
 
-		// 3. Validate token
+		// 3. API keys of integrations, limited to their scopes
+		if auth.IsAPIKey(token) {
+			if s.authenticateAPIKey(c, token) {
+				c.Next()
+				s.logDataAccess(c)
+				return
+			}
+			token = ""
+		}
+
+		// 4. Validate token
 		if token != "" {
 			// First try JWT validation
 			if s.jwtService != nil {
 				claims, err := s.jwtService.ValidateToken(token)
+				role, active := "", false
 				if err == nil {
-					// Store claims in context for later use
+					var issuedAt time.Time
+					if claims.IssuedAt != nil {
+						issuedAt = claims.IssuedAt.Time
+					}
+					role, active = s.adminRole(claims.UserID, issuedAt)
+				}
+				if err == nil && active {
+					// Store claims in context for later use. The role comes
+					// from the admin user, not the token, so it is current.
 					c.Set("user_claims", claims)
 					c.Set("user_id", claims.UserID)
 					c.Set("username", claims.Username)
-					c.Set("role", claims.Role)
-
-					// Log data access if security logger is available
-					if s.securityLogger != nil {
-						s.securityLogger.LogDataAccess(
-							claims.UserID,
-							claims.Username,
-							c.Request.URL.Path,
-							c.Request.Method,
-						)
-					}
+					c.Set("role", role)
 
 					c.Next()
+					s.logDataAccess(c)
 					return
 				}
 				// Log JWT validation error for debugging
@@ -638,12 +742,13 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 			}
 
 			// Fall back to legacy token check for backward compatibility
-			if token == s.adminToken {
+			if token == s.adminToken && (s.db == nil || !store.TokenLoginDisabled(s.db)) {
 				// Set default admin claims for legacy token
-				c.Set("user_id", "admin")
+				c.Set("user_id", legacyAdminID)
 				c.Set("username", "admin")
-				c.Set("role", "admin")
+				c.Set("role", auth.RoleSuperAdmin)
 				c.Next()
+				s.logDataAccess(c)
 				return
 			}
 		}
@@ -674,16 +779,39 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 	}
 }
 
+// logDataAccess logs the request of an authenticated admin once it was
+// handled, if the security logger is available. Failed requests changed
+// nothing and are left out.
+func (s *Server) logDataAccess(c *gin.Context) {
+	if s.securityLogger == nil || c.Writer.Status() >= http.StatusBadRequest {
+		return
+	}
+	s.securityLogger.LogDataAccess(
+		c.GetString("user_id"),
+		c.GetString("username"),
+		c.Request.URL.Path,
+		c.Request.Method,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+	)
+}
 
 // handleLoginPage serves the login page
 func (s *Server) handleLoginPage(c *gin.Context) {
 	c.HTML(http.StatusOK, "login.html", nil)
 }
 
-// handleLogin processes login request
+// handleLogin processes login request. Admin users log in with username
+// and password, plus a TOTP or recovery code when two-factor authentication
+// is enabled; the ADMIN_TOKEN still logs in as the super admin, with no
+// second factor, unless the disable_token_login setting is on and a super
+// admin has two-factor authentication.
 func (s *Server) handleLogin(c *gin.Context) {
 	var req struct {
-		Token string `json:"token"`
+		Token    string `json:"token"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+		OTPCode  string `json:"otp_code"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -708,8 +836,7 @@ func (s *Server) handleLogin(c *gin.Context) {
 		}
 	}
 	
-	// Verify token against admin token
-	if req.Token != s.adminToken {
+	loginFailed := func(username, reason string) {
 		// Record failed attempt
 		if s.rateLimiter != nil {
 			s.rateLimiter.RecordAttempt(clientIP, false)
@@ -717,10 +844,33 @@ func (s *Server) handleLogin(c *gin.Context) {
 		
 		// Log failed login
 		if s.securityLogger != nil {
-			s.securityLogger.LogLoginFailed("admin", clientIP, userAgent, "invalid_token")
+			s.securityLogger.LogLoginFailed(username, clientIP, userAgent, reason)
 		}
 		
 		JSONError(c, NewUnauthorizedError("Invalid credentials"))
+	}
+	
+	userID, username, role := legacyAdminID, "admin", auth.RoleSuperAdmin
+	if req.Username != "" {
+		admin, err := s.checkAdminPassword(req.Username, req.Password)
+		if err != nil {
+			loginFailed(req.Username, err.Error())
+			return
+		}
+		if admin.TOTPEnabled && !s.loginSecondFactor(c, admin, req.OTPCode, loginFailed) {
+			return
+		}
+		userID = strconv.FormatUint(uint64(admin.ID), 10)
+		username, role = admin.Username, admin.Role
+	} else if req.Token != s.adminToken {
+		// Verify token against admin token
+		loginFailed("admin", "invalid_token")
+		return
+	} else if s.db != nil && store.TokenLoginDisabled(s.db) {
+		if s.securityLogger != nil {
+			s.securityLogger.LogLoginFailed("admin", clientIP, userAgent, "token_login_disabled")
+		}
+		JSONError(c, NewForbiddenError("ADMIN_TOKEN login is disabled, log in with an admin account"))
 		return
 	}
 	
@@ -729,10 +879,79 @@ func (s *Server) handleLogin(c *gin.Context) {
 		s.rateLimiter.RecordAttempt(clientIP, true)
 	}
 	
+	s.completeLogin(c, userID, username, role)
+}
+
+// checkAdminPassword returns the active admin user matching a username and
+// password. The error is the reason for the security log.
+func (s *Server) checkAdminPassword(username, password string) (*store.AdminUser, error) {
+	if s.db == nil {
+		return nil, errors.New("no_database")
+	}
+	admin, err := store.GetAdminUserByUsername(s.db, username)
+	if err != nil {
+		return nil, errors.New("unknown_user")
+	}
+	if !admin.IsActive {
+		return nil, errors.New("disabled")
+	}
+	if admin.Password == "" {
+		return nil, errors.New("no_password")
+	}
+	if err := s.adminPasswords().ComparePassword(admin.Password, password); err != nil {
+		return nil, errors.New("invalid_password")
+	}
+	return admin, nil
+}
+
+// loginSecondFactor checks the second factor of an admin whose password
+// was accepted. Without a code the client is asked for one and no attempt
+// is recorded; wrong codes count against both the IP and the account.
+func (s *Server) loginSecondFactor(c *gin.Context, admin *store.AdminUser, code string, loginFailed func(username, reason string)) bool {
+	if strings.TrimSpace(code) == "" {
+		JSONError(c, AppError{
+			Code:       ErrCodeTwoFactorRequired,
+			Message:    "Two-factor authentication code required",
+			HTTPStatus: http.StatusUnauthorized,
+		})
+		return false
+	}
+	
+	if allowed, remaining := s.secondFactorAllowed(admin.Username); !allowed {
+		if s.securityLogger != nil {
+			s.securityLogger.LogRateLimited(c.ClientIP(), c.Request.UserAgent(), "/api/login")
+		}
+		JSONError(c, NewTooManyRequestsError(auth.FormatLockoutMessage(remaining)))
+		return false
+	}
+	
+	method, ok, err := s.checkSecondFactor(admin, code)
+	if err != nil {
+		logger.Error("Failed to check two-factor code", "error", err, "admin_id", admin.ID)
+		JSONError(c, NewInternalError(err))
+		return false
+	}
+	s.recordSecondFactor(admin.Username, ok)
+	if !ok {
+		loginFailed(admin.Username, "invalid_2fa_code")
+		return false
+	}
+	
+	logger.Info("Admin passed two-factor authentication", "admin_id", admin.ID, "method", method)
+	return true
+}
+
+// completeLogin creates the session and tokens of an authenticated admin
+// and writes the login response
+func (s *Server) completeLogin(c *gin.Context, userID, username, role string) {
+	clientIP := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	legacy := userID == legacyAdminID
+	
 	// Create session if session manager is available
 	var sessionID string
 	if s.sessionManager != nil {
-		session, err := s.sessionManager.CreateSession("admin", "admin", "admin", clientIP, userAgent)
+		session, err := s.sessionManager.CreateSession(userID, username, role, clientIP, userAgent)
 		if err != nil {
 			logger.Error("Failed to create session", "error", err)
 		} else {
@@ -746,34 +965,53 @@ func (s *Server) handleLogin(c *gin.Context) {
 	
 	if s.jwtService != nil {
 		// Generate JWT tokens
-		token, err := s.jwtService.GenerateToken("admin", "admin", "admin")
+		token, err := s.jwtService.GenerateToken(userID, username, role)
 		if err != nil {
 			logger.Error("Failed to generate JWT token", "error", err)
 			// Fall back to legacy token
-			responseToken = s.adminToken
+			if legacy {
+				responseToken = s.adminToken
+			}
 		} else {
 			responseToken = token
 			
 			// Generate refresh token
-			refresh, err := s.jwtService.GenerateRefreshToken("admin")
+			refresh, err := s.jwtService.GenerateRefreshToken(userID)
 			if err != nil {
 				logger.Error("Failed to generate refresh token", "error", err)
 			} else {
 				refreshToken = refresh
 			}
 		}
-	} else {
+	} else if legacy {
 		// Use legacy token
 		responseToken = s.adminToken
 	}
 	
+	// Admin users never get the legacy token, so without a JWT or a
+	// session they cannot log in
+	if responseToken == "" && sessionID == "" {
+		JSONError(c, NewInternalError(fmt.Errorf("no login method available for admin users")))
+		return
+	}
+	
+	if !legacy && s.db != nil {
+		if id, err := strconv.ParseUint(userID, 10, 32); err == nil {
+			if err := store.UpdateAdminLastLogin(s.db, uint(id)); err != nil {
+				logger.Error("Failed to record admin login", "error", err, "admin_id", id)
+			}
+		}
+	}
+	
 	// Log successful login
 	if s.securityLogger != nil {
-		s.securityLogger.LogLogin("admin", "admin", clientIP, userAgent)
+		s.securityLogger.LogLogin(userID, username, clientIP, userAgent)
 	}
 	
 	// Set cookie with the token
-	c.SetCookie("admin_token", responseToken, 86400*7, "/", "", false, true) // 7 days
+	if responseToken != "" {
+		c.SetCookie("admin_token", responseToken, 86400*7, "/", "", false, true) // 7 days
+	}
 	
 	// Set session cookie if available
 	if sessionID != "" {
@@ -837,13 +1075,40 @@ func (s *Server) handleRefreshToken(c *gin.Context) {
 		return
 	}
 	
-	// Generate new access token
-	newToken, err := s.jwtService.RefreshToken(refreshToken)
+	claims, err := s.jwtService.ParseRefreshToken(refreshToken)
 	if err != nil {
 		JSONError(c, NewUnauthorizedError("Invalid refresh token"))
 		return
 	}
 	
+	// The admin must still be active and not logged out since the refresh
+	// token was issued
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	role, ok := s.adminRole(claims.Subject, issuedAt)
+	if !ok {
+		JSONError(c, NewUnauthorizedError("Invalid refresh token"))
+		return
+	}
+	username := "admin"
+	if claims.Subject != legacyAdminID {
+		var admin store.AdminUser
+		if err := s.db.Select("username").First(&admin, claims.Subject).Error; err != nil {
+			JSONError(c, NewUnauthorizedError("Invalid refresh token"))
+			return
+		}
+		username = admin.Username
+	}
+	
+	// Generate new access token
+	newToken, err := s.jwtService.GenerateToken(claims.Subject, username, role)
+	if err != nil {
+		JSONError(c, NewInternalError(err))
+		return
+	}
+	
 	// Set new token in cookie
 	c.SetCookie("admin_token", newToken, 86400*7, "/", "", false, true)
 	
@@ -6,15 +6,17 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"shop-bot/internal/auth"
+	"shop-bot/internal/currency"
+	"shop-bot/internal/payment/epay"
 	"shop-bot/internal/store"
 	logger "shop-bot/internal/log"
-	payment "shop-bot/internal/payment/epay"
 )
 
 // handleSettings shows the settings page
 func (s *Server) handleSettings(c *gin.Context) {
 	// Get currency settings
-	currency, symbol := store.GetCurrencySettings(s.db, nil)
+	currencyCode, symbol := store.GetCurrencySettings(s.db, nil)
 
 	// Get order settings
 	orderSettings, err := store.GetSettingsMap(s.db)
@@ -43,48 +45,47 @@ func (s *Server) handleSettings(c *gin.Context) {
 		"epay_pid": s.config.EpayPID,
 		"epay_key": strings.Repeat("*", 20), // Mask the key
 		"epay_gateway": s.config.EpayGateway,
+		"epay_sign_type": s.config.EpaySignType,
+		"epay_private_key": "", // Never sent back, leave blank to keep the current key
+		"epay_private_key_set": s.config.EpayPrivateKey != "",
+		"epay_platform_public_key": s.config.EpayPlatformPublicKey,
 		"base_url": s.config.BaseURL,
+		"telegram_payment_token": strings.Repeat("*", 20), // Mask the token
 	}
 
 	// Get currency list
-	currencies := []struct {
-		Code   string
-		Symbol string
-		Name   string
-	}{
-		{"CNY", "¥", "人民币"},
-		{"USD", "$", "美元"},
-		{"EUR", "€", "欧元"},
-		{"GBP", "£", "英镑"},
-		{"JPY", "¥", "日元"},
-		{"HKD", "$", "港币"},
-		{"TWD", "NT$", "新台币"},
-		{"KRW", "₩", "韩元"},
-		{"SGD", "$", "新加坡元"},
-		{"AUD", "$", "澳元"},
-		{"CAD", "$", "加元"},
-		{"THB", "฿", "泰铢"},
-		{"MYR", "RM", "马来西亚令吉"},
-		{"PHP", "₱", "菲律宾比索"},
-		{"IDR", "Rp", "印尼盾"},
-		{"VND", "₫", "越南盾"},
-		{"INR", "₹", "印度卢比"},
-		{"RUB", "₽", "俄罗斯卢布"},
-		{"BRL", "R$", "巴西雷亚尔"},
-		{"MXN", "$", "墨西哥比索"},
-	}
+	currencies := currency.Supported
 
 	c.HTML(http.StatusOK, "settings.html", gin.H{
-		"currency":      currency,
+		"currency":      currencyCode,
 		"symbol":        symbol,
 		"currencies":    currencies,
 		"orderSettings": orderSettings,
 		"orderStats":    orderStats,
 		"coreSettings": coreSettings,
 		"paymentSettings": paymentSettings,
+		"paymentProviders": s.paymentProviderOptions(),
 	})
 }
 
+// paymentProviderOptions lists registered payment providers for the settings page
+func (s *Server) paymentProviderOptions() []gin.H {
+	enabled := make(map[string]bool)
+	for _, name := range store.GetEnabledPaymentProviders(s.db) {
+		enabled[name] = true
+	}
+
+	var options []gin.H
+	for _, p := range s.payments.All() {
+		options = append(options, gin.H{
+			"name":         p.Name(),
+			"display_name": p.DisplayName(),
+			"enabled":      enabled[p.Name()],
+		})
+	}
+	return options
+}
+
 // handleSaveSettings saves settings via API
 func (s *Server) handleSaveSettings(c *gin.Context) {
 	var req map[string]string
@@ -93,6 +94,7 @@ func (s *Server) handleSaveSettings(c *gin.Context) {
 		return
 	}
 	
+	before := s.settingsSnapshot()
 	// Save each setting
 	for key, value := range req {
 		var description, settingType string
@@ -114,6 +116,20 @@ func (s *Server) handleSaveSettings(c *gin.Context) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cleanup days"})
 				return
 			}
+		case store.SettingMaxPendingOrders:
+			description = "每个用户同时待支付的订单上限（0 表示不限制）"
+			settingType = "int"
+			if limit, err := strconv.Atoi(value); err != nil || limit < 0 || limit > 100 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pending order limit"})
+				return
+			}
+		case store.SettingCodeDuplicateScope:
+			description = "卡密查重范围（product 同一商品内，global 全部商品）"
+			settingType = "string"
+			if value != store.CodeDuplicateScopeProduct && value != store.CodeDuplicateScopeGlobal {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid duplicate scope"})
+				return
+			}
 		case "enable_auto_expire":
 			description = "启用订单自动过期"
 			settingType = "bool"
@@ -128,6 +144,75 @@ func (s *Server) handleSaveSettings(c *gin.Context) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid boolean value"})
 				return
 			}
+		case store.SettingEnableTransfer:
+			description = "启用用户间余额转账"
+			settingType = "bool"
+			if value != "true" && value != "false" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid boolean value"})
+				return
+			}
+		case store.SettingTransferMinCents:
+			description = "单笔转账最低金额（分）"
+			settingType = "int"
+			if cents, err := strconv.Atoi(value); err != nil || cents < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid minimum transfer amount"})
+				return
+			}
+		case store.SettingTransferDailyLimitCents:
+			description = "每日转账限额（分）"
+			settingType = "int"
+			// 0 disables the daily limit
+			if cents, err := strconv.Atoi(value); err != nil || cents < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid daily transfer limit"})
+				return
+			}
+		case store.SettingEnableWithdrawal:
+			description = "启用余额提现申请"
+			settingType = "bool"
+			if value != "true" && value != "false" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid boolean value"})
+				return
+			}
+		case store.SettingWithdrawMinCents:
+			description = "单笔提现最低金额（分）"
+			settingType = "int"
+			if cents, err := strconv.Atoi(value); err != nil || cents < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid minimum withdrawal amount"})
+				return
+			}
+		case store.SettingTelegramStarsRate:
+			description = "每 1 单位基础货币对应的 Telegram Stars 数量（0 表示未配置）"
+			settingType = "float"
+			if rate, err := strconv.ParseFloat(value, 64); err != nil || rate < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Telegram Stars rate"})
+				return
+			}
+		case store.SettingPaymentProviders:
+			description = "启用的支付渠道（逗号分隔，按显示顺序）"
+			settingType = "string"
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name == "" {
+					continue
+				}
+				if _, err := s.payments.Get(name); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown payment provider: " + name})
+					return
+				}
+			}
+		case store.SettingOverpaymentAction:
+			description = "多付处理方式（credit/hold）"
+			settingType = "string"
+			if value != store.MismatchActionCredit && value != store.MismatchActionHold {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid overpayment action"})
+				return
+			}
+		case store.SettingUnderpaymentAction:
+			description = "少付处理方式（hold/credit/request_difference）"
+			settingType = "string"
+			if value != store.MismatchActionHold && value != store.MismatchActionCredit && value != store.MismatchActionRequestDifference {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid underpayment action"})
+				return
+			}
 		default:
 			continue // Skip unknown settings
 		}
@@ -138,6 +223,7 @@ func (s *Server) handleSaveSettings(c *gin.Context) {
 		}
 	}
 	
+	s.auditSettingsChange(c, "update_settings", before)
 	c.JSON(http.StatusOK, gin.H{"message": "Settings saved successfully"})
 }
 
@@ -183,6 +269,7 @@ func (s *Server) handleSaveCoreSettings(c *gin.Context) {
 		AdminToken        string `json:"admin_token"`
 		BotToken          string `json:"bot_token"`
 		AdminTelegramIDs  string `json:"admin_telegram_ids"`
+		DisableTokenLogin *bool  `json:"disable_token_login"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -204,6 +291,7 @@ func (s *Server) handleSaveCoreSettings(c *gin.Context) {
 
 	updates["admin_telegram_ids"] = req.AdminTelegramIDs
 
+	before := s.settingsSnapshot()
 	// Update and reload configuration if config manager is available
 	if s.configManager != nil {
 		if err := s.configManager.UpdateAndReload(updates); err != nil {
@@ -228,6 +316,14 @@ func (s *Server) handleSaveCoreSettings(c *gin.Context) {
 		}
 	}
 
+	if req.DisableTokenLogin != nil {
+		if err := store.SetSetting(s.db, store.SettingDisableTokenLogin, strconv.FormatBool(*req.DisableTokenLogin),
+			"有超级管理员启用两步验证后禁止使用 ADMIN_TOKEN 登录", "bool"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存设置失败"})
+			return
+		}
+	}
+
 	// Process admin telegram IDs to create/update admin users
 	if req.AdminTelegramIDs != "" {
 		adminIDs := strings.Split(req.AdminTelegramIDs, ",")
@@ -254,6 +350,8 @@ func (s *Server) handleSaveCoreSettings(c *gin.Context) {
 					TelegramID:          &telegramID,
 					ReceiveNotifications: true,
 					IsActive:            true,
+					IsSuperAdmin:        true,
+					Role:                auth.RoleSuperAdmin,
 				}
 
 				if err := s.db.Create(&adminUser).Error; err != nil {
@@ -271,6 +369,7 @@ func (s *Server) handleSaveCoreSettings(c *gin.Context) {
 		}
 	}
 
+	s.auditSettingsChange(c, "update_core_settings", before)
 	c.JSON(http.StatusOK, gin.H{"message": "核心设置已保存"})
 }
 
@@ -280,7 +379,11 @@ func (s *Server) handleSavePaymentSettings(c *gin.Context) {
 		EpayPID     string `json:"epay_pid"`
 		EpayKey     string `json:"epay_key"`
 		EpayGateway string `json:"epay_gateway"`
+		EpaySignType string `json:"epay_sign_type"`
+		EpayPrivateKey string `json:"epay_private_key"`
+		EpayPlatformPublicKey string `json:"epay_platform_public_key"`
 		BaseURL     string `json:"base_url"`
+		TelegramPaymentToken string `json:"telegram_payment_token"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -300,6 +403,47 @@ func (s *Server) handleSavePaymentSettings(c *gin.Context) {
 		updates["epay_key"] = req.EpayKey
 	}
 
+	// Sign type and the V2 RSA keys, validated so a bad key is rejected
+	// here rather than silently disabling epay on reload
+	signType, err := epay.ParseSignType(req.EpaySignType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的签名类型"})
+		return
+	}
+	updates["epay_sign_type"] = string(signType)
+
+	if key := strings.TrimSpace(req.EpayPrivateKey); key != "" {
+		if _, err := epay.ParsePrivateKey(key); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "商户私钥格式错误: " + err.Error()})
+			return
+		}
+		updates["epay_private_key"] = key
+	}
+
+	if key := strings.TrimSpace(req.EpayPlatformPublicKey); key != "" {
+		if _, err := epay.ParsePublicKey(key); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "平台公钥格式错误: " + err.Error()})
+			return
+		}
+		updates["epay_platform_public_key"] = key
+	}
+
+	if signType == epay.SignTypeRSA {
+		hasPrivateKey := updates["epay_private_key"] != "" || s.config.EpayPrivateKey != ""
+		hasPublicKey := updates["epay_platform_public_key"] != "" || s.config.EpayPlatformPublicKey != ""
+		if !hasPrivateKey || !hasPublicKey {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "RSA 签名需要同时配置商户私钥和平台公钥"})
+			return
+		}
+	}
+
+	// Same for the Telegram Payments provider token
+	if req.TelegramPaymentToken != "" && !strings.Contains(req.TelegramPaymentToken, "*") {
+		updates["telegram_payment_token"] = req.TelegramPaymentToken
+	}
+
+	before := s.settingsSnapshot()
+
 	// Update and reload configuration if config manager is available
 	if s.configManager != nil {
 		if err := s.configManager.UpdateAndReload(updates); err != nil {
@@ -314,20 +458,12 @@ func (s *Server) handleSavePaymentSettings(c *gin.Context) {
 			logger.Info("Payment configuration after update",
 				"epay_pid", s.config.EpayPID,
 				"epay_key_set", s.config.EpayKey != "",
+				"epay_sign_type", s.config.EpaySignType,
+				"epay_private_key_set", s.config.EpayPrivateKey != "",
 				"epay_gateway", s.config.EpayGateway)
 
-			// Update payment client if we have the minimum required configuration
-			if s.config.EpayPID != "" && s.config.EpayKey != "" && s.config.EpayGateway != "" {
-				s.epay = payment.NewClient(s.config.EpayPID, s.config.EpayKey, s.config.EpayGateway)
-				logger.Info("Payment client updated with new configuration")
-			} else {
-				// Set to nil if configuration is incomplete to avoid using stale client
-				s.epay = nil
-				logger.Info("Payment client set to nil due to incomplete configuration",
-					"epay_pid_empty", s.config.EpayPID == "",
-					"epay_key_empty", s.config.EpayKey == "",
-					"epay_gateway_empty", s.config.EpayGateway == "")
-			}
+			// Re-register payment providers with the new configuration
+			s.configurePaymentProviders()
 		}
 	} else {
 		// Fallback to direct database update
@@ -347,5 +483,6 @@ func (s *Server) handleSavePaymentSettings(c *gin.Context) {
 		}
 	}
 
+	s.auditSettingsChange(c, "update_payment_settings", before)
 	c.JSON(http.StatusOK, gin.H{"message": "支付设置已保存"})
 }
\ No newline at end of file
@@ -0,0 +1,273 @@
+package httpadmin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/security"
+	"shop-bot/internal/store"
+	"shop-bot/internal/supplier"
+)
+
+// supplierRequest is the supplier form of a product
+type supplierRequest struct {
+	Type             string          `json:"type" binding:"required"`
+	Config           json.RawMessage `json:"config" binding:"required"`
+	Enabled          bool            `json:"enabled"`
+	RestockThreshold int             `json:"restock_threshold"`
+	RestockQuantity  int             `json:"restock_quantity"`
+	OnDemand         bool            `json:"on_demand"`
+	UnitCostCents    int             `json:"unit_cost_cents"`
+	Quantity         int             `json:"quantity"` // Codes to fetch in a test
+}
+
+// productForSupplier loads the product of a supplier route
+func (s *Server) productForSupplier(c *gin.Context) (*store.Product, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil, false
+	}
+	var product store.Product
+	if err := s.db.First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return nil, false
+	}
+	return &product, true
+}
+
+// supplierConfig validates the submitted connector config. Header values
+// left masked keep the value of the stored config.
+func (s *Server) supplierConfig(productID uint, req *supplierRequest) (string, error) {
+	config := string(req.Config)
+	if existing, err := store.GetProductSupplier(s.db, productID); err == nil && existing.Type == req.Type {
+		config = supplier.RestoreMasked(req.Type, config, existing.Config)
+	}
+	if _, err := supplier.New(req.Type, config); err != nil {
+		return "", err
+	}
+	return config, nil
+}
+
+// handleProductSupplier returns the supplier of a product and its latest runs
+func (s *Server) handleProductSupplier(c *gin.Context) {
+	product, ok := s.productForSupplier(c)
+	if !ok {
+		return
+	}
+
+	runs, err := store.ListSupplierRuns(s.db, product.ID, 20)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	config, err := store.GetProductSupplier(s.db, product.ID)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if config != nil {
+		config.Config = supplier.MaskConfig(config.Type, config.Config)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"supplier": config,
+		"runs":     runs,
+		"types":    supplier.Types(),
+	})
+}
+
+// handleProductSupplierSave creates or updates the supplier of a product
+func (s *Server) handleProductSupplierSave(c *gin.Context) {
+	product, ok := s.productForSupplier(c)
+	if !ok {
+		return
+	}
+
+	var req supplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	config, err := s.supplierConfig(product.ID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := s.supplierSnapshot(product.ID)
+	err = store.SaveProductSupplier(s.db, &store.ProductSupplier{
+		ProductID:        product.ID,
+		Type:             req.Type,
+		Config:           config,
+		Enabled:          req.Enabled,
+		RestockThreshold: req.RestockThreshold,
+		RestockQuantity:  req.RestockQuantity,
+		OnDemand:         req.OnDemand,
+		UnitCostCents:    req.UnitCostCents,
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidRestockSettings) || errors.Is(err, store.ErrInvalidUnitCost) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("Product supplier saved",
+		"product_id", product.ID,
+		"type", req.Type,
+		"enabled", req.Enabled,
+		"restock_threshold", req.RestockThreshold,
+		"restock_quantity", req.RestockQuantity,
+		"on_demand", req.OnDemand,
+		"unit_cost_cents", req.UnitCostCents,
+		"admin", c.GetString("username"))
+	s.auditChange(c, "save_supplier", productResource(product.ID)+":supplier", before, s.supplierSnapshot(product.ID))
+	c.JSON(http.StatusOK, gin.H{"message": "supplier saved"})
+}
+
+// handleProductSupplierDelete removes the supplier of a product
+func (s *Server) handleProductSupplierDelete(c *gin.Context) {
+	product, ok := s.productForSupplier(c)
+	if !ok {
+		return
+	}
+	before := s.supplierSnapshot(product.ID)
+	if err := store.DeleteProductSupplier(s.db, product.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Info("Product supplier removed", "product_id", product.ID, "admin", c.GetString("username"))
+	if before != nil {
+		s.auditChange(c, "delete_supplier", productResource(product.ID)+":supplier", before, nil)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "supplier removed"})
+}
+
+// handleProductSupplierTest fetches codes with the submitted config without
+// importing them and returns masked previews
+func (s *Server) handleProductSupplierTest(c *gin.Context) {
+	product, ok := s.productForSupplier(c)
+	if !ok {
+		return
+	}
+
+	var req supplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if req.Quantity <= 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "test quantity must be between 1 and 10"})
+		return
+	}
+
+	config, err := s.supplierConfig(product.ID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	items, err := supplier.Test(ctx, req.Type, config, product.ID, req.Quantity)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	previews := make([]string, 0, len(items))
+	for _, item := range items {
+		if len(previews) == 5 {
+			break
+		}
+		if item.Fields == nil {
+			previews = append(previews, security.MaskSensitiveData(item.Code, 4))
+			continue
+		}
+		keys := make([]string, 0, len(item.Fields))
+		for key := range item.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		preview := ""
+		for i, key := range keys {
+			if i > 0 {
+				preview += ", "
+			}
+			preview += key + "=" + security.MaskSensitiveData(item.Fields[key], 2)
+		}
+		previews = append(previews, preview)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"received": len(items),
+		"previews": previews,
+	})
+}
+
+// handleProductSupplierRestock pulls codes from the supplier right away
+func (s *Server) handleProductSupplierRestock(c *gin.Context) {
+	product, ok := s.productForSupplier(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Quantity int `json:"quantity"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+	}
+	if req.Quantity < 0 || req.Quantity > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity must be between 1 and 1000"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+	defer cancel()
+	run, err := s.suppliers.Restock(ctx, product.ID, store.SupplierTriggerManual, req.Quantity)
+	switch {
+	case errors.Is(err, supplier.ErrNotConfigured):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, supplier.ErrRestockInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil && run == nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "run": run})
+		return
+	}
+
+	logger.Info("Manual supplier restock",
+		"product_id", product.ID,
+		"imported", run.Imported,
+		"admin", c.GetString("username"))
+	c.JSON(http.StatusOK, gin.H{"run": run})
+
+	if run.Imported > 0 {
+		go s.sendStockUpdateNotification(product.Name, run.Imported)
+	}
+}
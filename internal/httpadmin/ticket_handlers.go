@@ -135,6 +135,7 @@ func (s *Server) handleTicketReply(c *gin.Context) {
 		return
 	}
 	
+	s.auditChange(c, "reply_ticket", ticketResource(uint(ticketID)), nil, gin.H{"content": req.Content})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Reply sent successfully",
@@ -166,6 +167,7 @@ func (s *Server) handleTicketStatusUpdate(c *gin.Context) {
 	}
 	
 	// Update ticket status
+	before := s.ticketSnapshot(uint(ticketID))
 	err = s.ticketService.UpdateTicketStatus(uint(ticketID), req.Status, adminID)
 	if err != nil {
 		logger.Error("Failed to update ticket status", "error", err)
@@ -184,6 +186,7 @@ func (s *Server) handleTicketStatusUpdate(c *gin.Context) {
 	systemMessage := "工单状态更新为: " + statusText[req.Status]
 	s.ticketService.AddMessage(uint(ticketID), "system", 0, "System", systemMessage, 0)
 	
+	s.auditTicketChange(c, "update_ticket_status", uint(ticketID), before)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Status updated successfully",
@@ -209,6 +212,7 @@ func (s *Server) handleTicketAssign(c *gin.Context) {
 	}
 	
 	// Update assignment
+	before := s.ticketSnapshot(uint(ticketID))
 	err = s.db.Model(&store.Ticket{}).Where("id = ?", ticketID).Update("assigned_to", req.AdminID).Error
 	if err != nil {
 		logger.Error("Failed to assign ticket", "error", err)
@@ -223,6 +227,7 @@ func (s *Server) handleTicketAssign(c *gin.Context) {
 	systemMessage := "工单已分配给: " + admin.Username
 	s.ticketService.AddMessage(uint(ticketID), "system", 0, "System", systemMessage, 0)
 	
+	s.auditTicketChange(c, "assign_ticket", uint(ticketID), before)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Ticket assigned successfully",
@@ -0,0 +1,339 @@
+package httpadmin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"shop-bot/internal/auth"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// totpIssuer names the account in authenticator apps
+const totpIssuer = "Shop Bot Admin"
+
+// Ways a second factor was verified
+const (
+	secondFactorTOTP         = "totp"
+	secondFactorRecoveryCode = "recovery_code"
+)
+
+// twoFactorLimiterKey is the rate limiter key of second factor attempts of
+// an account, so guesses are limited per account as well as per IP
+func twoFactorLimiterKey(username string) string {
+	return "2fa:" + username
+}
+
+// secondFactorAllowed reports whether the account is not locked out of
+// second factor attempts
+func (s *Server) secondFactorAllowed(username string) (bool, time.Duration) {
+	if s.rateLimiter == nil {
+		return true, 0
+	}
+	return s.rateLimiter.CheckAttempt(twoFactorLimiterKey(username))
+}
+
+// recordSecondFactor records a second factor attempt of an account
+func (s *Server) recordSecondFactor(username string, success bool) {
+	if s.rateLimiter != nil {
+		s.rateLimiter.RecordAttempt(twoFactorLimiterKey(username), success)
+	}
+}
+
+// checkSecondFactor checks a TOTP code, or failing that a recovery code, of
+// an admin user with two-factor authentication enabled and returns how it
+// was verified. Accepted codes cannot be used again.
+func (s *Server) checkSecondFactor(admin *store.AdminUser, code string) (string, bool, error) {
+	code = strings.TrimSpace(code)
+	if code == "" || !admin.TOTPEnabled {
+		return "", false, nil
+	}
+
+	if len(code) == auth.TOTPDigits {
+		secret, err := admin.TOTPKey()
+		if err != nil {
+			return "", false, err
+		}
+		step, ok := auth.ValidateTOTP(secret, code, time.Now(), admin.TOTPLastStep)
+		if !ok {
+			return "", false, nil
+		}
+		recorded, err := store.RecordAdminTOTPStep(s.db, admin.ID, step)
+		if err != nil || !recorded {
+			return "", false, err
+		}
+		return secondFactorTOTP, true, nil
+	}
+
+	used, err := store.UseAdminRecoveryCode(s.db, admin.ID, auth.HashRecoveryCode(code))
+	if err != nil || !used {
+		return "", false, err
+	}
+	remaining, _ := store.CountAdminRecoveryCodes(s.db, admin.ID)
+	logger.Warn("Admin recovery code used", "admin_id", admin.ID, "username", admin.Username, "remaining", remaining)
+	return secondFactorRecoveryCode, true, nil
+}
+
+// verifySecondFactor checks the code of a logged in admin for a 2FA change
+// under the same lockout as login. It writes the error response and
+// returns false when the code is not accepted.
+func (s *Server) verifySecondFactor(c *gin.Context, admin *store.AdminUser, code string) bool {
+	if allowed, remaining := s.secondFactorAllowed(admin.Username); !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": auth.FormatLockoutMessage(remaining)})
+		return false
+	}
+	_, ok, err := s.checkSecondFactor(admin, code)
+	if err != nil {
+		logger.Error("Failed to check two-factor code", "error", err, "admin_id", admin.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check code"})
+		return false
+	}
+	s.recordSecondFactor(admin.Username, ok)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return false
+	}
+	return true
+}
+
+// sessionAdmin loads the admin user of the request. Two-factor
+// authentication belongs to admin accounts, so the ADMIN_TOKEN login has
+// none.
+func (s *Server) sessionAdmin(c *gin.Context) (*store.AdminUser, bool) {
+	if c.GetString("user_id") == legacyAdminID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication applies to admin accounts, log in with username and password"})
+		return nil, false
+	}
+	var admin store.AdminUser
+	if err := s.db.First(&admin, currentAdminID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "admin not found"})
+		return nil, false
+	}
+	return &admin, true
+}
+
+// newRecoveryCodes generates recovery codes and their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// handleTwoFactorPage shows the two-factor authentication status of the
+// current admin
+func (s *Server) handleTwoFactorPage(c *gin.Context) {
+	data := gin.H{
+		"username": c.GetString("username"),
+		"legacy":   c.GetString("user_id") == legacyAdminID,
+	}
+	if !data["legacy"].(bool) {
+		var admin store.AdminUser
+		if err := s.db.First(&admin, currentAdminID(c)).Error; err != nil {
+			c.String(http.StatusNotFound, "Admin not found")
+			return
+		}
+		remaining, err := store.CountAdminRecoveryCodes(s.db, admin.ID)
+		if err != nil {
+			logger.Error("Failed to count recovery codes", "error", err, "admin_id", admin.ID)
+		}
+		data["enabled"] = admin.TOTPEnabled
+		data["recoveryCodesRemaining"] = remaining
+	}
+
+	if c.GetHeader("Accept") == "application/json" {
+		c.JSON(http.StatusOK, data)
+		return
+	}
+	c.HTML(http.StatusOK, "two_factor.html", data)
+}
+
+// handleTwoFactorSetup starts enrollment with a new secret. Two-factor
+// authentication stays off until a code from it is confirmed.
+func (s *Server) handleTwoFactorSetup(c *gin.Context) {
+	admin, ok := s.sessionAdmin(c)
+	if !ok {
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := store.StartAdminTOTPEnrollment(s.db, admin.ID, secret); err != nil {
+		if errors.Is(err, store.ErrTOTPAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret": secret,
+		"uri":    auth.TOTPProvisioningURI(totpIssuer, admin.Username, secret),
+	})
+}
+
+// handleTwoFactorEnable confirms enrollment with a code from the new secret
+// and returns the recovery codes, which are only shown this once
+func (s *Server) handleTwoFactorEnable(c *gin.Context) {
+	admin, ok := s.sessionAdmin(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if admin.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": store.ErrTOTPAlreadyEnabled.Error()})
+		return
+	}
+	if admin.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": store.ErrTOTPNotEnrolled.Error()})
+		return
+	}
+
+	if allowed, remaining := s.secondFactorAllowed(admin.Username); !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": auth.FormatLockoutMessage(remaining)})
+		return
+	}
+	secret, err := admin.TOTPKey()
+	if err != nil {
+		logger.Error("Failed to decrypt TOTP secret", "error", err, "admin_id", admin.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check code"})
+		return
+	}
+	step, valid := auth.ValidateTOTP(secret, req.Code, time.Now(), 0)
+	s.recordSecondFactor(admin.Username, valid)
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := store.EnableAdminTOTP(s.db, admin.ID, step, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.auditAdminChange(c, "enable_2fa", admin, "false", "true")
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication enabled", "recovery_codes": codes})
+}
+
+// handleTwoFactorDisable turns off two-factor authentication after checking
+// a current code
+func (s *Server) handleTwoFactorDisable(c *gin.Context) {
+	admin, ok := s.sessionAdmin(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if !admin.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": store.ErrTOTPNotEnabled.Error()})
+		return
+	}
+	if !s.verifySecondFactor(c, admin, req.Code) {
+		return
+	}
+
+	if err := store.DisableAdminTOTP(s.db, admin.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.auditAdminChange(c, "disable_2fa", admin, "true", "false")
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// handleTwoFactorRecoveryCodes replaces the recovery codes after checking a
+// current code
+func (s *Server) handleTwoFactorRecoveryCodes(c *gin.Context) {
+	admin, ok := s.sessionAdmin(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if !admin.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": store.ErrTOTPNotEnabled.Error()})
+		return
+	}
+	if !s.verifySecondFactor(c, admin, req.Code) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := store.ReplaceAdminRecoveryCodes(s.db, admin.ID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.auditAdminChange(c, "regenerate_recovery_codes", admin, "", "")
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// handleAdminTwoFactorReset turns off two-factor authentication of another
+// admin who lost their device and recovery codes
+func (s *Server) handleAdminTwoFactorReset(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+
+	var admin store.AdminUser
+	if err := s.db.First(&admin, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "admin not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := store.DisableAdminTOTP(s.db, admin.ID); err != nil {
+		adminUserError(c, err)
+		return
+	}
+	// Lift a lockout from guessing codes so the admin can log in again
+	if s.rateLimiter != nil {
+		s.rateLimiter.ResetAttempts(twoFactorLimiterKey(admin.Username))
+	}
+
+	s.auditAdminChange(c, "reset_2fa", &admin, strconv.FormatBool(admin.TOTPEnabled), "false")
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication reset"})
+}
@@ -0,0 +1,188 @@
+package httpadmin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"shop-bot/internal/bot/messages"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+func (s *Server) handleWithdrawalList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	perPage := 20
+	offset := (page - 1) * perPage
+	status := c.DefaultQuery("status", store.WithdrawalStatusPending)
+	if status == "all" {
+		status = ""
+	}
+
+	requests, total, err := store.ListWithdrawals(s.db, status, perPage, offset)
+	if err != nil {
+		logger.Error("Failed to fetch withdrawal requests", "error", err)
+		c.String(http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	pendingCount, _ := store.CountPendingWithdrawals(s.db)
+	totalPages := int(total+int64(perPage)-1) / perPage
+
+	if c.GetHeader("Accept") == "application/json" {
+		c.JSON(http.StatusOK, gin.H{
+			"withdrawals":   requests,
+			"total":         total,
+			"page":          page,
+			"total_pages":   totalPages,
+			"pending_count": pendingCount,
+		})
+		return
+	}
+
+	if status == "" {
+		status = "all"
+	}
+
+	c.HTML(http.StatusOK, "withdrawals.html", gin.H{
+		"withdrawals":  requests,
+		"status":       status,
+		"page":         page,
+		"totalPages":   totalPages,
+		"total":        total,
+		"pendingCount": pendingCount,
+	})
+}
+
+func (s *Server) handleWithdrawalApprove(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req struct {
+		ReferenceNo string `json:"reference_no" form:"reference_no"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	withdrawal, err := store.ApproveWithdrawal(s.db, uint(id), req.ReferenceNo, c.GetString("username"))
+	if err != nil {
+		s.respondWithdrawalError(c, err, uint(id))
+		return
+	}
+
+	logger.Info("Withdrawal approved", "withdrawal_id", withdrawal.ID, "reference_no", req.ReferenceNo, "admin", c.GetString("username"))
+	s.auditChange(c, "approve_withdrawal", withdrawalResource(withdrawal.ID),
+		gin.H{"status": store.WithdrawalStatusPending},
+		gin.H{"status": withdrawal.Status, "reference_no": withdrawal.ReferenceNo, "amount_cents": withdrawal.AmountCents})
+	go s.notifyWithdrawalReviewed(withdrawal.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal approved"})
+}
+
+func (s *Server) handleWithdrawalReject(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" form:"reason"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	withdrawal, err := store.RejectWithdrawal(s.db, uint(id), req.Reason, c.GetString("username"))
+	if err != nil {
+		s.respondWithdrawalError(c, err, uint(id))
+		return
+	}
+
+	logger.Info("Withdrawal rejected", "withdrawal_id", withdrawal.ID, "reason", req.Reason, "admin", c.GetString("username"))
+	s.auditChange(c, "reject_withdrawal", withdrawalResource(withdrawal.ID),
+		gin.H{"status": store.WithdrawalStatusPending},
+		gin.H{"status": withdrawal.Status, "reject_reason": withdrawal.RejectReason, "amount_cents": withdrawal.AmountCents})
+	// The held amount goes back to the balance
+	if balance, err := store.GetUserBalance(s.db, withdrawal.UserID); err == nil {
+		s.auditBalance(c, "release_withdrawal", withdrawal.UserID, balance-withdrawal.AmountCents, balance, gin.H{"withdrawal_id": withdrawal.ID})
+	}
+	go s.notifyWithdrawalReviewed(withdrawal.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal rejected, balance released"})
+}
+
+// withdrawalResource names a withdrawal request in the audit log
+func withdrawalResource(id uint) string {
+	return "withdrawal:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// respondWithdrawalError maps store errors to HTTP responses
+func (s *Server) respondWithdrawalError(c *gin.Context, err error, id uint) {
+	switch err {
+	case store.ErrWithdrawalNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal request not found"})
+	case store.ErrWithdrawalNotPending:
+		c.JSON(http.StatusConflict, gin.H{"error": "Withdrawal request has already been reviewed"})
+	case store.ErrWithdrawalMissingRefNo:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reference number is required"})
+	default:
+		logger.Error("Failed to review withdrawal", "error", err, "withdrawal_id", id)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update withdrawal"})
+	}
+}
+
+// notifyWithdrawalReviewed tells the user about the review result
+func (s *Server) notifyWithdrawalReviewed(id uint) {
+	if s.bot == nil {
+		return
+	}
+
+	withdrawal, err := store.GetWithdrawal(s.db, id)
+	if err != nil {
+		logger.Error("Failed to load withdrawal for notification", "error", err, "withdrawal_id", id)
+		return
+	}
+
+	msgManager := messages.GetManager()
+	lang := messages.GetUserLanguage(withdrawal.User.Language, "")
+	money := s.currency.ForUser(&withdrawal.User)
+	amount := money.Format(withdrawal.AmountCents)
+
+	var text string
+	if withdrawal.Status == store.WithdrawalStatusApproved {
+		text = msgManager.Format(lang, "withdraw_approved", map[string]interface{}{
+			"ID":          withdrawal.ID,
+			"Amount":      amount,
+			"ReferenceNo": withdrawal.ReferenceNo,
+		})
+	} else {
+		reason := withdrawal.RejectReason
+		if reason == "" {
+			reason = "-"
+		}
+		newBalance, _ := store.GetUserBalance(s.db, withdrawal.UserID)
+		text = msgManager.Format(lang, "withdraw_rejected", map[string]interface{}{
+			"ID":         withdrawal.ID,
+			"Amount":     amount,
+			"Reason":     reason,
+			"NewBalance": money.Format(newBalance),
+		})
+	}
+
+	msg := tgbotapi.NewMessage(withdrawal.User.TgUserID, text)
+	if _, err := s.bot.Send(msg); err != nil {
+		logger.Warn("Failed to notify user about withdrawal review", "error", err, "withdrawal_id", id)
+	}
+}
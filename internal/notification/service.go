@@ -9,8 +9,10 @@ import (
 	"gorm.io/gorm"
 	
 	"shop-bot/internal/config"
+	"shop-bot/internal/currency"
 	logger "shop-bot/internal/log"
 	"shop-bot/internal/store"
+	"shop-bot/internal/supplier"
 )
 
 // EventType represents the type of notification event
@@ -23,7 +25,13 @@ const (
 	EventDeposit        EventType = "deposit"
 	EventRechargeUsed   EventType = "recharge_used"
 	EventLowStock       EventType = "low_stock"
+	EventStockRecovered EventType = "stock_recovered"
 	EventNewUser        EventType = "new_user"
+	EventWithdrawalRequested EventType = "withdrawal_requested"
+	EventPaymentMismatch     EventType = "payment_mismatch"
+	EventSupplierFailed      EventType = "supplier_failed"
+	EventCodesExpired        EventType = "codes_expired"
+	EventLatePayment         EventType = "late_payment"
 )
 
 // Service handles admin notifications
@@ -151,8 +159,20 @@ func (s *Service) buildMessage(eventType EventType, data map[string]interface{})
 		return s.buildRechargeUsedMessage(data)
 	case EventLowStock:
 		return s.buildLowStockMessage(data)
+	case EventStockRecovered:
+		return s.buildStockRecoveredMessage(data)
 	case EventNewUser:
 		return s.buildNewUserMessage(data)
+	case EventWithdrawalRequested:
+		return s.buildWithdrawalRequestedMessage(data)
+	case EventPaymentMismatch:
+		return s.buildPaymentMismatchMessage(data)
+	case EventSupplierFailed:
+		return s.buildSupplierFailedMessage(data)
+	case EventCodesExpired:
+		return s.buildCodesExpiredMessage(data)
+	case EventLatePayment:
+		return s.buildLatePaymentMessage(data)
 	default:
 		return ""
 	}
@@ -173,12 +193,12 @@ func (s *Service) buildNewOrderMessage(data map[string]interface{}) string {
 				"订单号: #%d\n"+
 				"用户: %s (ID: %d)\n"+
 				"商品: %s\n"+
-				"金额: %.2f %s\n"+
+				"金额: %s\n"+
 				"时间: %s",
 			orderID,
 			escapeMarkdown(username), userID,
 			escapeMarkdown(productName),
-			float64(amount)/100, s.config.CurrencySymbol,
+			s.formatAmount(amount),
 			time.Now().Format("2006-01-02 15:04:05"),
 		)
 	}
@@ -202,13 +222,13 @@ func (s *Service) buildOrderPaidMessage(data map[string]interface{}) string {
 				"订单号: #%d\n"+
 				"用户: %s (ID: %d)\n"+
 				"商品: %s\n"+
-				"金额: %.2f %s\n"+
+				"金额: %s\n"+
 				"支付方式: %s\n"+
 				"时间: %s",
 			orderID,
 			escapeMarkdown(username), userID,
 			escapeMarkdown(productName),
-			float64(amount)/100, s.config.CurrencySymbol,
+			s.formatAmount(amount),
 			paymentMethod,
 			time.Now().Format("2006-01-02 15:04:05"),
 		)
@@ -224,8 +244,7 @@ func (s *Service) buildNoStockMessage(data map[string]interface{}) string {
 	productName, _ := data["product_name"].(string)
 	
 	// Get current stock count
-	var stockCount int64
-	s.db.Model(&store.Code{}).Where("product_id = ? AND status = 'available'", productID).Count(&stockCount)
+	stockCount, _ := store.CountAvailableCodes(s.db, productID)
 	
 	return fmt.Sprintf(
 		"⚠️ *商品缺货警告*\n\n"+
@@ -252,12 +271,12 @@ func (s *Service) buildDepositMessage(data map[string]interface{}) string {
 		return fmt.Sprintf(
 			"💵 *用户充值*\n\n"+
 				"用户: %s (ID: %d)\n"+
-				"充值金额: %.2f %s\n"+
-				"当前余额: %.2f %s\n"+
+				"充值金额: %s\n"+
+				"当前余额: %s\n"+
 				"时间: %s",
 			escapeMarkdown(username), userID,
-			float64(amount)/100, s.config.CurrencySymbol,
-			float64(newBalance)/100, s.config.CurrencySymbol,
+			s.formatAmount(amount),
+			s.formatAmount(newBalance),
 			time.Now().Format("2006-01-02 15:04:05"),
 		)
 	}
@@ -278,11 +297,11 @@ func (s *Service) buildRechargeUsedMessage(data map[string]interface{}) string {
 			"🎫 *充值卡使用*\n\n"+
 				"用户: %s (ID: %d)\n"+
 				"卡号: %s\n"+
-				"面额: %.2f %s\n"+
+				"面额: %s\n"+
 				"时间: %s",
 			escapeMarkdown(username), userID,
 			escapeMarkdown(cardCode),
-			float64(amount)/100, s.config.CurrencySymbol,
+			s.formatAmount(amount),
 			time.Now().Format("2006-01-02 15:04:05"),
 		)
 	}
@@ -290,19 +309,123 @@ func (s *Service) buildRechargeUsedMessage(data map[string]interface{}) string {
 	return ""
 }
 
+// NotifyStockAlert forwards a store stock alert to the admins
+func (s *Service) NotifyStockAlert(alert store.StockAlert) {
+	eventType := EventLowStock
+	if alert.Recovered {
+		eventType = EventStockRecovered
+	}
+	s.NotifyAdmins(eventType, map[string]interface{}{
+		"product_id":   alert.ProductID,
+		"product_name": alert.ProductName,
+		"stock_count":  int(alert.Stock),
+		"threshold":    alert.Threshold,
+	})
+}
+
 // buildLowStockMessage creates message for low stock warning
 func (s *Service) buildLowStockMessage(data map[string]interface{}) string {
 	productID, _ := data["product_id"].(uint)
 	productName, _ := data["product_name"].(string)
 	stockCount, _ := data["stock_count"].(int)
+	threshold, _ := data["threshold"].(int)
 	
 	return fmt.Sprintf(
 		"📉 *低库存警告*\n\n"+
 			"商品: %s (ID: %d)\n"+
-			"当前库存: %d\n\n"+
+			"当前库存: %d\n"+
+			"预警阈值: %d\n\n"+
 			"库存量较低，请考虑补货。",
 		escapeMarkdown(productName), productID,
-		stockCount,
+		stockCount, threshold,
+	)
+}
+
+// buildStockRecoveredMessage creates message for stock back above the threshold
+func (s *Service) buildStockRecoveredMessage(data map[string]interface{}) string {
+	productID, _ := data["product_id"].(uint)
+	productName, _ := data["product_name"].(string)
+	stockCount, _ := data["stock_count"].(int)
+	threshold, _ := data["threshold"].(int)
+	
+	return fmt.Sprintf(
+		"📈 *库存已恢复*\n\n"+
+			"商品: %s (ID: %d)\n"+
+			"当前库存: %d\n"+
+			"预警阈值: %d",
+		escapeMarkdown(productName), productID,
+		stockCount, threshold,
+	)
+}
+
+// NotifySupplierFailure tells the admins that pulling codes from a supplier failed
+func (s *Service) NotifySupplierFailure(failure supplier.Failure) {
+	s.NotifyAdmins(EventSupplierFailed, map[string]interface{}{
+		"product_id":   failure.ProductID,
+		"product_name": failure.ProductName,
+		"trigger":      failure.Trigger,
+		"attempts":     failure.Attempts,
+		"error":        failure.Error,
+	})
+}
+
+// buildSupplierFailedMessage creates message for a failed supplier pull
+func (s *Service) buildSupplierFailedMessage(data map[string]interface{}) string {
+	productID, _ := data["product_id"].(uint)
+	productName, _ := data["product_name"].(string)
+	trigger, _ := data["trigger"].(string)
+	attempts, _ := data["attempts"].(int)
+	errText, _ := data["error"].(string)
+	
+	triggers := map[string]string{
+		store.SupplierTriggerSchedule: "自动补货",
+		store.SupplierTriggerOnDemand: "购买时补货",
+		store.SupplierTriggerManual:   "手动补货",
+	}
+	
+	return fmt.Sprintf(
+		"🚚 *供应商补货失败*\n\n"+
+			"商品: %s (ID: %d)\n"+
+			"触发方式: %s\n"+
+			"尝试次数: %d\n"+
+			"错误: %s\n\n"+
+			"恢复成功前不会重复提醒，请在后台查看补货记录。",
+		escapeMarkdown(productName), productID,
+		triggers[trigger], attempts,
+		escapeMarkdown(errText),
+	)
+}
+
+// NotifyExpiredCodes tells the admins which expired codes were quarantined
+func (s *Service) NotifyExpiredCodes(reports []store.ExpiredCodeReport) {
+	s.NotifyAdmins(EventCodesExpired, map[string]interface{}{
+		"reports": reports,
+	})
+}
+
+// buildCodesExpiredMessage creates message for the daily expired code report
+func (s *Service) buildCodesExpiredMessage(data map[string]interface{}) string {
+	reports, _ := data["reports"].([]store.ExpiredCodeReport)
+	if len(reports) == 0 {
+		return ""
+	}
+	
+	var lines strings.Builder
+	totalCount, totalCost := 0, int64(0)
+	for _, report := range reports {
+		lines.WriteString(fmt.Sprintf("• %s (ID: %d): %d 个，成本 %s\n",
+			escapeMarkdown(report.ProductName), report.ProductID,
+			report.Count, s.formatAmount(int(report.CostCents))))
+		totalCount += report.Count
+		totalCost += report.CostCents
+	}
+	
+	return fmt.Sprintf(
+		"⏰ *卡密过期隔离*\n\n"+
+			"%s\n"+
+			"合计: %d 个，成本损失 %s\n\n"+
+			"过期卡密已自动隔离，不会再出售。",
+		lines.String(), totalCount, s.formatAmount(int(totalCost)),
 	)
 }
 
@@ -332,8 +455,139 @@ func (s *Service) buildNewUserMessage(data map[string]interface{}) string {
 	)
 }
 
+// buildWithdrawalRequestedMessage creates message for a new withdrawal request
+func (s *Service) buildWithdrawalRequestedMessage(data map[string]interface{}) string {
+	withdrawalID, _ := data["withdrawal_id"].(uint)
+	userID, _ := data["user_id"].(uint)
+	amount, _ := data["amount"].(int)
+	method, _ := data["payout_method"].(string)
+	account, _ := data["payout_account"].(string)
+
+	var user store.User
+	if err := s.db.First(&user, userID).Error; err == nil {
+		username := getUserDisplayName(&user)
+		return fmt.Sprintf(
+			"🏧 *提现申请*\n\n"+
+				"申请号: #%d\n"+
+				"用户: %s (ID: %d)\n"+
+				"金额: %s\n"+
+				"方式: %s\n"+
+				"账户: %s\n"+
+				"时间: %s\n\n"+
+				"请在管理后台审核。",
+			withdrawalID,
+			escapeMarkdown(username), userID,
+			s.formatAmount(amount),
+			escapeMarkdown(method),
+			escapeMarkdown(account),
+			time.Now().Format("2006-01-02 15:04:05"),
+		)
+	}
+
+	return ""
+}
+
+// buildPaymentMismatchMessage creates message for a payment whose amount did not match the order
+func (s *Service) buildPaymentMismatchMessage(data map[string]interface{}) string {
+	orderID, _ := data["order_id"].(uint)
+	userID, _ := data["user_id"].(uint)
+	received, _ := data["received"].(int)
+	due, _ := data["due"].(int)
+	credited, _ := data["credited"].(int)
+	outcome, _ := data["outcome"].(string)
+	paymentMethod, _ := data["payment_method"].(string)
+
+	handling := map[string]string{
+		store.SettlementOverpaidCredited:    "已发货，多付金额已转入用户余额",
+		store.SettlementUnderpaidCredited:   "订单已取消，已付金额已转入用户余额",
+		store.SettlementDifferenceRequested: "已请用户补付差价",
+		store.SettlementMismatchHeld:        "订单已挂起，请在管理后台处理",
+	}[outcome]
+	receivedText := s.formatAmount(received)
+	// Payments that could not be converted to the shop currency, and held
+	// payments, describe themselves
+	if text, ok := data["received_text"].(string); ok && text != "" {
+		receivedText = text
+	}
+	if text, ok := data["handling"].(string); ok && text != "" {
+		handling = text
+	}
+
+	var user store.User
+	if err := s.db.First(&user, userID).Error; err == nil {
+		username := getUserDisplayName(&user)
+		return fmt.Sprintf(
+			"⚠️ *支付金额不符*\n\n"+
+				"订单号: #%d\n"+
+				"用户: %s (ID: %d)\n"+
+				"应付金额: %s\n"+
+				"实付金额: %s\n"+
+				"转入余额: %s\n"+
+				"支付方式: %s\n"+
+				"处理方式: %s\n"+
+				"时间: %s",
+			orderID,
+			escapeMarkdown(username), userID,
+			s.formatAmount(due),
+			receivedText,
+			s.formatAmount(credited),
+			paymentMethod,
+			handling,
+			time.Now().Format("2006-01-02 15:04:05"),
+		)
+	}
+
+	return ""
+}
+
+// buildLatePaymentMessage creates message for a payment credited to the
+// balance because its order was closed or already paid
+func (s *Service) buildLatePaymentMessage(data map[string]interface{}) string {
+	orderID, _ := data["order_id"].(uint)
+	userID, _ := data["user_id"].(uint)
+	status, _ := data["status"].(string)
+	amount, _ := data["amount"].(int)
+	paymentMethod, _ := data["payment_method"].(string)
+	tradeNo, _ := data["trade_no"].(string)
+
+	reason := "订单已支付，重复付款"
+	if status == "expired" || status == store.OrderStatusCancelled {
+		reason = "订单已关闭"
+	}
+
+	var user store.User
+	if err := s.db.First(&user, userID).Error; err == nil {
+		username := getUserDisplayName(&user)
+		return fmt.Sprintf(
+			"ℹ️ *付款已转入余额*\n\n"+
+				"订单号: #%d\n"+
+				"用户: %s (ID: %d)\n"+
+				"原因: %s\n"+
+				"转入余额: %s\n"+
+				"支付方式: %s\n"+
+				"交易号: %s\n"+
+				"时间: %s",
+			orderID,
+			escapeMarkdown(username), userID,
+			reason,
+			s.formatAmount(amount),
+			paymentMethod,
+			escapeMarkdown(tradeNo),
+			time.Now().Format("2006-01-02 15:04:05"),
+		)
+	}
+
+	return ""
+}
+
 // Helper functions
 
+// formatAmount formats cents in the shop base currency
+func (s *Service) formatAmount(cents int) string {
+	code, symbol := store.GetCurrencySettings(s.db, s.config)
+	return currency.FormatCents(code, symbol, cents)
+}
+
 func getUserDisplayName(user *store.User) string {
 	if user.TgUsername != "" {
 		return "@" + user.TgUsername
@@ -102,8 +102,14 @@ func (t *TelegramChannel) formatMessage(notification *Notification) string {
 		return service.buildRechargeUsedMessage(notification.Data)
 	case EventLowStock:
 		return service.buildLowStockMessage(notification.Data)
+	case EventStockRecovered:
+		return service.buildStockRecoveredMessage(notification.Data)
 	case EventNewUser:
 		return service.buildNewUserMessage(notification.Data)
+	case EventSupplierFailed:
+		return service.buildSupplierFailedMessage(notification.Data)
+	case EventCodesExpired:
+		return service.buildCodesExpiredMessage(notification.Data)
 	default:
 		// Generic message format
 		text := fmt.Sprintf("🔔 *通知*\n\n类型: `%s`\n", notification.Type)
@@ -1,15 +1,18 @@
 package epay
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 )
 
 // OrderInfo represents order information from query
 type OrderInfo struct {
-	Code        int    `json:"code"`
+	Code        int    `json:"code"`          // 1 for success, 0 on the V2 API
 	Msg         string `json:"msg"`
 	TradeNo     string `json:"trade_no"`      // Epay order number
 	OutTradeNo  string `json:"out_trade_no"`  // Merchant order number
@@ -28,9 +31,7 @@ type OrderInfo struct {
 // QueryOrder queries a single order by trade_no or out_trade_no
 func (c *Client) QueryOrder(tradeNo, outTradeNo string) (*OrderInfo, error) {
 	params := url.Values{}
-	params.Set("act", "order")
 	params.Set("pid", c.PID)
-	params.Set("key", c.Key)
 	
 	if tradeNo != "" {
 		params.Set("trade_no", tradeNo)
@@ -40,6 +41,20 @@ func (c *Client) QueryOrder(tradeNo, outTradeNo string) (*OrderInfo, error) {
 		return nil, fmt.Errorf("either trade_no or out_trade_no must be provided")
 	}
 	
+	if c.isV2() {
+		var result OrderInfo
+		if err := c.postV2("/api/pay/query", params, &result); err != nil {
+			return nil, err
+		}
+		if result.Code != 0 {
+			return nil, fmt.Errorf("query failed: %s", result.Msg)
+		}
+		return &result, nil
+	}
+	
+	params.Set("act", "order")
+	params.Set("key", c.Key)
+	
 	resp, err := http.Get(c.Gateway + "/api.php?" + params.Encode())
 	if err != nil {
 		return nil, fmt.Errorf("failed to query order: %w", err)
@@ -60,9 +75,10 @@ func (c *Client) QueryOrder(tradeNo, outTradeNo string) (*OrderInfo, error) {
 
 // RefundRequest represents a refund request
 type RefundRequest struct {
-	TradeNo    string  // Epay order number
-	OutTradeNo string  // Merchant order number
-	Money      float64 // Refund amount
+	TradeNo     string  // Epay order number
+	OutTradeNo  string  // Merchant order number
+	Money       float64 // Refund amount
+	OutRefundNo string  // Merchant refund number, V2 only (optional)
 }
 
 // RefundResponse represents refund response
@@ -75,7 +91,6 @@ type RefundResponse struct {
 func (c *Client) RefundOrder(req RefundRequest) error {
 	values := url.Values{}
 	values.Set("pid", c.PID)
-	values.Set("key", c.Key)
 	
 	if req.TradeNo != "" {
 		values.Set("trade_no", req.TradeNo)
@@ -87,6 +102,22 @@ func (c *Client) RefundOrder(req RefundRequest) error {
 	
 	values.Set("money", fmt.Sprintf("%.2f", req.Money))
 	
+	if c.isV2() {
+		if req.OutRefundNo != "" {
+			values.Set("out_refund_no", req.OutRefundNo)
+		}
+		var result RefundResponse
+		if err := c.postV2("/api/pay/refund", values, &result); err != nil {
+			return err
+		}
+		if result.Code != 0 {
+			return fmt.Errorf("refund failed: %s", result.Msg)
+		}
+		return nil
+	}
+	
+	values.Set("key", c.Key)
+	
 	resp, err := http.PostForm(c.Gateway+"/api.php?act=refund", values)
 	if err != nil {
 		return fmt.Errorf("failed to submit refund: %w", err)
@@ -123,8 +154,20 @@ type MerchantInfo struct {
 // QueryMerchantInfo queries merchant account information
 func (c *Client) QueryMerchantInfo() (*MerchantInfo, error) {
 	params := url.Values{}
-	params.Set("act", "query")
 	params.Set("pid", c.PID)
+	
+	if c.isV2() {
+		var result MerchantInfo
+		if err := c.postV2("/api/merchant/info", params, &result); err != nil {
+			return nil, err
+		}
+		if result.Code != 0 {
+			return nil, fmt.Errorf("query failed")
+		}
+		return &result, nil
+	}
+	
+	params.Set("act", "query")
 	params.Set("key", c.Key)
 	
 	resp, err := http.Get(c.Gateway + "/api.php?" + params.Encode())
@@ -143,4 +186,59 @@ func (c *Client) QueryMerchantInfo() (*MerchantInfo, error) {
 	}
 	
 	return &result, nil
-}
\ No newline at end of file
+}
+
+// postV2 signs values, posts them to a V2 API path and decodes the JSON
+// response into out after checking the platform signature
+func (c *Client) postV2(path string, values url.Values, out interface{}) error {
+	if err := c.signParams(values); err != nil {
+		return err
+	}
+	
+	resp, err := http.PostForm(c.Gateway+path, values)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	
+	// Keep numbers as sent, the signature covers their original text
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return fmt.Errorf("failed to parse response: %w, body: %s", err, string(body))
+	}
+	
+	// Error responses are not signed, successful ones must be
+	if code, ok := fields["code"].(json.Number); ok && code.String() == "0" {
+		if !VerifyRSA(responseValues(fields), c.PlatformKey) {
+			return fmt.Errorf("invalid response signature from %s", path)
+		}
+	}
+	
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// responseValues flattens a JSON response into params for sign verification
+func responseValues(fields map[string]interface{}) url.Values {
+	values := url.Values{}
+	for k, v := range fields {
+		switch val := v.(type) {
+		case string:
+			values.Set(k, val)
+		case json.Number:
+			values.Set(k, val.String())
+		case bool:
+			values.Set(k, strconv.FormatBool(val))
+		}
+	}
+	return values
+}
@@ -2,13 +2,16 @@ package epay
 
 import (
 	"crypto/md5"
+	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"sort"
-	"strings"
+	"strconv"
+	"time"
+
+	"shop-bot/internal/config"
 )
 
 // PaymentType represents the payment method
@@ -34,18 +37,73 @@ const (
 
 // Client is the Epay API client
 type Client struct {
-	PID     string
-	Key     string
-	Gateway string
+	PID      string
+	Key      string // Merchant key, used with SignTypeMD5
+	Gateway  string
+	SignType SignType
+
+	PrivateKey  *rsa.PrivateKey // Merchant private key, used with SignTypeRSA
+	PlatformKey *rsa.PublicKey  // Platform public key, used with SignTypeRSA
 }
 
-// NewClient creates a new Epay client
+// NewClient creates a new Epay client using the legacy MD5 sign type
 func NewClient(pid, key, gateway string) *Client {
 	return &Client{
-		PID:     pid,
-		Key:     key,
-		Gateway: gateway,
+		PID:      pid,
+		Key:      key,
+		Gateway:  gateway,
+		SignType: SignTypeMD5,
+	}
+}
+
+// NewRSAClient creates a client for the V2 API, which signs requests with
+// the merchant private key and verifies the gateway with the platform public key
+func NewRSAClient(pid, gateway, privateKey, platformKey string) (*Client, error) {
+	priv, err := ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("merchant private key: %w", err)
+	}
+	pub, err := ParsePublicKey(platformKey)
+	if err != nil {
+		return nil, fmt.Errorf("platform public key: %w", err)
+	}
+
+	return &Client{
+		PID:         pid,
+		Gateway:     gateway,
+		SignType:    SignTypeRSA,
+		PrivateKey:  priv,
+		PlatformKey: pub,
+	}, nil
+}
+
+// NewClientFromConfig creates a client for the configured sign type. It
+// returns ErrNotConfigured when required settings are missing.
+func NewClientFromConfig(cfg *config.Config) (*Client, error) {
+	signType, err := ParseSignType(cfg.EpaySignType)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.EpayPID == "" || cfg.EpayGateway == "" {
+		return nil, ErrNotConfigured
+	}
+
+	if signType == SignTypeRSA {
+		if cfg.EpayPrivateKey == "" || cfg.EpayPlatformPublicKey == "" {
+			return nil, ErrNotConfigured
+		}
+		return NewRSAClient(cfg.EpayPID, cfg.EpayGateway, cfg.EpayPrivateKey, cfg.EpayPlatformPublicKey)
 	}
+
+	if cfg.EpayKey == "" {
+		return nil, ErrNotConfigured
+	}
+	return NewClient(cfg.EpayPID, cfg.EpayKey, cfg.EpayGateway), nil
+}
+
+// isV2 reports whether the client talks to the V2 (RSA) API
+func (c *Client) isV2() bool {
+	return c.SignType == SignTypeRSA
 }
 
 // CreateOrderParams contains parameters for creating an order
@@ -63,12 +121,14 @@ type CreateOrderParams struct {
 
 // CreateOrderResponse is the response from CreateOrder
 type CreateOrderResponse struct {
-	Code      int    `json:"code"` // 1 for success
+	Code      int    `json:"code"` // 1 for success, 0 on the V2 API
 	Msg       string `json:"msg"`  // Error message
 	TradeNo   string `json:"trade_no"`
 	PayURL    string `json:"payurl"`    // Direct payment URL
 	QRCode    string `json:"qrcode"`    // QR code content
 	URLScheme string `json:"urlscheme"` // Mini program URL
+	PayType   string `json:"pay_type"`  // V2: jump, qrcode, urlscheme, ...
+	PayInfo   string `json:"pay_info"`  // V2: content for PayType
 }
 
 // CreateOrder creates a payment order using API interface
@@ -104,10 +164,24 @@ func (c *Client) CreateOrder(params CreateOrderParams) (*CreateOrderResponse, er
 		values.Set("param", params.Param)
 	}
 	
+	if c.isV2() {
+		// Let the gateway pick the best pay_type for the channel
+		values.Set("method", "web")
+		var v2Resp CreateOrderResponse
+		if err := c.postV2("/api/pay/create", values, &v2Resp); err != nil {
+			return nil, err
+		}
+		if v2Resp.Code != 0 {
+			return nil, fmt.Errorf("epay error: %s", v2Resp.Msg)
+		}
+		v2Resp.applyPayInfo()
+		return &v2Resp, nil
+	}
+	
 	// Generate signature
-	sign := c.generateSign(values)
-	values.Set("sign", sign)
-	values.Set("sign_type", "MD5")
+	if err := c.signParams(values); err != nil {
+		return nil, err
+	}
 	
 	// Send request
 	resp, err := http.PostForm(c.Gateway+"/mapi.php", values)
@@ -134,6 +208,18 @@ func (c *Client) CreateOrder(params CreateOrderParams) (*CreateOrderResponse, er
 	return &jsonResp, nil
 }
 
+// applyPayInfo maps the V2 pay_type/pay_info pair onto the legacy fields
+func (resp *CreateOrderResponse) applyPayInfo() {
+	switch resp.PayType {
+	case "jump":
+		resp.PayURL = resp.PayInfo
+	case "qrcode":
+		resp.QRCode = resp.PayInfo
+	case "urlscheme":
+		resp.URLScheme = resp.PayInfo
+	}
+}
+
 // GetPaymentURL returns the appropriate payment URL based on response
 func (resp *CreateOrderResponse) GetPaymentURL() string {
 	// Priority: payurl > qrcode > urlscheme
@@ -156,7 +242,7 @@ func (resp *CreateOrderResponse) IsQRCode() bool {
 }
 
 // CreateSubmitURL creates a URL for form submission payment
-func (c *Client) CreateSubmitURL(params CreateOrderParams) string {
+func (c *Client) CreateSubmitURL(params CreateOrderParams) (string, error) {
 	// Build parameters
 	values := url.Values{}
 	values.Set("pid", c.PID)
@@ -174,55 +260,66 @@ func (c *Client) CreateSubmitURL(params CreateOrderParams) string {
 	}
 	
 	// Generate signature
-	sign := c.generateSign(values)
-	values.Set("sign", sign)
-	values.Set("sign_type", "MD5")
+	if err := c.signParams(values); err != nil {
+		return "", err
+	}
 	
-	return c.Gateway + "/submit.php?" + values.Encode()
+	if c.isV2() {
+		return c.Gateway + "/api/pay/submit?" + values.Encode(), nil
+	}
+	return c.Gateway + "/submit.php?" + values.Encode(), nil
 }
 
-// VerifyNotify verifies the callback notification
+// VerifyNotify verifies the callback notification with the client's sign type
 func (c *Client) VerifyNotify(params url.Values) bool {
+	if c.isV2() {
+		return VerifyRSA(params, c.PlatformKey)
+	}
+	return VerifySign(params, c.Key)
+}
+
+// VerifySign checks the MD5 sign of params against the merchant key
+func VerifySign(params url.Values, key string) bool {
 	// Get the sign from params
 	receivedSign := params.Get("sign")
 	if receivedSign == "" {
 		return false
 	}
 	
-	// Remove sign and sign_type for verification
-	paramsCopy := make(url.Values)
-	for k, v := range params {
-		if k != "sign" && k != "sign_type" {
-			paramsCopy[k] = v
-		}
-	}
-	
-	// Generate expected sign
-	expectedSign := c.generateSign(paramsCopy)
+	// Generate expected sign, sign and sign_type are skipped
+	expectedSign := Sign(params, key)
 	
 	return receivedSign == expectedSign
 }
 
-// generateSign generates MD5 signature for parameters
-func (c *Client) generateSign(params url.Values) string {
-	// Sort parameters by key ASCII order
-	var keys []string
-	for k := range params {
-		// Skip empty values, sign and sign_type
-		if k != "" && params.Get(k) != "" && k != "sign" && k != "sign_type" {
-			keys = append(keys, k)
+// signParams adds sign and sign_type to values. The V2 API also requires
+// a timestamp, which is part of the signed content.
+func (c *Client) signParams(values url.Values) error {
+	if c.isV2() {
+		values.Set("timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+		sign, err := SignRSA(values, c.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("failed to sign request: %w", err)
 		}
-	}
-	sort.Strings(keys)
-	
-	// Build sign string
-	var signParts []string
-	for _, k := range keys {
-		signParts = append(signParts, fmt.Sprintf("%s=%s", k, params.Get(k)))
+		values.Set("sign", sign)
+		values.Set("sign_type", string(SignTypeRSA))
+		return nil
 	}
 	
-	// Concatenate with key (no + character)
-	signStr := strings.Join(signParts, "&") + c.Key
+	values.Set("sign", c.generateSign(values))
+	values.Set("sign_type", string(SignTypeMD5))
+	return nil
+}
+
+// generateSign generates MD5 signature for parameters
+func (c *Client) generateSign(params url.Values) string {
+	return Sign(params, c.Key)
+}
+
+// Sign generates the MD5 signature for parameters with the merchant key
+func Sign(params url.Values, key string) string {
+	// Sorted k=v pairs concatenated with key (no + character)
+	signStr := signContent(params) + key
 	
 	// Calculate MD5
 	h := md5.New()
@@ -0,0 +1,150 @@
+package epay
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/payment"
+)
+
+// ProviderName is the registry name of the epay provider
+const ProviderName = "epay"
+
+// Provider adapts Client to the payment.PaymentProvider interface
+type Provider struct {
+	client *Client
+}
+
+// NewProvider creates an epay payment provider
+func NewProvider(client *Client) *Provider {
+	return &Provider{client: client}
+}
+
+// Client returns the underlying epay client
+func (p *Provider) Client() *Client {
+	return p.client
+}
+
+// Name returns the provider name
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+// DisplayName returns the label shown at checkout
+func (p *Provider) DisplayName() string {
+	return "支付宝 / 微信 (Epay)"
+}
+
+// Methods lists the payment types the bot offers in chat
+func (p *Provider) Methods() []payment.Method {
+	return []payment.Method{
+		{Name: string(PaymentAlipay), DisplayName: "支付宝"},
+		{Name: string(PaymentWechat), DisplayName: "微信支付"},
+		{Name: string(PaymentQQ), DisplayName: "QQ钱包"},
+	}
+}
+
+// CreateCheckout creates the payment. With a method chosen the order is
+// created through the API so a QR code can be shown in chat, otherwise, or
+// when the API call fails, the user gets the gateway submit page.
+func (p *Provider) CreateCheckout(ctx context.Context, req payment.CheckoutRequest) (*payment.Checkout, error) {
+	if req.OutTradeNo == "" {
+		return nil, payment.ErrMissingOutTradeNo
+	}
+
+	params := CreateOrderParams{
+		Type:       PaymentType(req.Method),
+		OutTradeNo: req.OutTradeNo,
+		Name:       req.Subject,
+		Money:      float64(req.AmountCents) / 100,
+		NotifyURL:  req.NotifyURL,
+		ReturnURL:  req.ReturnURL,
+		ClientIP:   req.ClientIP,
+		Param:      req.Param,
+	}
+
+	if req.Method != "" {
+		resp, err := p.client.CreateOrder(params)
+		if err == nil && (resp.QRCode != "" || resp.PayURL != "") {
+			return &payment.Checkout{
+				PayURL:  resp.PayURL,
+				QRCode:  resp.QRCode,
+				TradeNo: resp.TradeNo,
+			}, nil
+		}
+		logger.Warn("Epay API order failed, falling back to submit page",
+			"out_trade_no", req.OutTradeNo,
+			"method", req.Method,
+			"error", err)
+	}
+
+	payURL, err := p.client.CreateSubmitURL(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment.Checkout{PayURL: payURL}, nil
+}
+
+// VerifyCallback verifies the notify signature and parses the notification
+func (p *Provider) VerifyCallback(params url.Values) (*payment.Notification, error) {
+	if !p.client.VerifyNotify(params) {
+		return nil, payment.ErrInvalidSignature
+	}
+
+	notify := ParseNotify(params)
+	amountCents, err := parseMoneyCents(notify.Money)
+	if err != nil {
+		return nil, fmt.Errorf("invalid money %q: %w", notify.Money, err)
+	}
+
+	return &payment.Notification{
+		TradeNo:     notify.TradeNo,
+		OutTradeNo:  notify.OutTradeNo,
+		AmountCents: amountCents,
+		Paid:        notify.TradeStatus == "TRADE_SUCCESS",
+		Status:      notify.TradeStatus,
+		Method:      notify.Type,
+	}, nil
+}
+
+// Query looks up an order on the gateway
+func (p *Provider) Query(ctx context.Context, outTradeNo string) (*payment.QueryResult, error) {
+	info, err := p.client.QueryOrder("", outTradeNo)
+	if err != nil {
+		return nil, err
+	}
+
+	amountCents, err := parseMoneyCents(info.Money)
+	if err != nil {
+		return nil, fmt.Errorf("invalid money %q: %w", info.Money, err)
+	}
+
+	return &payment.QueryResult{
+		TradeNo:     info.TradeNo,
+		OutTradeNo:  info.OutTradeNo,
+		AmountCents: amountCents,
+		Paid:        info.Status == 1,
+	}, nil
+}
+
+// Refund submits a refund for the given merchant order number
+func (p *Provider) Refund(ctx context.Context, outTradeNo string, amountCents int) error {
+	return p.client.RefundOrder(RefundRequest{
+		OutTradeNo: outTradeNo,
+		Money:      float64(amountCents) / 100,
+	})
+}
+
+// parseMoneyCents converts a yuan amount string such as "10.00" to cents
+func parseMoneyCents(money string) (int, error) {
+	value, err := strconv.ParseFloat(money, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Round(value * 100)), nil
+}
@@ -0,0 +1,152 @@
+package epay
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SignType is the signature scheme used with the gateway
+type SignType string
+
+const (
+	// SignTypeMD5 is the legacy scheme, MD5 over the params and merchant key
+	SignTypeMD5 SignType = "MD5"
+	// SignTypeRSA is the V2 scheme, SHA256WithRSA with the merchant private
+	// key for requests and the platform public key for responses and notifies
+	SignTypeRSA SignType = "RSA"
+)
+
+var (
+	ErrInvalidSignType = errors.New("unsupported epay sign type")
+	ErrInvalidKey      = errors.New("invalid epay RSA key")
+	ErrNotConfigured   = errors.New("epay configuration is incomplete")
+)
+
+// ParseSignType parses a sign type setting, an empty value means MD5
+func ParseSignType(value string) (SignType, error) {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "", string(SignTypeMD5):
+		return SignTypeMD5, nil
+	case string(SignTypeRSA):
+		return SignTypeRSA, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrInvalidSignType, value)
+}
+
+// signContent builds the string to sign: non-empty params except sign and
+// sign_type, sorted by key and joined as k=v pairs with &
+func signContent(params url.Values) string {
+	var keys []string
+	for k := range params {
+		if k != "" && params.Get(k) != "" && k != "sign" && k != "sign_type" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var signParts []string
+	for _, k := range keys {
+		signParts = append(signParts, fmt.Sprintf("%s=%s", k, params.Get(k)))
+	}
+	return strings.Join(signParts, "&")
+}
+
+// SignRSA signs params with SHA256WithRSA and returns the base64 signature
+func SignRSA(params url.Values, key *rsa.PrivateKey) (string, error) {
+	digest := sha256.Sum256([]byte(signContent(params)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// VerifyRSA checks the base64 SHA256WithRSA sign of params against the platform public key
+func VerifyRSA(params url.Values, key *rsa.PublicKey) bool {
+	receivedSign := params.Get("sign")
+	if receivedSign == "" || key == nil {
+		return false
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(receivedSign)
+	if err != nil {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(signContent(params)))
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+}
+
+// ParsePrivateKey parses a merchant private key in PKCS#1 or PKCS#8 form.
+// Gateways usually hand out the bare base64 body, so PEM armour is optional.
+func ParsePrivateKey(value string) (*rsa.PrivateKey, error) {
+	der, err := decodeKey(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an RSA private key", ErrInvalidKey)
+	}
+	return key, nil
+}
+
+// ParsePublicKey parses a platform public key in PKIX or PKCS#1 form, with
+// or without PEM armour
+func ParsePublicKey(value string) (*rsa.PublicKey, error) {
+	der, err := decodeKey(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed, err := x509.ParsePKIXPublicKey(der); err == nil {
+		key, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: not an RSA public key", ErrInvalidKey)
+		}
+		return key, nil
+	}
+	key, err := x509.ParsePKCS1PublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return key, nil
+}
+
+// decodeKey returns the DER bytes of a PEM block or bare base64 key
+func decodeKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		return block.Bytes, nil
+	}
+
+	// Bare base64, possibly wrapped over several lines
+	compact := strings.Join(strings.Fields(value), "")
+	der, err := base64.StdEncoding.DecodeString(compact)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return der, nil
+}
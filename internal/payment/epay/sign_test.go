@@ -0,0 +1,146 @@
+package epay
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/url"
+	"testing"
+)
+
+const testMerchantKey = "ABCDEFGHIJKLMNOPQRSTUVWXYZ123456"
+
+// testNotifyParams returns the parameters of a payment request before signing
+func testNotifyParams() url.Values {
+	return url.Values{
+		"pid":          {"1001"},
+		"type":         {"alipay"},
+		"out_trade_no": {"D12-1700000000"},
+		"notify_url":   {"https://shop.example/payment/epay/notify"},
+		"name":         {"VIP Month"},
+		"money":        {"1.00"},
+		"param":        {""},
+	}
+}
+
+func TestSignContent(t *testing.T) {
+	params := testNotifyParams()
+	params.Set("sign", "ignored")
+	params.Set("sign_type", "MD5")
+
+	want := "money=1.00&name=VIP Month&notify_url=https://shop.example/payment/epay/notify&out_trade_no=D12-1700000000&pid=1001&type=alipay"
+	if got := signContent(params); got != want {
+		t.Fatalf("signContent = %q, want %q", got, want)
+	}
+}
+
+func TestSignMD5Vector(t *testing.T) {
+	// md5 of the sorted content followed by the merchant key
+	const want = "93f8063e7db87f1a092b8c7ab8ebd057"
+	if got := Sign(testNotifyParams(), testMerchantKey); got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestVerifySign(t *testing.T) {
+	params := testNotifyParams()
+	params.Set("sign", Sign(params, testMerchantKey))
+	params.Set("sign_type", "MD5")
+	if !VerifySign(params, testMerchantKey) {
+		t.Fatal("valid sign rejected")
+	}
+
+	if VerifySign(params, "wrong key") {
+		t.Error("sign accepted with the wrong key")
+	}
+
+	tampered := url.Values{}
+	for k, v := range params {
+		tampered[k] = v
+	}
+	tampered.Set("money", "100.00")
+	if VerifySign(tampered, testMerchantKey) {
+		t.Error("sign accepted after the amount changed")
+	}
+
+	unsigned := testNotifyParams()
+	if VerifySign(unsigned, testMerchantKey) {
+		t.Error("params without a sign accepted")
+	}
+}
+
+func TestSignRSARoundTrip(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	// Gateways hand out bare base64 keys as well as PEM blocks
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal private key: %v", err)
+	}
+	private, err := ParsePrivateKey(base64.StdEncoding.EncodeToString(privateDER))
+	if err != nil {
+		t.Fatalf("parse private key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	public, err := ParsePublicKey(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})))
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+
+	params := testNotifyParams()
+	params.Set("timestamp", "1700000000")
+	sign, err := SignRSA(params, private)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	params.Set("sign", sign)
+	params.Set("sign_type", string(SignTypeRSA))
+	if !VerifyRSA(params, public) {
+		t.Fatal("valid RSA sign rejected")
+	}
+
+	params.Set("money", "100.00")
+	if VerifyRSA(params, public) {
+		t.Error("RSA sign accepted after the amount changed")
+	}
+	if VerifyRSA(params, nil) {
+		t.Error("RSA sign accepted without a platform key")
+	}
+}
+
+func TestProviderVerifyCallback(t *testing.T) {
+	provider := NewProvider(NewClient("1001", testMerchantKey, "https://pay.example"))
+
+	params := url.Values{
+		"pid":          {"1001"},
+		"trade_no":     {"2024010112345"},
+		"out_trade_no": {"D12-1700000000"},
+		"type":         {"alipay"},
+		"name":         {"VIP Month"},
+		"money":        {"12.30"},
+		"trade_status": {"TRADE_SUCCESS"},
+	}
+	params.Set("sign", Sign(params, testMerchantKey))
+	params.Set("sign_type", "MD5")
+
+	notification, err := provider.VerifyCallback(params)
+	if err != nil {
+		t.Fatalf("verify callback: %v", err)
+	}
+	if notification.AmountCents != 1230 || !notification.Paid || notification.TradeNo != "2024010112345" {
+		t.Fatalf("notification = %+v", notification)
+	}
+
+	params.Set("money", "0.01")
+	if _, err := provider.VerifyCallback(params); err == nil {
+		t.Fatal("tampered callback accepted")
+	}
+}
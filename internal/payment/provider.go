@@ -0,0 +1,104 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+var (
+	ErrInvalidSignature     = errors.New("invalid callback signature")
+	ErrProviderNotFound     = errors.New("payment provider not found")
+	ErrRefundNotSupported   = errors.New("refund not supported by provider")
+	ErrMissingOutTradeNo    = errors.New("out_trade_no is required")
+	ErrCallbackNotSupported = errors.New("provider does not use http callbacks")
+)
+
+// CheckoutRequest describes a payment the user should complete
+type CheckoutRequest struct {
+	OutTradeNo  string // Merchant order number
+	Subject     string // Product name shown on the payment page
+	AmountCents int    // Amount in base currency cents
+	NotifyURL   string // Async callback URL for this provider
+	ReturnURL   string // Sync return URL
+	Method      string // Provider specific payment method (optional)
+	ClientIP    string // Client IP address (optional)
+	Param       string // Business extension parameter
+	ChatID      int64  // Telegram chat for in-chat payment requests
+}
+
+// Checkout is the result of creating a payment
+type Checkout struct {
+	PayURL  string // URL the user opens to pay
+	QRCode  string // QR code content, if the provider returned one
+	TradeNo string // Provider order number, if known at creation time
+	InChat  bool   // The payment request was sent into the chat, there is no link
+}
+
+// Notification is a verified payment callback
+type Notification struct {
+	TradeNo     string // Provider order number
+	OutTradeNo  string // Merchant order number
+	AmountCents int    // Paid amount in cents
+	Paid        bool   // Whether the trade completed successfully
+	Status      string // Raw provider trade status
+	Method      string // Payment method reported by the provider
+}
+
+// QueryResult is the provider side state of a payment
+type QueryResult struct {
+	TradeNo     string
+	OutTradeNo  string
+	AmountCents int
+	Paid        bool
+}
+
+// PaymentProvider is implemented by every payment gateway integration
+type PaymentProvider interface {
+	// Name returns the identifier used in routes and settings, e.g. "epay"
+	Name() string
+	// DisplayName returns the label shown to users at checkout
+	DisplayName() string
+	// CreateCheckout creates a payment and returns where the user can pay
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error)
+	// VerifyCallback validates and parses an async payment notification
+	VerifyCallback(params url.Values) (*Notification, error)
+	// Query fetches the payment state for a merchant order number
+	Query(ctx context.Context, outTradeNo string) (*QueryResult, error)
+	// Refund refunds part or all of a payment
+	Refund(ctx context.Context, outTradeNo string, amountCents int) error
+}
+
+// InChatProvider is implemented by providers that deliver the payment
+// request as a chat message, such as a Telegram invoice, instead of a link
+type InChatProvider interface {
+	PaymentProvider
+	InChat() bool
+}
+
+// IsInChat reports whether the provider pays inside the chat
+func IsInChat(p PaymentProvider) bool {
+	ic, ok := p.(InChatProvider)
+	return ok && ic.InChat()
+}
+
+// Method is a payment method the user can pick in chat before checkout
+type Method struct {
+	Name        string // Passed back as CheckoutRequest.Method
+	DisplayName string
+}
+
+// MethodProvider is implemented by providers that let the user choose a
+// payment method, such as Alipay or WeChat, before the checkout is created
+type MethodProvider interface {
+	PaymentProvider
+	Methods() []Method
+}
+
+// Methods returns the selectable payment methods of p, if any
+func Methods(p PaymentProvider) []Method {
+	if mp, ok := p.(MethodProvider); ok {
+		return mp.Methods()
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package payment
+
+import (
+	"strings"
+	"sync"
+)
+
+// Registry holds the configured payment providers by name
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]PaymentProvider
+	order     []string
+}
+
+// NewRegistry creates an empty provider registry
+func NewRegistry() *Registry {
+	return &Registry{
+		providers: make(map[string]PaymentProvider),
+	}
+}
+
+// Register adds a provider, replacing any provider with the same name
+func (r *Registry) Register(p PaymentProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := p.Name()
+	if _, exists := r.providers[name]; !exists {
+		r.order = append(r.order, name)
+	}
+	r.providers[name] = p
+}
+
+// Unregister removes a provider, e.g. after its configuration was cleared
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.providers[name]; !exists {
+		return
+	}
+	delete(r.providers, name)
+	for i, n := range r.order {
+		if n == name {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Get returns a registered provider by name
+func (r *Registry) Get(name string) (PaymentProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	return p, nil
+}
+
+// All returns every registered provider in registration order
+func (r *Registry) All() []PaymentProvider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]PaymentProvider, 0, len(r.order))
+	for _, name := range r.order {
+		result = append(result, r.providers[name])
+	}
+	return result
+}
+
+// Enabled returns the registered providers whose names are listed in
+// enabled, keeping the order of the list. Unknown names are skipped.
+func (r *Registry) Enabled(enabled []string) []PaymentProvider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []PaymentProvider
+	seen := make(map[string]bool)
+	for _, name := range enabled {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			continue
+		}
+		if p, ok := r.providers[name]; ok {
+			result = append(result, p)
+			seen[name] = true
+		}
+	}
+	return result
+}
@@ -0,0 +1,179 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+
+	"shop-bot/internal/config"
+	"shop-bot/internal/currency"
+	"shop-bot/internal/payment"
+	"shop-bot/internal/store"
+)
+
+const (
+	// ProviderName is the registry name of the Telegram Payments provider
+	ProviderName = "telegram"
+	// StarsProviderName is the registry name of the Telegram Stars provider
+	StarsProviderName = "stars"
+	// StarsCurrency is the currency code Telegram uses for Stars
+	StarsCurrency = "XTR"
+)
+
+var (
+	ErrStarsRateNotSet = errors.New("telegram stars rate is not configured")
+	ErrMissingChatID   = errors.New("chat id is required for telegram invoices")
+	ErrAmountTooSmall  = errors.New("amount is too small for a telegram invoice")
+)
+
+// Provider sends native Telegram invoices. With a payment provider token
+// from @BotFather it charges in the shop base currency; the Stars variant
+// needs no token and charges Telegram Stars (XTR) for digital goods.
+type Provider struct {
+	api    *tgbotapi.BotAPI
+	db     *gorm.DB
+	config *config.Config
+	token  string
+	stars  bool
+}
+
+// NewProvider creates a Telegram Payments provider using a payment provider token
+func NewProvider(api *tgbotapi.BotAPI, db *gorm.DB, cfg *config.Config, token string) *Provider {
+	return &Provider{
+		api:    api,
+		db:     db,
+		config: cfg,
+		token:  token,
+	}
+}
+
+// NewStarsProvider creates a Telegram Stars provider
+func NewStarsProvider(api *tgbotapi.BotAPI, db *gorm.DB) *Provider {
+	return &Provider{
+		api:   api,
+		db:    db,
+		stars: true,
+	}
+}
+
+// Name returns the provider name
+func (p *Provider) Name() string {
+	if p.stars {
+		return StarsProviderName
+	}
+	return ProviderName
+}
+
+// DisplayName returns the label shown at checkout
+func (p *Provider) DisplayName() string {
+	if p.stars {
+		return "⭐ Telegram Stars"
+	}
+	return "💳 Telegram Pay"
+}
+
+// InChat reports that invoices are sent into the chat
+func (p *Provider) InChat() bool {
+	return true
+}
+
+// InvoiceAmount converts base currency cents into the invoice currency and
+// amount in its smallest units
+func (p *Provider) InvoiceAmount(amountCents int) (string, int, error) {
+	if !p.stars {
+		currencyCode, _ := store.GetCurrencySettings(p.db, p.config)
+		return currencyCode, currency.MinorUnits(currencyCode, amountCents), nil
+	}
+
+	rate := store.GetTelegramStarsRate(p.db)
+	if rate <= 0 {
+		return "", 0, ErrStarsRateNotSet
+	}
+
+	// Round up so the shop never receives less than the order amount
+	stars := int(math.Ceil(float64(amountCents) / 100 * rate))
+	if stars < 1 {
+		return "", 0, ErrAmountTooSmall
+	}
+	return StarsCurrency, stars, nil
+}
+
+// CreateCheckout sends an invoice to the chat. The merchant order number is
+// used as the invoice payload so the payment can be matched later.
+func (p *Provider) CreateCheckout(ctx context.Context, req payment.CheckoutRequest) (*payment.Checkout, error) {
+	if req.OutTradeNo == "" {
+		return nil, payment.ErrMissingOutTradeNo
+	}
+	if req.ChatID == 0 {
+		return nil, ErrMissingChatID
+	}
+
+	currencyCode, amount, err := p.InvoiceAmount(req.AmountCents)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := tgbotapi.NewInvoice(req.ChatID, req.Subject, req.Subject, req.OutTradeNo, p.token, "", currencyCode,
+		[]tgbotapi.LabeledPrice{{Label: req.Subject, Amount: amount}})
+	invoice.SuggestedTipAmounts = []int{}
+
+	if _, err := p.api.Send(invoice); err != nil {
+		return nil, fmt.Errorf("failed to send invoice: %w", err)
+	}
+
+	return &payment.Checkout{InChat: true}, nil
+}
+
+// VerifyCallback is not used, Telegram confirms payments through bot updates
+func (p *Provider) VerifyCallback(params url.Values) (*payment.Notification, error) {
+	return nil, payment.ErrCallbackNotSupported
+}
+
+// Query reports the locally recorded state. Telegram has no query API, a
+// payment is final once the successful_payment update has been processed.
+func (p *Provider) Query(ctx context.Context, outTradeNo string) (*payment.QueryResult, error) {
+	order, err := store.GetOrderByOutTradeNo(p.db, outTradeNo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment.QueryResult{
+		TradeNo:     order.EpayTradeNo,
+		OutTradeNo:  order.EpayOutTradeNo,
+		AmountCents: order.PaymentAmount,
+		Paid:        order.EpayTradeNo != "" && order.Status != "pending",
+	}, nil
+}
+
+// Refund refunds a Stars payment in full. Telegram does not support
+// refunds for payments made through a provider token.
+func (p *Provider) Refund(ctx context.Context, outTradeNo string, amountCents int) error {
+	if !p.stars {
+		return payment.ErrRefundNotSupported
+	}
+
+	order, err := store.GetOrderByOutTradeNo(p.db, outTradeNo)
+	if err != nil {
+		return err
+	}
+	if order.EpayTradeNo == "" {
+		return fmt.Errorf("order %d has no telegram payment charge id", order.ID)
+	}
+	if amountCents != order.PaymentAmount {
+		return errors.New("telegram stars payments can only be refunded in full")
+	}
+
+	_, err = p.api.MakeRequest("refundStarPayment", tgbotapi.Params{
+		"user_id":                    fmt.Sprintf("%d", order.User.TgUserID),
+		"telegram_payment_charge_id": order.EpayTradeNo,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refund stars payment: %w", err)
+	}
+	return nil
+}
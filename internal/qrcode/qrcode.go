@@ -0,0 +1,522 @@
+// Package qrcode renders QR codes for payment links. It implements the
+// subset of ISO/IEC 18004 the bot needs: byte mode, error correction level
+// M and versions 1 to 20, which covers payment URLs of up to 666 bytes.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+const (
+	maxVersion = 20
+	quietZone  = 4 // Modules of white border required around the symbol
+)
+
+var ErrContentTooLong = errors.New("qrcode: content too long")
+
+// blockSpec describes the error correction blocks of a version at level M
+type blockSpec struct {
+	ecPerBlock int // EC codewords in every block
+	group1     int // Number of blocks in group 1
+	data1      int // Data codewords per group 1 block
+	group2     int // Number of blocks in group 2, which hold one more data codeword
+}
+
+// levelM lists the block structure for versions 1..20 at level M
+var levelM = [maxVersion + 1]blockSpec{
+	{},
+	{10, 1, 16, 0}, {16, 1, 28, 0}, {26, 1, 44, 0}, {18, 2, 32, 0}, {24, 2, 43, 0},
+	{16, 4, 27, 0}, {18, 4, 31, 0}, {22, 2, 38, 2}, {22, 3, 36, 2}, {26, 4, 43, 1},
+	{30, 1, 50, 4}, {22, 6, 36, 2}, {22, 8, 37, 1}, {24, 4, 40, 5}, {24, 5, 41, 5},
+	{28, 7, 45, 3}, {28, 10, 46, 1}, {26, 9, 43, 4}, {26, 3, 44, 11}, {26, 3, 41, 13},
+}
+
+func (s blockSpec) dataCodewords() int {
+	return s.group1*s.data1 + s.group2*(s.data1+1)
+}
+
+// Code is an encoded QR symbol
+type Code struct {
+	Version int
+	Size    int
+	modules [][]bool // [y][x], true is dark
+	isFunc  [][]bool // Finder, timing, alignment and format areas
+}
+
+// Dark reports whether the module at column x, row y is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode encodes content with byte mode at error correction level M using
+// the smallest version that fits
+func Encode(content string) (*Code, error) {
+	return encode(content, -1)
+}
+
+// encode builds the symbol with the given mask, or with the mask of the
+// lowest penalty when mask is negative
+func encode(content string, mask int) (*Code, error) {
+	data := []byte(content)
+
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if 4+countBits(v)+8*len(data) <= levelM[v].dataCodewords()*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrContentTooLong
+	}
+
+	codewords := addErrorCorrection(version, encodeData(version, data))
+
+	size := version*4 + 17
+	c := &Code{Version: version, Size: size}
+	c.modules = newGrid(size)
+	c.isFunc = newGrid(size)
+
+	c.drawFunctionPatterns()
+	c.drawCodewords(codewords)
+
+	// Pick the mask with the lowest penalty, applying a mask twice undoes it
+	if mask < 0 {
+		bestPenalty := -1
+		for m := 0; m < 8; m++ {
+			c.applyMask(m)
+			c.drawFormatBits(m)
+			if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+				mask, bestPenalty = m, penalty
+			}
+			c.applyMask(m)
+		}
+	}
+	c.applyMask(mask)
+	c.drawFormatBits(mask)
+
+	return c, nil
+}
+
+// Image renders the code with scale pixels per module and a quiet zone
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	dim := (c.Size + 2*quietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, dim, dim))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+quietZone)*scale+dx, (y+quietZone)*scale+dy, color.Gray{Y: 0})
+				}
+			}
+		}
+	}
+	return img
+}
+
+// PNG encodes content and renders it as a PNG image of at least size pixels
+func PNG(content string, size int) ([]byte, error) {
+	code, err := Encode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := code.Size + 2*quietZone
+	scale := (size + modules - 1) / modules
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code.Image(scale)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+// countBits is the width of the byte mode character count indicator
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// encodeData builds the data codewords: mode, count, payload, terminator and padding
+func encodeData(version int, data []byte) []byte {
+	capacity := levelM[version].dataCodewords() * 8
+
+	var bits bitBuffer
+	bits.append(0x4, 4) // Byte mode
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	terminator := capacity - bits.len()
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	if rem := bits.len() % 8; rem != 0 {
+		bits.append(0, 8-rem)
+	}
+	for pad := 0xEC; bits.len() < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	return bits.bytes()
+}
+
+// addErrorCorrection splits data into blocks, appends Reed-Solomon codewords
+// and interleaves the result
+func addErrorCorrection(version int, data []byte) []byte {
+	spec := levelM[version]
+	numBlocks := spec.group1 + spec.group2
+	divisor := rsDivisor(spec.ecPerBlock)
+
+	dataBlocks := make([][]byte, numBlocks)
+	ecBlocks := make([][]byte, numBlocks)
+	offset := 0
+	for i := 0; i < numBlocks; i++ {
+		n := spec.data1
+		if i >= spec.group1 {
+			n++
+		}
+		dataBlocks[i] = data[offset : offset+n]
+		ecBlocks[i] = rsRemainder(dataBlocks[i], divisor)
+		offset += n
+	}
+
+	var result []byte
+	for i := 0; i <= spec.data1; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < spec.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunc[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	// Timing patterns
+	for i := 0; i < c.Size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	// Alignment patterns, except where they would overlap the finders
+	positions := alignmentPositions(c.Version)
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas, the real bits are drawn per mask
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+func (c *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= c.Size || y < 0 || y >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// alignmentPositions returns the row and column centres of alignment patterns
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	num := version/7 + 2
+	step := (version*4 + num*2 + 1) / (num*2 - 2) * 2
+
+	positions := make([]int, num)
+	positions[0] = 6
+	for i, pos := num-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// formatBits returns the 15 bit format information for level M and mask:
+// five data bits, ten BCH bits, XORed with the fixed pattern
+func formatBits(mask int) int {
+	const levelMBits = 0 // Level M is encoded as 00
+	data := levelMBits<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionBits returns the 18 bit version information: six data bits and
+// twelve BCH bits
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+// drawFormatBits draws both copies of the format information for level M
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatBits(mask)
+
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	// Around the top left finder
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	// Split between the other two finders
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+	c.set(8, c.Size-8, true) // Always dark
+}
+
+// drawVersion draws the version information blocks used from version 7
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	bits := versionBits(c.Version)
+
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 != 0
+		a, b := c.Size-11+i%3, i/3
+		c.set(a, b, dark)
+		c.set(b, a, dark)
+	}
+}
+
+// drawCodewords places the data in the two column zigzag, skipping
+// function modules. Leftover remainder modules stay light.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.isFunc[y][x] || i >= len(data)*8 {
+					continue
+				}
+				c.modules[y][x] = (data[i>>3]>>(7-uint(i&7)))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.isFunc[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol with the four mask evaluation rules
+func (c *Code) penalty() int {
+	score := 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+
+	line := func(get func(i int) bool) {
+		// Rule 1: runs of five or more modules of the same colour
+		run := 1
+		for i := 1; i < c.Size; i++ {
+			if get(i) == get(i-1) {
+				run++
+				continue
+			}
+			if run >= 5 {
+				score += run - 2
+			}
+			run = 1
+		}
+		if run >= 5 {
+			score += run - 2
+		}
+
+		// Rule 3: finder-like 1:1:3:1:1 pattern with four light modules on one side
+		for i := 0; i+len(finderLike) <= c.Size; i++ {
+			match := true
+			for k, dark := range finderLike {
+				if get(i+k) != dark {
+					match = false
+					break
+				}
+			}
+			if match && (lightRun(get, i-4, i, c.Size) || lightRun(get, i+7, i+11, c.Size)) {
+				score += 40
+			}
+		}
+	}
+	for y := 0; y < c.Size; y++ {
+		line(func(i int) bool { return c.modules[y][i] })
+	}
+	for x := 0; x < c.Size; x++ {
+		line(func(i int) bool { return c.modules[i][x] })
+	}
+
+	// Rule 2: 2x2 blocks of the same colour
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				v := c.modules[y][x]
+				if v == c.modules[y][x+1] && v == c.modules[y+1][x] && v == c.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+
+	// Rule 4: balance of dark and light modules
+	total := c.Size * c.Size
+	deviation := abs(dark*20-total*10) / total
+	score += deviation * 10
+
+	return score
+}
+
+// lightRun reports whether modules from..to are light, outside the symbol counts as light
+func lightRun(get func(i int) bool, from, to, size int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < size && get(i) {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// bitBuffer accumulates bits most significant first
+type bitBuffer struct {
+	bits []bool
+}
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		b.bits = append(b.bits, (value>>i)&1 != 0)
+	}
+}
+
+func (b *bitBuffer) len() int {
+	return len(b.bits)
+}
+
+func (b *bitBuffer) bytes() []byte {
+	out := make([]byte, (len(b.bits)+7)/8)
+	for i, bit := range b.bits {
+		if bit {
+			out[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+	return out
+}
@@ -0,0 +1,193 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testContent returns a payment-like URL of n bytes
+func testContent(n int) string {
+	s := "https://pay.example.com/submit.php?out_trade_no="
+	for i := 0; len(s) < n; i++ {
+		s += string(rune('0' + i%10))
+	}
+	return s[:n]
+}
+
+// TestEncodeGolden compares whole symbols with ones produced by an
+// independent encoder (rsc.io/qr) for the same version and mask
+func TestEncodeGolden(t *testing.T) {
+	type golden struct {
+		version, length, mask int
+	}
+	var tests []golden
+	for mask := 0; mask < 8; mask++ {
+		tests = append(tests, golden{1, 14, mask})
+	}
+	tests = append(tests,
+		golden{2, 20, 7},
+		golden{5, 84, 2},
+		golden{7, 122, 3}, // First version with version information
+		golden{10, 213, 4},
+		golden{14, 362, 5},
+		golden{20, 666, 6},
+	)
+
+	for _, tt := range tests {
+		name := fmt.Sprintf("v%02d-mask%d", tt.version, tt.mask)
+		t.Run(name, func(t *testing.T) {
+			want, err := os.ReadFile(filepath.Join("testdata", name+".txt"))
+			if err != nil {
+				t.Fatalf("read golden: %v", err)
+			}
+			code, err := encode(testContent(tt.length), tt.mask)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if code.Version != tt.version {
+				t.Fatalf("version = %d, want %d", code.Version, tt.version)
+			}
+
+			got := render(code)
+			if got == string(want) {
+				return
+			}
+			gotRows, wantRows := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+			for y := range wantRows {
+				if y < len(gotRows) && gotRows[y] != wantRows[y] {
+					t.Fatalf("row %d differs:\n got %s\nwant %s", y, gotRows[y], wantRows[y])
+				}
+			}
+			t.Fatalf("symbol differs from golden")
+		})
+	}
+}
+
+// render draws the symbol as rows of # for dark and . for light modules
+func render(c *Code) string {
+	var b strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestEncodeUsesChosenMask(t *testing.T) {
+	content := testContent(100)
+	code, err := Encode(content)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	// The automatic choice must be one of the fixed mask symbols
+	for mask := 0; mask < 8; mask++ {
+		fixed, err := encode(content, mask)
+		if err != nil {
+			t.Fatalf("encode mask %d: %v", mask, err)
+		}
+		if render(fixed) == render(code) {
+			return
+		}
+	}
+	t.Fatal("symbol matches no mask")
+}
+
+func TestEncodeVersionSelection(t *testing.T) {
+	// Byte mode capacities at level M from ISO/IEC 18004 table 7
+	capacity := []int{0, 14, 26, 42, 62, 84, 106, 122, 152, 180, 213, 251, 287, 331, 362, 412, 450, 504, 560, 624, 666}
+	for version := 1; version <= maxVersion; version++ {
+		code, err := Encode(testContent(capacity[version]))
+		if err != nil {
+			t.Fatalf("encode %d bytes: %v", capacity[version], err)
+		}
+		if code.Version != version || code.Size != version*4+17 {
+			t.Errorf("%d bytes: version %d size %d, want version %d", capacity[version], code.Version, code.Size, version)
+		}
+		if version == maxVersion {
+			continue
+		}
+		if code, err := Encode(testContent(capacity[version] + 1)); err != nil || code.Version != version+1 {
+			t.Errorf("%d bytes: want version %d, got %v %v", capacity[version]+1, version+1, code, err)
+		}
+	}
+
+	if _, err := Encode(testContent(capacity[maxVersion] + 1)); !errors.Is(err, ErrContentTooLong) {
+		t.Errorf("error = %v, want %v", err, ErrContentTooLong)
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	// Format information for level M from ISO/IEC 18004 Annex C
+	want := []int{0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0}
+	for mask, bits := range want {
+		if got := formatBits(mask); got != bits {
+			t.Errorf("formatBits(%d) = %015b, want %015b", mask, got, bits)
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	// Version information from ISO/IEC 18004 Annex D
+	want := map[int]int{
+		7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3, 11: 0x0BBF6, 12: 0x0C762, 13: 0x0D847,
+		14: 0x0E60D, 15: 0x0F928, 16: 0x10B78, 17: 0x1145D, 18: 0x12A17, 19: 0x13532, 20: 0x149A6,
+	}
+	for version, bits := range want {
+		if got := versionBits(version); got != bits {
+			t.Errorf("versionBits(%d) = %018b, want %018b", version, got, bits)
+		}
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	// Row and column centres from ISO/IEC 18004 Annex E
+	tests := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		6:  {6, 34},
+		7:  {6, 22, 38},
+		14: {6, 26, 46, 66},
+		16: {6, 26, 50, 74},
+		20: {6, 34, 62, 90},
+	}
+	for version, want := range tests {
+		if got := alignmentPositions(version); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("alignmentPositions(%d) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	data, err := PNG(testContent(60), 256)
+	if err != nil {
+		t.Fatalf("PNG: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	// Version 4 is 33 modules plus the quiet zone, scaled to at least 256 pixels
+	if got := img.Bounds().Dx(); got != 41*7 {
+		t.Errorf("width = %d, want %d", got, 41*7)
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0xffff {
+		t.Error("quiet zone is not light")
+	}
+	if r, _, _, _ := img.At(4*7, 4*7).RGBA(); r != 0 {
+		t.Error("finder corner is not dark")
+	}
+}
@@ -0,0 +1,76 @@
+package qrcode
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{
+			// ISO/IEC 18004 Annex I: "01234567" as version 1-M
+			name: "annex 01234567",
+			data: []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11},
+			want: []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55},
+		},
+		{
+			// "HELLO WORLD" as version 1-M
+			name: "hello world",
+			data: []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			want: []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+	}
+	for _, tt := range tests {
+		if got := rsRemainder(tt.data, rsDivisor(len(tt.want))); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: remainder = % X, want % X", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRSDivisor(t *testing.T) {
+	// Generator polynomials from ISO/IEC 18004 Annex A as exponents of
+	// alpha, highest term first without the leading x^n
+	tests := map[int][]int{
+		7:  {87, 229, 146, 149, 238, 102, 21},
+		10: {251, 67, 46, 61, 118, 70, 64, 94, 32, 45},
+		16: {120, 104, 107, 109, 102, 161, 76, 3, 91, 191, 147, 169, 182, 194, 225, 120},
+	}
+
+	var antilog [255]byte
+	antilog[0] = 1
+	for i := 1; i < len(antilog); i++ {
+		antilog[i] = gfMul(antilog[i-1], 0x02)
+	}
+
+	for degree, exponents := range tests {
+		want := make([]byte, len(exponents))
+		for i, e := range exponents {
+			want[i] = antilog[e]
+		}
+		if got := rsDivisor(degree); !bytes.Equal(got, want) {
+			t.Errorf("rsDivisor(%d) = % X, want % X", degree, got, want)
+		}
+	}
+}
+
+func TestGFMul(t *testing.T) {
+	tests := []struct{ x, y, want byte }{
+		{0, 0x53, 0},
+		{1, 0x53, 0x53},
+		{0x02, 0x80, 0x1D}, // x^8 reduces to x^4 + x^3 + x^2 + 1
+		{0x53, 0xCA, 0x8F},
+		{0xFF, 0xFF, 0xE2},
+	}
+	for _, tt := range tests {
+		if got := gfMul(tt.x, tt.y); got != tt.want {
+			t.Errorf("gfMul(%#x, %#x) = %#x, want %#x", tt.x, tt.y, got, tt.want)
+		}
+		if got := gfMul(tt.y, tt.x); got != tt.want {
+			t.Errorf("gfMul(%#x, %#x) = %#x, want %#x", tt.y, tt.x, got, tt.want)
+		}
+	}
+}
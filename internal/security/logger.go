@@ -40,10 +40,16 @@ type SecurityEvent struct {
 	Timestamp   time.Time
 }
 
+// AuditRecorder persists audit trail entries
+type AuditRecorder interface {
+	RecordAudit(audit SecurityAudit) error
+}
+
 // SecurityLogger handles security event logging
 type SecurityLogger struct {
 	enableDetailedLogging bool
 	maskSensitiveData     bool
+	recorder              AuditRecorder
 }
 
 // NewSecurityLogger creates a new security logger
@@ -54,6 +60,12 @@ func NewSecurityLogger(enableDetailed, maskSensitive bool) *SecurityLogger {
 	}
 }
 
+// SetAuditRecorder persists audit entries and data changes in addition to
+// logging them
+func (sl *SecurityLogger) SetAuditRecorder(recorder AuditRecorder) {
+	sl.recorder = recorder
+}
+
 // LogEvent logs a security event
 func (sl *SecurityLogger) LogEvent(event SecurityEvent) {
 	// Set timestamp if not set
@@ -102,7 +114,7 @@ func (sl *SecurityLogger) LogEvent(event SecurityEvent) {
 	if sl.enableDetailedLogging && event.Details != nil {
 		for key, value := range event.Details {
 			// Mask sensitive fields
-			if sl.maskSensitiveData && isSensitiveField(key) {
+			if sl.maskSensitiveData && IsSensitiveField(key) {
 				if strVal, ok := value.(string); ok {
 					value = MaskSensitiveData(strVal, 4)
 				}
@@ -173,15 +185,31 @@ func (sl *SecurityLogger) LogAccessDenied(userID, username, resource, reason str
 	})
 }
 
-// LogDataAccess logs data access events
-func (sl *SecurityLogger) LogDataAccess(userID, username, resource, action string) {
+// LogDataAccess logs data access events. Requests that change data are
+// also recorded in the audit trail; reads are only logged.
+func (sl *SecurityLogger) LogDataAccess(userID, username, resource, action, ipAddress, userAgent string) {
 	sl.LogEvent(SecurityEvent{
-		Type:     EventDataAccess,
-		UserID:   userID,
-		Username: username,
-		Resource: resource,
-		Action:   action,
-		Result:   "success",
+		Type:      EventDataAccess,
+		UserID:    userID,
+		Username:  username,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Resource:  resource,
+		Action:    action,
+		Result:    "success",
+	})
+	
+	switch action {
+	case "GET", "HEAD", "OPTIONS":
+		return
+	}
+	sl.record(SecurityAudit{
+		UserID:    userID,
+		Username:  username,
+		Action:    AuditActionRequest + ":" + action,
+		Resource:  resource,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
 	})
 }
 
@@ -200,8 +228,8 @@ func (sl *SecurityLogger) LogSecurityAlert(alertType, description string, detail
 	})
 }
 
-// isSensitiveField checks if a field name indicates sensitive data
-func isSensitiveField(fieldName string) bool {
+// IsSensitiveField checks if a field name indicates sensitive data
+func IsSensitiveField(fieldName string) bool {
 	sensitiveFields := []string{
 		"password", "token", "secret", "key", "email", "phone",
 		"credit_card", "ssn", "api_key", "private_key",
@@ -217,6 +245,10 @@ func isSensitiveField(fieldName string) bool {
 	return false
 }
 
+// AuditActionRequest prefixes audit entries of data changing requests,
+// e.g. "request:POST"
+const AuditActionRequest = "request"
+
 // SecurityAudit represents an audit trail entry
 type SecurityAudit struct {
 	ID          string
@@ -272,4 +304,19 @@ func (sl *SecurityLogger) LogAudit(audit SecurityAudit) {
 	}
 	
 	logger.Info("Security Audit", fields...)
-}
\ No newline at end of file
+	
+	sl.record(audit)
+}
+
+// record persists an audit entry when a recorder is set
+func (sl *SecurityLogger) record(audit SecurityAudit) {
+	if sl.recorder == nil {
+		return
+	}
+	if audit.Timestamp.IsZero() {
+		audit.Timestamp = time.Now()
+	}
+	if err := sl.recorder.RecordAudit(audit); err != nil {
+		logger.Error("Failed to record audit entry", "error", err, "action", audit.Action, "resource", audit.Resource)
+	}
+}
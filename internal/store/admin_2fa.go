@@ -0,0 +1,238 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"shop-bot/internal/auth"
+	logger "shop-bot/internal/log"
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled    = errors.New("two-factor authentication setup has not been started")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+)
+
+// TOTPKey returns the TOTP secret of the admin. Secrets are stored
+// encrypted with the data encryption key, like codes, when one is set.
+func (a *AdminUser) TOTPKey() (string, error) {
+	return DecryptCode(a.TOTPSecret)
+}
+
+// StartAdminTOTPEnrollment stores a new secret that is not in use until
+// EnableAdminTOTP confirms a code from it
+func StartAdminTOTPEnrollment(db *gorm.DB, adminID uint, secret string) error {
+	stored, err := EncryptCode(secret)
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var admin AdminUser
+		if err := tx.Select("id", "totp_enabled").First(&admin, adminID).Error; err != nil {
+			return err
+		}
+		if admin.TOTPEnabled {
+			return ErrTOTPAlreadyEnabled
+		}
+		return tx.Model(&admin).Updates(map[string]interface{}{
+			"totp_secret":    stored,
+			"totp_last_step": 0,
+		}).Error
+	})
+}
+
+// EnableAdminTOTP turns on two-factor authentication with the enrolled
+// secret once a code from it was verified at step, and replaces the
+// recovery codes
+func EnableAdminTOTP(db *gorm.DB, adminID uint, step int64, recoveryHashes []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var admin AdminUser
+		if err := tx.Select("id", "totp_secret", "totp_enabled").First(&admin, adminID).Error; err != nil {
+			return err
+		}
+		if admin.TOTPEnabled {
+			return ErrTOTPAlreadyEnabled
+		}
+		if admin.TOTPSecret == "" {
+			return ErrTOTPNotEnrolled
+		}
+		if err := tx.Model(&admin).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodesTx(tx, adminID, recoveryHashes)
+	})
+}
+
+// DisableAdminTOTP turns off two-factor authentication and removes the
+// secret and recovery codes
+func DisableAdminTOTP(db *gorm.DB, adminID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&AdminUser{}).Where("id = ?", adminID).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("admin_user_id = ?", adminID).Delete(&AdminRecoveryCode{}).Error
+	})
+}
+
+// RecordAdminTOTPStep marks a time step as used. It returns false when the
+// step, or a later one, was already used, so concurrent logins cannot
+// share a code.
+func RecordAdminTOTPStep(db *gorm.DB, adminID uint, step int64) (bool, error) {
+	result := db.Model(&AdminUser{}).
+		Where("id = ? AND totp_last_step < ?", adminID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UseAdminRecoveryCode consumes an unused recovery code by its hash and
+// reports whether one matched
+func UseAdminRecoveryCode(db *gorm.DB, adminID uint, codeHash string) (bool, error) {
+	result := db.Model(&AdminRecoveryCode{}).
+		Where("admin_user_id = ? AND code_hash = ? AND used_at IS NULL", adminID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReplaceAdminRecoveryCodes discards the recovery codes of an admin user and
+// stores new ones
+func ReplaceAdminRecoveryCodes(db *gorm.DB, adminID uint, recoveryHashes []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodesTx(tx, adminID, recoveryHashes)
+	})
+}
+
+func replaceRecoveryCodesTx(tx *gorm.DB, adminID uint, recoveryHashes []string) error {
+	if err := tx.Where("admin_user_id = ?", adminID).Delete(&AdminRecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]AdminRecoveryCode, 0, len(recoveryHashes))
+	for _, hash := range recoveryHashes {
+		codes = append(codes, AdminRecoveryCode{AdminUserID: adminID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// CountAdminRecoveryCodes returns the number of unused recovery codes
+func CountAdminRecoveryCodes(db *gorm.DB, adminID uint) (int64, error) {
+	var count int64
+	err := db.Model(&AdminRecoveryCode{}).
+		Where("admin_user_id = ? AND used_at IS NULL", adminID).
+		Count(&count).Error
+	return count, err
+}
+
+// EncryptAdminTOTPSecrets encrypts TOTP secrets stored in plaintext before
+// the data encryption key was configured
+func EncryptAdminTOTPSecrets(db *gorm.DB) error {
+	if !CodeEncryptionEnabled() {
+		return nil
+	}
+	var admins []AdminUser
+	if err := db.Select("id", "totp_secret").
+		Where("totp_secret <> '' AND totp_secret NOT LIKE ?", encryptedCodePrefix+"%").
+		Find(&admins).Error; err != nil {
+		return err
+	}
+	for _, admin := range admins {
+		stored, err := EncryptCode(admin.TOTPSecret)
+		if err != nil {
+			return err
+		}
+		// Leave the secret alone if it changed meanwhile
+		if err := db.Model(&AdminUser{}).Where("id = ? AND totp_secret = ?", admin.ID, admin.TOTPSecret).
+			Update("totp_secret", stored).Error; err != nil {
+			return err
+		}
+	}
+	if len(admins) > 0 {
+		logger.Info("Encrypted admin TOTP secrets", "count", len(admins))
+	}
+	return nil
+}
+
+// RotateAdminTOTPSecrets re-encrypts the TOTP secrets of admins with
+// newCipher, like RotateCodeKey does for codes. It returns the number of
+// secrets rotated and the admins whose secret neither key could decrypt.
+func RotateAdminTOTPSecrets(db *gorm.DB, oldCipher, newCipher CodeCipher, dryRun bool) (int, []uint, error) {
+	if newCipher == nil {
+		return 0, nil, errors.New("new key is required")
+	}
+	var admins []AdminUser
+	if err := db.Select("id", "totp_secret").Where("totp_secret <> ''").Find(&admins).Error; err != nil {
+		return 0, nil, err
+	}
+
+	rotated := 0
+	var failed []uint
+	for _, admin := range admins {
+		plain := admin.TOTPSecret
+		if IsEncryptedCode(plain) {
+			if _, err := decryptCodeWith(newCipher, plain); err == nil {
+				continue
+			}
+			if oldCipher == nil {
+				failed = append(failed, admin.ID)
+				continue
+			}
+			decrypted, err := decryptCodeWith(oldCipher, plain)
+			if err != nil {
+				failed = append(failed, admin.ID)
+				continue
+			}
+			plain = decrypted
+		}
+		rotated++
+		if dryRun {
+			continue
+		}
+		stored, err := encryptCodeWith(newCipher, plain)
+		if err != nil {
+			return rotated, failed, fmt.Errorf("failed to encrypt TOTP secret of admin %d: %w", admin.ID, err)
+		}
+		if err := db.Model(&AdminUser{}).Where("id = ?", admin.ID).Update("totp_secret", stored).Error; err != nil {
+			return rotated, failed, fmt.Errorf("failed to update TOTP secret of admin %d: %w", admin.ID, err)
+		}
+	}
+	return rotated, failed, nil
+}
+
+// TokenLoginDisabled reports whether ADMIN_TOKEN logins are refused: the
+// setting is on and an active super admin has two-factor authentication,
+// so the shop cannot be locked out of its admin panel
+func TokenLoginDisabled(db *gorm.DB) bool {
+	if value, err := GetSetting(db, SettingDisableTokenLogin); err != nil || value != "true" {
+		return false
+	}
+	var count int64
+	if err := db.Model(&AdminUser{}).
+		Where("role = ? AND is_active = ? AND totp_enabled = ?", auth.RoleSuperAdmin, true, true).
+		Count(&count).Error; err != nil {
+		logger.Error("Failed to check admins with two-factor authentication", "error", err)
+		return false
+	}
+	return count > 0
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+
+	"shop-bot/internal/auth"
+)
+
+// newTestAdmin creates an active admin with a role
+func newTestAdmin(t *testing.T, db *gorm.DB, username, role string) *AdminUser {
+	t.Helper()
+	admin := &AdminUser{Username: username, Role: role, IsActive: true}
+	if err := db.Create(admin).Error; err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	return admin
+}
+
+// loadAdmin loads an admin as stored
+func loadAdmin(t *testing.T, db *gorm.DB, id uint) *AdminUser {
+	t.Helper()
+	var admin AdminUser
+	if err := db.First(&admin, id).Error; err != nil {
+		t.Fatalf("load admin: %v", err)
+	}
+	return &admin
+}
+
+func TestTOTPSecretEncryptedAtRest(t *testing.T) {
+	db := newTestDB(t)
+	admin := newTestAdmin(t, db, "alice", auth.RoleSuperAdmin)
+
+	// Enrolled before a key was configured
+	if err := StartAdminTOTPEnrollment(db, admin.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	if stored := loadAdmin(t, db, admin.ID).TOTPSecret; stored != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("secret without key = %q", stored)
+	}
+
+	oldCipher := newTestCipher(t, "old key")
+	useCodeCipher(t, oldCipher)
+	if err := EncryptAdminTOTPSecrets(db); err != nil {
+		t.Fatalf("encrypt secrets: %v", err)
+	}
+	stored := loadAdmin(t, db, admin.ID)
+	if !IsEncryptedCode(stored.TOTPSecret) {
+		t.Fatalf("secret not encrypted: %q", stored.TOTPSecret)
+	}
+	if secret, err := stored.TOTPKey(); err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("TOTPKey = %q, %v", secret, err)
+	}
+
+	newCipher := newTestCipher(t, "new key")
+	rotated, failed, err := RotateAdminTOTPSecrets(db, oldCipher, newCipher, false)
+	if err != nil || rotated != 1 || len(failed) != 0 {
+		t.Fatalf("rotate = %d, %v, %v", rotated, failed, err)
+	}
+	useCodeCipher(t, newCipher)
+	if secret, err := loadAdmin(t, db, admin.ID).TOTPKey(); err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("TOTPKey after rotation = %q, %v", secret, err)
+	}
+}
+
+func TestTokenLoginDisabled(t *testing.T) {
+	db := newTestDB(t)
+	admin := newTestAdmin(t, db, "root", auth.RoleSuperAdmin)
+
+	if TokenLoginDisabled(db) {
+		t.Fatal("token login disabled by default")
+	}
+	if err := SetSetting(db, SettingDisableTokenLogin, "true", "", "bool"); err != nil {
+		t.Fatalf("set setting: %v", err)
+	}
+	if TokenLoginDisabled(db) {
+		t.Fatal("token login disabled with no super admin using 2FA")
+	}
+
+	if err := StartAdminTOTPEnrollment(db, admin.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	if err := EnableAdminTOTP(db, admin.ID, 1, nil); err != nil {
+		t.Fatalf("enable 2FA: %v", err)
+	}
+	if !TokenLoginDisabled(db) {
+		t.Fatal("token login allowed although a super admin has 2FA")
+	}
+}
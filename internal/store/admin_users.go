@@ -0,0 +1,230 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"shop-bot/internal/auth"
+)
+
+var (
+	ErrInvalidRole          = errors.New("invalid role")
+	ErrLastSuperAdmin       = errors.New("at least one active super admin is required")
+	ErrInvalidAdminUsername = errors.New("username must be 3-50 characters without spaces")
+	ErrAdminUsernameTaken   = errors.New("username already exists")
+	ErrAdminTelegramIDTaken = errors.New("telegram ID is bound to another admin")
+)
+
+// BackfillAdminRoles gives admins flagged as super admin before roles
+// existed the super admin role
+func BackfillAdminRoles(db *gorm.DB) error {
+	return db.Model(&AdminUser{}).
+		Where("is_super_admin = ? AND role <> ?", true, auth.RoleSuperAdmin).
+		Update("role", auth.RoleSuperAdmin).Error
+}
+
+// ListAdminUsers returns all admin users
+func ListAdminUsers(db *gorm.DB) ([]AdminUser, error) {
+	var admins []AdminUser
+	err := db.Order("id").Find(&admins).Error
+	return admins, err
+}
+
+// SetAdminRole changes the role of an admin user and returns the previous
+// role. The last active super admin cannot be demoted.
+func SetAdminRole(db *gorm.DB, adminID uint, role string) (*AdminUser, string, error) {
+	if !auth.ValidRole(role) {
+		return nil, "", ErrInvalidRole
+	}
+
+	var admin AdminUser
+	var previous string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&admin, adminID).Error; err != nil {
+			return err
+		}
+		previous = admin.Role
+		if role != auth.RoleSuperAdmin {
+			if err := ensureOtherSuperAdminTx(tx, &admin); err != nil {
+				return err
+			}
+		}
+
+		admin.Role = role
+		admin.IsSuperAdmin = role == auth.RoleSuperAdmin
+		return tx.Model(&admin).Select("role", "is_super_admin").Updates(&admin).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &admin, previous, nil
+}
+
+// ensureOtherSuperAdminTx returns ErrLastSuperAdmin when admin is the only
+// active super admin, before it is demoted, disabled or deleted
+func ensureOtherSuperAdminTx(tx *gorm.DB, admin *AdminUser) error {
+	if admin.Role != auth.RoleSuperAdmin || !admin.IsActive {
+		return nil
+	}
+	var others int64
+	if err := tx.Model(&AdminUser{}).
+		Where("id <> ? AND role = ? AND is_active = ?", admin.ID, auth.RoleSuperAdmin, true).
+		Count(&others).Error; err != nil {
+		return err
+	}
+	if others == 0 {
+		return ErrLastSuperAdmin
+	}
+	return nil
+}
+
+// ensureTelegramIDFreeTx returns ErrAdminTelegramIDTaken when another admin
+// is bound to telegramID
+func ensureTelegramIDFreeTx(tx *gorm.DB, adminID uint, telegramID *int64) error {
+	if telegramID == nil {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&AdminUser{}).
+		Where("id <> ? AND telegram_id = ?", adminID, *telegramID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAdminTelegramIDTaken
+	}
+	return nil
+}
+
+// GetAdminUserByUsername returns the admin user with a username
+func GetAdminUserByUsername(db *gorm.DB, username string) (*AdminUser, error) {
+	var admin AdminUser
+	if err := db.Where("username = ?", username).First(&admin).Error; err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+// CreateAdminUser creates an admin user. Password must already be hashed.
+func CreateAdminUser(db *gorm.DB, admin *AdminUser) error {
+	admin.Username = strings.TrimSpace(admin.Username)
+	if len(admin.Username) < 3 || len(admin.Username) > 50 || strings.ContainsAny(admin.Username, " \t\r\n") {
+		return ErrInvalidAdminUsername
+	}
+	if !auth.ValidRole(admin.Role) {
+		return ErrInvalidRole
+	}
+	admin.IsSuperAdmin = admin.Role == auth.RoleSuperAdmin
+	admin.IsActive = true
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&AdminUser{}).Where("username = ?", admin.Username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAdminUsernameTaken
+		}
+		if err := ensureTelegramIDFreeTx(tx, 0, admin.TelegramID); err != nil {
+			return err
+		}
+		return tx.Create(admin).Error
+	})
+}
+
+// SetAdminActive enables or disables an admin user. The last active super
+// admin cannot be disabled.
+func SetAdminActive(db *gorm.DB, adminID uint, active bool) (*AdminUser, error) {
+	var admin AdminUser
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&admin, adminID).Error; err != nil {
+			return err
+		}
+		if !active {
+			if err := ensureOtherSuperAdminTx(tx, &admin); err != nil {
+				return err
+			}
+		}
+		admin.IsActive = active
+		return tx.Model(&admin).Update("is_active", active).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+// SetAdminPassword replaces the password hash of an admin user
+func SetAdminPassword(db *gorm.DB, adminID uint, passwordHash string) (*AdminUser, error) {
+	var admin AdminUser
+	if err := db.First(&admin, adminID).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&admin).Update("password", passwordHash).Error; err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+// SetAdminTelegramID binds an admin user to a Telegram ID, or unbinds it
+// when telegramID is nil
+func SetAdminTelegramID(db *gorm.DB, adminID uint, telegramID *int64) (*AdminUser, error) {
+	var admin AdminUser
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&admin, adminID).Error; err != nil {
+			return err
+		}
+		if err := ensureTelegramIDFreeTx(tx, admin.ID, telegramID); err != nil {
+			return err
+		}
+		admin.TelegramID = telegramID
+		return tx.Model(&admin).Update("telegram_id", telegramID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+// RevokeAdminSessions rejects every token and session issued to an admin
+// user up to now
+func RevokeAdminSessions(db *gorm.DB, adminID uint) error {
+	result := db.Model(&AdminUser{}).Where("id = ?", adminID).Update("sessions_revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAdminUser deletes an admin user. The last active super admin cannot
+// be deleted.
+func DeleteAdminUser(db *gorm.DB, adminID uint) (*AdminUser, error) {
+	var admin AdminUser
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&admin, adminID).Error; err != nil {
+			return err
+		}
+		if err := ensureOtherSuperAdminTx(tx, &admin); err != nil {
+			return err
+		}
+		if err := tx.Where("admin_user_id = ?", admin.ID).Delete(&AdminRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&admin).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+// UpdateAdminLastLogin records a successful login
+func UpdateAdminLastLogin(db *gorm.DB, adminID uint) error {
+	return db.Model(&AdminUser{}).Where("id = ?", adminID).Update("last_login_at", time.Now()).Error
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"shop-bot/internal/auth"
+)
+
+func TestCreateAdminUserRejects(t *testing.T) {
+	db := newTestDB(t)
+	telegramID := int64(42)
+	if err := CreateAdminUser(db, &AdminUser{Username: "alice", Password: "hash", Role: auth.RoleOperator, TelegramID: &telegramID}); err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		admin AdminUser
+		want  error
+	}{
+		{"duplicate username", AdminUser{Username: "alice", Role: auth.RoleViewer}, ErrAdminUsernameTaken},
+		{"duplicate after trimming", AdminUser{Username: "  alice ", Role: auth.RoleViewer}, ErrAdminUsernameTaken},
+		{"duplicate telegram ID", AdminUser{Username: "bob", Role: auth.RoleViewer, TelegramID: &telegramID}, ErrAdminTelegramIDTaken},
+		{"short username", AdminUser{Username: "al", Role: auth.RoleViewer}, ErrInvalidAdminUsername},
+		{"username with space", AdminUser{Username: "al ice", Role: auth.RoleViewer}, ErrInvalidAdminUsername},
+		{"unknown role", AdminUser{Username: "carol", Role: "owner"}, ErrInvalidRole},
+	}
+	for _, tt := range tests {
+		admin := tt.admin
+		admin.Password = "hash"
+		if err := CreateAdminUser(db, &admin); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	var count int64
+	db.Model(&AdminUser{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("%d admins stored, want only the first", count)
+	}
+}
+
+func TestLastSuperAdminIsKept(t *testing.T) {
+	db := newTestDB(t)
+	root := newTestAdmin(t, db, "root", auth.RoleSuperAdmin)
+	operator := newTestAdmin(t, db, "operator", auth.RoleOperator)
+
+	if _, _, err := SetAdminRole(db, root.ID, auth.RoleOperator); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Errorf("demote: error = %v, want %v", err, ErrLastSuperAdmin)
+	}
+	if _, err := SetAdminActive(db, root.ID, false); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Errorf("disable: error = %v, want %v", err, ErrLastSuperAdmin)
+	}
+	if _, err := DeleteAdminUser(db, root.ID); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Errorf("delete: error = %v, want %v", err, ErrLastSuperAdmin)
+	}
+	if stored := loadAdmin(t, db, root.ID); stored.Role != auth.RoleSuperAdmin || !stored.IsActive {
+		t.Fatalf("root = %+v, want an active super admin", stored)
+	}
+
+	// A disabled super admin does not count as another one
+	if _, _, err := SetAdminRole(db, operator.ID, auth.RoleSuperAdmin); err != nil {
+		t.Fatalf("promote operator: %v", err)
+	}
+	if _, err := SetAdminActive(db, operator.ID, false); err != nil {
+		t.Fatalf("disable operator: %v", err)
+	}
+	if _, err := DeleteAdminUser(db, root.ID); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Errorf("delete with a disabled peer: error = %v, want %v", err, ErrLastSuperAdmin)
+	}
+
+	if _, err := SetAdminActive(db, operator.ID, true); err != nil {
+		t.Fatalf("enable operator: %v", err)
+	}
+	admin, previous, err := SetAdminRole(db, root.ID, auth.RoleViewer)
+	if err != nil {
+		t.Fatalf("demote with another super admin: %v", err)
+	}
+	if previous != auth.RoleSuperAdmin || admin.Role != auth.RoleViewer || admin.IsSuperAdmin {
+		t.Errorf("demoted admin = %+v, previous %q", admin, previous)
+	}
+	if _, err := DeleteAdminUser(db, operator.ID); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Errorf("delete the remaining super admin: error = %v, want %v", err, ErrLastSuperAdmin)
+	}
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"shop-bot/internal/auth"
+)
+
+var (
+	ErrInvalidAPIKeyName   = errors.New("name must be 1-50 characters")
+	ErrInvalidAPIKeyScope  = errors.New("invalid scope")
+	ErrAPIKeyScopeRequired = errors.New("at least one scope is required")
+	ErrAPIKeyExpiry        = errors.New("expiry must be in the future")
+	ErrAPIKeyNotFound      = errors.New("API key not found")
+	ErrAPIKeyRevoked       = errors.New("API key already revoked")
+)
+
+// apiKeyTouchInterval limits how often the last use of a key is written, so
+// a busy integration does not write on every request
+const apiKeyTouchInterval = time.Minute
+
+// ScopeList returns the scopes of the key
+func (k *APIKey) ScopeList() []string {
+	var scopes []string
+	for _, scope := range strings.Split(k.Scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// Active reports whether the key can be used at t
+func (k *APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
+
+// CreateAPIKey validates and stores a new API key. Scopes are deduplicated
+// and sorted.
+func CreateAPIKey(db *gorm.DB, key *APIKey, scopes []string) error {
+	key.Name = strings.TrimSpace(key.Name)
+	if key.Name == "" || len(key.Name) > 50 {
+		return ErrInvalidAPIKeyName
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		return ErrAPIKeyExpiry
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	var valid []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !auth.ValidScope(scope) {
+			return ErrInvalidAPIKeyScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			valid = append(valid, scope)
+		}
+	}
+	if len(valid) == 0 {
+		return ErrAPIKeyScopeRequired
+	}
+	sort.Strings(valid)
+	key.Scopes = strings.Join(valid, ",")
+
+	return db.Create(key).Error
+}
+
+// ListAPIKeys returns all API keys, newest first
+func ListAPIKeys(db *gorm.DB) ([]APIKey, error) {
+	var keys []APIKey
+	err := db.Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// GetActiveAPIKey looks up an API key by its hash, returning
+// ErrAPIKeyNotFound when it does not exist, was revoked or expired
+func GetActiveAPIKey(db *gorm.DB, hash string) (*APIKey, error) {
+	var key APIKey
+	if err := db.Where("key_hash = ?", hash).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	if !key.Active(time.Now()) {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+// TouchAPIKey records the use of an API key, at most once a minute
+func TouchAPIKey(db *gorm.DB, id uint, ip string) error {
+	now := time.Now()
+	return db.Model(&APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-apiKeyTouchInterval)).
+		Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error
+}
+
+// RevokeAPIKey stops an API key from working and returns it
+func RevokeAPIKey(db *gorm.DB, id uint) (*APIKey, error) {
+	var key APIKey
+	if err := db.First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+
+	now := time.Now()
+	result := db.Model(&APIKey{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAPIKeyRevoked
+	}
+	key.RevokedAt = &now
+	return &key, nil
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"shop-bot/internal/security"
+)
+
+// AuditRecorder stores audit entries of the security logger in the
+// audit_logs table
+type AuditRecorder struct {
+	db *gorm.DB
+}
+
+// NewAuditRecorder creates an audit recorder
+func NewAuditRecorder(db *gorm.DB) *AuditRecorder {
+	return &AuditRecorder{db: db}
+}
+
+// RecordAudit implements security.AuditRecorder
+func (r *AuditRecorder) RecordAudit(audit security.SecurityAudit) error {
+	return r.db.Create(&AuditLog{
+		UserID:    truncateAuditField(audit.UserID, 50),
+		Username:  truncateAuditField(audit.Username, 50),
+		Action:    truncateAuditField(audit.Action, 50),
+		Resource:  truncateAuditField(audit.Resource, 255),
+		OldValue:  audit.OldValue,
+		NewValue:  audit.NewValue,
+		IPAddress: truncateAuditField(audit.IPAddress, 45),
+		UserAgent: truncateAuditField(audit.UserAgent, 255),
+		CreatedAt: audit.Timestamp,
+	}).Error
+}
+
+func truncateAuditField(value string, size int) string {
+	if len(value) <= size {
+		return value
+	}
+	return value[:size]
+}
+
+// AuditLogFilter narrows the admin audit log search
+type AuditLogFilter struct {
+	Username string
+	Action   string
+	Resource string // Matches resources starting with it, e.g. "product:12"
+	Query    string // Matches old or new values
+	From     *time.Time
+	To       *time.Time
+	Changes  bool // Only explicit changes, without data changing requests
+}
+
+func (f AuditLogFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.Username != "" {
+		query = query.Where("username = ?", f.Username)
+	}
+	if f.Action != "" {
+		query = query.Where("action = ?", f.Action)
+	}
+	if f.Resource != "" {
+		query = query.Where("resource LIKE ?", f.Resource+"%")
+	}
+	if f.Query != "" {
+		like := "%" + f.Query + "%"
+		query = query.Where("old_value LIKE ? OR new_value LIKE ?", like, like)
+	}
+	if f.From != nil {
+		query = query.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("created_at < ?", *f.To)
+	}
+	if f.Changes {
+		query = query.Where("action NOT LIKE ?", security.AuditActionRequest+":%")
+	}
+	return query
+}
+
+// ListAuditLogs returns audit entries matching the filter, newest first
+func ListAuditLogs(db *gorm.DB, filter AuditLogFilter, limit, offset int) ([]AuditLog, int64, error) {
+	query := filter.apply(db.Model(&AuditLog{}))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []AuditLog
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&logs).Error
+	return logs, total, err
+}
+
+// EachAuditLog calls fn for the audit entries matching the filter, newest
+// first, loading them in batches
+func EachAuditLog(db *gorm.DB, filter AuditLogFilter, fn func(AuditLog) error) error {
+	var lastID uint
+	for {
+		query := filter.apply(db.Model(&AuditLog{}))
+		if lastID > 0 {
+			query = query.Where("id < ?", lastID)
+		}
+		var batch []AuditLog
+		if err := query.Order("id DESC").Limit(500).Find(&batch).Error; err != nil {
+			return err
+		}
+		for _, entry := range batch {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if len(batch) < 500 {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// ListAuditActions returns the distinct actions in the audit log for filters
+func ListAuditActions(db *gorm.DB) ([]string, error) {
+	var actions []string
+	err := db.Model(&AuditLog{}).Distinct("action").Order("action").Pluck("action", &actions).Error
+	return actions, err
+}
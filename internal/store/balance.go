@@ -57,6 +57,31 @@ func AddBalance(db *gorm.DB, userID uint, amountCents int, txType string, descri
 	})
 }
 
+// adjustBalance changes a user's balance by amountCents in a single UPDATE,
+// so concurrent changes are not lost, and returns the new balance. Debits
+// that would leave the balance negative fail with ErrInsufficientBalance.
+func adjustBalance(tx *gorm.DB, userID uint, amountCents int) (int, error) {
+	query := tx.Model(&User{}).Where("id = ?", userID)
+	if amountCents < 0 {
+		query = query.Where("balance_cents >= ?", -amountCents)
+	}
+	result := query.Update("balance_cents", gorm.Expr("balance_cents + ?", amountCents))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected != 1 {
+		var count int64
+		if err := tx.Model(&User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			return 0, gorm.ErrRecordNotFound
+		}
+		return 0, ErrInsufficientBalance
+	}
+	return GetUserBalance(tx, userID)
+}
+
 // UseRechargeCard uses a recharge card to top up balance
 func UseRechargeCard(db *gorm.DB, userID uint, cardCode string) (*RechargeCard, error) {
 	var card RechargeCard
@@ -0,0 +1,239 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// How the codes of a batch entered stock
+const (
+	CodeBatchSourceUpload   = "upload"   // Plain codes uploaded by an admin
+	CodeBatchSourceImport   = "import"   // Structured CSV/JSON import by an admin
+	CodeBatchSourceSupplier = "supplier" // Pulled from a supplier API
+)
+
+// Profit report groupings
+const (
+	ProfitByProduct = "product"
+	ProfitByBatch   = "batch"
+	ProfitByDay     = "day"
+	ProfitByMonth   = "month"
+)
+
+var (
+	ErrInvalidUnitCost       = errors.New("unit cost must not be negative")
+	ErrInvalidProfitGrouping = errors.New("group must be product, batch, day or month")
+)
+
+// CodeBatchSummary is a batch with how many of its codes are sold and left
+type CodeBatchSummary struct {
+	CodeBatch
+	Sold      int64 `json:"sold"`
+	Available int64 `json:"available"`
+}
+
+// codeCost sums the unit cost of the batches codes were imported in. Codes
+// without a batch cost nothing.
+func codeCost(tx *gorm.DB, ids []uint) (int64, error) {
+	var total int64
+	err := tx.Model(&Code{}).
+		Joins("JOIN code_batches ON code_batches.id = codes.batch_id").
+		Where("codes.id IN ?", ids).
+		Select("COALESCE(SUM(code_batches.unit_cost_cents), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// ListCodeBatches returns the latest batches imported into a product
+func ListCodeBatches(db *gorm.DB, productID uint, limit int) ([]CodeBatchSummary, error) {
+	var batches []CodeBatch
+	if err := db.Where("product_id = ?", productID).Order("id DESC").Limit(limit).Find(&batches).Error; err != nil {
+		return nil, err
+	}
+	if len(batches) == 0 {
+		return []CodeBatchSummary{}, nil
+	}
+
+	ids := make([]uint, 0, len(batches))
+	for _, batch := range batches {
+		ids = append(ids, batch.ID)
+	}
+	var counts []struct {
+		BatchID   uint
+		Sold      int64
+		Available int64
+	}
+	err := db.Model(&Code{}).
+		Select("batch_id, SUM(CASE WHEN is_sold THEN 1 ELSE 0 END) AS sold, "+
+			"SUM(CASE WHEN NOT is_sold AND status = ? THEN 1 ELSE 0 END) AS available", CodeStatusAvailable).
+		Where("batch_id IN ?", ids).
+		Group("batch_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	byBatch := make(map[uint]int)
+	for i, count := range counts {
+		byBatch[count.BatchID] = i
+	}
+
+	summaries := make([]CodeBatchSummary, 0, len(batches))
+	for _, batch := range batches {
+		summary := CodeBatchSummary{CodeBatch: batch}
+		if i, ok := byBatch[batch.ID]; ok {
+			summary.Sold = counts[i].Sold
+			summary.Available = counts[i].Available
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// ProfitRow is the revenue, cost and profit of the codes sold in one group
+type ProfitRow struct {
+	Key          string `json:"key"` // Product ID, batch ID, or date
+	Label        string `json:"label"`
+	Sold         int    `json:"sold"`
+	RevenueCents int64  `json:"revenue_cents"`
+	CostCents    int64  `json:"cost_cents"`
+	ProfitCents  int64  `json:"profit_cents"`
+	Uncosted     int    `json:"uncosted"` // Codes sold without a batch, counted at zero cost
+}
+
+// MarginPercent returns profit as a percentage of revenue
+func (r ProfitRow) MarginPercent() float64 {
+	if r.RevenueCents == 0 {
+		return 0
+	}
+	return float64(r.ProfitCents) * 100 / float64(r.RevenueCents)
+}
+
+func (r *ProfitRow) add(revenue, cost int64, costed bool) {
+	r.Sold++
+	r.RevenueCents += revenue
+	r.CostCents += cost
+	r.ProfitCents += revenue - cost
+	if !costed {
+		r.Uncosted++
+	}
+}
+
+// ProfitReport summarises codes sold between From and To
+type ProfitReport struct {
+	GroupBy string      `json:"group_by"`
+	From    time.Time   `json:"from"`
+	To      time.Time   `json:"to"`
+	Rows    []ProfitRow `json:"rows"`
+	Total   ProfitRow   `json:"total"`
+}
+
+// GetProfitReport reports the revenue, cost and profit of codes sold in
+// [from, to), grouped by product, batch, day or month. Revenue is the
+// order amount of each sold code and cost the unit cost of its batch.
+func GetProfitReport(db *gorm.DB, groupBy string, from, to time.Time) (*ProfitReport, error) {
+	switch groupBy {
+	case ProfitByProduct, ProfitByBatch, ProfitByDay, ProfitByMonth:
+	default:
+		return nil, ErrInvalidProfitGrouping
+	}
+
+	rows, err := db.Table("codes").
+		Select("codes.product_id, products.name, codes.batch_id, code_batches.supplier, code_batches.created_at, "+
+			"codes.sold_at, orders.amount_cents, code_batches.unit_cost_cents").
+		Joins("JOIN orders ON orders.id = codes.order_id").
+		Joins("LEFT JOIN products ON products.id = codes.product_id").
+		Joins("LEFT JOIN code_batches ON code_batches.id = codes.batch_id").
+		Where("codes.is_sold = ? AND codes.sold_at >= ? AND codes.sold_at < ?", true, from, to).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &ProfitReport{GroupBy: groupBy, From: from, To: to, Total: ProfitRow{Key: "total", Label: "合计"}}
+	groups := make(map[string]*ProfitRow)
+	var order []string
+	for rows.Next() {
+		var (
+			productID    uint
+			productName  *string
+			batchID      *uint
+			supplier     *string
+			batchCreated *time.Time
+			soldAt       time.Time
+			amount       int64
+			unitCost     *int64
+		)
+		if err := rows.Scan(&productID, &productName, &batchID, &supplier, &batchCreated, &soldAt, &amount, &unitCost); err != nil {
+			return nil, err
+		}
+
+		var key, label string
+		switch groupBy {
+		case ProfitByProduct:
+			key = uintKey(productID)
+			label = "#" + key
+			if productName != nil {
+				label = *productName
+			}
+		case ProfitByBatch:
+			if batchID == nil {
+				key, label = "none", "无批次"
+				break
+			}
+			key = uintKey(*batchID)
+			label = "#" + key
+			if productName != nil {
+				label += " " + *productName
+			}
+			if supplier != nil && *supplier != "" {
+				label += " · " + *supplier
+			}
+			if batchCreated != nil {
+				label += " · " + batchCreated.Local().Format("2006-01-02")
+			}
+		case ProfitByDay:
+			key = soldAt.Local().Format("2006-01-02")
+			label = key
+		case ProfitByMonth:
+			key = soldAt.Local().Format("2006-01")
+			label = key
+		}
+
+		row, ok := groups[key]
+		if !ok {
+			row = &ProfitRow{Key: key, Label: label}
+			groups[key] = row
+			order = append(order, key)
+		}
+		var cost int64
+		if unitCost != nil {
+			cost = *unitCost
+		}
+		row.add(amount, cost, batchID != nil)
+		report.Total.add(amount, cost, batchID != nil)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Rows = make([]ProfitRow, 0, len(order))
+	for _, key := range order {
+		report.Rows = append(report.Rows, *groups[key])
+	}
+	switch groupBy {
+	case ProfitByDay, ProfitByMonth:
+		sort.Slice(report.Rows, func(i, j int) bool { return report.Rows[i].Key < report.Rows[j].Key })
+	default:
+		sort.SliceStable(report.Rows, func(i, j int) bool { return report.Rows[i].ProfitCents > report.Rows[j].ProfitCents })
+	}
+	return report, nil
+}
+
+func uintKey(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
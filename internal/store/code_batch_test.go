@@ -0,0 +1,111 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sellTestCode settles a product order paying received and dates the sale
+func sellTestCode(t *testing.T, db *gorm.DB, userID, productID uint, amount, received int, soldAt time.Time) *Order {
+	t.Helper()
+	order := &Order{UserID: userID, ProductID: &productID, AmountCents: amount, PaymentAmount: amount, Status: "pending",
+		EpayOutTradeNo: fmt.Sprintf("P%d-%d", productID, soldAt.UnixNano())}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := SettlePayment(db, order, "epay", order.EpayOutTradeNo, received); err != nil {
+		t.Fatalf("settle order: %v", err)
+	}
+	if err := db.Model(&Code{}).Where("order_id = ?", order.ID).Update("sold_at", soldAt).Error; err != nil {
+		t.Fatalf("date sale: %v", err)
+	}
+	return order
+}
+
+func TestGetProfitReport(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 0)
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local)
+
+	keys, _ := newTestCodes(t, db, "keys", 0)
+	if _, err := ImportCodes(db, keys.ID, []string{"K-1", "K-2", "K-3"}, CodeImportOptions{
+		Batch: CodeBatch{Source: CodeBatchSourceUpload, Supplier: "Acme", UnitCostCents: 30},
+	}); err != nil {
+		t.Fatalf("import keys: %v", err)
+	}
+	cards, _ := newTestCodes(t, db, "cards", 0)
+	if _, err := ImportCodes(db, cards.ID, []string{"C-1"}, CodeImportOptions{
+		Batch: CodeBatch{Source: CodeBatchSourceUpload, UnitCostCents: 45},
+	}); err != nil {
+		t.Fatalf("import cards: %v", err)
+	}
+	plain, _ := newTestCodes(t, db, "plain", 2) // No batch, so no known cost
+
+	sellTestCode(t, db, user.ID, keys.ID, 100, 100, from) // from is included
+	// The overpaid 60 is refunded to the balance and is not revenue
+	sellTestCode(t, db, user.ID, keys.ID, 100, 160, from.Add(19*24*time.Hour))
+	sellTestCode(t, db, user.ID, plain.ID, 80, 80, to.Add(-time.Second))
+	// Sales before from and at to fall outside the period
+	sellTestCode(t, db, user.ID, cards.ID, 150, 150, from.Add(-time.Second))
+	sellTestCode(t, db, user.ID, plain.ID, 80, 80, to)
+
+	// A mismatched payment refunded in full sells nothing
+	underpaid := &Order{UserID: user.ID, ProductID: &keys.ID, AmountCents: 100, PaymentAmount: 100, Status: "pending", EpayOutTradeNo: "P-under"}
+	if err := db.Create(underpaid).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := SettlePayment(db, underpaid, "epay", "T-under", 40); err != nil {
+		t.Fatalf("settle underpaid order: %v", err)
+	}
+	if _, err := CreditMismatchedOrder(db, underpaid); err != nil {
+		t.Fatalf("refund underpaid order: %v", err)
+	}
+
+	report, err := GetProfitReport(db, ProfitByProduct, from, to)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	want := []ProfitRow{
+		{Key: fmt.Sprint(keys.ID), Label: "keys", Sold: 2, RevenueCents: 200, CostCents: 60, ProfitCents: 140},
+		{Key: fmt.Sprint(plain.ID), Label: "plain", Sold: 1, RevenueCents: 80, ProfitCents: 80, Uncosted: 1},
+	}
+	if fmt.Sprint(report.Rows) != fmt.Sprint(want) {
+		t.Fatalf("rows = %+v, want %+v", report.Rows, want)
+	}
+	total := ProfitRow{Key: "total", Label: "合计", Sold: 3, RevenueCents: 280, CostCents: 60, ProfitCents: 220, Uncosted: 1}
+	if report.Total != total {
+		t.Fatalf("total = %+v, want %+v", report.Total, total)
+	}
+	if margin := report.Rows[0].MarginPercent(); margin != 70 {
+		t.Errorf("margin = %v, want 70", margin)
+	}
+
+	byDay, err := GetProfitReport(db, ProfitByDay, from, to)
+	if err != nil {
+		t.Fatalf("report by day: %v", err)
+	}
+	var days []string
+	for _, row := range byDay.Rows {
+		days = append(days, row.Key)
+	}
+	if fmt.Sprint(days) != "[2026-01-01 2026-01-20 2026-01-31]" {
+		t.Errorf("days = %v", days)
+	}
+
+	byBatch, err := GetProfitReport(db, ProfitByBatch, from.AddDate(0, -1, 0), to.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("report by batch: %v", err)
+	}
+	if len(byBatch.Rows) != 3 || byBatch.Rows[0].Key != "none" || byBatch.Rows[1].CostCents != 60 || byBatch.Rows[2].CostCents != 45 {
+		t.Errorf("batch rows = %+v, want uncosted codes, keys and cards by profit", byBatch.Rows)
+	}
+
+	if _, err := GetProfitReport(db, "week", from, to); !errors.Is(err, ErrInvalidProfitGrouping) {
+		t.Errorf("error = %v, want %v", err, ErrInvalidProfitGrouping)
+	}
+}
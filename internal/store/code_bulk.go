@@ -0,0 +1,387 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Code statuses. Only available codes are sold; sold codes keep the status
+// they had when they were claimed.
+const (
+	CodeStatusAvailable   = "available"
+	CodeStatusQuarantined = "quarantined" // Held back from sale until released
+	CodeStatusVoid        = "void"        // Permanently withdrawn from sale
+)
+
+// Bulk code operations recorded in code_operations
+const (
+	CodeActionExport     = "export"
+	CodeActionMove       = "move"
+	CodeActionVoid       = "void"
+	CodeActionQuarantine = "quarantine"
+	CodeActionRelease    = "release"
+	CodeActionDelete     = "delete"
+)
+
+var (
+	ErrEmptyCodeSelection = errors.New("no codes match the selection")
+	ErrInvalidCodeAction  = errors.New("invalid code action")
+	ErrInvalidMoveTarget  = errors.New("invalid target product")
+)
+
+// codeStatusTransitions lists which statuses each status action applies to
+var codeStatusTransitions = map[string]struct {
+	from []string
+	to   string
+}{
+	CodeActionVoid:       {from: []string{CodeStatusAvailable, CodeStatusQuarantined}, to: CodeStatusVoid},
+	CodeActionQuarantine: {from: []string{CodeStatusAvailable}, to: CodeStatusQuarantined},
+	CodeActionRelease:    {from: []string{CodeStatusQuarantined}, to: CodeStatusAvailable},
+}
+
+// CodeFilter selects codes of one product for a bulk operation
+type CodeFilter struct {
+	ProductID     uint       `json:"product_id"`
+	IDs           []uint     `json:"ids,omitempty"`
+	Sold          *bool      `json:"sold,omitempty"`
+	Status        string     `json:"status,omitempty"`
+	CreatedFrom   *time.Time `json:"created_from,omitempty"`
+	CreatedTo     *time.Time `json:"created_to,omitempty"`
+	ExpiresBefore *time.Time `json:"expires_before,omitempty"`
+}
+
+func (f CodeFilter) apply(query *gorm.DB) *gorm.DB {
+	query = query.Where("product_id = ?", f.ProductID)
+	if len(f.IDs) > 0 {
+		query = query.Where("id IN ?", f.IDs)
+	}
+	if f.Sold != nil {
+		query = query.Where("is_sold = ?", *f.Sold)
+	}
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		query = query.Where("created_at < ?", *f.CreatedTo)
+	}
+	if f.ExpiresBefore != nil {
+		query = query.Where("expires_at IS NOT NULL AND expires_at <= ?", *f.ExpiresBefore)
+	}
+	return query
+}
+
+// CodeBulkResult is the outcome of a bulk code operation
+type CodeBulkResult struct {
+	OperationID uint  `json:"operation_id"`
+	Selected    int   `json:"selected"`
+	Affected    int   `json:"affected"`
+	Skipped     int   `json:"skipped"`    // Sold or reserved codes, codes already in the target status or duplicates in the target product
+	Reserved    int   `json:"reserved"`   // Skipped codes held for pending orders
+	CostCents   int64 `json:"cost_cents"` // Purchase cost of the affected codes from their batches
+}
+
+// countReservedCodes counts the selected codes held for a pending order.
+// Bulk operations leave them alone so the order can still be delivered.
+func countReservedCodes(tx *gorm.DB, filter CodeFilter, now time.Time) (int, error) {
+	var reserved int64
+	err := filter.apply(tx.Model(&Code{})).
+		Where("is_sold = ? AND reserved_order_id IS NOT NULL AND reserved_until >= ?", false, now).
+		Count(&reserved).Error
+	return int(reserved), err
+}
+
+// unreservedCodes limits a query to codes no pending order holds
+func unreservedCodes(query *gorm.DB, now time.Time) *gorm.DB {
+	return query.Where("reserved_order_id IS NULL OR reserved_until < ?", now)
+}
+
+// recordCodeOperation stores the audit record of a bulk operation
+func recordCodeOperation(tx *gorm.DB, action string, filter CodeFilter, targetProductID *uint, result *CodeBulkResult, admin, note string) error {
+	encoded, err := json.Marshal(filter)
+	if err != nil {
+		return err
+	}
+	op := CodeOperation{
+		Action:          action,
+		ProductID:       filter.ProductID,
+		TargetProductID: targetProductID,
+		Filter:          string(encoded),
+		Affected:        result.Affected,
+		Skipped:         result.Skipped,
+		Note:            note,
+		Admin:           admin,
+	}
+	if err := tx.Create(&op).Error; err != nil {
+		return err
+	}
+	result.OperationID = op.ID
+	return nil
+}
+
+// ApplyCodeAction voids, quarantines, releases or deletes the selected
+// codes. Sold codes and codes reserved for pending orders are never changed
+// and are counted as skipped.
+func ApplyCodeAction(db *gorm.DB, filter CodeFilter, action, admin, note string) (*CodeBulkResult, error) {
+	transition, isStatusAction := codeStatusTransitions[action]
+	if !isStatusAction && action != CodeActionDelete {
+		return nil, ErrInvalidCodeAction
+	}
+
+	result := &CodeBulkResult{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var selected int64
+		if err := filter.apply(tx.Model(&Code{})).Count(&selected).Error; err != nil {
+			return err
+		}
+		if selected == 0 {
+			return ErrEmptyCodeSelection
+		}
+
+		now := time.Now()
+		reserved, err := countReservedCodes(tx, filter, now)
+		if err != nil {
+			return err
+		}
+
+		// Lock the codes the action applies to, so the cost is taken from
+		// exactly the codes that are changed
+		eligible := unreservedCodes(filter.apply(tx.Model(&Code{})), now).Where("is_sold = ?", false)
+		if isStatusAction {
+			eligible = eligible.Where("status IN ?", transition.from)
+		}
+		var ids []uint
+		if err := eligible.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id").Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+
+		for start := 0; start < len(ids); start += 500 {
+			end := start + 500
+			if end > len(ids) {
+				end = len(ids)
+			}
+			chunk := ids[start:end]
+			cost, err := codeCost(tx, chunk)
+			if err != nil {
+				return err
+			}
+
+			var update *gorm.DB
+			if isStatusAction {
+				update = tx.Model(&Code{}).Where("id IN ?", chunk).Update("status", transition.to)
+			} else {
+				update = tx.Where("id IN ?", chunk).Delete(&Code{})
+			}
+			if update.Error != nil {
+				return update.Error
+			}
+			result.Affected += int(update.RowsAffected)
+			result.CostCents += cost
+		}
+
+		result.Selected = int(selected)
+		result.Reserved = reserved
+		result.Skipped = result.Selected - result.Affected
+		return recordCodeOperation(tx, action, filter, nil, result, admin, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	CheckStockLevel(db, filter.ProductID)
+	return result, nil
+}
+
+// MoveCodes moves the selected unsold codes to another product. Codes that
+// already exist in the target product or are reserved for a pending order
+// are left where they are. Structured
+// codes can only move to a product that defines code fields.
+func MoveCodes(db *gorm.DB, filter CodeFilter, targetProductID uint, admin, note string) (*CodeBulkResult, error) {
+	if targetProductID == 0 || targetProductID == filter.ProductID {
+		return nil, ErrInvalidMoveTarget
+	}
+	var target Product
+	if err := db.First(&target, targetProductID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidMoveTarget
+		}
+		return nil, err
+	}
+
+	result := &CodeBulkResult{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var selected int64
+		if err := filter.apply(tx.Model(&Code{})).Count(&selected).Error; err != nil {
+			return err
+		}
+		if selected == 0 {
+			return ErrEmptyCodeSelection
+		}
+
+		now := time.Now()
+		reserved, err := countReservedCodes(tx, filter, now)
+		if err != nil {
+			return err
+		}
+
+		var codes []Code
+		if err := unreservedCodes(filter.apply(tx.Select("id", "code_hash", "structured")), now).
+			Where("is_sold = ?", false).Find(&codes).Error; err != nil {
+			return err
+		}
+
+		var ids []uint
+		for start := 0; start < len(codes); start += 500 {
+			end := start + 500
+			if end > len(codes) {
+				end = len(codes)
+			}
+			chunk := codes[start:end]
+
+			var hashes []string
+			for _, code := range chunk {
+				if code.Structured && len(target.Fields()) == 0 {
+					return fmt.Errorf("%w: %s has no code fields for structured codes", ErrInvalidMoveTarget, target.Name)
+				}
+				if code.CodeHash != nil {
+					hashes = append(hashes, *code.CodeHash)
+				}
+			}
+
+			// The per-product hash index would reject codes the target already has
+			existing := make(map[string]bool)
+			if len(hashes) > 0 {
+				var found []string
+				if err := tx.Model(&Code{}).Where("product_id = ? AND code_hash IN ?", targetProductID, hashes).
+					Pluck("code_hash", &found).Error; err != nil {
+					return err
+				}
+				for _, hash := range found {
+					existing[hash] = true
+				}
+			}
+
+			for _, code := range chunk {
+				if code.CodeHash == nil || !existing[*code.CodeHash] {
+					ids = append(ids, code.ID)
+				}
+			}
+		}
+
+		for start := 0; start < len(ids); start += 500 {
+			end := start + 500
+			if end > len(ids) {
+				end = len(ids)
+			}
+			if err := tx.Model(&Code{}).Where("id IN ?", ids[start:end]).
+				Update("product_id", targetProductID).Error; err != nil {
+				return err
+			}
+		}
+
+		result.Selected = int(selected)
+		result.Affected = len(ids)
+		result.Reserved = reserved
+		result.Skipped = result.Selected - result.Affected
+		return recordCodeOperation(tx, CodeActionMove, filter, &targetProductID, result, admin, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	CheckStockLevel(db, filter.ProductID)
+	CheckStockLevel(db, targetProductID)
+	return result, nil
+}
+
+// ExportCodes returns the selected codes, still encrypted, and records the export
+func ExportCodes(db *gorm.DB, filter CodeFilter, admin string) ([]Code, error) {
+	var codes []Code
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := filter.apply(tx).Order("id").Find(&codes).Error; err != nil {
+			return err
+		}
+		result := &CodeBulkResult{Selected: len(codes), Affected: len(codes)}
+		return recordCodeOperation(tx, CodeActionExport, filter, nil, result, admin, "")
+	})
+	return codes, err
+}
+
+// maxCodeSearchScan caps how many codes one admin search decrypts. Codes are
+// encrypted at rest, so a search decrypts every code it looks at; the sold
+// and status filters narrow the scan.
+const maxCodeSearchScan = 20000
+
+// CodePage is one page of a product's codes, rendered for display
+type CodePage struct {
+	Codes     []Code
+	Total     int64 // Codes matching the filter and search
+	Truncated bool  // The search stopped after maxCodeSearchScan codes
+}
+
+// ListCodes returns a page of the codes selected by filter. The total is
+// counted with the same filter as the page.
+func ListCodes(db *gorm.DB, product *Product, filter CodeFilter, offset, limit int) (*CodePage, error) {
+	page := &CodePage{}
+	if err := filter.apply(db.Model(&Code{})).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := filter.apply(db).Order("id").Offset(offset).Limit(limit).Find(&page.Codes).Error; err != nil {
+		return nil, err
+	}
+	for i := range page.Codes {
+		if rendered, err := product.RenderCode(&page.Codes[i]); err == nil {
+			page.Codes[i].Code = rendered
+		}
+	}
+	return page, nil
+}
+
+// SearchCodes returns a page of the codes selected by filter that match an
+// admin search, see Product.MatchCode. Codes are decrypted in chunks and
+// the scan stops after maxCodeSearchScan codes.
+func SearchCodes(db *gorm.DB, product *Product, filter CodeFilter, field, query string, offset, limit int) (*CodePage, error) {
+	page := &CodePage{}
+	var lastID uint
+	for scanned := 0; ; {
+		var chunk []Code
+		if err := filter.apply(db).Where("id > ?", lastID).Order("id").Limit(500).Find(&chunk).Error; err != nil {
+			return nil, err
+		}
+		for i := range chunk {
+			if scanned == maxCodeSearchScan {
+				page.Truncated = true
+				return page, nil
+			}
+			scanned++
+			lastID = chunk[i].ID
+
+			rendered, err := product.RenderCode(&chunk[i])
+			if err != nil || !product.MatchCode(&chunk[i], rendered, field, query) {
+				continue
+			}
+			if page.Total >= int64(offset) && len(page.Codes) < limit {
+				chunk[i].Code = rendered
+				page.Codes = append(page.Codes, chunk[i])
+			}
+			page.Total++
+		}
+		if len(chunk) < 500 {
+			return page, nil
+		}
+	}
+}
+
+// ListCodeOperations returns the latest operations on a product's codes,
+// including codes moved into it
+func ListCodeOperations(db *gorm.DB, productID uint, limit int) ([]CodeOperation, error) {
+	var ops []CodeOperation
+	err := db.Where("product_id = ? OR target_product_id = ?", productID, productID).
+		Order("id DESC").Limit(limit).Find(&ops).Error
+	return ops, err
+}
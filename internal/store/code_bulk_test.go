@@ -0,0 +1,147 @@
+package store
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newTestCodes creates a product with n available codes
+func newTestCodes(t *testing.T, db *gorm.DB, name string, n int) (*Product, []Code) {
+	t.Helper()
+	product := &Product{Name: name, PriceCents: 100, IsActive: true}
+	if err := db.Create(product).Error; err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	if n == 0 {
+		return product, nil
+	}
+	codes := make([]Code, n)
+	for i := range codes {
+		codes[i] = Code{ProductID: product.ID, Code: name + "-" + strconv.Itoa(i), Status: CodeStatusAvailable}
+	}
+	if err := db.Create(&codes).Error; err != nil {
+		t.Fatalf("create codes: %v", err)
+	}
+	return product, codes
+}
+
+// reserveTestCode holds a code for an order until until
+func reserveTestCode(t *testing.T, db *gorm.DB, codeID, orderID uint, until time.Time) {
+	t.Helper()
+	if err := db.Model(&Code{}).Where("id = ?", codeID).
+		Updates(map[string]interface{}{"reserved_order_id": orderID, "reserved_until": until}).Error; err != nil {
+		t.Fatalf("reserve code: %v", err)
+	}
+}
+
+func TestApplyCodeActionSkipsReservedCodes(t *testing.T) {
+	db := newTestDB(t)
+	product, codes := newTestCodes(t, db, "bulk", 3)
+	reserveTestCode(t, db, codes[0].ID, 1, time.Now().Add(time.Hour))
+	reserveTestCode(t, db, codes[1].ID, 2, time.Now().Add(-time.Hour)) // Reservation lapsed
+
+	result, err := ApplyCodeAction(db, CodeFilter{ProductID: product.ID}, CodeActionVoid, "admin", "")
+	if err != nil {
+		t.Fatalf("void codes: %v", err)
+	}
+	if result.Selected != 3 || result.Affected != 2 || result.Skipped != 1 || result.Reserved != 1 {
+		t.Fatalf("result = %+v, want 3 selected, 2 affected, 1 skipped, 1 reserved", result)
+	}
+
+	var reserved Code
+	if err := db.First(&reserved, codes[0].ID).Error; err != nil {
+		t.Fatalf("load code: %v", err)
+	}
+	if reserved.Status != CodeStatusAvailable {
+		t.Fatalf("reserved code status = %q, want %q", reserved.Status, CodeStatusAvailable)
+	}
+
+	result, err = ApplyCodeAction(db, CodeFilter{ProductID: product.ID}, CodeActionDelete, "admin", "")
+	if err != nil {
+		t.Fatalf("delete codes: %v", err)
+	}
+	if result.Affected != 2 || result.Reserved != 1 {
+		t.Fatalf("delete result = %+v, want 2 affected, 1 reserved", result)
+	}
+	if err := db.First(&reserved, codes[0].ID).Error; err != nil {
+		t.Fatalf("reserved code was deleted: %v", err)
+	}
+}
+
+func TestMoveCodesSkipsReservedCodes(t *testing.T) {
+	db := newTestDB(t)
+	product, codes := newTestCodes(t, db, "source", 2)
+	target, _ := newTestCodes(t, db, "target", 0)
+	reserveTestCode(t, db, codes[0].ID, 1, time.Now().Add(time.Hour))
+
+	result, err := MoveCodes(db, CodeFilter{ProductID: product.ID}, target.ID, "admin", "")
+	if err != nil {
+		t.Fatalf("move codes: %v", err)
+	}
+	if result.Affected != 1 || result.Skipped != 1 || result.Reserved != 1 {
+		t.Fatalf("result = %+v, want 1 affected, 1 skipped, 1 reserved", result)
+	}
+
+	var reserved Code
+	if err := db.First(&reserved, codes[0].ID).Error; err != nil {
+		t.Fatalf("load code: %v", err)
+	}
+	if reserved.ProductID != product.ID {
+		t.Fatalf("reserved code moved to product %d", reserved.ProductID)
+	}
+}
+
+func TestListCodesCountsWithFilter(t *testing.T) {
+	db := newTestDB(t)
+	product, codes := newTestCodes(t, db, "list", 5)
+	newTestCodes(t, db, "other", 3)
+	if err := db.Model(&Code{}).Where("id IN ?", []uint{codes[0].ID, codes[1].ID}).Update("is_sold", true).Error; err != nil {
+		t.Fatalf("sell codes: %v", err)
+	}
+
+	unsold := false
+	page, err := ListCodes(db, product, CodeFilter{ProductID: product.ID, Sold: &unsold}, 0, 2)
+	if err != nil {
+		t.Fatalf("list codes: %v", err)
+	}
+	if page.Total != 3 || len(page.Codes) != 2 || page.Codes[0].ID != codes[2].ID {
+		t.Fatalf("page = %d of %d starting at %d, want 2 of 3 unsold", len(page.Codes), page.Total, page.Codes[0].ID)
+	}
+
+	page, err = ListCodes(db, product, CodeFilter{ProductID: product.ID, Status: CodeStatusVoid}, 0, 50)
+	if err != nil {
+		t.Fatalf("list codes: %v", err)
+	}
+	if page.Total != 0 || len(page.Codes) != 0 {
+		t.Fatalf("page = %+v, want no void codes", page)
+	}
+}
+
+func TestSearchCodesPages(t *testing.T) {
+	db := newTestDB(t)
+	product, _ := newTestCodes(t, db, "search", 12) // search-0 .. search-11
+	filter := CodeFilter{ProductID: product.ID}
+
+	// search-1 and search-10 .. search-11
+	page, err := SearchCodes(db, product, filter, "", "SEARCH-1", 1, 2)
+	if err != nil {
+		t.Fatalf("search codes: %v", err)
+	}
+	if page.Total != 3 || page.Truncated {
+		t.Fatalf("page = %+v, want 3 matches", page)
+	}
+	if len(page.Codes) != 2 || page.Codes[0].Code != "search-10" || page.Codes[1].Code != "search-11" {
+		t.Fatalf("codes = %+v, want the second and third match", page.Codes)
+	}
+
+	page, err = SearchCodes(db, product, filter, "", "search-1", 5, 2)
+	if err != nil {
+		t.Fatalf("search codes: %v", err)
+	}
+	if page.Total != 3 || len(page.Codes) != 0 {
+		t.Fatalf("page = %+v, want an empty page past the matches", page)
+	}
+}
@@ -0,0 +1,290 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	logger "shop-bot/internal/log"
+)
+
+// encryptedCodePrefix marks codes stored as ciphertext. Rows without it are
+// plaintext from before encryption was enabled.
+const encryptedCodePrefix = "enc:v1:"
+
+var ErrCodeKeyMissing = errors.New("code is encrypted but no data encryption key is configured")
+
+// CodeCipher encrypts code contents at rest, implemented by security.DataSecurity.
+// HashData is a keyed hash, so code hashes do not reveal short codes either.
+type CodeCipher interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+	HashData(data string) string
+}
+
+// codeCipher is set once at startup when DATA_ENCRYPTION_KEY is configured
+var codeCipher CodeCipher
+
+// SetCodeCipher enables encryption of stored codes
+func SetCodeCipher(c CodeCipher) {
+	codeCipher = c
+}
+
+// CodeEncryptionEnabled reports whether new codes are stored encrypted
+func CodeEncryptionEnabled() bool {
+	return codeCipher != nil
+}
+
+// IsEncryptedCode reports whether a stored code value is ciphertext
+func IsEncryptedCode(stored string) bool {
+	return strings.HasPrefix(stored, encryptedCodePrefix)
+}
+
+// EncryptCode returns the value to store for a code. Without a configured
+// key the code is stored as is.
+func EncryptCode(plain string) (string, error) {
+	if codeCipher == nil {
+		return plain, nil
+	}
+	return encryptCodeWith(codeCipher, plain)
+}
+
+// DecryptCode returns the plaintext of a stored code value
+func DecryptCode(stored string) (string, error) {
+	if !IsEncryptedCode(stored) {
+		return stored, nil
+	}
+	if codeCipher == nil {
+		return "", ErrCodeKeyMissing
+	}
+	return decryptCodeWith(codeCipher, stored)
+}
+
+// EncryptCodes encrypts the contents of codes about to be inserted
+func EncryptCodes(codes []Code) error {
+	for i := range codes {
+		stored, err := EncryptCode(codes[i].Code)
+		if err != nil {
+			return err
+		}
+		codes[i].Code = stored
+	}
+	return nil
+}
+
+// DecryptCodes decrypts loaded codes in place for display. Codes that
+// cannot be decrypted are left as stored.
+func DecryptCodes(codes []Code) {
+	for i := range codes {
+		if plain, err := DecryptCode(codes[i].Code); err == nil {
+			codes[i].Code = plain
+		}
+	}
+}
+
+func encryptCodeWith(c CodeCipher, plain string) (string, error) {
+	ciphertext, err := c.Encrypt(plain)
+	if err != nil {
+		return "", err
+	}
+	return encryptedCodePrefix + ciphertext, nil
+}
+
+func decryptCodeWith(c CodeCipher, stored string) (string, error) {
+	return c.Decrypt(strings.TrimPrefix(stored, encryptedCodePrefix))
+}
+
+// CodeRotationResult summarises a key rotation run
+type CodeRotationResult struct {
+	Total     int // Rows examined
+	Rotated   int // Rows re-encrypted from the old key
+	Encrypted int // Plaintext rows encrypted for the first time
+	Skipped   int // Rows already encrypted with the new key
+	Unhashed  int // Rows left without a hash because they duplicate an earlier code
+	Failed    int // Rows that could be decrypted with neither key
+	FailedIDs []uint
+}
+
+// RotateCodeKey re-encrypts every stored code with newCipher. Rows encrypted
+// with oldCipher are decrypted first, plaintext rows are encrypted and rows
+// already readable with newCipher are left alone, so an interrupted run can
+// simply be repeated. oldCipher may be nil when only plaintext rows exist.
+// The hashes of all rows, including rows without one, are recomputed with
+// newCipher. With dryRun set nothing is written.
+func RotateCodeKey(db *gorm.DB, oldCipher, newCipher CodeCipher, batchSize int, dryRun bool) (*CodeRotationResult, error) {
+	if newCipher == nil {
+		return nil, errors.New("new key is required")
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	result := &CodeRotationResult{}
+	var lastID uint
+	for {
+		var codes []Code
+		if err := db.Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&codes).Error; err != nil {
+			return result, err
+		}
+		if len(codes) == 0 {
+			break
+		}
+		lastID = codes[len(codes)-1].ID
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, code := range codes {
+				result.Total++
+
+				plain := code.Code
+				reencrypt := true
+				if IsEncryptedCode(code.Code) {
+					if decrypted, err := decryptCodeWith(newCipher, code.Code); err == nil {
+						plain = decrypted
+						reencrypt = false
+						result.Skipped++
+					} else {
+						if oldCipher == nil {
+							result.Failed++
+							result.FailedIDs = append(result.FailedIDs, code.ID)
+							continue
+						}
+						decrypted, err := decryptCodeWith(oldCipher, code.Code)
+						if err != nil {
+							result.Failed++
+							result.FailedIDs = append(result.FailedIDs, code.ID)
+							continue
+						}
+						plain = decrypted
+						result.Rotated++
+					}
+				} else {
+					result.Encrypted++
+				}
+
+				if dryRun {
+					continue
+				}
+				if reencrypt {
+					stored, err := encryptCodeWith(newCipher, plain)
+					if err != nil {
+						return fmt.Errorf("failed to encrypt code %d: %w", code.ID, err)
+					}
+					if err := tx.Model(&Code{}).Where("id = ?", code.ID).Update("code", stored).Error; err != nil {
+						return fmt.Errorf("failed to update code %d: %w", code.ID, err)
+					}
+				}
+				// Hashes are keyed, recompute them with the new key
+				unhashed, err := setCodeHash(tx, code, hashCodeWith(newCipher, plain))
+				if err != nil {
+					return fmt.Errorf("failed to hash code %d: %w", code.ID, err)
+				}
+				if unhashed {
+					result.Unhashed++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	if dryRun || result.Failed > 0 {
+		// Rows left on the old key are rehashed once they can be read
+		return result, nil
+	}
+	return result, SetSetting(db, SettingCodeHashKeyCheck, codeHashKeyCheck(newCipher), codeHashKeyCheckDescription, "string")
+}
+
+// codeHashKeyCheckInput is hashed with the hashing key to tell whether the
+// key changed since the stored hashes were computed, without storing the key
+const codeHashKeyCheckInput = "code hash key check"
+
+const codeHashKeyCheckDescription = "卡密查重哈希密钥校验值（自动维护，请勿修改）"
+
+// codeHashKeyCheck returns the value stored to recognise the hashing key
+func codeHashKeyCheck(c CodeCipher) string {
+	return hashCodeWith(c, codeHashKeyCheckInput)
+}
+
+// setCodeHash stores the hash of a code unless another code of the product
+// already has it, which only happens for duplicates stored before duplicate
+// detection existed. Those keep an empty hash and true is returned.
+func setCodeHash(tx *gorm.DB, code Code, hash string) (bool, error) {
+	if code.CodeHash != nil && *code.CodeHash == hash {
+		return false, nil
+	}
+	var count int64
+	if err := tx.Model(&Code{}).Where("product_id = ? AND code_hash = ? AND id <> ?", code.ProductID, hash, code.ID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		if code.CodeHash == nil {
+			return true, nil
+		}
+		return true, tx.Model(&Code{}).Where("id = ?", code.ID).Update("code_hash", nil).Error
+	}
+	return false, tx.Model(&Code{}).Where("id = ?", code.ID).Update("code_hash", hash).Error
+}
+
+// RehashCodes recomputes the duplicate detection hashes of all codes,
+// including codes without one, when the hashing key changed since they were
+// computed. That happens when DATA_ENCRYPTION_KEY is set on a shop that
+// already has codes: without it the old unkeyed hashes would never match
+// new uploads. It also hashes codes stored before duplicate detection
+// existed, since no key was recorded for them. It does nothing while the
+// key is unchanged, so legacy duplicates left without a hash are only
+// scanned once.
+func RehashCodes(db *gorm.DB) error {
+	check := codeHashKeyCheck(codeCipher)
+	if stored, err := GetSetting(db, SettingCodeHashKeyCheck); err != nil {
+		return err
+	} else if stored == check {
+		return nil
+	}
+
+	var lastID uint
+	rehashed := 0
+	var duplicateIDs, failedIDs []uint
+	for {
+		var codes []Code
+		if err := db.Where("id > ?", lastID).Order("id").Limit(500).Find(&codes).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			break
+		}
+		lastID = codes[len(codes)-1].ID
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, code := range codes {
+				plain, err := DecryptCode(code.Code)
+				if err != nil {
+					failedIDs = append(failedIDs, code.ID)
+					continue
+				}
+				duplicate, err := setCodeHash(tx, code, HashCode(plain))
+				if err != nil {
+					return err
+				}
+				if duplicate {
+					duplicateIDs = append(duplicateIDs, code.ID)
+				} else {
+					rehashed++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Recomputed code hashes for the current key", "codes", rehashed, "duplicates", len(duplicateIDs), "duplicate_ids", duplicateIDs)
+	if len(failedIDs) > 0 {
+		// Keep the old check so the next start tries again
+		return fmt.Errorf("%d codes could not be decrypted to hash them: %v", len(failedIDs), failedIDs)
+	}
+	return SetSetting(db, SettingCodeHashKeyCheck, check, codeHashKeyCheckDescription, "string")
+}
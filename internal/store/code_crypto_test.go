@@ -0,0 +1,136 @@
+package store
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+
+	"shop-bot/internal/security"
+)
+
+// newTestCipher returns a data encryption cipher for key
+func newTestCipher(t *testing.T, key string) CodeCipher {
+	t.Helper()
+	ds, err := security.NewDataSecurity(key)
+	if err != nil {
+		t.Fatalf("new cipher: %v", err)
+	}
+	return ds
+}
+
+// useCodeCipher configures the code cipher for the rest of the test
+func useCodeCipher(t *testing.T, c CodeCipher) {
+	t.Helper()
+	previous := codeCipher
+	SetCodeCipher(c)
+	t.Cleanup(func() { SetCodeCipher(previous) })
+}
+
+// storedCode loads a code as stored
+func storedCode(t *testing.T, db *gorm.DB, id uint) Code {
+	t.Helper()
+	var code Code
+	if err := db.First(&code, id).Error; err != nil {
+		t.Fatalf("load code: %v", err)
+	}
+	return code
+}
+
+func TestRotateCodeKeyRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	oldCipher, newCipher := newTestCipher(t, "old key"), newTestCipher(t, "new key")
+	useCodeCipher(t, oldCipher)
+
+	product, _ := newTestCodes(t, db, "rotate", 0)
+	report, err := ImportCodes(db, product.ID, []string{"AAAA-1111", "BBBB-2222"}, CodeImportOptions{})
+	if err != nil || report.Inserted != 2 {
+		t.Fatalf("import codes: %v, %+v", err, report)
+	}
+	// A legacy plaintext row without a hash and a legacy duplicate of it
+	legacy := []Code{
+		{ProductID: product.ID, Code: "CCCC-3333", Status: CodeStatusAvailable},
+		{ProductID: product.ID, Code: "CCCC-3333", Status: CodeStatusAvailable},
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatalf("create legacy codes: %v", err)
+	}
+
+	result, err := RotateCodeKey(db, oldCipher, newCipher, 2, false)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if result.Total != 4 || result.Rotated != 2 || result.Encrypted != 2 || result.Failed != 0 || result.Unhashed != 1 {
+		t.Fatalf("result = %+v", result)
+	}
+
+	useCodeCipher(t, newCipher)
+	var codes []Code
+	if err := db.Order("id").Find(&codes).Error; err != nil {
+		t.Fatalf("load codes: %v", err)
+	}
+	want := []string{"AAAA-1111", "BBBB-2222", "CCCC-3333", "CCCC-3333"}
+	for i, code := range codes {
+		plain, err := DecryptCode(code.Code)
+		if err != nil || plain != want[i] {
+			t.Fatalf("code %d = %q, %v, want %q", code.ID, plain, err, want[i])
+		}
+		if i == 3 {
+			if code.CodeHash != nil {
+				t.Fatalf("legacy duplicate %d got a hash", code.ID)
+			}
+			continue
+		}
+		if code.CodeHash == nil || *code.CodeHash != HashCode(want[i]) {
+			t.Fatalf("code %d hash not recomputed with the new key", code.ID)
+		}
+	}
+
+	// Uploads under the new key find the rotated codes
+	report, err = ImportCodes(db, product.ID, []string{"AAAA-1111", "CCCC-3333"}, CodeImportOptions{})
+	if err != nil {
+		t.Fatalf("import codes: %v", err)
+	}
+	if report.Inserted != 0 || report.DuplicatesUnsold != 2 {
+		t.Fatalf("report = %+v, want both codes reported as duplicates", report)
+	}
+
+	// A repeated run changes nothing
+	result, err = RotateCodeKey(db, oldCipher, newCipher, 2, false)
+	if err != nil {
+		t.Fatalf("rotate again: %v", err)
+	}
+	if result.Skipped != 4 || result.Rotated != 0 || result.Encrypted != 0 {
+		t.Fatalf("second run = %+v, want every row skipped", result)
+	}
+	if err := RehashCodes(db); err != nil {
+		t.Fatalf("rehash: %v", err)
+	}
+	if code := storedCode(t, db, codes[0].ID); code.Code != codes[0].Code {
+		t.Fatalf("rehash rewrote an up to date code")
+	}
+}
+
+func TestRehashCodesAfterKeyEnabled(t *testing.T) {
+	db := newTestDB(t)
+	product, _ := newTestCodes(t, db, "rehash", 0)
+	if _, err := ImportCodes(db, product.ID, []string{"DDDD-4444"}, CodeImportOptions{}); err != nil {
+		t.Fatalf("import codes: %v", err)
+	}
+	if err := RehashCodes(db); err != nil {
+		t.Fatalf("rehash without key: %v", err)
+	}
+
+	// The key is configured without rotating the plaintext codes
+	useCodeCipher(t, newTestCipher(t, "key"))
+	if err := RehashCodes(db); err != nil {
+		t.Fatalf("rehash: %v", err)
+	}
+
+	report, err := ImportCodes(db, product.ID, []string{"DDDD-4444"}, CodeImportOptions{})
+	if err != nil {
+		t.Fatalf("import codes: %v", err)
+	}
+	if report.Inserted != 0 || report.DuplicatesUnsold != 1 {
+		t.Fatalf("report = %+v, want the code reported as a duplicate", report)
+	}
+}
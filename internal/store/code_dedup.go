@@ -0,0 +1,293 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Duplicate code detection scopes. The unique index on product_id and
+// code_hash only enforces the product scope; the global scope is checked by
+// ImportCodes, so codes stored before it was chosen, moved between products
+// or left unhashed as legacy duplicates may still repeat across products.
+const (
+	CodeDuplicateScopeProduct = "product" // A code may exist once per product
+	CodeDuplicateScopeGlobal  = "global"  // A code may exist once across all products, checked on import
+)
+
+// Reasons a code was reported as a duplicate
+const (
+	DuplicateInBatch = "batch"  // Repeated within the same upload
+	DuplicateUnsold  = "unsold" // Already in stock
+	DuplicateSold    = "sold"   // Already sold
+)
+
+// maxReportedDuplicates caps the duplicate details returned in an upload report
+const maxReportedDuplicates = 200
+
+// NormalizeCode canonicalises a code for duplicate detection: line endings
+// are unified, every line is trimmed, whitespace runs are collapsed and
+// empty lines are dropped. Letter case is kept since codes may be case sensitive.
+func NormalizeCode(code string) string {
+	code = strings.ReplaceAll(code, "\r\n", "\n")
+	var lines []string
+	for _, line := range strings.Split(code, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HashCode returns the duplicate detection hash of a code. It is keyed with
+// the data encryption key when one is configured.
+func HashCode(code string) string {
+	return hashCodeWith(codeCipher, code)
+}
+
+func hashCodeWith(c CodeCipher, code string) string {
+	normalized := NormalizeCode(code)
+	if c != nil {
+		return c.HashData(normalized)
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetCodeDuplicateScope returns whether codes must be unique per product or globally
+func GetCodeDuplicateScope(db *gorm.DB) string {
+	value, err := GetSetting(db, SettingCodeDuplicateScope)
+	if err != nil || value != CodeDuplicateScopeGlobal {
+		return CodeDuplicateScopeProduct
+	}
+	return value
+}
+
+// CodeDuplicate describes one uploaded code that was not inserted
+type CodeDuplicate struct {
+	Index      int    `json:"index"`   // 1-based position in the upload
+	Preview    string `json:"preview"` // Masked start of the code
+	Reason     string `json:"reason"`
+	FirstIndex int    `json:"first_index,omitempty"` // Earlier position of a code repeated in the upload
+	ExistingID uint   `json:"existing_id,omitempty"` // Matching code already in the database
+	ProductID  uint   `json:"product_id,omitempty"`  // Product of the matching code
+}
+
+// CodeUploadReport is the result of a code upload
+type CodeUploadReport struct {
+	Total             int             `json:"total"`
+	Inserted          int             `json:"inserted"`
+	DuplicatesInBatch int             `json:"duplicates_in_batch"`
+	DuplicatesUnsold  int             `json:"duplicates_unsold"`
+	DuplicatesSold    int             `json:"duplicates_sold"`
+	Invalid           int             `json:"invalid"`  // Structured rows that failed validation
+	Rejected          bool            `json:"rejected"` // Nothing was inserted because of duplicates
+	Scope             string          `json:"scope"`
+	Duplicates        []CodeDuplicate `json:"duplicates"`
+	Errors            []CodeRowError  `json:"errors"`
+	Truncated         bool            `json:"truncated"`          // More duplicates or errors than listed
+	BatchID           uint            `json:"batch_id,omitempty"` // Batch holding the inserted codes
+}
+
+func newCodeUploadReport(db *gorm.DB) *CodeUploadReport {
+	return &CodeUploadReport{
+		Scope:      GetCodeDuplicateScope(db),
+		Duplicates: []CodeDuplicate{},
+		Errors:     []CodeRowError{},
+	}
+}
+
+// DuplicateCount returns how many uploaded codes were duplicates
+func (r *CodeUploadReport) DuplicateCount() int {
+	return r.DuplicatesInBatch + r.DuplicatesUnsold + r.DuplicatesSold
+}
+
+func (r *CodeUploadReport) addDuplicate(d CodeDuplicate) {
+	switch d.Reason {
+	case DuplicateInBatch:
+		r.DuplicatesInBatch++
+	case DuplicateSold:
+		r.DuplicatesSold++
+	default:
+		r.DuplicatesUnsold++
+	}
+	if len(r.Duplicates) < maxReportedDuplicates {
+		r.Duplicates = append(r.Duplicates, d)
+	} else {
+		r.Truncated = true
+	}
+}
+
+func (r *CodeUploadReport) addRowError(e CodeRowError) {
+	r.Total++
+	r.Invalid++
+	if len(r.Errors) < maxReportedDuplicates {
+		r.Errors = append(r.Errors, e)
+	} else {
+		r.Truncated = true
+	}
+}
+
+// codeImportEntry is one code of an upload
+type codeImportEntry struct {
+	index   int    // 1-based position in the upload
+	code    string // Plaintext to store
+	preview string // Text shown masked in the report
+}
+
+// CodeImportOptions controls how uploaded codes are added to stock
+type CodeImportOptions struct {
+	RejectDuplicates bool       // Insert nothing if any duplicate is found
+	ExpiresAt        *time.Time // Expiry applied to every imported code
+	Batch            CodeBatch  // Source, supplier, cost and note of the batch the codes are recorded in
+}
+
+// ImportCodes adds uploaded codes to a product's stock. Codes that repeat
+// within the upload or match existing stock, sold or unsold, are skipped
+// and reported. With RejectDuplicates set nothing is inserted if any
+// duplicate is found. Inserted codes are recorded in a new batch and
+// encrypted when a key is configured.
+func ImportCodes(db *gorm.DB, productID uint, rawCodes []string, opts CodeImportOptions) (*CodeUploadReport, error) {
+	entries := make([]codeImportEntry, 0, len(rawCodes))
+	for i, raw := range rawCodes {
+		if code := strings.TrimSpace(raw); code != "" {
+			entries = append(entries, codeImportEntry{index: i + 1, code: code, preview: code})
+		}
+	}
+	return importCodes(db, productID, entries, false, opts, newCodeUploadReport(db))
+}
+
+func importCodes(db *gorm.DB, productID uint, entries []codeImportEntry, structured bool, opts CodeImportOptions, report *CodeUploadReport) (*CodeUploadReport, error) {
+	type pending struct {
+		codeImportEntry
+		hash string
+	}
+	var candidates []pending
+	seen := make(map[string]int)
+	for _, entry := range entries {
+		report.Total++
+
+		hash := HashCode(entry.code)
+		if first, ok := seen[hash]; ok {
+			report.addDuplicate(CodeDuplicate{
+				Index:      entry.index,
+				Preview:    codePreview(entry.preview),
+				Reason:     DuplicateInBatch,
+				FirstIndex: first,
+			})
+			continue
+		}
+		seen[hash] = entry.index
+		candidates = append(candidates, pending{codeImportEntry: entry, hash: hash})
+	}
+
+	// Look up existing stock in chunks to keep the IN list small
+	existing := make(map[string]Code)
+	for start := 0; start < len(candidates); start += 500 {
+		end := start + 500
+		if end > len(candidates) {
+			end = len(candidates)
+		}
+		hashes := make([]string, 0, end-start)
+		for _, c := range candidates[start:end] {
+			hashes = append(hashes, c.hash)
+		}
+
+		var found []Code
+		query := db.Select("id", "product_id", "is_sold", "code_hash").Where("code_hash IN ?", hashes)
+		if report.Scope == CodeDuplicateScopeProduct {
+			query = query.Where("product_id = ?", productID)
+		}
+		if err := query.Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, code := range found {
+			if code.CodeHash != nil {
+				existing[*code.CodeHash] = code
+			}
+		}
+	}
+
+	var codes []Code
+	for _, c := range candidates {
+		if match, ok := existing[c.hash]; ok {
+			reason := DuplicateUnsold
+			if match.IsSold {
+				reason = DuplicateSold
+			}
+			report.addDuplicate(CodeDuplicate{
+				Index:      c.index,
+				Preview:    codePreview(c.preview),
+				Reason:     reason,
+				ExistingID: match.ID,
+				ProductID:  match.ProductID,
+			})
+			continue
+		}
+
+		stored, err := EncryptCode(c.code)
+		if err != nil {
+			return nil, err
+		}
+		hash := c.hash
+		codes = append(codes, Code{
+			ProductID:  productID,
+			Code:       stored,
+			CodeHash:   &hash,
+			Structured: structured,
+			IsSold:     false,
+			Status:     CodeStatusAvailable,
+			ExpiresAt:  opts.ExpiresAt,
+		})
+	}
+
+	sort.Slice(report.Duplicates, func(i, j int) bool {
+		return report.Duplicates[i].Index < report.Duplicates[j].Index
+	})
+
+	if opts.RejectDuplicates && report.DuplicateCount() > 0 {
+		report.Rejected = true
+		return report, nil
+	}
+
+	if len(codes) > 0 {
+		batch := opts.Batch
+		batch.ID = 0
+		batch.ProductID = productID
+		batch.Quantity = len(codes)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&batch).Error; err != nil {
+				return err
+			}
+			for i := range codes {
+				codes[i].BatchID = &batch.ID
+			}
+			return tx.CreateInBatches(&codes, 100).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		report.BatchID = batch.ID
+		CheckStockLevel(db, productID)
+	}
+	report.Inserted = len(codes)
+	return report, nil
+}
+
+// codePreview shows the start of a code's first line for reports, masking the rest
+func codePreview(code string) string {
+	line := strings.SplitN(code, "\n", 2)[0]
+	runes := []rune(line)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	visible := 4
+	if len(runes) > 12 {
+		visible = 6
+	}
+	return string(runes[:visible]) + strings.Repeat("*", len(runes)-visible)
+}
@@ -0,0 +1,36 @@
+package store
+
+import "testing"
+
+func TestRehashCodesHashesLegacyCodesOnce(t *testing.T) {
+	db := newTestDB(t)
+	product, _ := newTestCodes(t, db, "legacy", 0)
+	legacy := []Code{
+		{ProductID: product.ID, Code: "EEEE-5555", Status: CodeStatusAvailable},
+		{ProductID: product.ID, Code: "EEEE-5555", Status: CodeStatusAvailable},
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatalf("create legacy codes: %v", err)
+	}
+
+	if err := RehashCodes(db); err != nil {
+		t.Fatalf("rehash: %v", err)
+	}
+	if code := storedCode(t, db, legacy[0].ID); code.CodeHash == nil || *code.CodeHash != HashCode("EEEE-5555") {
+		t.Fatalf("legacy code %d was not hashed", code.ID)
+	}
+	if code := storedCode(t, db, legacy[1].ID); code.CodeHash != nil {
+		t.Fatalf("legacy duplicate %d got a hash", code.ID)
+	}
+
+	// With the key unchanged the duplicate is not scanned again
+	if err := db.Model(&Code{}).Where("id = ?", legacy[0].ID).Update("code_hash", nil).Error; err != nil {
+		t.Fatalf("clear hash: %v", err)
+	}
+	if err := RehashCodes(db); err != nil {
+		t.Fatalf("rehash again: %v", err)
+	}
+	if code := storedCode(t, db, legacy[0].ID); code.CodeHash != nil {
+		t.Fatalf("codes were rehashed although the key did not change")
+	}
+}
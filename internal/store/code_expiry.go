@@ -0,0 +1,80 @@
+package store
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	logger "shop-bot/internal/log"
+)
+
+// codeFEFOOrder sorts codes first-expired-first-out, codes without an
+// expiry date last. It works on both SQLite and PostgreSQL.
+const codeFEFOOrder = "(expires_at IS NULL), expires_at, id"
+
+// CodeOperationSystemAdmin is recorded as the admin of operations run by scheduled jobs
+const CodeOperationSystemAdmin = "system"
+
+// IsExpired reports whether an unsold code is past its expiry date
+func (c Code) IsExpired() bool {
+	return !c.IsSold && c.ExpiresAt != nil && !c.ExpiresAt.After(time.Now())
+}
+
+// ExpiredCodeReport summarises the codes of one product quarantined because they expired
+type ExpiredCodeReport struct {
+	ProductID   uint
+	ProductName string
+	Count       int
+	CostCents   int64 // Purchase cost of the codes from their batches
+	OperationID uint
+}
+
+// QuarantineExpiredCodes moves unsold codes past their expiry date to
+// quarantine, one audited operation per product, and reports what was
+// written off
+func QuarantineExpiredCodes(db *gorm.DB) ([]ExpiredCodeReport, error) {
+	now := time.Now()
+	var productIDs []uint
+	if err := db.Model(&Code{}).
+		Where("is_sold = ? AND status = ? AND expires_at IS NOT NULL AND expires_at <= ?", false, CodeStatusAvailable, now).
+		Distinct().Pluck("product_id", &productIDs).Error; err != nil {
+		return nil, err
+	}
+
+	var reports []ExpiredCodeReport
+	for _, productID := range productIDs {
+		var product Product
+		if err := db.Select("id", "name").First(&product, productID).Error; err != nil {
+			logger.Error("Failed to load product of expired codes", "error", err, "product_id", productID)
+			continue
+		}
+
+		sold := false
+		filter := CodeFilter{
+			ProductID:     productID,
+			Sold:          &sold,
+			Status:        CodeStatusAvailable,
+			ExpiresBefore: &now,
+		}
+		result, err := ApplyCodeAction(db, filter, CodeActionQuarantine, CodeOperationSystemAdmin, "已过期")
+		if err == ErrEmptyCodeSelection {
+			continue // Sold or quarantined in the meantime
+		}
+		if err != nil {
+			logger.Error("Failed to quarantine expired codes", "error", err, "product_id", productID)
+			continue
+		}
+		if result.Affected == 0 {
+			continue
+		}
+
+		reports = append(reports, ExpiredCodeReport{
+			ProductID:   product.ID,
+			ProductName: product.Name,
+			Count:       result.Affected,
+			CostCents:   result.CostCents,
+			OperationID: result.OperationID,
+		})
+		logger.Info("Quarantined expired codes", "product_id", productID, "count", result.Affected)
+	}
+	return reports, nil
+}
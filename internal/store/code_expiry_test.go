@@ -0,0 +1,48 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuarantineExpiredCodesCostsQuarantinedCodesOnly(t *testing.T) {
+	db := newTestDB(t)
+	product, _ := newTestCodes(t, db, "expiring", 0)
+
+	expired := time.Now().Add(-time.Hour)
+	report, err := ImportCodes(db, product.ID, []string{"E-1", "E-2", "E-3", "E-4"}, CodeImportOptions{
+		ExpiresAt: &expired,
+		Batch:     CodeBatch{Source: CodeBatchSourceUpload, UnitCostCents: 250},
+	})
+	if err != nil || report.Inserted != 4 {
+		t.Fatalf("import codes: %+v, %v", report, err)
+	}
+	if _, err := ImportCodes(db, product.ID, []string{"FRESH"}, CodeImportOptions{
+		Batch: CodeBatch{Source: CodeBatchSourceUpload, UnitCostCents: 999},
+	}); err != nil {
+		t.Fatalf("import fresh code: %v", err)
+	}
+
+	var codes []Code
+	if err := db.Where("product_id = ? AND expires_at IS NOT NULL", product.ID).Order("id").Find(&codes).Error; err != nil {
+		t.Fatalf("load codes: %v", err)
+	}
+	reserveTestCode(t, db, codes[0].ID, 1, time.Now().Add(time.Hour))
+	if err := db.Model(&codes[1]).Update("status", CodeStatusVoid).Error; err != nil {
+		t.Fatalf("void code: %v", err)
+	}
+
+	reports, err := QuarantineExpiredCodes(db)
+	if err != nil {
+		t.Fatalf("quarantine: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Count != 2 || reports[0].CostCents != 500 {
+		t.Fatalf("reports = %+v, want 2 codes costing 500", reports)
+	}
+
+	var quarantined int64
+	db.Model(&Code{}).Where("product_id = ? AND status = ?", product.ID, CodeStatusQuarantined).Count(&quarantined)
+	if quarantined != 2 {
+		t.Fatalf("%d codes quarantined, want 2", quarantined)
+	}
+}
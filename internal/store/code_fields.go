@@ -0,0 +1,336 @@
+package store
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCodeFields       = errors.New("invalid code fields")
+	ErrInvalidDeliveryTemplate = errors.New("invalid delivery template")
+	ErrNoCodeFields            = errors.New("product has no code fields")
+)
+
+// maxCodeFields limits how many fields a product's codes can have
+const maxCodeFields = 20
+
+var codeFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// CodeField is one field of a structured code, e.g. account or password
+type CodeField struct {
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Required bool   `json:"required"`
+}
+
+// CodeRowError describes an import row that could not be used
+type CodeRowError struct {
+	Index int    `json:"index"` // 1-based data row
+	Error string `json:"error"`
+}
+
+// Fields returns the structured code fields of the product, nil when its
+// codes are plain text
+func (p *Product) Fields() []CodeField {
+	if p.CodeFields == "" {
+		return nil
+	}
+	var fields []CodeField
+	if err := json.Unmarshal([]byte(p.CodeFields), &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// ValidateCodeFields checks field keys are unique identifiers and fills in missing labels
+func ValidateCodeFields(fields []CodeField) error {
+	if len(fields) > maxCodeFields {
+		return fmt.Errorf("%w: at most %d fields", ErrInvalidCodeFields, maxCodeFields)
+	}
+	seen := make(map[string]bool)
+	for i := range fields {
+		fields[i].Key = strings.TrimSpace(fields[i].Key)
+		fields[i].Label = strings.TrimSpace(fields[i].Label)
+		if !codeFieldKeyPattern.MatchString(fields[i].Key) {
+			return fmt.Errorf("%w: key %q must be lowercase letters, digits or underscores", ErrInvalidCodeFields, fields[i].Key)
+		}
+		if seen[fields[i].Key] {
+			return fmt.Errorf("%w: duplicate key %q", ErrInvalidCodeFields, fields[i].Key)
+		}
+		seen[fields[i].Key] = true
+		if fields[i].Label == "" {
+			fields[i].Label = fields[i].Key
+		}
+	}
+	return nil
+}
+
+// DefaultDeliveryTemplate lists every field as "label: value"
+func DefaultDeliveryTemplate(fields []CodeField) string {
+	lines := make([]string, 0, len(fields))
+	for _, f := range fields {
+		lines = append(lines, fmt.Sprintf("%s: {{.%s}}", f.Label, f.Key))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func parseDeliveryTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("delivery").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDeliveryTemplate, err)
+	}
+	return tmpl, nil
+}
+
+// SetProductCodeFields stores the field definitions and delivery template of
+// a product. An empty template falls back to DefaultDeliveryTemplate.
+func SetProductCodeFields(db *gorm.DB, productID uint, fields []CodeField, deliveryTemplate string) error {
+	if err := ValidateCodeFields(fields); err != nil {
+		return err
+	}
+
+	encoded := ""
+	if len(fields) > 0 {
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		encoded = string(data)
+	}
+
+	deliveryTemplate = strings.TrimSpace(deliveryTemplate)
+	if deliveryTemplate != "" {
+		// Render once with sample values so broken templates are rejected now
+		tmpl, err := parseDeliveryTemplate(deliveryTemplate)
+		if err != nil {
+			return err
+		}
+		sample := make(map[string]string)
+		for _, f := range fields {
+			sample[f.Key] = f.Label
+		}
+		if err := tmpl.Execute(io.Discard, sample); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDeliveryTemplate, err)
+		}
+	}
+
+	return db.Model(&Product{}).Where("id = ?", productID).Updates(map[string]interface{}{
+		"code_fields":       encoded,
+		"delivery_template": deliveryTemplate,
+	}).Error
+}
+
+// CodeFieldValues decodes the field values of a decrypted structured code
+func CodeFieldValues(plain string) (map[string]string, error) {
+	values := make(map[string]string)
+	if err := json.Unmarshal([]byte(plain), &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// RenderCode decrypts a code and, for structured codes, formats it with the
+// product's delivery template. This is what the customer receives.
+func (p *Product) RenderCode(code *Code) (string, error) {
+	plain, err := DecryptCode(code.Code)
+	if err != nil || !code.Structured {
+		return plain, err
+	}
+
+	values, err := CodeFieldValues(plain)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode structured code %d: %w", code.ID, err)
+	}
+
+	text := p.DeliveryTemplate
+	if text == "" {
+		text = DefaultDeliveryTemplate(p.Fields())
+	}
+	tmpl, err := parseDeliveryTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDeliveryTemplate, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// RenderCode loads the product of a structured code when needed and renders it
+func RenderCode(db *gorm.DB, code *Code) (string, error) {
+	if !code.Structured {
+		return DecryptCode(code.Code)
+	}
+	var product Product
+	if err := db.First(&product, code.ProductID).Error; err != nil {
+		return "", err
+	}
+	return product.RenderCode(code)
+}
+
+// ParseCodeRecordsCSV reads structured codes from CSV. The header row names
+// the columns by field key or label; unknown columns are ignored.
+func ParseCodeRecordsCSV(r io.Reader, fields []CodeField) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make([]string, len(header))
+	matched := 0
+	for i, name := range header {
+		if key := matchCodeField(fields, name); key != "" {
+			columns[i] = key
+			matched++
+		}
+	}
+	if matched == 0 {
+		return nil, fmt.Errorf("CSV header matches none of the fields: %s", fieldKeys(fields))
+	}
+
+	var records []map[string]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		record := make(map[string]string)
+		for i, value := range row {
+			if i < len(columns) && columns[i] != "" {
+				record[columns[i]] = value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// ParseCodeRecordsJSON reads structured codes from a JSON array of objects
+// keyed by field key or label
+func ParseCodeRecordsJSON(r io.Reader, fields []CodeField) ([]map[string]string, error) {
+	var rows []map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("JSON must be an array of objects: %w", err)
+	}
+
+	records := make([]map[string]string, 0, len(rows))
+	for _, row := range rows {
+		record := make(map[string]string)
+		for name, value := range row {
+			key := matchCodeField(fields, name)
+			if key == "" || value == nil {
+				continue
+			}
+			if s, ok := value.(string); ok {
+				record[key] = s
+			} else {
+				record[key] = fmt.Sprint(value)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// matchCodeField returns the key of the field a column name refers to
+func matchCodeField(fields []CodeField, name string) string {
+	name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+	for _, f := range fields {
+		if strings.EqualFold(name, f.Key) || strings.EqualFold(name, f.Label) {
+			return f.Key
+		}
+	}
+	return ""
+}
+
+func fieldKeys(fields []CodeField) string {
+	keys := make([]string, 0, len(fields))
+	for _, f := range fields {
+		keys = append(keys, f.Key)
+	}
+	return strings.Join(keys, ", ")
+}
+
+// ImportStructuredCodes validates records against the product's fields and
+// imports them like ImportCodes. Rows missing a required field are reported
+// and skipped. Each code is stored as a JSON object of its field values.
+func ImportStructuredCodes(db *gorm.DB, product *Product, records []map[string]string, opts CodeImportOptions) (*CodeUploadReport, error) {
+	fields := product.Fields()
+	if len(fields) == 0 {
+		return nil, ErrNoCodeFields
+	}
+
+	report := newCodeUploadReport(db)
+	entries := make([]codeImportEntry, 0, len(records))
+	for i, record := range records {
+		values := make(map[string]string)
+		var missing []string
+		for _, f := range fields {
+			value := strings.TrimSpace(record[f.Key])
+			if value == "" {
+				if f.Required {
+					missing = append(missing, f.Label)
+				}
+				continue
+			}
+			values[f.Key] = value
+		}
+
+		if len(values) == 0 {
+			continue // Blank row
+		}
+		if len(missing) > 0 {
+			report.addRowError(CodeRowError{Index: i + 1, Error: "missing " + strings.Join(missing, ", ")})
+			continue
+		}
+
+		// json.Marshal sorts map keys, so equal codes encode identically
+		encoded, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, codeImportEntry{index: i + 1, code: string(encoded), preview: values[fields[0].Key]})
+	}
+
+	return importCodes(db, product.ID, entries, true, opts, report)
+}
+
+// MatchCode reports whether a code matches an admin search. With a field
+// key only that field of a structured code is searched, otherwise the
+// rendered code. Matching is case insensitive.
+func (p *Product) MatchCode(code *Code, rendered, field, query string) bool {
+	query = strings.ToLower(query)
+	if field == "" || !code.Structured {
+		return strings.Contains(strings.ToLower(rendered), query)
+	}
+
+	plain, err := DecryptCode(code.Code)
+	if err != nil {
+		return false
+	}
+	values, err := CodeFieldValues(plain)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(values[field]), query)
+}
@@ -0,0 +1,213 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// accountFields are the code fields of an account product
+var accountFields = []CodeField{
+	{Key: "account", Label: "Account", Required: true},
+	{Key: "password", Label: "Password", Required: true},
+	{Key: "note", Label: "Note"},
+}
+
+// newStructuredProduct creates a product whose codes have accountFields
+func newStructuredProduct(t *testing.T, db *gorm.DB, name, deliveryTemplate string) *Product {
+	t.Helper()
+	product, _ := newTestCodes(t, db, name, 0)
+	if err := SetProductCodeFields(db, product.ID, append([]CodeField(nil), accountFields...), deliveryTemplate); err != nil {
+		t.Fatalf("set code fields: %v", err)
+	}
+	if err := db.First(product, product.ID).Error; err != nil {
+		t.Fatalf("reload product: %v", err)
+	}
+	return product
+}
+
+func TestValidateCodeFields(t *testing.T) {
+	fields := []CodeField{{Key: " account "}, {Key: "pin_2", Label: " PIN "}}
+	if err := ValidateCodeFields(fields); err != nil {
+		t.Fatalf("valid fields: %v", err)
+	}
+	if fields[0].Key != "account" || fields[0].Label != "account" || fields[1].Label != "PIN" {
+		t.Errorf("fields = %+v, want trimmed keys and default labels", fields)
+	}
+
+	tooMany := make([]CodeField, maxCodeFields+1)
+	for i := range tooMany {
+		tooMany[i].Key = "f" + strings.Repeat("x", i)
+	}
+	invalid := map[string][]CodeField{
+		"upper case":    {{Key: "Account"}},
+		"leading digit": {{Key: "1pin"}},
+		"space":         {{Key: "user name"}},
+		"empty":         {{Key: ""}},
+		"duplicate":     {{Key: "pin"}, {Key: "pin"}},
+		"too many":      tooMany,
+	}
+	for name, fields := range invalid {
+		if err := ValidateCodeFields(fields); !errors.Is(err, ErrInvalidCodeFields) {
+			t.Errorf("%s: error = %v, want %v", name, err, ErrInvalidCodeFields)
+		}
+	}
+}
+
+func TestSetProductCodeFieldsRejectsBrokenTemplates(t *testing.T) {
+	db := newTestDB(t)
+	product, _ := newTestCodes(t, db, "template", 0)
+
+	for _, text := range []string{"{{.account", "{{.account | nosuchfunc}}", `{{template "missing"}}`} {
+		err := SetProductCodeFields(db, product.ID, append([]CodeField(nil), accountFields...), text)
+		if !errors.Is(err, ErrInvalidDeliveryTemplate) {
+			t.Errorf("template %q: error = %v, want %v", text, err, ErrInvalidDeliveryTemplate)
+		}
+	}
+}
+
+func TestImportStructuredCodesValidatesRows(t *testing.T) {
+	db := newTestDB(t)
+	product := newStructuredProduct(t, db, "accounts", "")
+
+	records := []map[string]string{
+		{"account": "a@example.com", "password": "p1", "note": "vip"},
+		{"account": "b@example.com"},                                  // Missing password
+		{"account": " ", "password": "", "note": ""},                  // Blank row
+		{"note": "vip", "password": "p1", "account": "a@example.com"}, // Same values as the first row
+		{"account": "c@example.com", "password": "p3", "x": "ignored"},
+	}
+	report, err := ImportStructuredCodes(db, product, records, CodeImportOptions{})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Inserted != 2 || report.Invalid != 1 || report.DuplicatesInBatch != 1 {
+		t.Fatalf("report = %+v, want 2 inserted, 1 invalid and 1 duplicate", report)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Index != 2 || !strings.Contains(report.Errors[0].Error, "Password") {
+		t.Fatalf("errors = %+v, want row 2 missing Password", report.Errors)
+	}
+
+	// Key order does not matter for duplicates
+	again, err := ImportStructuredCodes(db, product, []map[string]string{{"password": "p3", "account": "c@example.com"}}, CodeImportOptions{})
+	if err != nil {
+		t.Fatalf("import again: %v", err)
+	}
+	if again.Inserted != 0 || again.DuplicatesUnsold != 1 {
+		t.Fatalf("report = %+v, want the existing code reported", again)
+	}
+
+	plain, _ := newTestCodes(t, db, "plain", 0)
+	if _, err := ImportStructuredCodes(db, plain, records, CodeImportOptions{}); !errors.Is(err, ErrNoCodeFields) {
+		t.Fatalf("error = %v, want %v", err, ErrNoCodeFields)
+	}
+}
+
+func TestRenderStructuredCode(t *testing.T) {
+	useCodeCipher(t, newTestCipher(t, "code-fields-key"))
+	db := newTestDB(t)
+
+	custom := newStructuredProduct(t, db, "custom", "Login {{.account}} / {{.password}}{{if .note}} ({{.note}}){{end}}")
+	fallback := newStructuredProduct(t, db, "fallback", "")
+	for _, product := range []*Product{custom, fallback} {
+		if _, err := ImportStructuredCodes(db, product, []map[string]string{{"account": "a@example.com", "password": "p1"}}, CodeImportOptions{}); err != nil {
+			t.Fatalf("import: %v", err)
+		}
+	}
+
+	tests := []struct {
+		product *Product
+		want    string
+	}{
+		{custom, "Login a@example.com / p1"},
+		{fallback, "Account: a@example.com\nPassword: p1\nNote:"},
+	}
+	for _, tt := range tests {
+		var code Code
+		if err := db.Where("product_id = ?", tt.product.ID).First(&code).Error; err != nil {
+			t.Fatalf("load code: %v", err)
+		}
+		if strings.Contains(code.Code, "a@example.com") {
+			t.Fatalf("structured code stored in plain text: %q", code.Code)
+		}
+		got, err := RenderCode(db, &code)
+		if err != nil {
+			t.Fatalf("render %s: %v", tt.product.Name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s rendered %q, want %q", tt.product.Name, got, tt.want)
+		}
+
+		if !tt.product.MatchCode(&code, got, "account", "A@EXAMPLE") {
+			t.Errorf("%s: account search did not match", tt.product.Name)
+		}
+		if tt.product.MatchCode(&code, got, "password", "example") {
+			t.Errorf("%s: password search matched the account", tt.product.Name)
+		}
+	}
+}
+
+func TestParseCodeRecords(t *testing.T) {
+	csvText := "\ufeffACCOUNT,Password,extra\na@example.com,p1,x\nb@example.com\n"
+	records, err := ParseCodeRecordsCSV(strings.NewReader(csvText), accountFields)
+	if err != nil {
+		t.Fatalf("parse CSV: %v", err)
+	}
+	if len(records) != 2 || records[0]["account"] != "a@example.com" || records[0]["password"] != "p1" || records[1]["account"] != "b@example.com" {
+		t.Fatalf("CSV records = %v", records)
+	}
+	if _, ok := records[0]["extra"]; ok {
+		t.Error("unknown CSV column kept")
+	}
+	if _, err := ParseCodeRecordsCSV(strings.NewReader("foo,bar\n1,2\n"), accountFields); err == nil {
+		t.Error("CSV without known columns accepted")
+	}
+
+	jsonText := `[{"Account":"a@example.com","password":1234,"note":null,"extra":"x"}]`
+	records, err = ParseCodeRecordsJSON(strings.NewReader(jsonText), accountFields)
+	if err != nil {
+		t.Fatalf("parse JSON: %v", err)
+	}
+	if len(records) != 1 || records[0]["account"] != "a@example.com" || records[0]["password"] != "1234" || len(records[0]) != 2 {
+		t.Fatalf("JSON records = %v", records)
+	}
+	if _, err := ParseCodeRecordsJSON(strings.NewReader(`{"account":"a"}`), accountFields); err == nil {
+		t.Error("JSON object accepted instead of an array")
+	}
+}
+
+func TestMoveStructuredCodes(t *testing.T) {
+	db := newTestDB(t)
+	source := newStructuredProduct(t, db, "source", "")
+	if _, err := ImportStructuredCodes(db, source, []map[string]string{{"account": "a@example.com", "password": "p1"}}, CodeImportOptions{}); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	plain, _ := newTestCodes(t, db, "plain", 0)
+	_, err := MoveCodes(db, CodeFilter{ProductID: source.ID}, plain.ID, "admin", "")
+	if !errors.Is(err, ErrInvalidMoveTarget) {
+		t.Fatalf("move to plain product: error = %v, want %v", err, ErrInvalidMoveTarget)
+	}
+	var left int64
+	db.Model(&Code{}).Where("product_id = ?", source.ID).Count(&left)
+	if left != 1 {
+		t.Fatalf("%d codes left in the source, want 1", left)
+	}
+
+	target := newStructuredProduct(t, db, "target", "")
+	result, err := MoveCodes(db, CodeFilter{ProductID: source.ID}, target.ID, "admin", "")
+	if err != nil {
+		t.Fatalf("move to structured product: %v", err)
+	}
+	if result.Affected != 1 {
+		t.Fatalf("result = %+v, want 1 moved", result)
+	}
+
+	// Plain codes may move to a product with fields
+	_, plainCodes := newTestCodes(t, db, "plain-codes", 1)
+	if result, err := MoveCodes(db, CodeFilter{ProductID: plainCodes[0].ProductID}, target.ID, "admin", ""); err != nil || result.Affected != 1 {
+		t.Fatalf("move plain code: %+v, %v", result, err)
+	}
+}
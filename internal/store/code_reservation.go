@@ -0,0 +1,85 @@
+package store
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	logger "shop-bot/internal/log"
+)
+
+// IsReserved reports whether the code is held for a pending order
+func (c Code) IsReserved() bool {
+	return !c.IsSold && c.ReservedOrderID != nil && c.ReservedUntil != nil && c.ReservedUntil.After(time.Now())
+}
+
+// reserveCodeTx holds one available code for a new order until the order
+// expires, so the code is still there when the payment arrives. The code
+// expiring first is reserved.
+func reserveCodeTx(tx *gorm.DB, productID, orderID uint, until time.Time) error {
+	now := time.Now()
+	lock := ""
+	if IsPostgres(tx) {
+		lock = "FOR UPDATE SKIP LOCKED"
+	}
+	result := tx.Exec(`
+		UPDATE codes
+		SET reserved_order_id = ?, reserved_until = ?
+		WHERE id IN (
+			SELECT id FROM codes
+			WHERE product_id = ? AND is_sold = ? AND status = ?
+				AND (reserved_order_id IS NULL OR reserved_until < ?)
+				AND (expires_at IS NULL OR expires_at > ?)
+			ORDER BY `+codeFEFOOrder+`
+			LIMIT 1
+			`+lock+`
+		)
+	`, orderID, until, productID, false, CodeStatusAvailable, now, now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoStock
+	}
+	return nil
+}
+
+// CountCodesForOrder returns the codes an order can still be fulfilled
+// from: the free stock plus the code reserved for the order
+func CountCodesForOrder(db *gorm.DB, productID, orderID uint) (int64, error) {
+	var count int64
+	now := time.Now()
+	err := db.Model(&Code{}).
+		Where("product_id = ? AND is_sold = ? AND status = ?", productID, false, CodeStatusAvailable).
+		Where("reserved_order_id IS NULL OR reserved_until < ? OR reserved_order_id = ?", now, orderID).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Count(&count).Error
+	return count, err
+}
+
+// releaseCodeReservation returns the code held for an order to stock
+func releaseCodeReservation(tx *gorm.DB, orderID uint) error {
+	return tx.Model(&Code{}).
+		Where("reserved_order_id = ? AND is_sold = ?", orderID, false).
+		Updates(map[string]interface{}{
+			"reserved_order_id": nil,
+			"reserved_until":    nil,
+		}).Error
+}
+
+// ReleaseExpiredReservations clears reservations whose time ran out. They
+// no longer hold stock either way, this only keeps the columns tidy.
+func ReleaseExpiredReservations(db *gorm.DB) error {
+	result := db.Model(&Code{}).
+		Where("reserved_order_id IS NOT NULL AND reserved_until < ? AND is_sold = ?", time.Now(), false).
+		Updates(map[string]interface{}{
+			"reserved_order_id": nil,
+			"reserved_until":    nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		logger.Info("Released expired code reservations", "count", result.RowsAffected)
+	}
+	return nil
+}
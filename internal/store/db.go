@@ -56,9 +56,20 @@ func AutoMigrate(db *gorm.DB) error {
 		&SystemSetting{},
 		&FAQ{},
 		&AdminUser{},
+		&AdminRecoveryCode{},
+		&AuditLog{},
+		&APIKey{},
 		&Ticket{}, // Ticket must be created before TicketMessage
 		&TicketMessage{},
 		&TicketTemplate{},
+		&WithdrawalRequest{},
+		&ExchangeRate{},
+		&PaymentCallback{},
+		&OrderPaymentRef{},
+		&CodeOperation{},
+		&ProductSupplier{},
+		&SupplierRun{},
+		&CodeBatch{},
 	)
 }
 
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	logger "shop-bot/internal/log"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	os.Exit(m.Run())
+}
+
+// newTestDB returns a migrated SQLite database in a temporary file. Writers
+// wait for each other instead of failing, like they do on Postgres.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=10000&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := AutoMigrate(db); err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// newTestUser creates a user with a balance
+func newTestUser(t *testing.T, db *gorm.DB, tgUserID int64, balanceCents int) *User {
+	t.Helper()
+	user := &User{TgUserID: tgUserID, BalanceCents: balanceCents}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// balanceOf returns the stored balance of a user
+func balanceOf(t *testing.T, db *gorm.DB, userID uint) int {
+	t.Helper()
+	balance, err := GetUserBalance(db, userID)
+	if err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	return balance
+}
+
+// newTestOrder creates a deposit order of a user
+func newTestOrder(t *testing.T, db *gorm.DB, userID uint, status string, amountCents int) *Order {
+	t.Helper()
+	order := &Order{
+		UserID:         userID,
+		AmountCents:    amountCents,
+		PaymentAmount:  amountCents,
+		Status:         status,
+		EpayOutTradeNo: "D" + strconv.FormatUint(uint64(userID), 10) + "-" + strconv.FormatInt(time.Now().UnixNano(), 10),
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	return order
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidExchangeRate  = errors.New("exchange rate must be greater than zero")
+	ErrExchangeRateNotFound = errors.New("exchange rate not found")
+)
+
+// GetExchangeRates returns all exchange rates ordered by currency code
+func GetExchangeRates(db *gorm.DB) ([]ExchangeRate, error) {
+	var rates []ExchangeRate
+	err := db.Order("currency").Find(&rates).Error
+	return rates, err
+}
+
+// GetActiveExchangeRates returns exchange rates that users can choose from
+func GetActiveExchangeRates(db *gorm.DB) ([]ExchangeRate, error) {
+	var rates []ExchangeRate
+	err := db.Where("is_active = ?", true).Order("currency").Find(&rates).Error
+	return rates, err
+}
+
+// GetExchangeRate returns the active exchange rate for a currency
+func GetExchangeRate(db *gorm.DB, currency string) (*ExchangeRate, error) {
+	var rate ExchangeRate
+	err := db.Where("currency = ? AND is_active = ?", strings.ToUpper(currency), true).First(&rate).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrExchangeRateNotFound
+		}
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// SaveExchangeRate creates or updates the exchange rate for a currency
+func SaveExchangeRate(db *gorm.DB, currency, symbol string, rate float64, isActive bool, updatedBy string) (*ExchangeRate, error) {
+	if rate <= 0 {
+		return nil, ErrInvalidExchangeRate
+	}
+
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+
+	var existing ExchangeRate
+	err := db.Where("currency = ?", currency).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		existing = ExchangeRate{
+			Currency:  currency,
+			Symbol:    symbol,
+			Rate:      rate,
+			IsActive:  isActive,
+			UpdatedBy: updatedBy,
+		}
+		if err := db.Create(&existing).Error; err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&existing).Updates(map[string]interface{}{
+		"symbol":     symbol,
+		"rate":       rate,
+		"is_active":  isActive,
+		"updated_by": updatedBy,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &existing, nil
+}
+
+// DeleteExchangeRate removes a currency and resets users who had selected it
+func DeleteExchangeRate(db *gorm.DB, currency string) error {
+	currency = strings.ToUpper(currency)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("currency = ?", currency).Delete(&ExchangeRate{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrExchangeRateNotFound
+		}
+
+		return tx.Model(&User{}).Where("display_currency = ?", currency).
+			Update("display_currency", "").Error
+	})
+}
+
+// SetUserDisplayCurrency updates the user's preferred display currency.
+// An empty currency resets the user to the shop base currency.
+func SetUserDisplayCurrency(db *gorm.DB, userID uint, currency string) error {
+	return db.Model(&User{}).Where("id = ?", userID).
+		Update("display_currency", strings.ToUpper(currency)).Error
+}
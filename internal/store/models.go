@@ -14,6 +14,7 @@ type User struct {
 	TgLastName   string    `gorm:"size:100"`
 	Language     string    `gorm:"size:10;default:'en'"`
 	BalanceCents int       `gorm:"default:0;not null"` // User balance in cents
+	DisplayCurrency string `gorm:"size:10"` // Preferred display currency, empty means shop base currency
 	CreatedAt    time.Time
 }
 
@@ -24,6 +25,10 @@ type Product struct {
 	Description string    `gorm:"type:text" json:"description"`
 	PriceCents  int       `gorm:"not null" json:"price_cents"` // Price in cents to avoid float precision issues
 	IsActive    bool      `gorm:"default:true;index" json:"is_active"`
+	CodeFields       string `gorm:"type:text" json:"code_fields"`       // JSON list of structured code fields
+	DeliveryTemplate string `gorm:"type:text" json:"delivery_template"` // Renders structured codes for delivery
+	LowStockThreshold int  `gorm:"not null;default:0" json:"low_stock_threshold"` // Alert admins at or below this stock, 0 disables
+	LowStockAlerted   bool `gorm:"not null;default:false" json:"low_stock_alerted"` // A low-stock alert is outstanding
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -31,13 +36,20 @@ type Product struct {
 // Code represents a card/account code
 type Code struct {
 	ID         uint      `gorm:"primaryKey"`
-	ProductID  uint      `gorm:"not null;index"`
+	ProductID  uint      `gorm:"not null;index;uniqueIndex:idx_codes_product_hash"`
 	Product    Product   `gorm:"foreignKey:ProductID"`
 	Code       string    `gorm:"type:text;not null"`
+	CodeHash   *string   `gorm:"size:64;index;uniqueIndex:idx_codes_product_hash"` // Hash of the normalized code, for duplicate detection
+	Structured bool      `gorm:"default:false"` // Code holds a JSON object of the product's code fields
 	IsSold     bool      `gorm:"default:false;index"`
+	Status     string    `gorm:"size:20;not null;default:'available';index"` // available, quarantined, void; only available codes are sold
 	SoldAt     *time.Time
 	OrderID    *uint
 	Order      *Order    `gorm:"foreignKey:OrderID"`
+	ReservedOrderID *uint      `gorm:"index"` // Pending order holding this code until ReservedUntil
+	ReservedUntil   *time.Time
+	ExpiresAt       *time.Time `gorm:"index"` // Codes are not sold after this time, nil never expires
+	BatchID         *uint      `gorm:"index"` // Inventory batch the code was imported with
 	CreatedAt  time.Time
 }
 
@@ -51,9 +63,11 @@ type Order struct {
 	AmountCents     int       `gorm:"not null"`
 	BalanceUsed     int       `gorm:"default:0;not null"` // Balance used for this order
 	PaymentAmount   int       `gorm:"not null"` // Actual payment amount (after balance deduction)
-	Status          string    `gorm:"size:20;not null;default:'pending';index"` // pending, paid, delivered, paid_no_stock, failed_delivery, expired
+	PaidAmount      int       `gorm:"default:0;not null"` // Amount received from the payment provider so far
+	Status          string    `gorm:"size:20;not null;default:'pending';index"` // pending, paid, delivered, paid_no_stock, failed_delivery, expired, payment_mismatch, cancelled
 	EpayTradeNo     string    `gorm:"size:100;index"`
 	EpayOutTradeNo  string    `gorm:"size:100;uniqueIndex"`
+	PaymentProvider string    `gorm:"size:20;index"` // Provider that issued the trade numbers above, e.g. epay
 	DeliveryRetries int       `gorm:"default:0;not null"` // Number of delivery retry attempts
 	LastRetryAt     *time.Time
 	CreatedAt       time.Time
@@ -96,13 +110,17 @@ type BalanceTransaction struct {
 	ID             uint      `gorm:"primaryKey"`
 	UserID         uint      `gorm:"not null;index"`
 	User           User      `gorm:"foreignKey:UserID"`
-	Type           string    `gorm:"size:20;not null"` // recharge, purchase, refund
+	Type           string    `gorm:"size:20;not null"` // recharge, purchase, refund, transfer_in, transfer_out, withdraw_hold, withdraw_release
 	AmountCents    int       `gorm:"not null"` // Positive for income, negative for expense
 	BalanceAfter   int       `gorm:"not null"` // Balance after transaction
 	RechargeCardID *uint
 	RechargeCard   *RechargeCard `gorm:"foreignKey:RechargeCardID"`
 	OrderID        *uint
 	Order          *Order    `gorm:"foreignKey:OrderID"`
+	CounterpartyUserID *uint `gorm:"index"` // Other side of a transfer
+	CounterpartyUser   *User `gorm:"foreignKey:CounterpartyUserID"`
+	WithdrawalID       *uint `gorm:"index"`
+	TradeNo            *string `gorm:"size:100;uniqueIndex"` // Payment credited after it could not settle its order, credited once
 	Description    string    `gorm:"size:200"`
 	CreatedAt      time.Time
 }
@@ -220,17 +238,62 @@ type FAQ struct {
 type AdminUser struct {
 	ID                   uint       `gorm:"primaryKey"`
 	Username             string     `gorm:"uniqueIndex;size:50;not null"`
-	Password             string     `gorm:"size:255;not null"`
+	Password             string     `gorm:"size:255;not null" json:"-"`
 	Email                string     `gorm:"size:100"`
 	IsActive             bool       `gorm:"default:true"`
-	IsSuperAdmin         bool       `gorm:"default:false"`
+	IsSuperAdmin         bool       `gorm:"default:false"` // Kept in sync with Role for older code paths
+	Role                 string     `gorm:"size:20;not null;default:'operator'"` // super_admin, operator, support, viewer
 	TelegramID           *int64     `gorm:"index"`
 	ReceiveNotifications bool       `gorm:"default:true"`
 	LastLoginAt          *time.Time
+	SessionsRevokedAt    *time.Time // Tokens and sessions issued up to this time are rejected
+	TOTPSecret           string     `gorm:"size:255" json:"-"` // Set at enrollment, in use once TOTPEnabled; encrypted like codes when a key is configured
+	TOTPEnabled          bool       `gorm:"default:false"`
+	TOTPLastStep         int64      `json:"-"` // Last accepted time step, so codes cannot be replayed
 	CreatedAt            time.Time
 	UpdatedAt            time.Time
 }
 
+// AuditLog is a persisted admin audit trail entry
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    string    `gorm:"size:50;index"` // Admin user ID, "admin" for the ADMIN_TOKEN, "api_key:<id>" for API keys
+	Username  string    `gorm:"size:50;index"`
+	Action    string    `gorm:"size:50;index"`  // e.g. update_product, delete_code, request:POST
+	Resource  string    `gorm:"size:255;index"` // e.g. product:12, settings or a request path
+	OldValue  string    `gorm:"type:text"`      // JSON of the changed fields before the change
+	NewValue  string    `gorm:"type:text"`      // JSON of the changed fields after the change
+	IPAddress string    `gorm:"size:45"`
+	UserAgent string    `gorm:"size:255"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// AdminRecoveryCode is a one-time code that replaces a TOTP code at login
+type AdminRecoveryCode struct {
+	ID          uint       `gorm:"primaryKey"`
+	AdminUserID uint       `gorm:"index;not null"`
+	CodeHash    string     `gorm:"size:64;not null"`
+	UsedAt      *time.Time
+	CreatedAt   time.Time
+}
+
+// APIKey is a scoped credential for machine-to-machine admin access. Only
+// the hash of the key is stored.
+type APIKey struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Name          string     `gorm:"size:50;not null" json:"name"`
+	Prefix        string     `gorm:"size:20;not null" json:"prefix"` // Start of the key, to tell keys apart
+	KeyHash       string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Scopes        string     `gorm:"type:text;not null" json:"scopes"` // Comma separated permissions, e.g. "orders:read,codes:write"
+	CreatedBy     uint       `gorm:"index" json:"created_by"`           // Admin user ID
+	CreatedByName string     `gorm:"size:50" json:"created_by_name"`
+	ExpiresAt     *time.Time `json:"expires_at"` // nil never expires
+	LastUsedAt    *time.Time `json:"last_used_at"`
+	LastUsedIP    string     `gorm:"size:45" json:"last_used_ip"`
+	RevokedAt     *time.Time `gorm:"index" json:"revoked_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
 // Ticket represents a support ticket
 type Ticket struct {
 	ID          uint      `gorm:"primaryKey"`
@@ -278,4 +341,141 @@ type TicketTemplate struct {
 	UpdatedAt time.Time
 }
 
-func (FAQ) TableName() string { return "faqs" }
\ No newline at end of file
+func (FAQ) TableName() string { return "faqs" }
+
+// WithdrawalRequest represents a user's request to cash out balance.
+// The amount is held (deducted) when the request is created and
+// released back to the user if the request is rejected.
+type WithdrawalRequest struct {
+	ID            uint       `gorm:"primaryKey"`
+	UserID        uint       `gorm:"not null;index"`
+	User          User       `gorm:"foreignKey:UserID"`
+	AmountCents   int        `gorm:"not null"`
+	PayoutMethod  string     `gorm:"size:50"`  // alipay, wechat, bank, usdt, ...
+	PayoutAccount string     `gorm:"size:500;not null"` // Account details entered by the user
+	Status        string     `gorm:"size:20;not null;default:'pending';index"` // pending, approved, rejected
+	ReferenceNo   string     `gorm:"size:100"` // Payout reference entered by admin
+	RejectReason  string     `gorm:"size:500"`
+	ReviewedBy    string     `gorm:"size:50"`
+	ReviewedAt    *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (WithdrawalRequest) TableName() string { return "withdrawal_requests" }
+
+// ExchangeRate represents an admin-maintained display rate.
+// Rate is the amount of Currency equal to one unit of the shop base currency.
+type ExchangeRate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Currency  string    `gorm:"uniqueIndex;size:10;not null" json:"currency"` // ISO code, e.g. USD
+	Symbol    string    `gorm:"size:10" json:"symbol"`
+	Rate      float64   `gorm:"not null" json:"rate"`
+	IsActive  bool      `gorm:"default:true" json:"is_active"`
+	UpdatedBy string    `gorm:"size:50" json:"updated_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (ExchangeRate) TableName() string { return "exchange_rates" }
+
+// OrderPaymentRef is a merchant order number issued for an order. Each
+// checkout issues a new one and the order keeps only the latest, so earlier
+// ones are kept here to match payments made with them.
+type OrderPaymentRef struct {
+	ID         uint      `gorm:"primaryKey"`
+	OrderID    uint      `gorm:"not null;index"`
+	Provider   string    `gorm:"size:20"`
+	OutTradeNo string    `gorm:"size:100;uniqueIndex"`
+	CreatedAt  time.Time
+}
+
+// PaymentCallback is a raw inbound payment callback kept for auditing
+// and for re-running processing after an issue has been fixed.
+type PaymentCallback struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Provider       string    `gorm:"size:20;not null;index" json:"provider"`
+	Source         string    `gorm:"size:20;not null" json:"source"` // notify, return, replay
+	RawParams      string    `gorm:"type:text" json:"raw_params"`    // URL encoded parameters as received
+	OutTradeNo     string    `gorm:"size:100;index" json:"out_trade_no"`
+	TradeNo        string    `gorm:"size:100;index" json:"trade_no"`
+	SignatureValid bool      `json:"signature_valid"`
+	OrderID        *uint     `gorm:"index" json:"order_id"`
+	Result         string    `gorm:"size:30;index" json:"result"` // processed, duplicate, invalid_signature, ...
+	Error          string    `gorm:"type:text" json:"error"`
+	TraceID        string    `gorm:"size:64;index" json:"trace_id"`
+	ReplayOf       *uint     `gorm:"index" json:"replay_of"` // Original callback when re-run by an admin
+	ReplayedBy     string    `gorm:"size:50" json:"replayed_by"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (PaymentCallback) TableName() string { return "payment_callbacks" }
+
+// CodeOperation records a bulk inventory operation performed by an admin
+type CodeOperation struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	Action          string    `gorm:"size:20;not null;index" json:"action"` // export, move, void, quarantine, release, delete
+	ProductID       uint      `gorm:"not null;index" json:"product_id"`
+	TargetProductID *uint     `json:"target_product_id"` // Destination of moved codes
+	Filter          string    `gorm:"type:text" json:"filter"` // JSON encoded selection
+	Affected        int       `json:"affected"`
+	Skipped         int       `json:"skipped"`
+	Note            string    `gorm:"size:500" json:"note"`
+	Admin           string    `gorm:"size:50" json:"admin"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func (CodeOperation) TableName() string { return "code_operations" }
+
+// ProductSupplier configures automatic restocking of a product from an upstream supplier
+type ProductSupplier struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	ProductID        uint       `gorm:"not null;uniqueIndex" json:"product_id"`
+	Type             string     `gorm:"size:30;not null" json:"type"`      // Connector type, e.g. http_json
+	Config           string     `gorm:"type:text" json:"config"`           // JSON connector settings
+	Enabled          bool       `gorm:"not null;default:false" json:"enabled"`
+	RestockThreshold int        `gorm:"not null;default:0" json:"restock_threshold"` // Pull codes when stock falls below this, 0 disables scheduled pulls
+	RestockQuantity  int        `gorm:"not null;default:0" json:"restock_quantity"`  // Codes requested per pull
+	OnDemand         bool       `gorm:"not null;default:false" json:"on_demand"`     // Fetch a code at purchase time when stock is empty
+	UnitCostCents    int        `gorm:"not null;default:0" json:"unit_cost_cents"`   // Purchase cost recorded on batches of pulled codes
+	LastRunAt        *time.Time `json:"last_run_at"`
+	LastError        string     `gorm:"type:text" json:"last_error"`
+	FailureCount     int        `gorm:"not null;default:0" json:"failure_count"` // Consecutive failed runs
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func (ProductSupplier) TableName() string { return "product_suppliers" }
+
+// SupplierRun records one pull of codes from a supplier
+type SupplierRun struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ProductID  uint      `gorm:"not null;index" json:"product_id"`
+	Trigger    string    `gorm:"size:20;not null" json:"trigger"` // schedule, on_demand, manual
+	Requested  int       `json:"requested"`
+	Received   int       `json:"received"`
+	Imported   int       `json:"imported"`
+	Duplicates int       `json:"duplicates"`
+	Invalid    int       `json:"invalid"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `gorm:"type:text" json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (SupplierRun) TableName() string { return "supplier_runs" }
+
+// CodeBatch records one import of codes into a product's stock and what they cost
+type CodeBatch struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ProductID     uint      `gorm:"not null;index" json:"product_id"` // Product the codes were imported into
+	Source        string    `gorm:"size:20;not null" json:"source"`   // upload, import, supplier
+	Supplier      string    `gorm:"size:200" json:"supplier"`
+	UnitCostCents int       `gorm:"not null;default:0" json:"unit_cost_cents"`
+	Quantity      int       `gorm:"not null;default:0" json:"quantity"` // Codes inserted
+	Note          string    `gorm:"size:500" json:"note"`
+	CreatedBy     string    `gorm:"size:50" json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (CodeBatch) TableName() string { return "code_batches" }
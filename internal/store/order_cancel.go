@@ -0,0 +1,192 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTooManyPendingOrders = errors.New("too many pending orders")
+	ErrLatePaymentCredited  = errors.New("late payment already credited")
+	ErrMissingTradeNo       = errors.New("payment trade number is required")
+)
+
+// GetOrderExpireHours returns how long a pending order stays payable
+func GetOrderExpireHours(db *gorm.DB) int {
+	value, err := GetSetting(db, SettingOrderExpireHours)
+	if err != nil {
+		return 24
+	}
+	hours, err := strconv.Atoi(value)
+	if err != nil || hours < 1 {
+		return 24
+	}
+	return hours
+}
+
+// ExpiresAt returns when a pending order expires given the expiry setting
+func (o *Order) ExpiresAt(expireHours int) time.Time {
+	return o.CreatedAt.Add(time.Duration(expireHours) * time.Hour)
+}
+
+// GetMaxPendingOrders returns how many pending orders a user may have at
+// once. Zero means unlimited.
+func GetMaxPendingOrders(db *gorm.DB) int {
+	value, err := GetSetting(db, SettingMaxPendingOrders)
+	if err != nil {
+		return 0
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// CheckPendingOrderLimit returns ErrTooManyPendingOrders when the user
+// already has as many pending orders as max_pending_orders allows
+func CheckPendingOrderLimit(db *gorm.DB, userID uint) error {
+	limit := GetMaxPendingOrders(db)
+	if limit == 0 {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&Order{}).Where("user_id = ? AND status = ?", userID, "pending").Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(limit) {
+		return ErrTooManyPendingOrders
+	}
+	return nil
+}
+
+// CancelPendingOrder cancels a pending order on behalf of its owner and
+// returns any balance that was deducted when the order was created
+func CancelPendingOrder(db *gorm.DB, userID, orderID uint) (*Order, error) {
+	var order Order
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+
+		result := tx.Model(&Order{}).Where("id = ? AND status = ?", order.ID, "pending").
+			Update("status", OrderStatusCancelled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrderNotPending
+		}
+		order.Status = OrderStatusCancelled
+
+		if err := releaseCodeReservation(tx, order.ID); err != nil {
+			return err
+		}
+		return releaseOrderBalance(tx, &order, fmt.Sprintf("订单 #%d 已取消，退回余额", order.ID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if order.ProductID != nil {
+		CheckStockLevel(db, *order.ProductID)
+	}
+	return &order, nil
+}
+
+// releaseOrderBalance returns the balance deducted for an unpaid order
+func releaseOrderBalance(tx *gorm.DB, order *Order, description string) error {
+	if order.BalanceUsed <= 0 {
+		return nil
+	}
+	return AddBalance(tx, order.UserID, order.BalanceUsed, "refund", description, nil, &order.ID)
+}
+
+// expireOrderWithBalance expires one pending order that used balance and
+// returns the balance and its reserved code in the same transaction
+func expireOrderWithBalance(db *gorm.DB, order *Order) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Order{}).Where("id = ? AND status = ?", order.ID, "pending").
+			Update("status", "expired")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // Paid or cancelled in the meantime
+		}
+		if err := releaseCodeReservation(tx, order.ID); err != nil {
+			return err
+		}
+		return releaseOrderBalance(tx, order, fmt.Sprintf("订单 #%d 已过期，退回余额", order.ID))
+	})
+}
+
+// CreditLatePayment credits a payment that can no longer settle its order
+// to the user's balance: a payment for an order that was cancelled or
+// expired before the user paid, or a second payment for an order already
+// paid by another trade. The trade number is recorded on the ledger entry,
+// and on the closed order, so repeated notifications are not credited twice.
+func CreditLatePayment(db *gorm.DB, order *Order, provider, tradeNo string, receivedCents int) error {
+	if tradeNo == "" {
+		return ErrMissingTradeNo
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var credited int64
+		if err := tx.Model(&BalanceTransaction{}).Where("trade_no = ?", tradeNo).Count(&credited).Error; err != nil {
+			return err
+		}
+		if credited > 0 {
+			return ErrLatePaymentCredited
+		}
+
+		// A closed order that was never paid takes the trade
+		result := tx.Model(&Order{}).
+			Where("id = ? AND status IN ? AND (epay_trade_no = '' OR epay_trade_no IS NULL)", order.ID, []string{"expired", OrderStatusCancelled}).
+			Updates(map[string]interface{}{
+				"epay_trade_no":    tradeNo,
+				"payment_provider": provider,
+				"paid_amount":      receivedCents,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		description := fmt.Sprintf("订单 #%d 关闭后收到付款，转入余额", order.ID)
+		if result.RowsAffected == 1 {
+			order.EpayTradeNo = tradeNo
+			order.PaymentProvider = provider
+			order.PaidAmount = receivedCents
+		} else {
+			// Otherwise the order was paid before, by this trade when the
+			// notification is a repeat
+			var current Order
+			if err := tx.Select("id", "epay_trade_no").First(&current, order.ID).Error; err != nil {
+				return err
+			}
+			if current.EpayTradeNo == tradeNo {
+				return ErrLatePaymentCredited
+			}
+			description = fmt.Sprintf("订单 #%d 重复付款，转入余额", order.ID)
+		}
+
+		newBalance, err := adjustBalance(tx, order.UserID, receivedCents)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&BalanceTransaction{
+			UserID:       order.UserID,
+			Type:         "refund",
+			AmountCents:  receivedCents,
+			BalanceAfter: newBalance,
+			OrderID:      &order.ID,
+			TradeNo:      &tradeNo,
+			Description:  description,
+		}).Error
+	})
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCreditLatePaymentClosedOrder(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 0)
+	order := newTestOrder(t, db, user.ID, "expired", 1200)
+
+	if err := CreditLatePayment(db, order, "epay", "T1", 1200); err != nil {
+		t.Fatalf("CreditLatePayment: %v", err)
+	}
+	if got := balanceOf(t, db, user.ID); got != 1200 {
+		t.Errorf("balance = %d, want 1200", got)
+	}
+	var stored Order
+	db.First(&stored, order.ID)
+	if stored.EpayTradeNo != "T1" || stored.PaidAmount != 1200 || stored.Status != "expired" {
+		t.Errorf("order = %+v, want trade T1 recorded on the expired order", stored)
+	}
+
+	if err := CreditLatePayment(db, order, "epay", "T1", 1200); !errors.Is(err, ErrLatePaymentCredited) {
+		t.Errorf("repeat error = %v, want %v", err, ErrLatePaymentCredited)
+	}
+	if got := balanceOf(t, db, user.ID); got != 1200 {
+		t.Errorf("balance after repeat = %d, want 1200", got)
+	}
+}
+
+func TestCreditLatePaymentSecondTrade(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 0)
+	order := newTestOrder(t, db, user.ID, "delivered", 1000)
+	db.Model(order).Update("epay_trade_no", "T1")
+
+	// The trade that paid the order is not a second payment
+	if err := CreditLatePayment(db, order, "epay", "T1", 1000); !errors.Is(err, ErrLatePaymentCredited) {
+		t.Errorf("original trade error = %v, want %v", err, ErrLatePaymentCredited)
+	}
+
+	if err := CreditLatePayment(db, order, "epay", "T2", 1000); err != nil {
+		t.Fatalf("CreditLatePayment: %v", err)
+	}
+	if err := CreditLatePayment(db, order, "epay", "T2", 1000); !errors.Is(err, ErrLatePaymentCredited) {
+		t.Errorf("repeat error = %v, want %v", err, ErrLatePaymentCredited)
+	}
+	if got := balanceOf(t, db, user.ID); got != 1000 {
+		t.Errorf("balance = %d, want 1000", got)
+	}
+	var stored Order
+	db.First(&stored, order.ID)
+	if stored.EpayTradeNo != "T1" {
+		t.Errorf("order trade = %q, want the original T1 kept", stored.EpayTradeNo)
+	}
+}
+
+func TestCreditLatePaymentRequiresTradeNo(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 0)
+	order := newTestOrder(t, db, user.ID, "cancelled", 500)
+
+	if err := CreditLatePayment(db, order, "epay", "", 500); !errors.Is(err, ErrMissingTradeNo) {
+		t.Errorf("error = %v, want %v", err, ErrMissingTradeNo)
+	}
+}
@@ -36,17 +36,72 @@ func ExpirePendingOrders(db *gorm.DB) error {
 	// Calculate expiration time
 	expirationTime := time.Now().Add(-time.Duration(expireHours) * time.Hour)
 	
-	// Update pending orders to expired
-	result := db.Model(&Order{}).
-		Where("status = ? AND created_at < ?", "pending", expirationTime).
-		Update("status", "expired")
+	// Orders that used balance are expired one by one so the balance is returned
+	var balanceOrders []Order
+	if err := db.Where("status = ? AND created_at < ? AND balance_used > 0", "pending", expirationTime).
+		Find(&balanceOrders).Error; err != nil {
+		return fmt.Errorf("failed to load orders to expire: %w", err)
+	}
+	productIDs := make(map[uint]bool)
+	for i := range balanceOrders {
+		if err := expireOrderWithBalance(db, &balanceOrders[i]); err != nil {
+			logger.Error("Failed to expire order", "order_id", balanceOrders[i].ID, "error", err)
+			continue
+		}
+		if balanceOrders[i].ProductID != nil {
+			productIDs[*balanceOrders[i].ProductID] = true
+		}
+	}
 	
-	if result.Error != nil {
-		return fmt.Errorf("failed to expire orders: %w", result.Error)
+	// Update pending orders to expired and return their reserved codes
+	var rowsAffected int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var orders []Order
+		if err := tx.Select("id", "product_id").
+			Where("status = ? AND created_at < ?", "pending", expirationTime).
+			Find(&orders).Error; err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+		
+		orderIDs := make([]uint, 0, len(orders))
+		for _, order := range orders {
+			orderIDs = append(orderIDs, order.ID)
+			if order.ProductID != nil {
+				productIDs[*order.ProductID] = true
+			}
+		}
+		
+		result := tx.Model(&Order{}).
+			Where("id IN ? AND status = ?", orderIDs, "pending").
+			Update("status", "expired")
+		if result.Error != nil {
+			return result.Error
+		}
+		rowsAffected = result.RowsAffected
+		
+		return tx.Model(&Code{}).
+			Where("reserved_order_id IN ? AND is_sold = ?", orderIDs, false).
+			Updates(map[string]interface{}{
+				"reserved_order_id": nil,
+				"reserved_until":    nil,
+			}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to expire orders: %w", err)
 	}
 	
-	if result.RowsAffected > 0 {
-		logger.Info("Expired orders", "count", result.RowsAffected)
+	if rowsAffected > 0 {
+		logger.Info("Expired orders", "count", rowsAffected)
+	}
+	
+	if err := ReleaseExpiredReservations(db); err != nil {
+		logger.Error("Failed to release expired code reservations", "error", err)
+	}
+	for productID := range productIDs {
+		CheckStockLevel(db, productID)
 	}
 	
 	return nil
@@ -98,7 +153,7 @@ func GetOrderStats(db *gorm.DB) (map[string]int64, error) {
 	stats := make(map[string]int64)
 	
 	// Count orders by status
-	statuses := []string{"pending", "paid", "delivered", "paid_no_stock", "failed_delivery", "expired"}
+	statuses := []string{"pending", "paid", "delivered", "paid_no_stock", "failed_delivery", "expired", OrderStatusPaymentMismatch, OrderStatusCancelled}
 	
 	for _, status := range statuses {
 		var count int64
@@ -125,19 +180,31 @@ func GetExpiredOrdersCount(db *gorm.DB) (int64, error) {
 	return count, err
 }
 
-// ManualExpireOrder manually expires a specific order
+// ManualExpireOrder manually expires a specific order and returns its
+// reserved code to stock
 func ManualExpireOrder(db *gorm.DB, orderID uint) error {
-	result := db.Model(&Order{}).
-		Where("id = ? AND status = ?", orderID, "pending").
-		Update("status", "expired")
-	
-	if result.Error != nil {
-		return result.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Order{}).
+			Where("id = ? AND status = ?", orderID, "pending").
+			Update("status", "expired")
+		
+		if result.Error != nil {
+			return result.Error
+		}
+		
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("order not found or not in pending status")
+		}
+		
+		return releaseCodeReservation(tx, orderID)
+	})
+	if err != nil {
+		return err
 	}
 	
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("order not found or not in pending status")
+	var order Order
+	if err := db.Select("id", "product_id").First(&order, orderID).Error; err == nil && order.ProductID != nil {
+		CheckStockLevel(db, *order.ProductID)
 	}
-	
 	return nil
 }
\ No newline at end of file
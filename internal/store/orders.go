@@ -2,12 +2,22 @@ package store
 
 import (
 	"errors"
+	"fmt"
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// Order statuses for payments whose amount did not match
+const (
+	OrderStatusPaymentMismatch = "payment_mismatch"
+	OrderStatusCancelled       = "cancelled"
+)
+
 var (
-	ErrOrderNotFound = errors.New("order not found")
-	ErrUnauthorized  = errors.New("unauthorized access")
+	ErrOrderNotFound   = errors.New("order not found")
+	ErrUnauthorized    = errors.New("unauthorized access")
+	ErrOrderNotPending = errors.New("order is not pending")
 )
 
 // GetUserOrders retrieves orders for a specific user
@@ -101,5 +111,124 @@ func GetOrderCode(db *gorm.DB, orderID uint) (string, error) {
 		}
 		return "", err
 	}
-	return code.Code, nil
-}
\ No newline at end of file
+	return RenderCode(db, &code)
+}
+// SetOrderPaymentRef records which provider and merchant order number a
+// payment was started with. Earlier numbers of the order stay valid, so a
+// payment started before a retry is still matched.
+func SetOrderPaymentRef(db *gorm.DB, orderID uint, provider, outTradeNo string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Order{}).Where("id = ?", orderID).Updates(map[string]interface{}{
+			"epay_out_trade_no": outTradeNo,
+			"payment_provider":  provider,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrderPaymentRef{
+			OrderID:    orderID,
+			Provider:   provider,
+			OutTradeNo: outTradeNo,
+		}).Error
+	})
+}
+
+// GetOrderByOutTradeNo finds an order by its latest or any earlier merchant
+// order number
+func GetOrderByOutTradeNo(db *gorm.DB, outTradeNo string) (*Order, error) {
+	var order Order
+	err := db.Preload("User").Preload("Product").
+		Where("epay_out_trade_no = ?", outTradeNo).
+		First(&order).Error
+	if err == gorm.ErrRecordNotFound {
+		var ref OrderPaymentRef
+		if err := db.Where("out_trade_no = ?", outTradeNo).First(&ref).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, ErrOrderNotFound
+			}
+			return nil, err
+		}
+		err = db.Preload("User").Preload("Product").First(&order, ref.OrderID).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrOrderNotFound
+		}
+	}
+	return &order, err
+}
+
+// CompletePaidOrder marks a pending or payment_mismatch order as paid and
+// fulfils it in one transaction: product orders claim a code, deposit orders
+// credit the balance. order.Status is updated to the final status, which is
+// either delivered or paid_no_stock. The returned code is empty for deposits
+// and when the product is out of stock.
+func CompletePaidOrder(db *gorm.DB, order *Order, provider, tradeNo string) (string, error) {
+	code, err := completePaidOrder(db, order, provider, tradeNo)
+	if err != nil {
+		return "", err
+	}
+
+	if order.ProductID != nil {
+		CheckStockLevel(db, *order.ProductID)
+	}
+	return code, nil
+}
+
+// completePaidOrder does the work of CompletePaidOrder without the stock
+// check, so settlements can run it inside their own transaction and check
+// the stock level once that has committed.
+func completePaidOrder(db *gorm.DB, order *Order, provider, tradeNo string) (string, error) {
+	var code string
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Only an unpaid order can be paid, guards against duplicate callbacks
+		result := tx.Model(&Order{}).Where("id = ? AND status IN ?", order.ID, []string{"pending", OrderStatusPaymentMismatch}).Updates(map[string]interface{}{
+			"status":           "paid",
+			"paid_amount":      order.PaymentAmount,
+			"epay_trade_no":    tradeNo,
+			"payment_provider": provider,
+			"paid_at":          &now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrderNotPending
+		}
+		order.Status = "paid"
+		order.PaidAmount = order.PaymentAmount
+		order.EpayTradeNo = tradeNo
+		order.PaymentProvider = provider
+		order.PaidAt = &now
+
+		if order.ProductID != nil {
+			// Product order - try to claim code
+			claimed, err := claimOneCode(tx, *order.ProductID, order.ID)
+			if err == ErrNoStock {
+				order.Status = "paid_no_stock"
+				return tx.Model(&Order{}).Where("id = ?", order.ID).Update("status", order.Status).Error
+			}
+			if err != nil {
+				return err
+			}
+			code = claimed
+		} else {
+			// Balance recharge
+			if err := AddBalance(tx, order.UserID, order.AmountCents, "recharge",
+				fmt.Sprintf("充值订单 #%d", order.ID), nil, &order.ID); err != nil {
+				return err
+			}
+		}
+
+		order.Status = "delivered"
+		order.DeliveredAt = &now
+		return tx.Model(&Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+			"status":       order.Status,
+			"delivered_at": &now,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetOrderByOutTradeNoKeepsEarlierRefs(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 0)
+	order := newTestOrder(t, db, user.ID, "pending", 1000)
+
+	for _, ref := range []string{"D1-100", "D1-200"} {
+		if err := SetOrderPaymentRef(db, order.ID, "epay", ref); err != nil {
+			t.Fatalf("SetOrderPaymentRef(%s): %v", ref, err)
+		}
+	}
+
+	for _, ref := range []string{"D1-100", "D1-200"} {
+		found, err := GetOrderByOutTradeNo(db, ref)
+		if err != nil {
+			t.Fatalf("GetOrderByOutTradeNo(%s): %v", ref, err)
+		}
+		if found.ID != order.ID {
+			t.Errorf("GetOrderByOutTradeNo(%s) = order %d, want %d", ref, found.ID, order.ID)
+		}
+		if found.EpayOutTradeNo != "D1-200" {
+			t.Errorf("current ref = %q, want the latest D1-200", found.EpayOutTradeNo)
+		}
+	}
+
+	if _, err := GetOrderByOutTradeNo(db, "D1-300"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("unknown ref error = %v, want %v", err, ErrOrderNotFound)
+	}
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Payment callback processing results
+const (
+	CallbackResultProcessed        = "processed"
+	CallbackResultDuplicate        = "duplicate"
+	CallbackResultInvalidSignature = "invalid_signature"
+	CallbackResultInvalidParams    = "invalid_params"
+	CallbackResultNotPaid          = "not_paid"
+	CallbackResultOrderNotFound    = "order_not_found"
+	CallbackResultFailed           = "failed"
+	CallbackResultUnknownProvider  = "unknown_provider"
+	CallbackResultAmountMismatch   = "amount_mismatch"
+)
+
+// Payment callback sources
+const (
+	CallbackSourceNotify = "notify"
+	CallbackSourceReturn = "return"
+	CallbackSourceReplay = "replay"
+)
+
+var ErrPaymentCallbackNotFound = errors.New("payment callback not found")
+
+// PaymentCallbackFilter narrows the admin callback search
+type PaymentCallbackFilter struct {
+	Provider string
+	Result   string
+	Query    string // Matches out_trade_no, trade_no or trace_id
+	OrderID  uint
+}
+
+// CreatePaymentCallback stores a callback record
+func CreatePaymentCallback(db *gorm.DB, callback *PaymentCallback) error {
+	return db.Create(callback).Error
+}
+
+// GetPaymentCallback returns a stored callback by ID
+func GetPaymentCallback(db *gorm.DB, id uint) (*PaymentCallback, error) {
+	var callback PaymentCallback
+	if err := db.First(&callback, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrPaymentCallbackNotFound
+		}
+		return nil, err
+	}
+	return &callback, nil
+}
+
+// ListPaymentCallbacks returns callbacks matching the filter, newest first
+func ListPaymentCallbacks(db *gorm.DB, filter PaymentCallbackFilter, limit, offset int) ([]PaymentCallback, int64, error) {
+	query := db.Model(&PaymentCallback{})
+	if filter.Provider != "" {
+		query = query.Where("provider = ?", filter.Provider)
+	}
+	if filter.Result != "" {
+		query = query.Where("result = ?", filter.Result)
+	}
+	if filter.OrderID != 0 {
+		query = query.Where("order_id = ?", filter.OrderID)
+	}
+	if filter.Query != "" {
+		like := "%" + filter.Query + "%"
+		query = query.Where("out_trade_no LIKE ? OR trade_no LIKE ? OR trace_id = ?", like, like, filter.Query)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var callbacks []PaymentCallback
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&callbacks).Error
+	return callbacks, total, err
+}
+
+// TradeProcessed reports whether a provider trade was already applied to an
+// order, so a repeated notification of it is not applied again
+func TradeProcessed(db *gorm.DB, orderID uint, tradeNo string) (bool, error) {
+	var count int64
+	err := db.Model(&PaymentCallback{}).
+		Where("order_id = ? AND trade_no = ? AND result IN ?", orderID, tradeNo,
+			[]string{CallbackResultProcessed, CallbackResultAmountMismatch}).
+		Count(&count).Error
+	return count > 0, err
+}
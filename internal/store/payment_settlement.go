@@ -0,0 +1,204 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Payment settlement outcomes
+const (
+	SettlementCompleted           = "completed"            // Paid in full and fulfilled
+	SettlementOverpaidCredited    = "overpaid_credited"    // Fulfilled, the excess went to the balance
+	SettlementMismatchHeld        = "mismatch_held"        // Held in payment_mismatch for an admin
+	SettlementUnderpaidCredited   = "underpaid_credited"   // Cancelled, the partial payment went to the balance
+	SettlementDifferenceRequested = "difference_requested" // Waiting for the user to pay the rest
+)
+
+var ErrNotPaymentMismatch = errors.New("order is not in payment_mismatch")
+
+// PaymentSettlement is the result of settling a provider payment against an order
+type PaymentSettlement struct {
+	Outcome       string
+	ReceivedCents int    // Amount reported by the provider
+	DueCents      int    // Amount that was due before this payment
+	CreditedCents int    // Amount credited to the user's balance
+	RemainingDue  int    // Amount still to pay for SettlementDifferenceRequested
+	Code          string // Delivered code for product orders
+}
+
+// AmountDue returns how much of the payment amount has not been received yet
+func (o *Order) AmountDue() int {
+	return o.PaymentAmount - o.PaidAmount
+}
+
+// SettlePayment verifies the received amount against what the order still
+// owes. Exact payments are fulfilled; mismatches are handled according to
+// the overpayment and underpayment settings, and anything not handled
+// automatically is held in payment_mismatch.
+func SettlePayment(db *gorm.DB, order *Order, provider, tradeNo string, receivedCents int) (*PaymentSettlement, error) {
+	settlement := &PaymentSettlement{
+		ReceivedCents: receivedCents,
+		DueCents:      order.AmountDue(),
+	}
+	overAction, underAction := GetPaymentMismatchActions(db)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		switch {
+		case receivedCents == settlement.DueCents:
+			code, err := completePaidOrder(tx, order, provider, tradeNo)
+			if err != nil {
+				return err
+			}
+			settlement.Outcome = SettlementCompleted
+			settlement.Code = code
+			return nil
+
+		case receivedCents > settlement.DueCents && overAction == MismatchActionCredit:
+			code, err := completePaidOrder(tx, order, provider, tradeNo)
+			if err != nil {
+				return err
+			}
+			excess := receivedCents - settlement.DueCents
+			if err := AddBalance(tx, order.UserID, excess, "refund",
+				fmt.Sprintf("订单 #%d 超额支付退回", order.ID), nil, &order.ID); err != nil {
+				return err
+			}
+			settlement.Outcome = SettlementOverpaidCredited
+			settlement.Code = code
+			settlement.CreditedCents = excess
+			return nil
+		}
+
+		if err := markPaymentMismatch(tx, order, provider, tradeNo, receivedCents); err != nil {
+			return err
+		}
+
+		if receivedCents < settlement.DueCents {
+			switch underAction {
+			case MismatchActionCredit:
+				credited, err := creditMismatchedOrder(tx, order, fmt.Sprintf("订单 #%d 支付金额不足，已付金额退回", order.ID))
+				if err != nil {
+					return err
+				}
+				settlement.Outcome = SettlementUnderpaidCredited
+				settlement.CreditedCents = credited
+				return nil
+			case MismatchActionRequestDifference:
+				settlement.Outcome = SettlementDifferenceRequested
+				settlement.RemainingDue = order.AmountDue()
+				return nil
+			}
+		}
+
+		settlement.Outcome = SettlementMismatchHeld
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if order.ProductID != nil {
+		CheckStockLevel(db, *order.ProductID)
+	}
+	return settlement, nil
+}
+
+// markPaymentMismatch records a payment that does not match the amount due
+func markPaymentMismatch(tx *gorm.DB, order *Order, provider, tradeNo string, receivedCents int) error {
+	now := time.Now()
+	result := tx.Model(&Order{}).Where("id = ? AND status IN ?", order.ID, []string{"pending", OrderStatusPaymentMismatch}).Updates(map[string]interface{}{
+		"status":           OrderStatusPaymentMismatch,
+		"paid_amount":      gorm.Expr("paid_amount + ?", receivedCents),
+		"epay_trade_no":    tradeNo,
+		"payment_provider": provider,
+		"paid_at":          &now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrderNotPending
+	}
+
+	order.Status = OrderStatusPaymentMismatch
+	order.PaidAmount += receivedCents
+	order.EpayTradeNo = tradeNo
+	order.PaymentProvider = provider
+	order.PaidAt = &now
+	return nil
+}
+
+// creditMismatchedOrder moves everything received for a mismatched order,
+// including any balance used, to the user's balance and cancels the order
+func creditMismatchedOrder(tx *gorm.DB, order *Order, description string) (int, error) {
+	result := tx.Model(&Order{}).Where("id = ? AND status = ?", order.ID, OrderStatusPaymentMismatch).
+		Update("status", OrderStatusCancelled)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, ErrNotPaymentMismatch
+	}
+	if err := releaseCodeReservation(tx, order.ID); err != nil {
+		return 0, err
+	}
+
+	// Balance deducted when the order was created is returned as well
+	credited := order.PaidAmount + order.BalanceUsed
+	if credited > 0 {
+		if err := AddBalance(tx, order.UserID, credited, "refund", description, nil, &order.ID); err != nil {
+			return 0, err
+		}
+	}
+	order.Status = OrderStatusCancelled
+	return credited, nil
+}
+
+// DeliverMismatchedOrder accepts a mismatched payment as final and fulfils
+// the order. Any amount received above the payment amount is credited to
+// the user's balance. It returns the delivered code and the credited excess.
+func DeliverMismatchedOrder(db *gorm.DB, order *Order) (string, int, error) {
+	if order.Status != OrderStatusPaymentMismatch {
+		return "", 0, ErrNotPaymentMismatch
+	}
+
+	var code string
+	excess := order.PaidAmount - order.PaymentAmount
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		code, err = completePaidOrder(tx, order, order.PaymentProvider, order.EpayTradeNo)
+		if err != nil {
+			return err
+		}
+		if excess > 0 {
+			return AddBalance(tx, order.UserID, excess, "refund",
+				fmt.Sprintf("订单 #%d 超额支付退回", order.ID), nil, &order.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	if order.ProductID != nil {
+		CheckStockLevel(db, *order.ProductID)
+	}
+	if excess < 0 {
+		excess = 0
+	}
+	return code, excess, nil
+}
+
+// CreditMismatchedOrder cancels a mismatched order and credits everything
+// received for it to the user's balance
+func CreditMismatchedOrder(db *gorm.DB, order *Order) (int, error) {
+	var credited int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		credited, err = creditMismatchedOrder(tx, order, fmt.Sprintf("订单 #%d 支付金额异常，已付金额退回", order.ID))
+		return err
+	})
+	return credited, err
+}
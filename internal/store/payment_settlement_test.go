@@ -0,0 +1,83 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSettlePaymentExact(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 0)
+	order := newTestOrder(t, db, user.ID, "pending", 1000)
+
+	settlement, err := SettlePayment(db, order, "epay", "T1", 1000)
+	if err != nil {
+		t.Fatalf("SettlePayment: %v", err)
+	}
+	if settlement.Outcome != SettlementCompleted {
+		t.Errorf("outcome = %q, want %q", settlement.Outcome, SettlementCompleted)
+	}
+	if got := balanceOf(t, db, user.ID); got != 1000 {
+		t.Errorf("balance = %d, want the deposit of 1000", got)
+	}
+}
+
+func TestSettlePaymentIdempotent(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 0)
+	order := newTestOrder(t, db, user.ID, "pending", 1000)
+
+	if _, err := SettlePayment(db, order, "epay", "T1", 1000); err != nil {
+		t.Fatalf("SettlePayment: %v", err)
+	}
+
+	// A repeated notification works on a fresh copy of the pending order
+	var stale Order
+	db.First(&stale, order.ID)
+	stale.Status = "pending"
+	if _, err := SettlePayment(db, &stale, "epay", "T1", 1000); !errors.Is(err, ErrOrderNotPending) {
+		t.Errorf("repeat error = %v, want %v", err, ErrOrderNotPending)
+	}
+	if got := balanceOf(t, db, user.ID); got != 1000 {
+		t.Errorf("balance = %d, want the deposit credited once", got)
+	}
+}
+
+func TestSettlePaymentOverpaidCredited(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 0)
+	order := newTestOrder(t, db, user.ID, "pending", 1000)
+
+	settlement, err := SettlePayment(db, order, "epay", "T1", 1500)
+	if err != nil {
+		t.Fatalf("SettlePayment: %v", err)
+	}
+	if settlement.Outcome != SettlementOverpaidCredited || settlement.CreditedCents != 500 {
+		t.Errorf("settlement = %+v, want 500 overpaid credited", settlement)
+	}
+	if got := balanceOf(t, db, user.ID); got != 1500 {
+		t.Errorf("balance = %d, want 1500", got)
+	}
+}
+
+func TestSettlePaymentUnderpaidHeld(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 0)
+	order := newTestOrder(t, db, user.ID, "pending", 1000)
+
+	settlement, err := SettlePayment(db, order, "epay", "T1", 400)
+	if err != nil {
+		t.Fatalf("SettlePayment: %v", err)
+	}
+	if settlement.Outcome != SettlementMismatchHeld {
+		t.Errorf("outcome = %q, want %q", settlement.Outcome, SettlementMismatchHeld)
+	}
+	var stored Order
+	db.First(&stored, order.ID)
+	if stored.Status != OrderStatusPaymentMismatch || stored.PaidAmount != 400 || stored.AmountDue() != 600 {
+		t.Errorf("order = %+v, want payment_mismatch with 600 due", stored)
+	}
+	if got := balanceOf(t, db, user.ID); got != 0 {
+		t.Errorf("balance = %d, want 0 while held", got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"shop-bot/internal/auth"
 	"shop-bot/internal/config"
 )
 
@@ -15,93 +16,143 @@ var (
 	ErrClaimFailed = errors.New("failed to claim code")
 )
 
-// CountAvailableCodes returns the number of unsold codes for a product
+// availableCodes limits a query to codes that can be sold or reserved now:
+// unsold, available, not expired and not held by an unexpired reservation
+func availableCodes(db *gorm.DB) *gorm.DB {
+	now := time.Now()
+	return db.Where("is_sold = ? AND status = ? AND (reserved_order_id IS NULL OR reserved_until < ?) AND (expires_at IS NULL OR expires_at > ?)",
+		false, CodeStatusAvailable, now, now)
+}
+
+// CountAvailableCodes returns the number of unsold, unexpired codes for a
+// product that are not reserved for a pending order
 func CountAvailableCodes(db *gorm.DB, productID uint) (int64, error) {
 	var count int64
-	err := db.Model(&Code{}).
-		Where("product_id = ? AND is_sold = ?", productID, false).
+	err := availableCodes(db.Model(&Code{}).Where("product_id = ?", productID)).
 		Count(&count).Error
 	return count, err
 }
 
-// ClaimOneCodeTx claims one available code for an order with concurrency safety
+// ClaimOneCodeTx claims one available code for an order with concurrency
+// safety. The code reserved for the order is used when it is still there and
+// has not expired, otherwise the code expiring first is claimed.
 func ClaimOneCodeTx(ctx context.Context, db *gorm.DB, productID uint, orderID uint) (string, error) {
 	var claimedCode string
-	
 	err := db.Transaction(func(tx *gorm.DB) error {
-		if IsPostgres(db) {
-			// PostgreSQL: Use FOR UPDATE SKIP LOCKED for better concurrency
-			var code Code
-			err := tx.Raw(`
-				SELECT * FROM codes 
-				WHERE product_id = ? AND is_sold = false 
-				LIMIT 1 
-				FOR UPDATE SKIP LOCKED
-			`, productID).Scan(&code).Error
-			
-			if err != nil {
-				if err == gorm.ErrRecordNotFound {
-					return ErrNoStock
-				}
-				return err
-			}
-			
-			// Update the code as sold
-			result := tx.Model(&Code{}).
-				Where("id = ?", code.ID).
-				Updates(map[string]interface{}{
-					"is_sold": true,
-					"sold_at": gorm.Expr("NOW()"),
-					"order_id": orderID,
-				})
-				
-			if result.Error != nil {
-				return result.Error
-			}
-			
-			claimedCode = code.Code
-			
-		} else {
-			// SQLite: Use UPDATE with LIMIT and check affected rows
-			result := tx.Exec(`
-				UPDATE codes 
-				SET is_sold = 1, sold_at = CURRENT_TIMESTAMP, order_id = ?
-				WHERE id IN (
-					SELECT id FROM codes 
-					WHERE product_id = ? AND is_sold = 0 
-					LIMIT 1
-				)
-			`, orderID, productID)
-			
-			if result.Error != nil {
-				return result.Error
-			}
-			
-			if result.RowsAffected == 0 {
-				return ErrNoStock
-			}
-			
-			// Fetch the claimed code
-			var code Code
-			err := tx.Where("order_id = ?", orderID).First(&code).Error
-			if err != nil {
-				return fmt.Errorf("failed to fetch claimed code: %w", err)
+		code, err := claimOneCode(tx, productID, orderID)
+		claimedCode = code
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	
+	CheckStockLevel(db, productID)
+	return claimedCode, nil
+}
+
+// claimOneCode claims a code within the caller's transaction and returns it
+// rendered for delivery. The caller checks the stock level once the
+// transaction is committed.
+func claimOneCode(tx *gorm.DB, productID uint, orderID uint) (string, error) {
+	now := time.Now()
+	var code Code
+	
+	// Prefer the code reserved when the order was created
+	result := tx.Model(&Code{}).
+		Where("reserved_order_id = ? AND product_id = ? AND is_sold = ? AND status = ?", orderID, productID, false, CodeStatusAvailable).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Updates(map[string]interface{}{
+			"is_sold":           true,
+			"sold_at":           time.Now(),
+			"order_id":          orderID,
+			"reserved_order_id": nil,
+			"reserved_until":    nil,
+		})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	
+	if result.RowsAffected > 0 {
+		if err := tx.Where("order_id = ?", orderID).First(&code).Error; err != nil {
+			return "", fmt.Errorf("failed to fetch claimed code: %w", err)
+		}
+	} else if IsPostgres(tx) {
+		// PostgreSQL: Use FOR UPDATE SKIP LOCKED for better concurrency
+		err := tx.Raw(`
+			SELECT * FROM codes 
+			WHERE product_id = ? AND is_sold = false AND status = ?
+				AND (reserved_order_id IS NULL OR reserved_until < ?)
+				AND (expires_at IS NULL OR expires_at > ?)
+			ORDER BY `+codeFEFOOrder+`
+			LIMIT 1 
+			FOR UPDATE SKIP LOCKED
+		`, productID, CodeStatusAvailable, now, now).Scan(&code).Error
+		
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return "", ErrNoStock
 			}
+			return "", err
+		}
+		if code.ID == 0 {
+			return "", ErrNoStock
+		}
+		
+		// Update the code as sold
+		result := tx.Model(&Code{}).
+			Where("id = ?", code.ID).
+			Updates(map[string]interface{}{
+				"is_sold": true,
+				"sold_at": gorm.Expr("NOW()"),
+				"order_id": orderID,
+				"reserved_order_id": nil,
+				"reserved_until": nil,
+			})
 			
-			claimedCode = code.Code
+		if result.Error != nil {
+			return "", result.Error
 		}
 		
-		return nil
-	})
+	} else {
+		// SQLite: Use UPDATE with LIMIT and check affected rows
+		result := tx.Exec(`
+			UPDATE codes 
+			SET is_sold = 1, sold_at = CURRENT_TIMESTAMP, order_id = ?,
+				reserved_order_id = NULL, reserved_until = NULL
+			WHERE id IN (
+				SELECT id FROM codes 
+				WHERE product_id = ? AND is_sold = 0 AND status = ?
+					AND (reserved_order_id IS NULL OR reserved_until < ?)
+					AND (expires_at IS NULL OR expires_at > ?)
+				ORDER BY `+codeFEFOOrder+`
+				LIMIT 1
+			)
+		`, orderID, productID, CodeStatusAvailable, now, now)
+		
+		if result.Error != nil {
+			return "", result.Error
+		}
+		
+		if result.RowsAffected == 0 {
+			return "", ErrNoStock
+		}
+		
+		// Fetch the claimed code
+		err := tx.Where("order_id = ?", orderID).First(&code).Error
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch claimed code: %w", err)
+		}
+	}
 	
+	// Codes are only decrypted, and structured codes rendered, when they are delivered
+	rendered, err := RenderCode(tx, &code)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to render claimed code: %w", err)
 	}
-	
-	return claimedCode, nil
+	return rendered, nil
 }
 
-// GetProduct fetches a product by ID
 func GetProduct(db *gorm.DB, productID uint) (*Product, error) {
 	var product Product
 	err := db.First(&product, productID).Error
@@ -169,7 +220,8 @@ func GetOrCreateUserWithStatus(db *gorm.DB, tgUserID int64, username string) (*U
 	return &user, true, nil
 }
 
-// CreateOrder creates a new order
+// CreateOrder creates a new order and reserves a code for it. It returns
+// ErrNoStock when no code can be reserved.
 func CreateOrder(db *gorm.DB, userID, productID uint, amountCents int) (*Order, error) {
 	// Generate unique out_trade_no at creation time
 	tempID := fmt.Sprintf("%d-%d-%d", userID, productID, time.Now().UnixNano())
@@ -183,17 +235,27 @@ func CreateOrder(db *gorm.DB, userID, productID uint, amountCents int) (*Order,
 		EpayOutTradeNo: tempID, // Temporary unique ID, will be updated when payment is initiated
 	}
 	
-	if err := db.Create(order).Error; err != nil {
+	reservedUntil := time.Now().Add(time.Duration(GetOrderExpireHours(db)) * time.Hour)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		return reserveCodeTx(tx, productID, order.ID, reservedUntil)
+	})
+	if err != nil {
 		return nil, err
 	}
 	
+	CheckStockLevel(db, productID)
 	return order, nil
 }
 
-// CreateOrderWithBalance creates an order with balance deduction
+// CreateOrderWithBalance creates an order with balance deduction and
+// reserves a code for it. It returns ErrNoStock when no code can be reserved.
 func CreateOrderWithBalance(db *gorm.DB, userID, productID uint, amountCents int, useBalance bool) (*Order, error) {
 	var order *Order
 	
+	reservedUntil := time.Now().Add(time.Duration(GetOrderExpireHours(db)) * time.Hour)
 	err := db.Transaction(func(tx *gorm.DB) error {
 		// Get user balance
 		var user User
@@ -232,6 +294,9 @@ func CreateOrderWithBalance(db *gorm.DB, userID, productID uint, amountCents int
 		if err := tx.Create(order).Error; err != nil {
 			return err
 		}
+		if err := reserveCodeTx(tx, productID, order.ID, reservedUntil); err != nil {
+			return err
+		}
 		
 		// If using balance, deduct it immediately
 		if balanceUsed > 0 {
@@ -258,6 +323,7 @@ func CreateOrderWithBalance(db *gorm.DB, userID, productID uint, amountCents int
 		return nil, err
 	}
 	
+	CheckStockLevel(db, productID)
 	return order, nil
 }
 
@@ -378,6 +444,8 @@ func InitializeAdminsFromConfig(db *gorm.DB, cfg *config.Config) error {
 				TelegramID:          &telegramID,
 				ReceiveNotifications: true,
 				IsActive:            true,
+				IsSuperAdmin:        true, // Admins listed in the environment are trusted with everything
+				Role:                auth.RoleSuperAdmin,
 			}
 
 			// Check if username already exists
@@ -42,6 +42,9 @@ func SeedData(db *gorm.DB) error {
 		
 		// Create test codes for each product
 		codes := generateTestCodes(p.ID, 10)
+		if err := EncryptCodes(codes); err != nil {
+			return fmt.Errorf("failed to encrypt codes for product %s: %w", p.Name, err)
+		}
 		if err := db.Create(&codes).Error; err != nil {
 			return fmt.Errorf("failed to create codes for product %s: %w", p.Name, err)
 		}
@@ -59,6 +62,7 @@ func generateTestCodes(productID uint, count int) []Code {
 			ProductID: productID,
 			Code:      fmt.Sprintf("TEST-%d-%04d", productID, i+1),
 			IsSold:    false,
+			Status:    CodeStatusAvailable,
 		}
 	}
 	return codes
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	logger "shop-bot/internal/log"
+)
+
+var ErrInvalidLowStockThreshold = errors.New("low-stock threshold must be between 0 and 100000")
+
+// StockAlert is raised when a product's available stock falls to its
+// low-stock threshold, and again when it recovers above it
+type StockAlert struct {
+	ProductID   uint
+	ProductName string
+	Stock       int64
+	Threshold   int
+	Recovered   bool
+}
+
+// stockAlertHook delivers stock alerts, typically to the admin notifier
+var stockAlertHook func(StockAlert)
+
+// SetStockAlertHook sets the function that receives low-stock alerts.
+// The hook runs in its own goroutine.
+func SetStockAlertHook(hook func(StockAlert)) {
+	stockAlertHook = hook
+}
+
+// CheckStockLevel compares a product's available stock with its low-stock
+// threshold. The alerted flag is flipped with a conditional update so that
+// concurrent claims and uploads raise one alert per crossing. Call it with
+// the outer db once the stock change is committed, never inside a
+// transaction, so a rolled back change raises no alert.
+func CheckStockLevel(db *gorm.DB, productID uint) {
+	if stockAlertHook == nil {
+		return
+	}
+
+	var product Product
+	if err := db.Select("id", "name", "low_stock_threshold", "low_stock_alerted").First(&product, productID).Error; err != nil {
+		logger.Error("Failed to load product for stock check", "error", err, "product_id", productID)
+		return
+	}
+	if product.LowStockThreshold <= 0 && !product.LowStockAlerted {
+		return
+	}
+
+	stock, err := CountAvailableCodes(db, productID)
+	if err != nil {
+		logger.Error("Failed to count stock", "error", err, "product_id", productID)
+		return
+	}
+
+	low := product.LowStockThreshold > 0 && stock <= int64(product.LowStockThreshold)
+	if low == product.LowStockAlerted {
+		return
+	}
+	result := db.Model(&Product{}).Where("id = ? AND low_stock_alerted = ?", productID, !low).
+		UpdateColumn("low_stock_alerted", low)
+	if result.Error != nil {
+		logger.Error("Failed to update low-stock flag", "error", result.Error, "product_id", productID)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return // Another claim or upload already handled this crossing
+	}
+	if !low && product.LowStockThreshold <= 0 {
+		return // Alerts were switched off, nothing recovered
+	}
+
+	alert := StockAlert{
+		ProductID:   product.ID,
+		ProductName: product.Name,
+		Stock:       stock,
+		Threshold:   product.LowStockThreshold,
+		Recovered:   !low,
+	}
+	go stockAlertHook(alert)
+}
+
+// SetLowStockThreshold changes a product's threshold and re-evaluates its stock
+func SetLowStockThreshold(db *gorm.DB, productID uint, threshold int) error {
+	if threshold < 0 || threshold > 100000 {
+		return ErrInvalidLowStockThreshold
+	}
+	if err := db.Model(&Product{}).Where("id = ?", productID).
+		Update("low_stock_threshold", threshold).Error; err != nil {
+		return err
+	}
+	CheckStockLevel(db, productID)
+	return nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestCompletePaidOrderRaisesStockAlertAfterCommit(t *testing.T) {
+	db := newTestDB(t)
+	product, _ := newTestCodes(t, db, "alert", 2)
+	if err := db.Model(product).Update("low_stock_threshold", 1).Error; err != nil {
+		t.Fatalf("set threshold: %v", err)
+	}
+
+	alerts := make(chan StockAlert, 4)
+	SetStockAlertHook(func(alert StockAlert) { alerts <- alert })
+	t.Cleanup(func() { SetStockAlertHook(nil) })
+
+	user := newTestUser(t, db, 1, 0)
+	order := &Order{UserID: user.ID, ProductID: &product.ID, AmountCents: 100, PaymentAmount: 100, Status: "pending", EpayOutTradeNo: "alert-1"}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := CompletePaidOrder(db, order, "epay", "T1"); err != nil {
+		t.Fatalf("complete order: %v", err)
+	}
+
+	select {
+	case alert := <-alerts:
+		if alert.ProductID != product.ID || alert.Stock != 1 || alert.Recovered {
+			t.Fatalf("alert = %+v, want low stock of 1", alert)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no stock alert after the order was completed")
+	}
+
+	var stored Product
+	if err := db.First(&stored, product.ID).Error; err != nil {
+		t.Fatalf("load product: %v", err)
+	}
+	if !stored.LowStockAlerted {
+		t.Fatal("low-stock flag was not committed")
+	}
+}
+
+func TestRolledBackSettlementRaisesNoStockAlert(t *testing.T) {
+	db := newTestDB(t)
+	product, codes := newTestCodes(t, db, "rollback", 2)
+	if err := db.Model(product).Update("low_stock_threshold", 1).Error; err != nil {
+		t.Fatalf("set threshold: %v", err)
+	}
+
+	alerts := make(chan StockAlert, 4)
+	SetStockAlertHook(func(alert StockAlert) { alerts <- alert })
+	t.Cleanup(func() { SetStockAlertHook(nil) })
+
+	// Crediting the overpayment fails after the code has been claimed
+	errCredit := errors.New("balance write failed")
+	if err := db.Callback().Create().Before("gorm:create").Register("test:fail_balance", func(tx *gorm.DB) {
+		if tx.Statement.Table == "balance_transactions" {
+			tx.AddError(errCredit)
+		}
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	user := newTestUser(t, db, 1, 0)
+	order := &Order{UserID: user.ID, ProductID: &product.ID, AmountCents: 100, PaymentAmount: 100, Status: "pending", EpayOutTradeNo: "rollback-1"}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := SettlePayment(db, order, "epay", "T1", 150); !errors.Is(err, errCredit) {
+		t.Fatalf("settle error = %v, want %v", err, errCredit)
+	}
+
+	var stored Product
+	if err := db.First(&stored, product.ID).Error; err != nil {
+		t.Fatalf("load product: %v", err)
+	}
+	if stored.LowStockAlerted {
+		t.Fatal("low-stock flag set by a rolled back settlement")
+	}
+	var sold int64
+	db.Model(&Code{}).Where("id IN ? AND is_sold = ?", []uint{codes[0].ID, codes[1].ID}, true).Count(&sold)
+	if sold != 0 {
+		t.Fatalf("%d codes sold by a rolled back settlement", sold)
+	}
+
+	select {
+	case alert := <-alerts:
+		t.Fatalf("alert %+v raised by a rolled back settlement", alert)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// What started a supplier pull
+const (
+	SupplierTriggerSchedule = "schedule"  // Stock fell below the restock threshold
+	SupplierTriggerOnDemand = "on_demand" // A buyer found the product out of stock
+	SupplierTriggerManual   = "manual"    // An admin asked for a pull
+)
+
+// maxRestockQuantity caps the codes requested from a supplier in one pull
+const maxRestockQuantity = 1000
+
+var ErrInvalidRestockSettings = errors.New("restock threshold must be between 0 and 100000 and quantity between 1 and 1000")
+
+// GetProductSupplier returns the supplier configured for a product
+func GetProductSupplier(db *gorm.DB, productID uint) (*ProductSupplier, error) {
+	var supplier ProductSupplier
+	if err := db.Where("product_id = ?", productID).First(&supplier).Error; err != nil {
+		return nil, err
+	}
+	return &supplier, nil
+}
+
+// SaveProductSupplier creates or replaces the supplier of a product. The
+// run status of an existing supplier is kept.
+func SaveProductSupplier(db *gorm.DB, supplier *ProductSupplier) error {
+	if supplier.RestockThreshold < 0 || supplier.RestockThreshold > 100000 ||
+		supplier.RestockQuantity < 1 || supplier.RestockQuantity > maxRestockQuantity {
+		return ErrInvalidRestockSettings
+	}
+	if supplier.UnitCostCents < 0 {
+		return ErrInvalidUnitCost
+	}
+
+	existing, err := GetProductSupplier(db, supplier.ProductID)
+	if err == gorm.ErrRecordNotFound {
+		return db.Create(supplier).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	supplier.ID = existing.ID
+	return db.Model(existing).Select("type", "config", "enabled", "restock_threshold", "restock_quantity", "on_demand", "unit_cost_cents").
+		Updates(supplier).Error
+}
+
+// DeleteProductSupplier removes the supplier of a product, its run history is kept
+func DeleteProductSupplier(db *gorm.DB, productID uint) error {
+	return db.Where("product_id = ?", productID).Delete(&ProductSupplier{}).Error
+}
+
+// ListEnabledSuppliers returns every enabled supplier
+func ListEnabledSuppliers(db *gorm.DB) ([]ProductSupplier, error) {
+	var suppliers []ProductSupplier
+	err := db.Where("enabled = ?", true).Order("product_id").Find(&suppliers).Error
+	return suppliers, err
+}
+
+// RecordSupplierRun stores a pull and updates the supplier's status. It
+// returns the number of consecutive failed runs, zero after a success.
+func RecordSupplierRun(db *gorm.DB, run *SupplierRun) (int, error) {
+	failures := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(run).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"last_run_at":   time.Now(),
+			"last_error":    run.Error,
+			"failure_count": 0,
+		}
+		if run.Error != "" {
+			updates["failure_count"] = gorm.Expr("failure_count + 1")
+		}
+		if err := tx.Model(&ProductSupplier{}).Where("product_id = ?", run.ProductID).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if run.Error == "" {
+			return nil
+		}
+		return tx.Model(&ProductSupplier{}).Where("product_id = ?", run.ProductID).
+			Pluck("failure_count", &failures).Error
+	})
+	return failures, err
+}
+
+// ListSupplierRuns returns the latest pulls for a product
+func ListSupplierRuns(db *gorm.DB, productID uint, limit int) ([]SupplierRun, error) {
+	var runs []SupplierRun
+	err := db.Where("product_id = ?", productID).Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
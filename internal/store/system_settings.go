@@ -1,6 +1,9 @@
 package store
 
 import (
+	"strconv"
+	"strings"
+
 	"gorm.io/gorm"
 )
 
@@ -10,6 +13,38 @@ const (
 	SettingOrderCleanupDays   = "order_cleanup_days"
 	SettingEnableAutoExpire   = "enable_auto_expire"
 	SettingEnableAutoCleanup  = "enable_auto_cleanup"
+	SettingMaxPendingOrders   = "max_pending_orders"
+
+	// Inventory settings
+	SettingCodeDuplicateScope = "code_duplicate_scope"
+	SettingCodeHashKeyCheck   = "code_hash_key_check" // Maintained by RehashCodes, not edited by admins
+
+	// Balance transfer settings
+	SettingEnableTransfer          = "enable_balance_transfer"
+	SettingTransferMinCents        = "transfer_min_cents"
+	SettingTransferDailyLimitCents = "transfer_daily_limit_cents"
+
+	// Withdrawal settings
+	SettingEnableWithdrawal   = "enable_withdrawal"
+	SettingWithdrawMinCents   = "withdraw_min_cents"
+
+	// Payment settings
+	SettingPaymentProviders  = "payment_providers"
+	SettingTelegramStarsRate = "telegram_stars_rate"
+
+	// Payment amount mismatch handling
+	SettingOverpaymentAction  = "overpayment_action"
+	SettingUnderpaymentAction = "underpayment_action"
+
+	// Admin login settings
+	SettingDisableTokenLogin = "disable_token_login" // Refuse ADMIN_TOKEN logins once a super admin has 2FA
+)
+
+// Payment mismatch actions
+const (
+	MismatchActionHold              = "hold"               // Keep the order in payment_mismatch for an admin
+	MismatchActionCredit            = "credit"             // Credit the excess, or the whole partial payment, to the balance
+	MismatchActionRequestDifference = "request_difference" // Ask the user to pay the missing amount
 )
 
 // GetSetting retrieves a setting by key
@@ -28,6 +63,30 @@ func GetSetting(db *gorm.DB, key string) (string, error) {
 				return "true", nil
 			case SettingEnableAutoCleanup:
 				return "true", nil
+			case SettingMaxPendingOrders:
+				return "3", nil
+			case SettingCodeDuplicateScope:
+				return CodeDuplicateScopeProduct, nil
+			case SettingEnableTransfer:
+				return "true", nil
+			case SettingTransferMinCents:
+				return "100", nil
+			case SettingTransferDailyLimitCents:
+				return "100000", nil
+			case SettingEnableWithdrawal:
+				return "true", nil
+			case SettingWithdrawMinCents:
+				return "1000", nil
+			case SettingPaymentProviders:
+				return "epay", nil
+			case SettingTelegramStarsRate:
+				return "0", nil
+			case SettingOverpaymentAction:
+				return MismatchActionCredit, nil
+			case SettingUnderpaymentAction:
+				return MismatchActionHold, nil
+			case SettingDisableTokenLogin:
+				return "false", nil
 			default:
 				return "", nil
 			}
@@ -100,6 +159,78 @@ func InitializeSettings(db *gorm.DB) error {
 			Description: "启用过期订单自动清理",
 			Type:        "bool",
 		},
+		{
+			Key:         SettingMaxPendingOrders,
+			Value:       "3",
+			Description: "每个用户同时待支付的订单上限（0 表示不限制）",
+			Type:        "int",
+		},
+		{
+			Key:         SettingCodeDuplicateScope,
+			Value:       CodeDuplicateScopeProduct,
+			Description: "卡密查重范围（product 同一商品内，global 全部商品；global 仅在导入时检查）",
+			Type:        "string",
+		},
+		{
+			Key:         SettingEnableTransfer,
+			Value:       "true",
+			Description: "启用用户间余额转账",
+			Type:        "bool",
+		},
+		{
+			Key:         SettingTransferMinCents,
+			Value:       "100",
+			Description: "单笔转账最低金额（分）",
+			Type:        "int",
+		},
+		{
+			Key:         SettingTransferDailyLimitCents,
+			Value:       "100000",
+			Description: "每日转账限额（分）",
+			Type:        "int",
+		},
+		{
+			Key:         SettingEnableWithdrawal,
+			Value:       "true",
+			Description: "启用余额提现申请",
+			Type:        "bool",
+		},
+		{
+			Key:         SettingWithdrawMinCents,
+			Value:       "1000",
+			Description: "单笔提现最低金额（分）",
+			Type:        "int",
+		},
+		{
+			Key:         SettingPaymentProviders,
+			Value:       "epay",
+			Description: "启用的支付渠道（逗号分隔，按显示顺序）",
+			Type:        "string",
+		},
+		{
+			Key:         SettingTelegramStarsRate,
+			Value:       "0",
+			Description: "每 1 单位基础货币对应的 Telegram Stars 数量（0 表示未配置）",
+			Type:        "float",
+		},
+		{
+			Key:         SettingOverpaymentAction,
+			Value:       MismatchActionCredit,
+			Description: "超额支付处理方式（credit 发货并将多付金额转入余额，hold 转人工处理）",
+			Type:        "string",
+		},
+		{
+			Key:         SettingUnderpaymentAction,
+			Value:       MismatchActionHold,
+			Description: "少付处理方式（hold 转人工处理，credit 将已付金额转入余额，request_difference 请用户补差价）",
+			Type:        "string",
+		},
+		{
+			Key:         SettingDisableTokenLogin,
+			Value:       "false",
+			Description: "有超级管理员启用两步验证后禁止使用 ADMIN_TOKEN 登录",
+			Type:        "bool",
+		},
 	}
 	
 	for _, s := range defaultSettings {
@@ -145,6 +276,88 @@ func GetSettingsMap(db *gorm.DB) (map[string]string, error) {
 	if _, ok := result[SettingEnableAutoCleanup]; !ok {
 		result[SettingEnableAutoCleanup] = "true"
 	}
+	if _, ok := result[SettingMaxPendingOrders]; !ok {
+		result[SettingMaxPendingOrders] = "3"
+	}
+	if _, ok := result[SettingCodeDuplicateScope]; !ok {
+		result[SettingCodeDuplicateScope] = CodeDuplicateScopeProduct
+	}
+	if _, ok := result[SettingEnableTransfer]; !ok {
+		result[SettingEnableTransfer] = "true"
+	}
+	if _, ok := result[SettingTransferMinCents]; !ok {
+		result[SettingTransferMinCents] = "100"
+	}
+	if _, ok := result[SettingTransferDailyLimitCents]; !ok {
+		result[SettingTransferDailyLimitCents] = "100000"
+	}
+	if _, ok := result[SettingEnableWithdrawal]; !ok {
+		result[SettingEnableWithdrawal] = "true"
+	}
+	if _, ok := result[SettingWithdrawMinCents]; !ok {
+		result[SettingWithdrawMinCents] = "1000"
+	}
+	if _, ok := result[SettingPaymentProviders]; !ok {
+		result[SettingPaymentProviders] = "epay"
+	}
+	if _, ok := result[SettingTelegramStarsRate]; !ok {
+		result[SettingTelegramStarsRate] = "0"
+	}
+	if _, ok := result[SettingOverpaymentAction]; !ok {
+		result[SettingOverpaymentAction] = MismatchActionCredit
+	}
+	if _, ok := result[SettingUnderpaymentAction]; !ok {
+		result[SettingUnderpaymentAction] = MismatchActionHold
+	}
+	if _, ok := result[SettingDisableTokenLogin]; !ok {
+		result[SettingDisableTokenLogin] = "false"
+	}
 	
 	return result, nil
-}
\ No newline at end of file
+}
+
+// GetEnabledPaymentProviders returns the names of the payment providers
+// offered at checkout, in display order
+func GetEnabledPaymentProviders(db *gorm.DB) []string {
+	value, err := GetSetting(db, SettingPaymentProviders)
+	if err != nil {
+		value = "epay"
+	}
+
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// GetTelegramStarsRate returns how many Telegram Stars one unit of the base
+// currency costs. Zero means Stars checkout is not configured.
+func GetTelegramStarsRate(db *gorm.DB) float64 {
+	value, err := GetSetting(db, SettingTelegramStarsRate)
+	if err != nil {
+		return 0
+	}
+
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 {
+		return 0
+	}
+	return rate
+}
+
+// GetPaymentMismatchActions returns how overpaid and underpaid payments are handled
+func GetPaymentMismatchActions(db *gorm.DB) (over, under string) {
+	over, err := GetSetting(db, SettingOverpaymentAction)
+	if err != nil || (over != MismatchActionCredit && over != MismatchActionHold) {
+		over = MismatchActionCredit
+	}
+
+	under, err = GetSetting(db, SettingUnderpaymentAction)
+	if err != nil || (under != MismatchActionHold && under != MismatchActionCredit && under != MismatchActionRequestDifference) {
+		under = MismatchActionHold
+	}
+	return over, under
+}
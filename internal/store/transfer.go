@@ -0,0 +1,193 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTransferDisabled           = errors.New("balance transfer is disabled")
+	ErrTransferToSelf             = errors.New("cannot transfer balance to yourself")
+	ErrTransferBelowMinimum       = errors.New("transfer amount is below the minimum")
+	ErrTransferDailyLimitExceeded = errors.New("daily transfer limit exceeded")
+	ErrRecipientNotFound          = errors.New("recipient not found")
+)
+
+// TransferLimits holds the configured limits for balance transfers
+type TransferLimits struct {
+	Enabled         bool
+	MinCents        int
+	DailyLimitCents int
+}
+
+// GetTransferLimits loads transfer limits from system settings
+func GetTransferLimits(db *gorm.DB) TransferLimits {
+	limits := TransferLimits{
+		Enabled:         true,
+		MinCents:        100,
+		DailyLimitCents: 100000,
+	}
+
+	if v, err := GetSetting(db, SettingEnableTransfer); err == nil && v != "" {
+		limits.Enabled = v == "true"
+	}
+	if v, err := GetSetting(db, SettingTransferMinCents); err == nil {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			limits.MinCents = n
+		}
+	}
+	if v, err := GetSetting(db, SettingTransferDailyLimitCents); err == nil {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			limits.DailyLimitCents = n
+		}
+	}
+
+	return limits
+}
+
+// FindUserByIdentifier finds a user by Telegram ID or @username
+func FindUserByIdentifier(db *gorm.DB, identifier string) (*User, error) {
+	identifier = strings.TrimSpace(identifier)
+	if identifier == "" {
+		return nil, ErrRecipientNotFound
+	}
+
+	var user User
+	var err error
+	if tgID, parseErr := strconv.ParseInt(identifier, 10, 64); parseErr == nil {
+		err = db.Where("tg_user_id = ?", tgID).First(&user).Error
+	} else {
+		username := strings.TrimPrefix(identifier, "@")
+		err = db.Where("LOWER(username) = LOWER(?) OR LOWER(tg_username) = LOWER(?)", username, username).
+			First(&user).Error
+	}
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrRecipientNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetTransferredToday returns the total amount a user has sent since local
+// midnight
+func GetTransferredToday(db *gorm.DB, userID uint) (int, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var result struct {
+		Total int
+	}
+	err := db.Model(&BalanceTransaction{}).
+		Select("COALESCE(SUM(-amount_cents), 0) as total").
+		Where("user_id = ? AND type = ? AND created_at >= ?", userID, "transfer_out", today).
+		Scan(&result).Error
+
+	return result.Total, err
+}
+
+// TransferBalance moves balance from one user to another in a single transaction.
+// Both sides get a ledger entry referencing each other.
+func TransferBalance(db *gorm.DB, fromUserID, toUserID uint, amountCents int, note string) error {
+	if fromUserID == toUserID {
+		return ErrTransferToSelf
+	}
+
+	limits := GetTransferLimits(db)
+	if !limits.Enabled {
+		return ErrTransferDisabled
+	}
+	if amountCents <= 0 || amountCents < limits.MinCents {
+		return ErrTransferBelowMinimum
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Lock both users in a stable order to avoid deadlocks. The lock on
+		// the sender also keeps concurrent transfers from both passing the
+		// daily limit.
+		firstID, secondID := fromUserID, toUserID
+		if firstID > secondID {
+			firstID, secondID = secondID, firstID
+		}
+
+		users := make(map[uint]*User, 2)
+		for _, id := range []uint{firstID, secondID} {
+			var user User
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, id).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return ErrRecipientNotFound
+				}
+				return err
+			}
+			users[id] = &user
+		}
+		sender := users[fromUserID]
+		recipient := users[toUserID]
+
+		// Check daily limit inside the transaction
+		if limits.DailyLimitCents > 0 {
+			sentToday, err := GetTransferredToday(tx, fromUserID)
+			if err != nil {
+				return err
+			}
+			if sentToday+amountCents > limits.DailyLimitCents {
+				return ErrTransferDailyLimitExceeded
+			}
+		}
+
+		senderBalance, err := adjustBalance(tx, fromUserID, -amountCents)
+		if err != nil {
+			return err
+		}
+		recipientBalance, err := adjustBalance(tx, toUserID, amountCents)
+		if err != nil {
+			return err
+		}
+
+		outDesc := fmt.Sprintf("Transfer to user %d", recipient.TgUserID)
+		inDesc := fmt.Sprintf("Transfer from user %d", sender.TgUserID)
+		if note != "" {
+			outDesc += ": " + note
+			inDesc += ": " + note
+		}
+
+		entries := []BalanceTransaction{
+			{
+				UserID:             fromUserID,
+				Type:               "transfer_out",
+				AmountCents:        -amountCents,
+				BalanceAfter:       senderBalance,
+				CounterpartyUserID: &toUserID,
+				Description:        truncateDescription(outDesc),
+			},
+			{
+				UserID:             toUserID,
+				Type:               "transfer_in",
+				AmountCents:        amountCents,
+				BalanceAfter:       recipientBalance,
+				CounterpartyUserID: &fromUserID,
+				Description:        truncateDescription(inDesc),
+			},
+		}
+
+		return tx.Create(&entries).Error
+	})
+}
+
+// truncateDescription keeps ledger descriptions within the column size
+func truncateDescription(desc string) string {
+	runes := []rune(desc)
+	if len(runes) > 200 {
+		return string(runes[:200])
+	}
+	return desc
+}
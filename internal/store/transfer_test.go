@@ -0,0 +1,125 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTransferBalance(t *testing.T) {
+	db := newTestDB(t)
+	sender := newTestUser(t, db, 1, 5000)
+	recipient := newTestUser(t, db, 2, 100)
+
+	if err := TransferBalance(db, sender.ID, recipient.ID, 1500, "thanks"); err != nil {
+		t.Fatalf("TransferBalance: %v", err)
+	}
+	if got := balanceOf(t, db, sender.ID); got != 3500 {
+		t.Errorf("sender balance = %d, want 3500", got)
+	}
+	if got := balanceOf(t, db, recipient.ID); got != 1600 {
+		t.Errorf("recipient balance = %d, want 1600", got)
+	}
+
+	var entries []BalanceTransaction
+	db.Order("id").Find(&entries)
+	if len(entries) != 2 {
+		t.Fatalf("%d ledger entries, want 2", len(entries))
+	}
+	if entries[0].Type != "transfer_out" || entries[0].AmountCents != -1500 || entries[0].BalanceAfter != 3500 {
+		t.Errorf("sender entry = %+v", entries[0])
+	}
+	if entries[1].Type != "transfer_in" || entries[1].AmountCents != 1500 || entries[1].BalanceAfter != 1600 {
+		t.Errorf("recipient entry = %+v", entries[1])
+	}
+}
+
+func TestTransferBalanceRejects(t *testing.T) {
+	db := newTestDB(t)
+	sender := newTestUser(t, db, 1, 500)
+	recipient := newTestUser(t, db, 2, 0)
+
+	tests := []struct {
+		name   string
+		to     uint
+		amount int
+		want   error
+	}{
+		{"self", sender.ID, 100, ErrTransferToSelf},
+		{"below minimum", recipient.ID, 50, ErrTransferBelowMinimum},
+		{"insufficient balance", recipient.ID, 600, ErrInsufficientBalance},
+		{"unknown recipient", 999, 100, ErrRecipientNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := TransferBalance(db, sender.ID, tt.to, tt.amount, ""); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if got := balanceOf(t, db, sender.ID); got != 500 {
+		t.Errorf("sender balance = %d, want 500", got)
+	}
+}
+
+func TestTransferBalanceConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	sender := newTestUser(t, db, 1, 1000)
+	recipient := newTestUser(t, db, 2, 0)
+
+	// Ten transfers of 300 race for a balance that covers three
+	const transfers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, transfers)
+	for i := 0; i < transfers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- TransferBalance(db, sender.ID, recipient.ID, 300, "")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrInsufficientBalance):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 3 {
+		t.Errorf("%d transfers succeeded, want 3", succeeded)
+	}
+	if got := balanceOf(t, db, sender.ID); got != 100 {
+		t.Errorf("sender balance = %d, want 100", got)
+	}
+	if got := balanceOf(t, db, recipient.ID); got != 900 {
+		t.Errorf("recipient balance = %d, want 900", got)
+	}
+}
+
+func TestTransferBalanceDailyLimit(t *testing.T) {
+	db := newTestDB(t)
+	if err := SetSetting(db, SettingTransferDailyLimitCents, "1000", "", "int"); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	sender := newTestUser(t, db, 1, 5000)
+	recipient := newTestUser(t, db, 2, 0)
+
+	if err := TransferBalance(db, sender.ID, recipient.ID, 800, ""); err != nil {
+		t.Fatalf("first transfer: %v", err)
+	}
+	if err := TransferBalance(db, sender.ID, recipient.ID, 300, ""); !errors.Is(err, ErrTransferDailyLimitExceeded) {
+		t.Errorf("second transfer error = %v, want %v", err, ErrTransferDailyLimitExceeded)
+	}
+	sent, err := GetTransferredToday(db, sender.ID)
+	if err != nil {
+		t.Fatalf("GetTransferredToday: %v", err)
+	}
+	if sent != 800 {
+		t.Errorf("sent today = %d, want 800", sent)
+	}
+}
@@ -0,0 +1,278 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	WithdrawalStatusPending  = "pending"
+	WithdrawalStatusApproved = "approved"
+	WithdrawalStatusRejected = "rejected"
+)
+
+var (
+	ErrWithdrawalDisabled       = errors.New("withdrawal is disabled")
+	ErrWithdrawalBelowMinimum   = errors.New("withdrawal amount is below the minimum")
+	ErrWithdrawalPendingExists  = errors.New("user already has a pending withdrawal")
+	ErrWithdrawalNotFound       = errors.New("withdrawal request not found")
+	ErrWithdrawalNotPending     = errors.New("withdrawal request is not pending")
+	ErrWithdrawalMissingAccount = errors.New("payout account is required")
+	ErrWithdrawalMissingRefNo   = errors.New("reference number is required")
+)
+
+// WithdrawalLimits holds the configured limits for withdrawals
+type WithdrawalLimits struct {
+	Enabled  bool
+	MinCents int
+}
+
+// GetWithdrawalLimits loads withdrawal limits from system settings
+func GetWithdrawalLimits(db *gorm.DB) WithdrawalLimits {
+	limits := WithdrawalLimits{
+		Enabled:  true,
+		MinCents: 1000,
+	}
+
+	if v, err := GetSetting(db, SettingEnableWithdrawal); err == nil && v != "" {
+		limits.Enabled = v == "true"
+	}
+	if v, err := GetSetting(db, SettingWithdrawMinCents); err == nil {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			limits.MinCents = n
+		}
+	}
+
+	return limits
+}
+
+// GetPendingWithdrawal returns the user's pending withdrawal, if any
+func GetPendingWithdrawal(db *gorm.DB, userID uint) (*WithdrawalRequest, error) {
+	var req WithdrawalRequest
+	err := db.Where("user_id = ? AND status = ?", userID, WithdrawalStatusPending).First(&req).Error
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// CreateWithdrawalRequest creates a withdrawal request and holds the amount
+// from the user's balance in the same transaction.
+func CreateWithdrawalRequest(db *gorm.DB, userID uint, amountCents int, method, account string) (*WithdrawalRequest, error) {
+	limits := GetWithdrawalLimits(db)
+	if !limits.Enabled {
+		return nil, ErrWithdrawalDisabled
+	}
+	if amountCents <= 0 || amountCents < limits.MinCents {
+		return nil, ErrWithdrawalBelowMinimum
+	}
+
+	account = strings.TrimSpace(account)
+	if account == "" {
+		return nil, ErrWithdrawalMissingAccount
+	}
+
+	req := &WithdrawalRequest{
+		UserID:        userID,
+		AmountCents:   amountCents,
+		PayoutMethod:  strings.TrimSpace(method),
+		PayoutAccount: account,
+		Status:        WithdrawalStatusPending,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user first so concurrent requests check for a pending
+		// withdrawal one after another
+		var user User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var pending int64
+		if err := tx.Model(&WithdrawalRequest{}).
+			Where("user_id = ? AND status = ?", userID, WithdrawalStatusPending).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrWithdrawalPendingExists
+		}
+
+		// The debit fails when the balance is too low, also when another
+		// debit got there first
+		newBalance, err := adjustBalance(tx, userID, -amountCents)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(req).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&BalanceTransaction{
+			UserID:       userID,
+			Type:         "withdraw_hold",
+			AmountCents:  -amountCents,
+			BalanceAfter: newBalance,
+			WithdrawalID: &req.ID,
+			Description:  fmt.Sprintf("Withdrawal request #%d (on hold)", req.ID),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// ApproveWithdrawal marks a pending withdrawal as paid out. The held amount
+// stays deducted; a zero-amount ledger entry records the payout reference.
+func ApproveWithdrawal(db *gorm.DB, id uint, referenceNo, reviewer string) (*WithdrawalRequest, error) {
+	referenceNo = strings.TrimSpace(referenceNo)
+	if referenceNo == "" {
+		return nil, ErrWithdrawalMissingRefNo
+	}
+
+	var req WithdrawalRequest
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := reviewPendingWithdrawal(tx, id, &req, map[string]interface{}{
+			"status":       WithdrawalStatusApproved,
+			"reference_no": referenceNo,
+			"reviewed_by":  reviewer,
+			"reviewed_at":  time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		var user User
+		if err := tx.First(&user, req.UserID).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&BalanceTransaction{
+			UserID:       req.UserID,
+			Type:         "withdraw",
+			AmountCents:  0,
+			BalanceAfter: user.BalanceCents,
+			WithdrawalID: &req.ID,
+			Description:  truncateDescription(fmt.Sprintf("Withdrawal #%d paid out, ref %s", req.ID, referenceNo)),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// RejectWithdrawal rejects a pending withdrawal and releases the held amount
+// back to the user's balance.
+func RejectWithdrawal(db *gorm.DB, id uint, reason, reviewer string) (*WithdrawalRequest, error) {
+	reason = strings.TrimSpace(reason)
+
+	var req WithdrawalRequest
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := reviewPendingWithdrawal(tx, id, &req, map[string]interface{}{
+			"status":        WithdrawalStatusRejected,
+			"reject_reason": reason,
+			"reviewed_by":   reviewer,
+			"reviewed_at":   time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		newBalance, err := adjustBalance(tx, req.UserID, req.AmountCents)
+		if err != nil {
+			return err
+		}
+
+		desc := fmt.Sprintf("Withdrawal #%d rejected, hold released", req.ID)
+		if reason != "" {
+			desc += ": " + reason
+		}
+
+		return tx.Create(&BalanceTransaction{
+			UserID:       req.UserID,
+			Type:         "withdraw_release",
+			AmountCents:  req.AmountCents,
+			BalanceAfter: newBalance,
+			WithdrawalID: &req.ID,
+			Description:  truncateDescription(desc),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// reviewPendingWithdrawal applies a review to a withdrawal only while it is
+// still pending, so of two concurrent reviews exactly one wins, and loads the
+// reviewed withdrawal into req
+func reviewPendingWithdrawal(tx *gorm.DB, id uint, req *WithdrawalRequest, updates map[string]interface{}) error {
+	result := tx.Model(&WithdrawalRequest{}).
+		Where("id = ? AND status = ?", id, WithdrawalStatusPending).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if err := tx.First(req, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrWithdrawalNotFound
+		}
+		return err
+	}
+	if result.RowsAffected != 1 {
+		return ErrWithdrawalNotPending
+	}
+	return nil
+}
+
+// GetWithdrawal returns a withdrawal request with its user
+func GetWithdrawal(db *gorm.DB, id uint) (*WithdrawalRequest, error) {
+	var req WithdrawalRequest
+	if err := db.Preload("User").First(&req, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrWithdrawalNotFound
+		}
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ListWithdrawals returns withdrawal requests filtered by status with pagination
+func ListWithdrawals(db *gorm.DB, status string, limit, offset int) ([]WithdrawalRequest, int64, error) {
+	var requests []WithdrawalRequest
+	var total int64
+
+	query := db.Model(&WithdrawalRequest{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Preload("User").
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&requests).Error
+
+	return requests, total, err
+}
+
+// CountPendingWithdrawals returns the number of withdrawals waiting for review
+func CountPendingWithdrawals(db *gorm.DB) (int64, error) {
+	var count int64
+	err := db.Model(&WithdrawalRequest{}).Where("status = ?", WithdrawalStatusPending).Count(&count).Error
+	return count, err
+}
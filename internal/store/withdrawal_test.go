@@ -0,0 +1,162 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCreateWithdrawalRequestHoldsBalance(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 5000)
+
+	req, err := CreateWithdrawalRequest(db, user.ID, 3000, "alipay", "me@example.com")
+	if err != nil {
+		t.Fatalf("CreateWithdrawalRequest: %v", err)
+	}
+	if req.Status != WithdrawalStatusPending {
+		t.Errorf("status = %q, want %q", req.Status, WithdrawalStatusPending)
+	}
+	if got := balanceOf(t, db, user.ID); got != 2000 {
+		t.Errorf("balance = %d, want 2000", got)
+	}
+
+	if _, err := CreateWithdrawalRequest(db, user.ID, 1000, "alipay", "me@example.com"); !errors.Is(err, ErrWithdrawalPendingExists) {
+		t.Errorf("second request error = %v, want %v", err, ErrWithdrawalPendingExists)
+	}
+}
+
+func TestCreateWithdrawalRequestInsufficientBalance(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 1500)
+
+	if _, err := CreateWithdrawalRequest(db, user.ID, 2000, "alipay", "me@example.com"); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("error = %v, want %v", err, ErrInsufficientBalance)
+	}
+	if got := balanceOf(t, db, user.ID); got != 1500 {
+		t.Errorf("balance = %d, want 1500", got)
+	}
+	var count int64
+	db.Model(&WithdrawalRequest{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d withdrawal requests stored, want 0", count)
+	}
+}
+
+func TestCreateWithdrawalRequestConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 10000)
+
+	const requests = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := CreateWithdrawalRequest(db, user.ID, 1000, "alipay", "me@example.com")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrWithdrawalPendingExists):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d requests succeeded, want 1", succeeded)
+	}
+	if got := balanceOf(t, db, user.ID); got != 9000 {
+		t.Errorf("balance = %d, want one hold of 1000", got)
+	}
+}
+
+func TestRejectWithdrawalConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 5000)
+	req, err := CreateWithdrawalRequest(db, user.ID, 3000, "alipay", "me@example.com")
+	if err != nil {
+		t.Fatalf("CreateWithdrawalRequest: %v", err)
+	}
+
+	const reviewers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, reviewers)
+	for i := 0; i < reviewers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := RejectWithdrawal(db, req.ID, "duplicate", "admin")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrWithdrawalNotPending):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d rejects succeeded, want 1", succeeded)
+	}
+	if got := balanceOf(t, db, user.ID); got != 5000 {
+		t.Errorf("balance = %d, want the hold released once to 5000", got)
+	}
+}
+
+func TestApproveAndRejectRace(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, 1, 5000)
+	req, err := CreateWithdrawalRequest(db, user.ID, 3000, "alipay", "me@example.com")
+	if err != nil {
+		t.Fatalf("CreateWithdrawalRequest: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var approveErr, rejectErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, approveErr = ApproveWithdrawal(db, req.ID, "REF-1", "admin")
+	}()
+	go func() {
+		defer wg.Done()
+		_, rejectErr = RejectWithdrawal(db, req.ID, "", "admin")
+	}()
+	wg.Wait()
+
+	if (approveErr == nil) == (rejectErr == nil) {
+		t.Fatalf("approve error = %v, reject error = %v, want exactly one to succeed", approveErr, rejectErr)
+	}
+	stored, err := GetWithdrawal(db, req.ID)
+	if err != nil {
+		t.Fatalf("GetWithdrawal: %v", err)
+	}
+	want := 2000
+	if approveErr != nil {
+		want = 5000
+	}
+	if got := balanceOf(t, db, user.ID); got != want {
+		t.Errorf("balance = %d with status %s, want %d", got, stored.Status, want)
+	}
+}
+
+func TestReviewWithdrawalNotFound(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := RejectWithdrawal(db, 42, "", "admin"); !errors.Is(err, ErrWithdrawalNotFound) {
+		t.Errorf("error = %v, want %v", err, ErrWithdrawalNotFound)
+	}
+}
@@ -0,0 +1,252 @@
+package supplier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypeHTTPJSON is the generic connector for suppliers with a JSON API
+const TypeHTTPJSON = "http_json"
+
+// maxResponseSize caps how much of a supplier response is read
+const maxResponseSize = 5 << 20
+
+// HTTPJSONConfig configures the generic HTTP JSON connector. The URL and
+// body may contain {quantity} and {product_id} placeholders. Header values
+// may reference SUPPLIER_* environment variables as ${SUPPLIER_NAME} so
+// credentials need not be stored in the database.
+type HTTPJSONConfig struct {
+	URL            string            `json:"url"`
+	Method         string            `json:"method"` // GET or POST, GET when empty
+	Headers        map[string]string `json:"headers"`
+	Body           string            `json:"body"`            // Request body for POST
+	CodesPath      string            `json:"codes_path"`      // Dotted path of the code array in the response, e.g. data.codes
+	CodeField      string            `json:"code_field"`      // Key of the code when the array holds objects, empty to use the objects as code fields
+	TimeoutSeconds int               `json:"timeout_seconds"` // 15 when zero
+}
+
+func parseHTTPJSONConfig(config string) (*HTTPJSONConfig, error) {
+	var cfg HTTPJSONConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	cfg.Method = strings.ToUpper(strings.TrimSpace(cfg.Method))
+	if cfg.Method == "" {
+		cfg.Method = http.MethodGet
+	}
+	if cfg.Method != http.MethodGet && cfg.Method != http.MethodPost {
+		return nil, fmt.Errorf("%w: method must be GET or POST", ErrInvalidConfig)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an http or https URL", ErrInvalidConfig)
+	}
+	if cfg.TimeoutSeconds < 0 || cfg.TimeoutSeconds > 120 {
+		return nil, fmt.Errorf("%w: timeout must be between 1 and 120 seconds", ErrInvalidConfig)
+	}
+	if cfg.TimeoutSeconds == 0 {
+		cfg.TimeoutSeconds = 15
+	}
+	// Admins choose the URL, so headers must not be able to send other
+	// server secrets, like the bot token, to it
+	for name, value := range cfg.Headers {
+		for _, ref := range envRef.FindAllStringSubmatch(value, -1) {
+			if !allowedEnv(ref[1]) {
+				return nil, fmt.Errorf("%w: header %s may only reference %s* environment variables, not %s", ErrInvalidConfig, name, EnvPrefix, ref[1])
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+type httpJSONConnector struct {
+	config *HTTPJSONConfig
+	client *http.Client
+}
+
+func newHTTPJSONConnector(config string) (Connector, error) {
+	cfg, err := parseHTTPJSONConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &httpJSONConnector{
+		config: cfg,
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+	}, nil
+}
+
+// Fetch requests codes and extracts them from the JSON response
+func (c *httpJSONConnector) Fetch(ctx context.Context, req Request) ([]Item, error) {
+	placeholders := strings.NewReplacer(
+		"{quantity}", strconv.Itoa(req.Quantity),
+		"{product_id}", strconv.FormatUint(uint64(req.ProductID), 10),
+	)
+
+	var body io.Reader
+	if c.config.Method == http.MethodPost && c.config.Body != "" {
+		body = strings.NewReader(placeholders.Replace(c.config.Body))
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, c.config.Method, placeholders.Replace(c.config.URL), body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range c.config.Headers {
+		httpReq.Header.Set(name, expandEnv(value))
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, temporary(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, temporary(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("supplier returned HTTP %d: %s", resp.StatusCode, truncate(string(data), 200))
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, temporary(err)
+		}
+		return nil, err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("supplier returned invalid JSON: %w", err)
+	}
+	return c.extractItems(decoded)
+}
+
+// extractItems walks codes_path and converts the array it points to
+func (c *httpJSONConnector) extractItems(decoded interface{}) ([]Item, error) {
+	node := decoded
+	if path := strings.TrimSpace(c.config.CodesPath); path != "" {
+		for _, key := range strings.Split(path, ".") {
+			object, ok := node.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("codes_path %q not found in response", c.config.CodesPath)
+			}
+			if node, ok = object[key]; !ok {
+				return nil, fmt.Errorf("codes_path %q not found in response", c.config.CodesPath)
+			}
+		}
+	}
+	list, ok := node.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("codes_path %q is not an array", c.config.CodesPath)
+	}
+
+	items := make([]Item, 0, len(list))
+	for i, entry := range list {
+		switch value := entry.(type) {
+		case string:
+			items = append(items, Item{Code: value})
+		case map[string]interface{}:
+			if c.config.CodeField != "" {
+				code, ok := value[c.config.CodeField]
+				if !ok {
+					return nil, fmt.Errorf("item %d has no %q field", i+1, c.config.CodeField)
+				}
+				items = append(items, Item{Code: scalarString(code)})
+				continue
+			}
+			fields := make(map[string]string, len(value))
+			for key, v := range value {
+				fields[key] = scalarString(v)
+			}
+			items = append(items, Item{Fields: fields})
+		default:
+			items = append(items, Item{Code: scalarString(value)})
+		}
+	}
+	return items, nil
+}
+
+// scalarString formats a JSON value as a code string
+func scalarString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	}
+}
+
+// expandEnv replaces ${SUPPLIER_NAME} references with environment
+// variables. Other references expand to nothing; configs holding them are
+// rejected when parsed.
+func expandEnv(value string) string {
+	return envRef.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envRef.FindStringSubmatch(ref)[1]
+		if !allowedEnv(name) {
+			return ""
+		}
+		return os.Getenv(name)
+	})
+}
+
+func truncate(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// MaskConfig hides header values before a config is shown to admins, both
+// literal secrets and the environment variables they reference
+func MaskConfig(typ, config string) string {
+	if typ != TypeHTTPJSON || config == "" {
+		return config
+	}
+	var cfg HTTPJSONConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return ""
+	}
+	for name, value := range cfg.Headers {
+		cfg.Headers[name] = maskSecret(value)
+	}
+	encoded, _ := json.Marshal(cfg)
+	return string(encoded)
+}
+
+// RestoreMasked fills header values an admin left masked with the values of
+// the stored config, so saving a masked config keeps its secrets
+func RestoreMasked(typ, config, stored string) string {
+	if typ != TypeHTTPJSON || stored == "" || !strings.Contains(config, maskedValue) {
+		return config
+	}
+	var cfg, old HTTPJSONConfig
+	if json.Unmarshal([]byte(config), &cfg) != nil || json.Unmarshal([]byte(stored), &old) != nil {
+		return config
+	}
+	for name, value := range cfg.Headers {
+		if value == maskedValue {
+			cfg.Headers[name] = old.Headers[name]
+		}
+	}
+	encoded, _ := json.Marshal(cfg)
+	return string(encoded)
+}
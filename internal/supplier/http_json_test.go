@@ -0,0 +1,234 @@
+package supplier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestConnector builds an http_json connector for the config
+func newTestConnector(t *testing.T, config HTTPJSONConfig) Connector {
+	t.Helper()
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("encode config: %v", err)
+	}
+	connector, err := New(TypeHTTPJSON, string(encoded))
+	if err != nil {
+		t.Fatalf("build connector: %v", err)
+	}
+	return connector
+}
+
+func TestHTTPJSONFetchGet(t *testing.T) {
+	t.Setenv("SUPPLIER_TEST_TOKEN", "secret")
+	var gotQuery, gotAuth, gotMethod string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotQuery = r.URL.RawQuery
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"data":{"codes":["A-1","A-2",42]}}`))
+	}))
+	defer server.Close()
+
+	connector := newTestConnector(t, HTTPJSONConfig{
+		URL:       server.URL + "/codes?qty={quantity}&product={product_id}",
+		Headers:   map[string]string{"Authorization": "Bearer ${SUPPLIER_TEST_TOKEN}"},
+		CodesPath: "data.codes",
+	})
+	items, err := connector.Fetch(context.Background(), Request{ProductID: 7, Quantity: 3})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	if gotMethod != http.MethodGet || gotQuery != "qty=3&product=7" {
+		t.Errorf("request = %s ?%s, want GET ?qty=3&product=7", gotMethod, gotQuery)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the expanded token", gotAuth)
+	}
+	want := []string{"A-1", "A-2", "42"}
+	if len(items) != len(want) {
+		t.Fatalf("items = %+v, want %v", items, want)
+	}
+	for i, item := range items {
+		if item.Code != want[i] || item.Fields != nil {
+			t.Errorf("item %d = %+v, want code %q", i, item, want[i])
+		}
+	}
+}
+
+func TestHTTPJSONFetchPost(t *testing.T) {
+	var gotBody, gotType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotType = r.Header.Get("Content-Type")
+		w.Write([]byte(`{"items":[{"key":"K1","serial":"S1"},{"key":"K2","serial":"S2"}]}`))
+	}))
+	defer server.Close()
+
+	connector := newTestConnector(t, HTTPJSONConfig{
+		URL:       server.URL,
+		Method:    "post",
+		Body:      `{"sku":{product_id},"count":{quantity}}`,
+		CodesPath: "items",
+		CodeField: "key",
+	})
+	items, err := connector.Fetch(context.Background(), Request{ProductID: 5, Quantity: 2})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if gotBody != `{"sku":5,"count":2}` || gotType != "application/json" {
+		t.Errorf("body = %q (%s), want the placeholders replaced", gotBody, gotType)
+	}
+	if len(items) != 2 || items[0].Code != "K1" || items[1].Code != "K2" {
+		t.Fatalf("items = %+v, want codes K1 and K2", items)
+	}
+}
+
+func TestHTTPJSONFetchFields(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"account":"a@example.com","password":"p1","level":3}]`))
+	}))
+	defer server.Close()
+
+	items, err := newTestConnector(t, HTTPJSONConfig{URL: server.URL}).Fetch(context.Background(), Request{Quantity: 1})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(items) != 1 || items[0].Code != "" {
+		t.Fatalf("items = %+v, want one structured item", items)
+	}
+	fields := items[0].Fields
+	if fields["account"] != "a@example.com" || fields["password"] != "p1" || fields["level"] != "3" {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+func TestHTTPJSONFetchErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		config    HTTPJSONConfig
+		temporary bool
+		contains  string
+	}{
+		{name: "server error", status: http.StatusBadGateway, body: "upstream down", temporary: true, contains: "HTTP 502"},
+		{name: "rate limited", status: http.StatusTooManyRequests, temporary: true, contains: "HTTP 429"},
+		{name: "client error", status: http.StatusUnauthorized, body: "bad token", contains: "HTTP 401: bad token"},
+		{name: "invalid json", status: http.StatusOK, body: "<html>", contains: "invalid JSON"},
+		{name: "missing path", status: http.StatusOK, body: `{"data":{}}`, config: HTTPJSONConfig{CodesPath: "data.codes"}, contains: "not found"},
+		{name: "not an array", status: http.StatusOK, body: `{"codes":"A-1"}`, config: HTTPJSONConfig{CodesPath: "codes"}, contains: "not an array"},
+		{name: "missing code field", status: http.StatusOK, body: `[{"serial":"S1"}]`, config: HTTPJSONConfig{CodeField: "key"}, contains: `no "key" field`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			tt.config.URL = server.URL
+			_, err := newTestConnector(t, tt.config).Fetch(context.Background(), Request{Quantity: 1})
+			if err == nil {
+				t.Fatal("fetch succeeded")
+			}
+			if IsTemporary(err) != tt.temporary {
+				t.Errorf("IsTemporary(%v) = %v, want %v", err, IsTemporary(err), tt.temporary)
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.contains)
+			}
+		})
+	}
+}
+
+func TestHTTPJSONFetchOversizedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A valid array larger than maxResponseSize is cut off and fails to parse
+		w.Write([]byte(`["`))
+		w.Write([]byte(strings.Repeat("A", maxResponseSize)))
+		w.Write([]byte(`"]`))
+	}))
+	defer server.Close()
+
+	_, err := newTestConnector(t, HTTPJSONConfig{URL: server.URL}).Fetch(context.Background(), Request{Quantity: 1})
+	if err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Fatalf("error = %v, want the truncated response rejected", err)
+	}
+	if IsTemporary(err) {
+		t.Error("oversized response is retried")
+	}
+}
+
+func TestHTTPJSONFetchUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	_, err := newTestConnector(t, HTTPJSONConfig{URL: url}).Fetch(context.Background(), Request{Quantity: 1})
+	if err == nil || !IsTemporary(err) {
+		t.Fatalf("error = %v, want a temporary error", err)
+	}
+}
+
+func TestParseHTTPJSONConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		valid  bool
+	}{
+		{"defaults", `{"url":"https://supplier.example/codes"}`, true},
+		{"supplier env", `{"url":"https://supplier.example","headers":{"Authorization":"Bearer ${SUPPLIER_TOKEN}"}}`, true},
+		{"other env", `{"url":"https://supplier.example","headers":{"Authorization":"Bearer ${BOT_TOKEN}"}}`, false},
+		{"bare prefix", `{"url":"https://supplier.example","headers":{"X-Key":"${SUPPLIER_}"}}`, false},
+		{"mixed env", `{"url":"https://supplier.example","headers":{"X-Key":"${SUPPLIER_KEY}:${DATABASE_URL}"}}`, false},
+		{"bad method", `{"url":"https://supplier.example","method":"DELETE"}`, false},
+		{"bad scheme", `{"url":"file:///etc/passwd"}`, false},
+		{"no host", `{"url":"https://"}`, false},
+		{"long timeout", `{"url":"https://supplier.example","timeout_seconds":600}`, false},
+		{"not json", `url=https://supplier.example`, false},
+	}
+	for _, tt := range tests {
+		cfg, err := parseHTTPJSONConfig(tt.config)
+		if tt.valid {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, ErrInvalidConfig)
+		}
+		if cfg != nil {
+			t.Errorf("%s: config returned with the error", tt.name)
+		}
+	}
+
+	cfg, err := parseHTTPJSONConfig(`{"url":"https://supplier.example"}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.Method != http.MethodGet || cfg.TimeoutSeconds != 15 {
+		t.Errorf("config = %+v, want GET with a 15 second timeout", cfg)
+	}
+}
+
+func TestExpandEnvOnlyExpandsSupplierVariables(t *testing.T) {
+	t.Setenv("SUPPLIER_KEY", "k")
+	t.Setenv("SECRET_KEY", "s")
+	if got := expandEnv("${SUPPLIER_KEY}/${SECRET_KEY}"); got != "k/" {
+		t.Errorf("expandEnv = %q, want %q", got, "k/")
+	}
+}
@@ -0,0 +1,299 @@
+package supplier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+var (
+	ErrNotConfigured     = errors.New("no supplier configured for product")
+	ErrRestockInProgress = errors.New("a restock is already running for this product")
+)
+
+// Failure is reported to admins when a pull fails after all retries
+type Failure struct {
+	ProductID   uint
+	ProductName string
+	Trigger     string
+	Attempts    int
+	Failures    int // Consecutive failed runs including this one
+	Error       string
+}
+
+// Service pulls codes from product suppliers
+type Service struct {
+	db       *gorm.DB
+	attempts int           // Fetch attempts per scheduled or manual pull
+	backoff  time.Duration // Wait before the first retry, doubled after each retry
+
+	onFailure func(Failure)
+
+	mu    sync.Mutex
+	locks map[uint]chan struct{} // One pull per product at a time
+}
+
+// NewService creates a supplier service
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:       db,
+		attempts: 3,
+		backoff:  2 * time.Second,
+		locks:    make(map[uint]chan struct{}),
+	}
+}
+
+// SetFailureHook sets the function that reports failed pulls, typically to
+// the admin notifier. It is called on the first failure of a streak only.
+func (s *Service) SetFailureHook(hook func(Failure)) {
+	s.onFailure = hook
+}
+
+// lock takes the product's pull lock, waiting until ctx is done when wait is set
+func (s *Service) lock(ctx context.Context, productID uint, wait bool) bool {
+	s.mu.Lock()
+	ch, ok := s.locks[productID]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		s.locks[productID] = ch
+	}
+	s.mu.Unlock()
+
+	if !wait {
+		select {
+		case ch <- struct{}{}:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case ch <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Service) unlock(productID uint) {
+	s.mu.Lock()
+	ch := s.locks[productID]
+	s.mu.Unlock()
+	<-ch
+}
+
+// Restock pulls quantity codes for a product, or the configured restock
+// quantity when quantity is zero, and imports them into its stock
+func (s *Service) Restock(ctx context.Context, productID uint, trigger string, quantity int) (*store.SupplierRun, error) {
+	if !s.lock(ctx, productID, false) {
+		return nil, ErrRestockInProgress
+	}
+	defer s.unlock(productID)
+	return s.restock(ctx, productID, trigger, quantity, s.attempts)
+}
+
+func (s *Service) restock(ctx context.Context, productID uint, trigger string, quantity, attempts int) (*store.SupplierRun, error) {
+	config, err := store.GetProductSupplier(s.db, productID)
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrNotConfigured
+	}
+	if err != nil {
+		return nil, err
+	}
+	var product store.Product
+	if err := s.db.First(&product, productID).Error; err != nil {
+		return nil, err
+	}
+	if quantity <= 0 {
+		quantity = config.RestockQuantity
+	}
+
+	started := time.Now()
+	run := &store.SupplierRun{
+		ProductID: productID,
+		Trigger:   trigger,
+		Requested: quantity,
+	}
+
+	items, err := s.fetch(ctx, config, Request{ProductID: productID, Quantity: quantity}, attempts, run)
+	if err == nil {
+		run.Received = len(items)
+		err = s.importItems(&product, config, items, run)
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	run.DurationMs = time.Since(started).Milliseconds()
+
+	failures, recordErr := store.RecordSupplierRun(s.db, run)
+	if recordErr != nil {
+		logger.Error("Failed to record supplier run", "error", recordErr, "product_id", productID)
+	}
+
+	if err != nil {
+		logger.Error("Supplier restock failed", "error", err, "product_id", productID,
+			"trigger", trigger, "attempts", run.Attempts)
+		if failures == 1 && s.onFailure != nil {
+			go s.onFailure(Failure{
+				ProductID:   productID,
+				ProductName: product.Name,
+				Trigger:     trigger,
+				Attempts:    run.Attempts,
+				Failures:    failures,
+				Error:       run.Error,
+			})
+		}
+		return run, err
+	}
+
+	logger.Info("Supplier restock completed", "product_id", productID, "trigger", trigger,
+		"requested", run.Requested, "received", run.Received, "imported", run.Imported,
+		"duplicates", run.Duplicates, "invalid", run.Invalid)
+	return run, nil
+}
+
+// fetch calls the connector, retrying temporary errors with backoff
+func (s *Service) fetch(ctx context.Context, config *store.ProductSupplier, req Request, attempts int, run *store.SupplierRun) ([]Item, error) {
+	connector, err := New(config.Type, config.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := s.backoff
+	for {
+		run.Attempts++
+		items, err := connector.Fetch(ctx, req)
+		if err == nil {
+			return items, nil
+		}
+		if !IsTemporary(err) || run.Attempts >= attempts {
+			return nil, err
+		}
+		logger.Warn("Supplier fetch failed, retrying", "error", err, "product_id", req.ProductID,
+			"attempt", run.Attempts, "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// importItems adds the fetched codes to the product's stock as one batch
+// at the supplier's unit cost
+func (s *Service) importItems(product *store.Product, config *store.ProductSupplier, items []Item, run *store.SupplierRun) error {
+	if len(items) == 0 {
+		return errors.New("supplier returned no codes")
+	}
+
+	opts := store.CodeImportOptions{
+		Batch: store.CodeBatch{
+			Source:        store.CodeBatchSourceSupplier,
+			Supplier:      config.Type,
+			UnitCostCents: config.UnitCostCents,
+			Note:          "trigger: " + run.Trigger,
+			CreatedBy:     store.CodeOperationSystemAdmin,
+		},
+	}
+
+	var report *store.CodeUploadReport
+	var err error
+	if len(product.Fields()) > 0 {
+		records := make([]map[string]string, 0, len(items))
+		for _, item := range items {
+			records = append(records, item.Fields)
+		}
+		report, err = store.ImportStructuredCodes(s.db, product, records, opts)
+	} else {
+		codes := make([]string, 0, len(items))
+		for _, item := range items {
+			codes = append(codes, item.Code)
+		}
+		report, err = store.ImportCodes(s.db, product.ID, codes, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	run.Imported = report.Inserted
+	run.Duplicates = report.DuplicateCount()
+	run.Invalid = len(items) - report.Total // Blank codes and rows missing required fields
+	if run.Imported == 0 {
+		return fmt.Errorf("none of the %d codes could be imported (%d duplicates, %d invalid)",
+			len(items), run.Duplicates, run.Invalid)
+	}
+	return nil
+}
+
+// CheckAll pulls codes for every enabled supplier whose product stock fell
+// below its restock threshold
+func (s *Service) CheckAll(ctx context.Context) {
+	suppliers, err := store.ListEnabledSuppliers(s.db)
+	if err != nil {
+		logger.Error("Failed to load suppliers", "error", err)
+		return
+	}
+
+	for _, config := range suppliers {
+		if ctx.Err() != nil {
+			return
+		}
+		if config.RestockThreshold <= 0 {
+			continue
+		}
+		stock, err := store.CountAvailableCodes(s.db, config.ProductID)
+		if err != nil {
+			logger.Error("Failed to count stock", "error", err, "product_id", config.ProductID)
+			continue
+		}
+		if stock >= int64(config.RestockThreshold) {
+			continue
+		}
+		if _, err := s.Restock(ctx, config.ProductID, store.SupplierTriggerSchedule, 0); errors.Is(err, ErrRestockInProgress) {
+			logger.Info("Supplier restock already running", "product_id", config.ProductID)
+		}
+	}
+}
+
+// FetchOnDemand pulls codes for a product whose stock ran out while a buyer
+// is waiting. It makes a single attempt and reports whether stock is
+// available afterwards. Buyers arriving during a pull wait for it.
+func (s *Service) FetchOnDemand(ctx context.Context, productID uint) bool {
+	config, err := store.GetProductSupplier(s.db, productID)
+	if err != nil || !config.Enabled || !config.OnDemand {
+		return false
+	}
+
+	if !s.lock(ctx, productID, true) {
+		return false
+	}
+	defer s.unlock(productID)
+
+	// A pull that finished while we waited may have restocked already
+	if stock, err := store.CountAvailableCodes(s.db, productID); err == nil && stock > 0 {
+		return true
+	}
+	if _, err := s.restock(ctx, productID, store.SupplierTriggerOnDemand, 0, 1); err != nil {
+		return false
+	}
+	stock, err := store.CountAvailableCodes(s.db, productID)
+	return err == nil && stock > 0
+}
+
+// Test fetches codes with a config without importing them, so admins can
+// check a connector before saving it
+func Test(ctx context.Context, typ, config string, productID uint, quantity int) ([]Item, error) {
+	connector, err := New(typ, config)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Fetch(ctx, Request{ProductID: productID, Quantity: quantity})
+}
@@ -0,0 +1,240 @@
+package supplier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	os.Exit(m.Run())
+}
+
+// newTestDB returns a migrated SQLite database in a temporary file
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=10000&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := store.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// stubSupplier serves responses in turn, repeating the last one, and counts requests
+type stubSupplier struct {
+	*httptest.Server
+	requests  atomic.Int32
+	responses []stubResponse
+}
+
+type stubResponse struct {
+	status int
+	body   string
+}
+
+func newStubSupplier(t *testing.T, responses ...stubResponse) *stubSupplier {
+	t.Helper()
+	stub := &stubSupplier{responses: responses}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(stub.requests.Add(1))
+		if n > len(stub.responses) {
+			n = len(stub.responses)
+		}
+		resp := stub.responses[n-1]
+		w.WriteHeader(resp.status)
+		w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// newTestService returns a service that retries without waiting
+func newTestService(db *gorm.DB) *Service {
+	s := NewService(db)
+	s.backoff = time.Millisecond
+	return s
+}
+
+// newSuppliedProduct creates a product whose supplier is the stub
+func newSuppliedProduct(t *testing.T, db *gorm.DB, stub *stubSupplier, threshold, quantity int) *store.Product {
+	t.Helper()
+	product := &store.Product{Name: "supplied", PriceCents: 100, IsActive: true}
+	if err := db.Create(product).Error; err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	config, _ := json.Marshal(HTTPJSONConfig{URL: stub.URL})
+	if err := store.SaveProductSupplier(db, &store.ProductSupplier{
+		ProductID:        product.ID,
+		Type:             TypeHTTPJSON,
+		Config:           string(config),
+		Enabled:          true,
+		RestockThreshold: threshold,
+		RestockQuantity:  quantity,
+		UnitCostCents:    40,
+	}); err != nil {
+		t.Fatalf("save supplier: %v", err)
+	}
+	return product
+}
+
+func stockOf(t *testing.T, db *gorm.DB, productID uint) int64 {
+	t.Helper()
+	stock, err := store.CountAvailableCodes(db, productID)
+	if err != nil {
+		t.Fatalf("count stock: %v", err)
+	}
+	return stock
+}
+
+func TestCheckAllRestocksBelowThreshold(t *testing.T) {
+	db := newTestDB(t)
+	stub := newStubSupplier(t, stubResponse{http.StatusOK, `["C-1","C-2","C-3"]`})
+	product := newSuppliedProduct(t, db, stub, 2, 3)
+	s := newTestService(db)
+
+	s.CheckAll(context.Background())
+	if stub.requests.Load() != 1 {
+		t.Fatalf("requests = %d, want one pull for empty stock", stub.requests.Load())
+	}
+	if got := stockOf(t, db, product.ID); got != 3 {
+		t.Fatalf("stock = %d, want 3", got)
+	}
+
+	var batch store.CodeBatch
+	if err := db.Where("product_id = ?", product.ID).First(&batch).Error; err != nil {
+		t.Fatalf("load batch: %v", err)
+	}
+	if batch.Source != store.CodeBatchSourceSupplier || batch.Quantity != 3 || batch.UnitCostCents != 40 {
+		t.Errorf("batch = %+v, want 3 supplier codes at 40", batch)
+	}
+
+	// Stock at or above the threshold is left alone
+	s.CheckAll(context.Background())
+	if stub.requests.Load() != 1 {
+		t.Fatalf("requests = %d, want no pull above the threshold", stub.requests.Load())
+	}
+}
+
+func TestRestockSkipsDuplicates(t *testing.T) {
+	db := newTestDB(t)
+	stub := newStubSupplier(t,
+		stubResponse{http.StatusOK, `["OLD","NEW-1","NEW-1","NEW-2"," "]`},
+		stubResponse{http.StatusOK, `["OLD","NEW-1"]`},
+	)
+	product := newSuppliedProduct(t, db, stub, 0, 5)
+	if _, err := store.ImportCodes(db, product.ID, []string{"OLD"}, store.CodeImportOptions{}); err != nil {
+		t.Fatalf("import existing code: %v", err)
+	}
+
+	run, err := newTestService(db).Restock(context.Background(), product.ID, store.SupplierTriggerManual, 0)
+	if err != nil {
+		t.Fatalf("restock: %v", err)
+	}
+	if run.Requested != 5 || run.Received != 5 || run.Imported != 2 || run.Duplicates != 2 || run.Invalid != 1 {
+		t.Errorf("run = %+v, want 5 received, 2 imported, 2 duplicates, 1 invalid", run)
+	}
+	if got := stockOf(t, db, product.ID); got != 3 {
+		t.Errorf("stock = %d, want 3", got)
+	}
+
+	// A pull of nothing but known codes fails
+	if _, err := newTestService(db).Restock(context.Background(), product.ID, store.SupplierTriggerManual, 0); err == nil {
+		t.Fatal("restock of duplicates only succeeded")
+	}
+}
+
+func TestRestockRetriesTemporaryErrors(t *testing.T) {
+	db := newTestDB(t)
+	stub := newStubSupplier(t,
+		stubResponse{http.StatusServiceUnavailable, "busy"},
+		stubResponse{http.StatusTooManyRequests, "slow down"},
+		stubResponse{http.StatusOK, `["R-1"]`},
+	)
+	product := newSuppliedProduct(t, db, stub, 0, 1)
+
+	run, err := newTestService(db).Restock(context.Background(), product.ID, store.SupplierTriggerManual, 0)
+	if err != nil {
+		t.Fatalf("restock: %v", err)
+	}
+	if run.Attempts != 3 || run.Imported != 1 {
+		t.Errorf("run = %+v, want success on the third attempt", run)
+	}
+}
+
+func TestRestockDoesNotRetryClientErrors(t *testing.T) {
+	db := newTestDB(t)
+	stub := newStubSupplier(t, stubResponse{http.StatusForbidden, "no"})
+	product := newSuppliedProduct(t, db, stub, 0, 1)
+
+	run, err := newTestService(db).Restock(context.Background(), product.ID, store.SupplierTriggerManual, 0)
+	if err == nil {
+		t.Fatal("restock succeeded")
+	}
+	if run.Attempts != 1 || stub.requests.Load() != 1 {
+		t.Errorf("attempts = %d, requests = %d, want a single try", run.Attempts, stub.requests.Load())
+	}
+}
+
+func TestRestockReportsFailureOnce(t *testing.T) {
+	db := newTestDB(t)
+	stub := newStubSupplier(t, stubResponse{http.StatusInternalServerError, "down"})
+	product := newSuppliedProduct(t, db, stub, 0, 1)
+
+	failures := make(chan Failure, 4)
+	s := newTestService(db)
+	s.SetFailureHook(func(f Failure) { failures <- f })
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Restock(context.Background(), product.ID, store.SupplierTriggerManual, 0); err == nil {
+			t.Fatal("restock succeeded")
+		}
+	}
+	if stub.requests.Load() != 6 {
+		t.Errorf("requests = %d, want 3 attempts per run", stub.requests.Load())
+	}
+
+	select {
+	case f := <-failures:
+		if f.ProductID != product.ID || f.Attempts != 3 || f.Failures != 1 || f.Error == "" {
+			t.Errorf("failure = %+v, want the first failed run after 3 attempts", f)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("failure was not reported")
+	}
+	select {
+	case f := <-failures:
+		t.Fatalf("second failure %+v reported again", f)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	config, err := store.GetProductSupplier(db, product.ID)
+	if err != nil {
+		t.Fatalf("load supplier: %v", err)
+	}
+	if config.FailureCount != 2 || config.LastError == "" {
+		t.Errorf("supplier = %+v, want 2 consecutive failures", config)
+	}
+}
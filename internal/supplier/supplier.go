@@ -0,0 +1,106 @@
+// Package supplier pulls codes from upstream suppliers into product stock.
+// Connectors talk to a supplier's API, the Service decides when to pull and
+// imports the result through the same duplicate checks as admin uploads.
+package supplier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownType   = errors.New("unknown supplier type")
+	ErrInvalidConfig = errors.New("invalid supplier config")
+)
+
+// Item is one code returned by a supplier. Plain codes use Code, codes of
+// products with code fields use Fields.
+type Item struct {
+	Code   string
+	Fields map[string]string
+}
+
+// Request describes the codes to fetch
+type Request struct {
+	ProductID uint
+	Quantity  int
+}
+
+// Connector fetches codes from one supplier API
+type Connector interface {
+	Fetch(ctx context.Context, req Request) ([]Item, error)
+}
+
+// Factory builds a connector from its JSON config
+type Factory func(config string) (Connector, error)
+
+var factories = map[string]Factory{
+	TypeHTTPJSON: newHTTPJSONConnector,
+}
+
+// New builds the connector of the given type
+func New(typ, config string) (Connector, error) {
+	factory, ok := factories[typ]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, typ)
+	}
+	return factory(config)
+}
+
+// Types returns the supported connector types
+func Types() []string {
+	types := make([]string, 0, len(factories))
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// temporaryError marks failures worth retrying, such as timeouts and 5xx responses
+type temporaryError struct {
+	err error
+}
+
+func (e *temporaryError) Error() string { return e.err.Error() }
+func (e *temporaryError) Unwrap() error { return e.err }
+
+func temporary(err error) error {
+	return &temporaryError{err: err}
+}
+
+// IsTemporary reports whether a fetch error may succeed when retried
+func IsTemporary(err error) bool {
+	var t *temporaryError
+	return errors.As(err, &t)
+}
+
+// EnvPrefix starts the names of the environment variables supplier configs
+// may reference
+const EnvPrefix = "SUPPLIER_"
+
+// envRef matches ${NAME} references to environment variables in configs
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// maskedValue replaces secrets when a config is shown to admins
+const maskedValue = "******"
+
+// allowedEnv reports whether supplier configs may reference an environment
+// variable
+func allowedEnv(name string) bool {
+	return strings.HasPrefix(name, EnvPrefix) && len(name) > len(EnvPrefix)
+}
+
+// maskSecret hides a header value. References to the environment, such as
+// "Bearer ${SUPPLIER_TOKEN}", are hidden too so the page does not tell
+// which variables hold credentials.
+func maskSecret(value string) string {
+	if value == "" {
+		return value
+	}
+	return maskedValue
+}
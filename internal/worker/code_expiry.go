@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/store"
+)
+
+// CodeExpiryWorker quarantines expired codes once a day and reports them
+type CodeExpiryWorker struct {
+	db       *gorm.DB
+	interval time.Duration
+	report   func([]store.ExpiredCodeReport)
+}
+
+// NewCodeExpiryWorker creates a new code expiry worker. report receives the
+// codes quarantined in a run and may be nil.
+func NewCodeExpiryWorker(db *gorm.DB, report func([]store.ExpiredCodeReport)) *CodeExpiryWorker {
+	return &CodeExpiryWorker{
+		db:       db,
+		interval: 24 * time.Hour,
+		report:   report,
+	}
+}
+
+// Start starts the code expiry worker
+func (w *CodeExpiryWorker) Start(ctx context.Context) {
+	logger.Info("Starting code expiry worker", "interval", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	// Run immediately on start
+	w.runExpiry()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Code expiry worker stopped")
+			return
+		case <-ticker.C:
+			w.runExpiry()
+		}
+	}
+}
+
+// runExpiry quarantines expired codes and reports them to the admins
+func (w *CodeExpiryWorker) runExpiry() {
+	logger.Info("Running code expiry check")
+	reports, err := store.QuarantineExpiredCodes(w.db)
+	if err != nil {
+		logger.Error("Failed to quarantine expired codes", "error", err)
+		return
+	}
+	if len(reports) > 0 && w.report != nil {
+		w.report(reports)
+	}
+}
@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	logger "shop-bot/internal/log"
+	"shop-bot/internal/supplier"
+)
+
+// RestockWorker pulls codes from suppliers when product stock runs low
+type RestockWorker struct {
+	suppliers *supplier.Service
+	interval  time.Duration
+}
+
+// NewRestockWorker creates a new restock worker
+func NewRestockWorker(suppliers *supplier.Service) *RestockWorker {
+	return &RestockWorker{
+		suppliers: suppliers,
+		interval:  10 * time.Minute,
+	}
+}
+
+// Start starts the restock worker
+func (w *RestockWorker) Start(ctx context.Context) {
+	logger.Info("Starting restock worker", "interval", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	// Run immediately on start
+	w.suppliers.CheckAll(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Restock worker stopped")
+			return
+		case <-ticker.C:
+			w.suppliers.CheckAll(ctx)
+		}
+	}
+}
@@ -93,8 +93,14 @@ func (w *RetryWorker) retryDelivery(order *store.Order) {
 		return
 	}
 	
+	plain, err := store.RenderCode(w.db, &code)
+	if err != nil {
+		logger.Error("Failed to decrypt code for order", "order_id", order.ID, "error", err)
+		return
+	}
+	
 	// Try to send the code again
-	if err := w.sendCodeToUser(order, code.Code); err != nil {
+	if err := w.sendCodeToUser(order, plain); err != nil {
 		// Update retry count and timestamp
 		now := time.Now()
 		updates := map[string]interface{}{
@@ -123,7 +129,7 @@ func (w *RetryWorker) handleNoStockRetry(order *store.Order) {
 	}
 	
 	// For no-stock orders, we might want to check if stock is now available
-	stock, err := store.CountAvailableCodes(w.db, *order.ProductID)
+	stock, err := store.CountCodesForOrder(w.db, *order.ProductID, order.ID)
 	if err != nil {
 		logger.Error("Failed to check stock", "order_id", order.ID, "error", err)
 		return